@@ -4,8 +4,11 @@
 
 class FaassConfiguration {
   static apiInternalPath = '/api/configuration'; 
+  static pollingDelay = 10000; 
   headers = new Headers();
   distantConf = null; 
+  etag = null; 
+  outdated = false; 
   inProgress = false; 
   constructor( password ) {}
   refresh() { 
@@ -13,7 +16,11 @@ class FaassConfiguration {
     return this.#getWebRequest()
       .then( 
         c => {
-          this.distantConf = c; 
+          // null : not modified since the last refresh 
+          if ( c != null ) {
+            [ this.etag, this.distantConf ] = c; 
+          }
+          this.outdated = false; 
           this.inProgress = false; 
           return Promise.resolve(); 
         }
@@ -32,6 +39,25 @@ class FaassConfiguration {
       )
     ;
   }
+  // cheap (If-None-Match) : the displayed conf is kept, only marked as outdated 
+  poll() {
+    if ( this.distantConf == null || this.inProgress || this.outdated ) {
+      return Promise.resolve( this.outdated ); 
+    }
+    return this.#getWebRequest()
+      .then( 
+        c => {
+          this.outdated = ( c != null ); 
+          return this.outdated; 
+        }
+      )
+      .catch( 
+        e => {
+          console.error( `err poll : ${e}` ); 
+          return false; 
+        }
+      );
+  }
   submitForm( action, requestLoad ) {
     switch ( action ) {
       case 'update':
@@ -42,7 +68,9 @@ class FaassConfiguration {
           .catch( 
             e => {
               this.inProgress = false; 
-              if ( typeof e == "number" ) {
+              if ( e === 412 ) {
+                return Promise.reject( `the distant conf has changed meanwhile ; refresh it before updating` ); 
+              } else if ( typeof e == "number" ) {
                 console.error( `err refresh, status code : ${e}` ); 
                 return Promise.reject( `invalid status code (${e})` ); 
               } else { 
@@ -64,6 +92,10 @@ class FaassConfiguration {
       'Content-type', 
       'application/json'
     ); 
+    this.headers.delete( 'If-None-Match' ); 
+    if ( this.etag != null ) {
+      this.headers.set( 'If-Match', this.etag ); 
+    }
     const request = new Request( 
     window.location.origin+FaassConfiguration.apiInternalPath, 
       {
@@ -90,6 +122,10 @@ class FaassConfiguration {
         .getElementById( 'auth_form_conf' )
         .value 
     ); 
+    this.headers.delete( 'If-Match' ); 
+    if ( this.etag != null ) {
+      this.headers.set( 'If-None-Match', this.etag ); 
+    }
     const request = new Request( 
     window.location.origin+FaassConfiguration.apiInternalPath, 
       {
@@ -100,8 +136,13 @@ class FaassConfiguration {
     return fetch( request )
       .then( 
         r => {
-          if (r.status === 200) {
-            return r.json(); 
+          if (r.status === 304) {
+            return null; 
+          } else if (r.status === 200) {
+            return r.json()
+              .then( 
+                c => [ r.headers.get( 'ETag' ), c ] 
+              ); 
           } else {
             return Promise.reject( r.status );
           }
@@ -360,6 +401,30 @@ function submitForm( evt ) {
 
 // -----------------------------------------------
 
+function pollConf() {
+  if ( document.querySelector( 'form-object[target="conf"]' ) == null ) {
+    return; 
+  }
+  window.FaassConfiguration.poll()
+    .then( 
+      outdated => {
+        if ( outdated && document.getElementById( 'outdated' ) == null ) {
+          document.getElementById('content').insertAdjacentHTML( 
+            'afterbegin', 
+            `
+              <div id="outdated">
+                <error-detail detail="the distant conf has changed since this form was loaded"></error-detail>
+                <conf-get last="refresh"></conf-get>
+              </div>
+            `
+          ); 
+        }
+      }
+    );
+}
+
+// -----------------------------------------------
+
 function goTo( part, ...rest ) {
   switch ( part ) {
     case 'error': 
@@ -413,6 +478,7 @@ window.addEventListener(
       evt => goTo( 'error', 'not implemented' )
     ); 
     goTo( 'before-refresh' ); 
+    setInterval( pollConf, FaassConfiguration.pollingDelay ); 
   }
 );
 
@@ -67,6 +67,54 @@ func main() {
     &Logger,
   )
   
+  go utils.CollectArtifacts( 
+    ctx, 
+    &GLOBAL_CONF_MUTEXT,
+    &GLOBAL_CONF, 
+    &GLOBAL_WAIT_GROUP, 
+    &Logger,
+  )
+  
+  go utils.RunJobs( 
+    ctx, 
+    &GLOBAL_CONF_MUTEXT,
+    &GLOBAL_CONF, 
+    &GLOBAL_WAIT_GROUP, 
+    &Logger,
+  )
+  
+  go utils.RunSchedules( 
+    ctx, 
+    &GLOBAL_CONF_MUTEXT,
+    &GLOBAL_CONF, 
+    &GLOBAL_WAIT_GROUP, 
+    &Logger,
+  )
+  
+  go utils.RunTriggers( 
+    ctx, 
+    &GLOBAL_CONF_MUTEXT,
+    &GLOBAL_CONF, 
+    &GLOBAL_WAIT_GROUP, 
+    &Logger,
+  )
+  
+  go utils.WatchBuilds( 
+    ctx, 
+    &GLOBAL_CONF_MUTEXT,
+    &GLOBAL_CONF, 
+    &GLOBAL_WAIT_GROUP, 
+    &Logger,
+  )
+  
+  go utils.WatchRoutesDir( 
+    ctx, 
+    &GLOBAL_CONF_MUTEXT,
+    &GLOBAL_CONF, 
+    &GLOBAL_WAIT_GROUP, 
+    &Logger,
+  )
+  
   signalChan := make( chan os.Signal, 1 )
   signal.Notify(
     signalChan,
@@ -79,33 +127,65 @@ func main() {
     restartChan,
     syscall.SIGHUP,
   )
+  switcher := &server.Switcher{}
   continueServer := true
   for continueServer == true {
     Logger.Info("server start")
-    httpServer := &http.Server{
-      Addr:     GLOBAL_CONF.IncomingAdress+":"+strconv.Itoa( GLOBAL_CONF.IncomingPort ),
-      Handler:  server.CreateServeMux(
+    GLOBAL_CONF_MUTEXT.RLock()
+    listenKey := server.ListenKey( &GLOBAL_CONF )
+    listenAdress := GLOBAL_CONF.IncomingAdress+":"+strconv.Itoa( GLOBAL_CONF.IncomingPort )
+    GLOBAL_CONF_MUTEXT.RUnlock()
+    switcher.Set( 
+      server.CreateServeMux(
         &GLOBAL_CONF,
         &GLOBAL_CONF_MUTEXT, 
         &Logger,
         GLOBAL_REGEX_ROUTE_NAME, 
       ),
+    )
+    httpServer := &http.Server{
+      Addr:     listenAdress,
+      Handler:  switcher,
     }
     go server.Run( &GLOBAL_CONF, &Logger, httpServer )
-    select {
-      case <-signalChan: 
-        if err := httpServer.Shutdown( ctx ); err != nil {
-          Logger.Panic( "shutdown error: %v\n", err )
-          defer os.Exit( configuration.ExitConfShuttingServerFailed )
-        }
-        Logger.Info("interrupt received ; shutting down")
-        continueServer = false
-      case <-restartChan: 
-        if err := httpServer.Shutdown( ctx ); err != nil {
-          Logger.Panic( "restart failed ; shutdown error: %v\n", err )
-          defer os.Exit( configuration.ExitConfShuttingServerFailed )
-        }
-        Logger.Info("restart received")
+    restartServer := false 
+    for continueServer == true && restartServer == false {
+      select {
+        case <-signalChan: 
+          if err := httpServer.Shutdown( ctx ); err != nil {
+            Logger.Panicf( "shutdown error: %v\n", err )
+            defer os.Exit( configuration.ExitConfShuttingServerFailed )
+          }
+          Logger.Info("interrupt received ; shutting down")
+          continueServer = false
+        case <-restartChan: 
+          Logger.Info("reload received")
+          if err := utils.ReloadConf( GLOBAL_CONF_PATH, &GLOBAL_CONF_MUTEXT, &GLOBAL_CONF, &Logger ) ; err != nil {
+            Logger.Errorf( "reload failed ; current conf kept : %v", err )
+            continue
+          }
+          GLOBAL_CONF_MUTEXT.RLock()
+          newListenKey := server.ListenKey( &GLOBAL_CONF )
+          GLOBAL_CONF_MUTEXT.RUnlock()
+          if newListenKey == listenKey {
+            switcher.Set( 
+              server.CreateServeMux(
+                &GLOBAL_CONF,
+                &GLOBAL_CONF_MUTEXT, 
+                &Logger,
+                GLOBAL_REGEX_ROUTE_NAME, 
+              ),
+            )
+            Logger.Info("reload done ; listener kept")
+            continue
+          }
+          if err := httpServer.Shutdown( ctx ); err != nil {
+            Logger.Panicf( "restart failed ; shutdown error: %v\n", err )
+            defer os.Exit( configuration.ExitConfShuttingServerFailed )
+          }
+          Logger.Info("reload done ; listener changed, restart")
+          restartServer = true
+      }
     }
   }
 
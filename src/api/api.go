@@ -1,21 +1,274 @@
 package api
 
 import (
+  "context"
+  "crypto/sha256"
+  "encoding/hex"
+  "errors"
+  "encoding/json"
   "net/http"
+  "strings"
+  "sync"
   // -----------
+  "itinerary"
   "configuration"
+  "configuration/auth"
+  "configuration/utils"
+  "formats/patch"
+  "httpresponse"
+  "logger"
+  "network"
 )
 
-func VerifyAuthorization( c *configuration.Conf, r *http.Request ) bool {
-  if c.AuthorizationAPI == "" { 
-    if r.Header.Get( "Authorization" ) != "" {
-      return false 
+func Authenticate( c *configuration.Conf, r *http.Request ) *auth.Principal {
+  return auth.Authenticate( 
+    r.Header.Get( "Authorization" ), 
+    c.AuthorizationAPI, 
+    c.APIKeys, 
+  )
+}
+
+func IsActive( c *configuration.Conf ) bool {
+  return c.AuthorizationAPI != "" || len( c.APIKeys ) > 0
+}
+
+// the key of the route after the handler's prefix (as registered in the muxer)
+func RouteKey( r *http.Request, prefix string ) string {
+  return strings.TrimPrefix( r.URL.Path, prefix )
+}
+
+// the records of a request carry its id
+func Logger( l *logger.Logger, r *http.Request ) *logger.Logger {
+  return l.With( logger.FieldRequest, network.RequestId( r.Context() ) )
+}
+
+type principalKey struct{}
+
+func WithPrincipal( r *http.Request, principal *auth.Principal ) *http.Request {
+  return r.WithContext( context.WithValue( r.Context(), principalKey{}, principal ) )
+}
+
+func Principal( r *http.Request ) *auth.Principal {
+  principal, _ := r.Context().Value( principalKey{} ).( *auth.Principal )
+  return principal
+}
+
+func PrincipalName( r *http.Request ) string {
+  if principal, ok := r.Context().Value( principalKey{} ).( *auth.Principal ) ; ok && principal != nil {
+    return principal.Name
+  }
+  return ""
+}
+
+// to call with the conf's mutex held, after a successful mutation : records the 
+// revision in history then persists it 
+func Commit( c *configuration.Conf, l *logger.Logger, httpResponse *httpresponse.Response, r *http.Request, summary string ) {
+  if err := c.Commit( PrincipalName( r ), summary ) ; err != nil {
+    l.Errorf( "API change applied but not persisted : %v", err )
+    httpResponse.Code = http.StatusInternalServerError
+    httpResponse.MessageError = "change applied but not persisted"
+    httpResponse.Payload = nil
+  }
+}
+
+// -----------------------------------------------
+
+// strong ETags, from the exported content (references, not secrets) : the 
+// runtime state doesn't change them
+func ETag( content []byte ) string {
+  sum := sha256.Sum256( content )
+  return `"`+hex.EncodeToString( sum[:16] )+`"`
+}
+
+// to call with the conf's mutex held ; "" for a missing route
+func RouteETag( route *itinerary.Route ) string {
+  if route == nil {
+    return ""
+  }
+  exported, err := route.Export( true )
+  if err != nil {
+    return ""
+  }
+  content, err := json.Marshal( &exported )
+  if err != nil {
+    return ""
+  }
+  return ETag( content )
+}
+
+// the revision in effect ; to call with the conf's mutex held
+func ConfETag( c *configuration.Conf ) string {
+  content, err := c.Marshal( true )
+  if err != nil {
+    return ""
+  }
+  return ETag( content )
+}
+
+func matchETag( header string, etag string, weak bool ) bool {
+  for _, candidate := range strings.Split( header, "," ) {
+    candidate = strings.TrimSpace( candidate )
+    if weak {
+      candidate = strings.TrimPrefix( candidate, "W/" )
+    }
+    if candidate == etag || ( candidate == "*" && etag != "" ) {
+      return true
     }
+  }
+  return false
+}
+
+// If-None-Match of a GET : the client's copy is current, a 304 is set
+func NotModified( r *http.Request, httpResponse *httpresponse.Response, etag string ) bool {
+  header := r.Header.Get( "If-None-Match" )
+  if header == "" || etag == "" || matchETag( header, etag, true ) != true {
+    return false
+  }
+  httpResponse.Code = http.StatusNotModified
+  httpResponse.MessageError = ""
+  httpResponse.ETag = etag
+  return true
+}
+
+// If-Match and If-None-Match of a change ("" for a missing resource) : false 
+// when the precondition fails, a 412 is set
+func Precondition( r *http.Request, httpResponse *httpresponse.Response, etag string ) bool {
+  ifMatch := r.Header.Get( "If-Match" )
+  ifNoneMatch := r.Header.Get( "If-None-Match" )
+  if ( ifMatch == "" || matchETag( ifMatch, etag, false ) ) && ( ifNoneMatch == "" || matchETag( ifNoneMatch, etag, true ) != true ) {
     return true
-  } else { 
-    if r.Header.Get( "Authorization" ) == c.AuthorizationAPI {
-      return true 
+  }
+  httpResponse.Code = http.StatusPreconditionFailed
+  httpResponse.MessageError = "the resource has changed (precondition failed)"
+  httpResponse.ETag = etag
+  return false
+}
+
+// -----------------------------------------------
+
+// the errors of utils.PatchConf ; the problems are given by field (JSON pointer) 
+// in the problem+json's errors
+func PatchFailed( l *logger.Logger, httpResponse *httpresponse.Response, err error ) {
+  defer l.Warningf( "API change refused : %v", err )
+  var problems configuration.Problems
+  var patchErr *patch.Error
+  var typeErr *json.UnmarshalTypeError
+  switch {
+  case errors.As( err, &problems ):
+    httpResponse.Code = http.StatusUnprocessableEntity
+    httpResponse.MessageError = "the patched conf is invalid"
+    httpResponse.Details = problems
+  case errors.As( err, &patchErr ):
+    httpResponse.Code = http.StatusBadRequest
+    httpResponse.MessageError = "the patch can't be applied"
+    if patchErr.Failed {
+      httpResponse.Code = http.StatusConflict
+      httpResponse.MessageError = "the patch's test failed"
+    }
+    httpResponse.Details = configuration.Problems{ { Path: patchErr.Path, Message: patchErr.Error() } }
+  case errors.As( err, &typeErr ):
+    httpResponse.Code = http.StatusUnprocessableEntity
+    httpResponse.MessageError = "the patched conf is invalid"
+    httpResponse.Details = configuration.Problems{ { 
+      Path: "/"+strings.ReplaceAll( typeErr.Field, ".", "/" ), 
+      Message: "value of type "+typeErr.Value+" where "+typeErr.Type.String()+" is expected", 
+    } }
+  default:
+    httpResponse.Code = http.StatusUnprocessableEntity
+    httpResponse.MessageError = "the patched conf is invalid"
+    httpResponse.Details = configuration.Problems{ { Path: "", Message: err.Error() } }
+  }
+}
+
+// the response is already given by the edit of a change
+var ErrRefused = errors.New( "change refused" )
+
+// the scope to write a route's document : a shell runs on the host, as the 
+// paths of the host a route can name (script, build's source, triggers' dirs, 
+// read and moved) : only for admins 
+func RouteScope( document map[string]interface{} ) string {
+  if triggers, _ := document["triggers"].( []interface{} ) ; len( triggers ) > 0 {
+    return auth.ScopeAdminConfig
+  }
+  if build, _ := document["build"].( map[string]interface{} ) ; build != nil {
+    if source, _ := build["source"].( string ) ; source != "" {
+      return auth.ScopeAdminConfig
+    }
+  }
+  if script, _ := document["script"].( string ) ; script != "" {
+    return auth.ScopeAdminConfig
+  }
+  switch document["type"] {
+  case "function":
+    return auth.ScopeDeployFunctions
+  case "service":
+    return auth.ScopeManageServices
+  }
+  return auth.ScopeAdminConfig
+}
+
+// false (the response given) when the principal can't write this document
+func AllowRoute( l *logger.Logger, httpResponse *httpresponse.Response, r *http.Request, key string, document map[string]interface{} ) bool {
+  scope := RouteScope( document )
+  principal := Principal( r )
+  if principal == nil || principal.Allow( scope, key ) != true {
+    defer l.Infof( "API request refused for principal '%v' (scope '%v')", PrincipalName( r ), scope )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return false
+  }
+  return true
+}
+
+// a change of a route as a patch of the conf (utils.PatchConf) : checked, its 
+// jobs, schedules, triggers and subscriptions synced, recorded and persisted 
+// like the others. The edit is called with the conf's mutex held, with the 
+// route in effect and its document (nil when absent) ; it gives the new 
+// document (nil removes the route) or ErrRefused ; both documents need their 
+// scope (RouteScope). False when the response is given (refused, invalid, or 
+// applied but not persisted)
+func ChangeRoute( c *configuration.Conf, m *sync.RWMutex, l *logger.Logger, httpResponse *httpresponse.Response, r *http.Request, key string, summary string, edit func( route *itinerary.Route, current map[string]interface{} ) ( map[string]interface{}, error ) ) bool {
+  apply := func( document interface{} ) ( interface{}, error ) {
+    root, ok := document.( map[string]interface{} )
+    if ok != true {
+      return nil, errors.New( "conf is not an object" )
+    }
+    routes, _ := root["routes"].( map[string]interface{} )
+    if routes == nil {
+      routes = map[string]interface{}{}
+      root["routes"] = routes
     }
-    return false 
+    current, _ := routes[key].( map[string]interface{} )
+    if current != nil && AllowRoute( l, httpResponse, r, key, current ) != true {
+      return nil, ErrRefused
+    }
+    updated, err := edit( c.Routes[key], current )
+    if err != nil {
+      return nil, err
+    }
+    if updated != nil && AllowRoute( l, httpResponse, r, key, updated ) != true {
+      return nil, ErrRefused
+    }
+    if updated == nil {
+      delete( routes, key )
+    } else {
+      routes[key] = updated
+    }
+    return document, nil
+  }
+  changes, err := utils.PatchConf( apply, PrincipalName( r ), summary, m, c, l )
+  switch {
+  case err == ErrRefused:
+    return false
+  case err != nil && changes != nil:
+    l.Errorf( "API change applied but not persisted : %v", err )
+    httpResponse.Code = http.StatusInternalServerError
+    httpResponse.MessageError = "change applied but not persisted"
+    httpResponse.Payload = nil
+    return false
+  case err != nil:
+    PatchFailed( l, httpResponse, err )
+    return false
   }
-}
\ No newline at end of file
+  return true
+}
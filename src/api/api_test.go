@@ -0,0 +1,46 @@
+package api
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  // -----------
+  "httpresponse"
+)
+
+func TestPreconditions( t *testing.T ) {
+  etag := ETag( []byte( "content" ) )
+  for _, c := range []struct {
+    header string
+    value string
+    etag string
+    ok bool
+  } {
+    { "", "", etag, true },
+    { "If-Match", etag, etag, true },
+    { "If-Match", `"other", `+etag, etag, true },
+    { "If-Match", `"other"`, etag, false },
+    { "If-Match", "*", etag, true },
+    { "If-Match", "*", "", false },
+    { "If-None-Match", "*", etag, false },
+    { "If-None-Match", "*", "", true },
+  } {
+    r := httptest.NewRequest( http.MethodPut, "/api/routes/a", nil )
+    if c.header != "" {
+      r.Header.Set( c.header, c.value )
+    }
+    httpResponse := httpresponse.Response{}
+    if Precondition( r, &httpResponse, c.etag ) != c.ok {
+      t.Errorf( "%v: %v (etag '%v') : %v expected", c.header, c.value, c.etag, c.ok )
+    }
+    if c.ok != true && httpResponse.Code != http.StatusPreconditionFailed {
+      t.Errorf( "%v: %v : code %v", c.header, c.value, httpResponse.Code )
+    }
+  }
+  r := httptest.NewRequest( http.MethodGet, "/api/configuration", nil )
+  r.Header.Set( "If-None-Match", "W/"+etag )
+  httpResponse := httpresponse.Response{}
+  if NotModified( r, &httpResponse, etag ) != true || httpResponse.Code != http.StatusNotModified {
+    t.Errorf( "weak If-None-Match must match : %v", httpResponse.Code )
+  }
+}
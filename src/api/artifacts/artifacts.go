@@ -0,0 +1,189 @@
+package artifacts
+
+import (
+  "errors"
+  "net/http"
+  "os"
+  "strings"
+  "sync"
+  // -----------
+  "api"
+  "artifacts"
+  "configuration"
+  "configuration/auth"
+  "httpresponse"
+  "logger"
+)
+
+// the store of the functions' code : list, upload (a file ; the bundles are
+// deployed by /api/routes/<key>/deploy), download and removal of the artifacts
+// without reference. An artifact isn't bound to a route : the principals
+// restricted to some routes can only upload
+
+const Path = "/api/artifacts"
+
+type HandlerApi struct {
+  Logger *logger.Logger
+  ConfMutext *sync.RWMutex
+  Conf *configuration.Conf
+}
+
+type Referenced struct {
+  Digest string `json:"digest"`
+  References []string `json:"references"`
+}
+
+func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Request ) {
+  handlerApi.Logger = api.Logger( handlerApi.Logger, r )
+  httpResponse := httpresponse.Response {
+    Code: http.StatusInternalServerError,
+    MessageError: "an unexpected error has occurred",
+  }
+  defer httpResponse.Respond( handlerApi.Logger, w )
+  handlerApi.ConfMutext.RLock()
+  principal := api.Authenticate( handlerApi.Conf, r )
+  handlerApi.ConfMutext.RUnlock()
+  if principal == nil {
+    httpResponse.Code = http.StatusUnauthorized
+    httpResponse.MessageError = "you must be authentified"
+    return
+  }
+  digest := strings.TrimPrefix( strings.TrimPrefix( r.URL.Path, Path ), "/" )
+  scope := auth.ScopeRead
+  allowed := false
+  switch r.Method {
+  case http.MethodGet:
+    allowed = principal.Allow( scope, "" )
+  case http.MethodPost:
+    scope = auth.ScopeDeployFunctions
+    allowed = principal.HasScope( scope ) && digest == ""
+  case http.MethodDelete:
+    scope = auth.ScopeDeployFunctions
+    allowed = principal.Allow( scope, "" ) && digest != ""
+  default:
+    httpResponse.Code = http.StatusMethodNotAllowed
+    httpResponse.MessageError = "HTTP verb incorrect"
+    return
+  }
+  if allowed != true {
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, scope )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  }
+  if digest != "" && artifacts.ValidDigest( digest ) != true {
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow artifact"
+    return
+  }
+  r = api.WithPrincipal( r, principal )
+  switch {
+  case r.Method == http.MethodPost:
+    handlerApi.Post( &httpResponse, w, r )
+  case r.Method == http.MethodDelete:
+    handlerApi.Delete( &httpResponse, r, digest )
+  case digest == "":
+    handlerApi.List( &httpResponse )
+  default:
+    handlerApi.Get( &httpResponse, w, r, digest )
+  }
+}
+
+func ( handlerApi *HandlerApi ) List ( httpResponse *httpresponse.Response ) {
+  handlerApi.ConfMutext.RLock()
+  defer handlerApi.ConfMutext.RUnlock()
+  list, err := handlerApi.Conf.Artifacts.List( handlerApi.Conf.ArtifactReferences() )
+  if err != nil {
+    defer handlerApi.Logger.Errorf( "List artifacts failed : %v", err )
+    httpResponse.MessageError = "impossible to list the artifacts"
+    return
+  }
+  defer handlerApi.Logger.Infof( "List artifacts asked (%v)", len( list ) )
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = list
+}
+
+func ( handlerApi *HandlerApi ) Post ( httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request ) {
+  handlerApi.ConfMutext.RLock()
+  store := handlerApi.Conf.Artifacts
+  handlerApi.ConfMutext.RUnlock()
+  artifact, err := store.Put( http.MaxBytesReader( w, r.Body, artifacts.FileSizeMax ) )
+  var tooLarge *http.MaxBytesError
+  if errors.As( err, &tooLarge ) {
+    defer handlerApi.Logger.Infof( "Post artifact refused : too large" )
+    httpResponse.Code = http.StatusRequestEntityTooLarge
+    httpResponse.MessageError = "the artifact is too large"
+    return
+  }
+  if err != nil {
+    defer handlerApi.Logger.Errorf( "Post artifact failed : %v", err )
+    httpResponse.MessageError = "impossible to store the artifact"
+    return
+  }
+  defer handlerApi.Logger.Infof( "Post artifact executed : %v (%v bytes)", artifact.Digest, artifact.Size )
+  httpResponse.Code = http.StatusCreated
+  httpResponse.MessageError = ""
+  httpResponse.Payload = artifact
+}
+
+// a file as is, a tree as tar ; the digest is the ETag (the content never
+// changes)
+func ( handlerApi *HandlerApi ) Get ( httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request, digest string ) {
+  handlerApi.ConfMutext.RLock()
+  store := handlerApi.Conf.Artifacts
+  handlerApi.ConfMutext.RUnlock()
+  etag := `"`+digest+`"`
+  if _, err := store.Stat( digest ) ; err != nil {
+    defer handlerApi.Logger.Infof( "Get artifact '%v' failed : non-existent", digest )
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow artifact"
+    return
+  }
+  if api.NotModified( r, httpResponse, etag ) {
+    defer handlerApi.Logger.Infof( "Get artifact '%v' asked (not modified)", digest )
+    return
+  }
+  content, kind, err := store.Open( digest )
+  if err != nil {
+    defer handlerApi.Logger.Errorf( "Get artifact '%v' failed : %v", digest, err )
+    httpResponse.MessageError = "impossible to read the artifact"
+    return
+  }
+  defer handlerApi.Logger.Infof( "Get artifact '%v' asked (%v)", digest, kind )
+  contentType := "application/octet-stream"
+  if kind == artifacts.KindTree {
+    contentType = "application/x-tar"
+  }
+  w.Header().Set( "Content-type", contentType )
+  httpResponse.Code = http.StatusOK
+  httpResponse.ETag = etag
+  httpResponse.IOFile = content
+}
+
+// under the conf's lock : the references can't change meanwhile
+func ( handlerApi *HandlerApi ) Delete ( httpResponse *httpresponse.Response, r *http.Request, digest string ) {
+  handlerApi.ConfMutext.Lock()
+  defer handlerApi.ConfMutext.Unlock()
+  store := handlerApi.Conf.Artifacts
+  if _, err := store.Stat( digest ) ; err != nil {
+    defer handlerApi.Logger.Infof( "Delete artifact '%v' failed : non-existent", digest )
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow artifact"
+    return
+  }
+  if references := handlerApi.Conf.ArtifactReferences()[digest] ; len( references ) > 0 {
+    defer handlerApi.Logger.Infof( "Delete artifact '%v' failed : referenced (%v)", digest, references )
+    httpResponse.Code = http.StatusConflict
+    httpResponse.MessageError = "this artifact is referenced"
+    httpResponse.Details = Referenced { Digest: digest, References: references }
+    return
+  }
+  if err := store.Remove( digest ) ; err != nil && os.IsNotExist( err ) != true {
+    defer handlerApi.Logger.Errorf( "Delete artifact '%v' failed : %v", digest, err )
+    httpResponse.MessageError = "impossible to remove the artifact"
+    return
+  }
+  defer handlerApi.Logger.Warningf( "Delete artifact '%v' executed by '%v'", digest, api.PrincipalName( r ) )
+  httpResponse.Code = http.StatusNoContent
+  httpResponse.MessageError = "artifact deleted"
+}
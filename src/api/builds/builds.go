@@ -0,0 +1,145 @@
+package builds
+
+import (
+  "bytes"
+  "io/ioutil"
+  "net/http"
+  "strings"
+  "sync"
+  // -----------
+  "api"
+  "builder"
+  "configuration"
+  "configuration/auth"
+  "httpresponse"
+  "logger"
+)
+
+// the builds of the functions' images (the last one by route) : state, new
+// build without cache and logs, followed until the build ends
+// (?follow=false for the current content)
+
+const (
+  Path                                  = "/api/builds"
+  LogsResource                          = "logs"
+)
+
+type HandlerApi struct {
+  Logger *logger.Logger
+  ConfMutext *sync.RWMutex
+  Conf *configuration.Conf
+}
+
+func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Request ) {
+  handlerApi.Logger = api.Logger( handlerApi.Logger, r )
+  httpResponse := httpresponse.Response {
+    Code: http.StatusInternalServerError,
+    MessageError: "an unexpected error has occurred",
+  }
+  defer httpResponse.Respond( handlerApi.Logger, w )
+  handlerApi.ConfMutext.RLock()
+  principal := api.Authenticate( handlerApi.Conf, r )
+  current := handlerApi.Conf.Builder
+  handlerApi.ConfMutext.RUnlock()
+  if principal == nil {
+    httpResponse.Code = http.StatusUnauthorized
+    httpResponse.MessageError = "you must be authentified"
+    return
+  }
+  key, resource, _ := strings.Cut( strings.TrimPrefix( strings.TrimPrefix( r.URL.Path, Path ), "/" ), "/" )
+  scope := auth.ScopeRead
+  if r.Method == http.MethodPost {
+    scope = auth.ScopeDeployFunctions
+  }
+  // the list is filtered by route
+  allowed := principal.HasScope( scope )
+  if key != "" {
+    allowed = principal.Allow( scope, key )
+  }
+  if allowed != true {
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, scope )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  }
+  if current == nil {
+    httpResponse.Code = http.StatusServiceUnavailable
+    httpResponse.MessageError = "builder unavailable"
+    return
+  }
+  r = api.WithPrincipal( r, principal )
+  switch {
+  case resource != "" && resource != LogsResource, resource == LogsResource && key == "":
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow resource"
+  case r.Method == http.MethodGet && key == "":
+    handlerApi.List( &httpResponse, current, principal )
+  case r.Method == http.MethodGet && resource == LogsResource:
+    handlerApi.Logs( &httpResponse, w, r, current, key )
+  case r.Method == http.MethodGet:
+    handlerApi.Get( &httpResponse, current, key )
+  case r.Method == http.MethodPost && key != "" && resource == "":
+    handlerApi.Post( &httpResponse, r, current, key )
+  default:
+    httpResponse.Code = http.StatusMethodNotAllowed
+    httpResponse.MessageError = "HTTP verb incorrect"
+  }
+}
+
+// only the routes the principal can read
+func ( handlerApi *HandlerApi ) List ( httpResponse *httpresponse.Response, current *builder.Builder, principal *auth.Principal ) {
+  jobs := []builder.Job{}
+  for _, job := range current.Jobs() {
+    if principal.Allow( auth.ScopeRead, job.Key ) {
+      jobs = append( jobs, job )
+    }
+  }
+  defer handlerApi.Logger.Infof( "List builds asked (%v)", len( jobs ) )
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = jobs
+}
+
+func ( handlerApi *HandlerApi ) Get ( httpResponse *httpresponse.Response, current *builder.Builder, key string ) {
+  job, ok := current.Job( key )
+  if ok != true {
+    defer handlerApi.Logger.Infof( "Get build '%v' failed : non-existent", key )
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow build"
+    return
+  }
+  defer handlerApi.Logger.Infof( "Get build '%v' asked (%v)", key, job.Status )
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = job
+}
+
+func ( handlerApi *HandlerApi ) Post ( httpResponse *httpresponse.Response, r *http.Request, current *builder.Builder, key string ) {
+  job, err := current.Rebuild( key )
+  if err != nil {
+    defer handlerApi.Logger.Infof( "Post build '%v' failed : %v", key, err )
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "this route has no build"
+    return
+  }
+  defer handlerApi.Logger.Warningf( "Post build '%v' executed by '%v' (job %v)", key, api.PrincipalName( r ), job.Id )
+  httpResponse.Code = http.StatusAccepted
+  httpResponse.MessageError = ""
+  httpResponse.Payload = job
+}
+
+func ( handlerApi *HandlerApi ) Logs ( httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request, current *builder.Builder, key string ) {
+  log := current.Log( key )
+  if log == nil {
+    defer handlerApi.Logger.Infof( "Get build logs '%v' failed : non-existent", key )
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow build"
+    return
+  }
+  defer handlerApi.Logger.Infof( "Get build logs '%v' asked", key )
+  w.Header().Set( "Content-type", "text/plain; charset=utf-8" )
+  httpResponse.Code = http.StatusOK
+  if r.URL.Query().Get( "follow" ) == "false" {
+    httpResponse.IOFile = ioutil.NopCloser( bytes.NewReader( log.Bytes() ) )
+  } else {
+    httpResponse.IOFile = log.Follow( r.Context() )
+  }
+}
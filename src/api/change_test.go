@@ -0,0 +1,79 @@
+package api
+
+import (
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "sync"
+  "testing"
+  // -----------
+  "configuration"
+  "configuration/auth"
+  "configuration/utils"
+  "httpresponse"
+  "itinerary"
+  "logger"
+)
+
+// the legacy endpoints (functions, services) change the routes through the 
+// conf's validator : its problems are given back
+func TestChangeRouteProblems( t *testing.T ) {
+  dir := t.TempDir()
+  confPath := filepath.Join( dir, "conf.json" )
+  content := `{ "adress": "127.0.0.1", "listen": 9090, "delay": 45, "prefix": "lambda", "tmp": "`+dir+`",
+    "pathcmdcontainer": "/bin/true", "authorizations": { "default": "Basic x" }, "authapi": "default", "routes": {} }`
+  if err := ioutil.WriteFile( confPath, []byte( content ), 0600 ) ; err != nil {
+    t.Fatal( err )
+  }
+  l := &logger.Logger{}
+  l.Init()
+  c := &configuration.Conf{}
+  if _, err := utils.LoadConf( confPath, c, l ) ; err != nil {
+    t.Fatal( err )
+  }
+  m := sync.RWMutex{}
+  r := httptest.NewRequest( http.MethodPost, "/api/services/a", nil )
+  r = WithPrincipal( r, &auth.Principal { Name: "admin", Scopes: []string{ auth.ScopeAdminConfig } } )
+  httpResponse := httpresponse.Response{}
+  applied := ChangeRoute( c, &m, l, &httpResponse, r, "a", "post service 'a'", func( route *itinerary.Route, current map[string]interface{} ) ( map[string]interface{}, error ) {
+    return map[string]interface{}{ "type": "service", "port": 0 }, nil
+  } )
+  if applied || httpResponse.Code != http.StatusUnprocessableEntity {
+    t.Fatalf( "invalid route applied (code %v)", httpResponse.Code )
+  }
+  problems, _ := httpResponse.Details.( configuration.Problems )
+  if len( problems ) == 0 {
+    t.Error( "problems expected" )
+  }
+  if _, ok := c.Routes["a"] ; ok {
+    t.Error( "invalid route kept" )
+  }
+}
+
+// a key to deploy functions can't name the host's paths (triggers, source, script)
+func TestRouteScope( t *testing.T ) {
+  for _, c := range []struct {
+    document map[string]interface{}
+    scope string
+  } {
+    { map[string]interface{}{ "type": "function" }, auth.ScopeDeployFunctions },
+    { map[string]interface{}{ "type": "service" }, auth.ScopeManageServices },
+    { map[string]interface{}{ "type": "shell" }, auth.ScopeAdminConfig },
+    { map[string]interface{}{ "type": "function", "triggers": []interface{}{ map[string]interface{}{ "dir": "/etc" } } }, auth.ScopeAdminConfig },
+    { map[string]interface{}{ "type": "function", "build": map[string]interface{}{ "source": "/etc" } }, auth.ScopeAdminConfig },
+    { map[string]interface{}{ "type": "function", "script": "/etc/shadow" }, auth.ScopeAdminConfig },
+  } {
+    if scope := RouteScope( c.document ) ; scope != c.scope {
+      t.Errorf( "%v : scope '%v', '%v' expected", c.document, scope, c.scope )
+    }
+  }
+  l := &logger.Logger{}
+  l.Init()
+  r := httptest.NewRequest( http.MethodPatch, "/api/functions/a", nil )
+  r = WithPrincipal( r, &auth.Principal { Name: "ci", Scopes: []string{ auth.ScopeDeployFunctions } } )
+  httpResponse := httpresponse.Response{}
+  if AllowRoute( l, &httpResponse, r, "a", map[string]interface{}{ "type": "function", "triggers": []interface{}{ map[string]interface{}{ "dir": "/etc" } } } ) || httpResponse.Code != http.StatusForbidden {
+    t.Errorf( "triggers allowed to deploy-functions (code %v)", httpResponse.Code )
+  }
+}
@@ -1,17 +1,26 @@
 package configuration
 
 import (
+  "errors"
   "net/http"
+  "strings"
   "io/ioutil"
   "encoding/json"
   "sync"
   // -----------
   "api"
   "configuration"
+  "configuration/auth"
+  "configuration/utils"
+  "formats/patch"
   "httpresponse"
   "logger"
 )
 
+const SchemaPath = "/api/configuration/schema"
+
+var errPrecondition = errors.New( "precondition failed" )
+
 type HandlerApi struct {
   Logger *logger.Logger
   ConfMutext *sync.RWMutex
@@ -19,19 +28,51 @@ type HandlerApi struct {
 }
 
 func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Request ) {
+  handlerApi.Logger = api.Logger( handlerApi.Logger, r )
   httpResponse := httpresponse.Response {
     Code: http.StatusInternalServerError,
     MessageError: "an unexpected error has occurred",
   }
   defer httpResponse.Respond( handlerApi.Logger, w )
   handlerApi.ConfMutext.RLock()
-  auth := api.VerifyAuthorization( handlerApi.Conf, r )
+  principal := api.Authenticate( handlerApi.Conf, r )
   handlerApi.ConfMutext.RUnlock()
-  if auth != true {
+  if principal == nil {
     httpResponse.Code = http.StatusUnauthorized
     httpResponse.MessageError = "you must be authentified"
     return
   }
+  isHistory := strings.HasPrefix( r.URL.Path, HistoryPath )
+  isSchema := strings.HasPrefix( r.URL.Path, SchemaPath )
+  if isHistory != true && isSchema != true && r.URL.Path != "/api/configuration" {
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow resource"
+    return
+  }
+  scope := auth.ScopeAdminConfig
+  if r.Method == http.MethodGet && isHistory != true {
+    scope = auth.ScopeRead
+  }
+  if principal.Allow( scope, "" ) != true {
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, scope )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  }
+  r = api.WithPrincipal( r, principal )
+  if isHistory {
+    handlerApi.ServeHistory( &httpResponse, r )
+    return
+  }
+  if isSchema {
+    if r.Method != http.MethodGet {
+      httpResponse.Code = http.StatusMethodNotAllowed
+      httpResponse.MessageError = "HTTP verb incorrect"
+      return
+    }
+    handlerApi.GetSchema( &httpResponse, r )
+    return
+  }
   switch r.Method  {
     case http.MethodGet:
       handlerApi.Get( &httpResponse, r )
@@ -43,15 +84,12 @@ func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Reques
    }
 }
 
+// JSON Merge Patch or JSON Patch on the conf's document (json names, like the 
+// schema) ; "application/json" is the UI's form : fields by heads' names. 
+// If-Match is checked against the conf's ETag, with the lock held 
 func ( handlerApi *HandlerApi ) Patch( httpResponse *httpresponse.Response, r *http.Request ) {
-  handlerApi.ConfMutext.Lock()
-  defer handlerApi.ConfMutext.Unlock()
   defer handlerApi.Logger.Infof( "Patch conf asked" )
-  if contentType := r.Header.Get("Content-type"); contentType != "application/json" {
-    httpResponse.Code = http.StatusBadRequest
-    httpResponse.MessageError = "you must have 'application/json' content-type header"
-    return
-  }
+  contentType := strings.TrimSpace( strings.Split( r.Header.Get( "Content-type" ), ";" )[0] )
   body, err := ioutil.ReadAll( r.Body )
   if err != nil {
     defer handlerApi.Logger.Warningf( "Patch conf asked ; can't read body : %v", err )
@@ -59,47 +97,119 @@ func ( handlerApi *HandlerApi ) Patch( httpResponse *httpresponse.Response, r *h
     httpResponse.MessageError = "the request's body is an invalid"
     return
   }
-  var f interface{}
-  err = json.Unmarshal( body, &f )
-  if err != nil {
-    defer handlerApi.Logger.Warningf( "Patch conf asked ; can't parse body : %v", err )
-    httpResponse.Code = http.StatusBadRequest
-    httpResponse.MessageError = "the request's body is an invalid"
-    return
-  }
-  o := f.( map[string]interface{} )
-  for key, value := range o {
-    switch key {
-    case "DelayCleaningContainers":
-      switch value.(type) {
-      case float64:
-        delay := int(value.(float64))
-        if delay >= configuration.ConfDelayCleaningContainersMin && delay <= configuration.ConfDelayCleaningContainersMax {
-          defer handlerApi.Logger.Warningf( "Patch conf executed, delay changed ; new value : %v", delay )
-          handlerApi.Conf.DelayCleaningContainers = delay
-          continue
-        } else {
-          httpResponse.Code = http.StatusBadRequest
-          httpResponse.MessageError = "value of delay invalid : int between 5 and 60 (seconds)"
-          return
-        }
-      default:
-        httpResponse.Code = http.StatusBadRequest
-        httpResponse.MessageError = "type's value of delay invalid"
+  var apply func( document interface{} ) ( interface{}, error )
+  switch contentType {
+  case patch.ContentTypeMergePatch, "application/json":
+    var mergePatch interface{}
+    if err := json.Unmarshal( body, &mergePatch ) ; err != nil {
+      defer handlerApi.Logger.Warningf( "Patch conf asked ; can't parse body : %v", err )
+      httpResponse.Code = http.StatusBadRequest
+      httpResponse.MessageError = "the request's body is an invalid"
+      return
+    }
+    if contentType == "application/json" {
+      if mergePatch, err = legacyPatch( mergePatch ) ; err != nil {
+        api.PatchFailed( handlerApi.Logger, httpResponse, err )
         return
       }
-    default:
-      httpResponse.Code = http.StatusNotImplemented
-      httpResponse.MessageError = "at least one key is invalid"
+    }
+    apply = func( document interface{} ) ( interface{}, error ) {
+      return patch.Merge( document, mergePatch ), nil
+    }
+  case patch.ContentTypeJSONPatch:
+    var operations []patch.Operation
+    if err := json.Unmarshal( body, &operations ) ; err != nil {
+      defer handlerApi.Logger.Warningf( "Patch conf asked ; can't parse body : %v", err )
+      httpResponse.Code = http.StatusBadRequest
+      httpResponse.MessageError = "the request's body is an invalid"
       return
     }
+    apply = func( document interface{} ) ( interface{}, error ) {
+      return patch.Apply( document, operations )
+    }
+  default:
+    httpResponse.Code = http.StatusUnsupportedMediaType
+    httpResponse.MessageError = "you must have '"+patch.ContentTypeMergePatch+"', '"+patch.ContentTypeJSONPatch+"' or 'application/json' content-type header"
+    return
+  }
+  precondition := func( document interface{} ) ( interface{}, error ) {
+    // called with the conf's mutex held
+    if api.Precondition( r, httpResponse, api.ConfETag( handlerApi.Conf ) ) != true {
+      return nil, errPrecondition
+    }
+    return apply( document )
+  }
+  changes, err := utils.PatchConf( 
+    precondition, 
+    api.PrincipalName( r ), 
+    "patch configuration ("+contentType+")", 
+    handlerApi.ConfMutext, 
+    handlerApi.Conf, 
+    handlerApi.Logger, 
+  )
+  if err != nil && changes != nil {
+    handlerApi.Logger.Errorf( "API change applied but not persisted : %v", err )
+    httpResponse.Code = http.StatusInternalServerError
+    httpResponse.MessageError = "change applied but not persisted"
+    return
   }
+  if err == errPrecondition {
+    defer handlerApi.Logger.Infof( "Patch conf refused : precondition failed" )
+    return
+  }
+  if err != nil {
+    api.PatchFailed( handlerApi.Logger, httpResponse, err )
+    return
+  }
+  defer handlerApi.Logger.Warningf( "Patch conf executed ; %v change(s)", len( changes ) )
   httpResponse.Code = http.StatusAccepted
+  httpResponse.Payload = changes
+}
+
+func legacyPatch( form interface{} ) ( interface{}, error ) {
+  fields, ok := form.( map[string]interface{} )
+  if ok != true {
+    return nil, configuration.Problems{ { Path: "", Message: "an object is expected" } }
+  }
+  mergePatch := map[string]interface{}{}
+  problems := configuration.Problems{}
+  for key, value := range fields {
+    name, ok := configuration.FieldName( key )
+    if ok != true {
+      problems = append( problems, configuration.Problem { Path: "/"+key, Message: "unknown field" } )
+      continue
+    }
+    mergePatch[name] = value
+  }
+  if len( problems ) > 0 {
+    return nil, problems
+  }
+  return mergePatch, nil
+}
+
+func ( handlerApi *HandlerApi ) GetSchema( httpResponse *httpresponse.Response, r *http.Request ) {
+  defer handlerApi.Logger.Infof( "Conf schema asked" )
+  switch strings.Trim( strings.TrimPrefix( r.URL.Path, SchemaPath ), "/" ) {
+  case "":
+    httpResponse.Payload = configuration.Schema()
+  case "route":
+    httpResponse.Payload = configuration.RouteSchema()
+  default:
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow schema"
+    return
+  }
+  httpResponse.Code = http.StatusOK
 }
 
 func ( handlerApi *HandlerApi ) Get( httpResponse *httpresponse.Response, r *http.Request ) {
   handlerApi.ConfMutext.RLock()
   defer handlerApi.ConfMutext.RUnlock()
+  httpResponse.ETag = api.ConfETag( handlerApi.Conf )
+  if api.NotModified( r, httpResponse, httpResponse.ETag ) {
+    defer handlerApi.Logger.Infof( "Conf asked (not modified)" )
+    return
+  }
   defer handlerApi.Logger.Infof( "Conf asked" )
   httpResponse.Code = http.StatusOK
   httpResponse.Payload = handlerApi.Conf.GetHead()
@@ -0,0 +1,136 @@
+package configuration
+
+import (
+  "net/http"
+  "strconv"
+  "strings"
+  // -----------
+  "api"
+  "configuration/history"
+  "configuration/utils"
+  "httpresponse"
+)
+
+const HistoryPath = "/api/configuration/history"
+
+func ( handlerApi *HandlerApi ) ServeHistory( httpResponse *httpresponse.Response, r *http.Request ) {
+  parts := strings.Split( strings.Trim( strings.TrimPrefix( r.URL.Path, HistoryPath ), "/" ), "/" )
+  switch {
+  case r.Method == http.MethodGet && parts[0] == "":
+    handlerApi.HistoryList( httpResponse )
+  case r.Method == http.MethodGet && parts[0] == "diff" && len( parts ) == 1:
+    handlerApi.HistoryDiff( httpResponse, r )
+  case r.Method == http.MethodGet && len( parts ) == 1:
+    handlerApi.HistoryGet( httpResponse, parts[0] )
+  case r.Method == http.MethodPost && len( parts ) == 2 && parts[1] == "rollback":
+    handlerApi.HistoryRollback( httpResponse, r, parts[0] )
+  case len( parts ) == 2 && parts[1] == "rollback", len( parts ) == 1:
+    httpResponse.Code = http.StatusMethodNotAllowed
+    httpResponse.MessageError = "HTTP verb incorrect"
+  default:
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow resource"
+  }
+}
+
+func ( handlerApi *HandlerApi ) getRevision( httpResponse *httpresponse.Response, value string ) ( history.Revision, bool ) {
+  id, err := strconv.Atoi( value )
+  if err != nil {
+    httpResponse.Code = http.StatusBadRequest
+    httpResponse.MessageError = "revision's id invalid"
+    return history.Revision{}, false
+  }
+  handlerApi.ConfMutext.RLock()
+  h := handlerApi.Conf.History
+  handlerApi.ConfMutext.RUnlock()
+  if h == nil {
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow revision"
+    return history.Revision{}, false
+  }
+  revision, ok := h.Get( id )
+  if !ok {
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow revision"
+    return history.Revision{}, false
+  }
+  return revision, true
+}
+
+func ( handlerApi *HandlerApi ) HistoryList( httpResponse *httpresponse.Response ) {
+  handlerApi.ConfMutext.RLock()
+  defer handlerApi.ConfMutext.RUnlock()
+  defer handlerApi.Logger.Infof( "Conf history asked" )
+  httpResponse.Code = http.StatusOK
+  if handlerApi.Conf.History == nil {
+    httpResponse.Payload = []history.Revision{}
+    return
+  }
+  httpResponse.Payload = handlerApi.Conf.History.List()
+}
+
+func ( handlerApi *HandlerApi ) HistoryGet( httpResponse *httpresponse.Response, value string ) {
+  revision, ok := handlerApi.getRevision( httpResponse, value )
+  if !ok {
+    return
+  }
+  defer handlerApi.Logger.Infof( "Conf revision '%v' asked", revision.Id )
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = revision
+}
+
+// without "to", the diff is done with the last revision 
+func ( handlerApi *HandlerApi ) HistoryDiff( httpResponse *httpresponse.Response, r *http.Request ) {
+  query := r.URL.Query()
+  from, ok := handlerApi.getRevision( httpResponse, query.Get( "from" ) )
+  if !ok {
+    return
+  }
+  var to history.Revision
+  if query.Get( "to" ) == "" {
+    handlerApi.ConfMutext.RLock()
+    to, _ = handlerApi.Conf.History.Last()
+    handlerApi.ConfMutext.RUnlock()
+  } else if to, ok = handlerApi.getRevision( httpResponse, query.Get( "to" ) ) ; !ok {
+    return
+  }
+  changes, err := history.Diff( from.Content, to.Content )
+  if err != nil {
+    defer handlerApi.Logger.Warningf( "Conf diff %v..%v failed : %v", from.Id, to.Id, err )
+    return
+  }
+  defer handlerApi.Logger.Infof( "Conf diff %v..%v asked", from.Id, to.Id )
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = map[string]interface{} {
+    "from": from.Id,
+    "to": to.Id,
+    "changes": changes,
+  }
+}
+
+func ( handlerApi *HandlerApi ) HistoryRollback( httpResponse *httpresponse.Response, r *http.Request, value string ) {
+  revision, ok := handlerApi.getRevision( httpResponse, value )
+  if !ok {
+    return
+  }
+  err := utils.RollbackConf( 
+    revision, 
+    api.PrincipalName( r ), 
+    handlerApi.ConfMutext, 
+    handlerApi.Conf, 
+    handlerApi.Logger, 
+  )
+  if err != nil {
+    defer handlerApi.Logger.Warningf( "Conf rollback to revision %v failed : %v", revision.Id, err )
+    httpResponse.Code = http.StatusConflict
+    httpResponse.MessageError = "rollback failed ; current conf kept"
+    return
+  }
+  defer handlerApi.Logger.Warningf( "Conf rollback to revision %v executed by '%v'", revision.Id, api.PrincipalName( r ) )
+  handlerApi.ConfMutext.RLock()
+  defer handlerApi.ConfMutext.RUnlock()
+  last, _ := handlerApi.Conf.History.Last()
+  last.Content = nil
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = last
+}
@@ -0,0 +1,122 @@
+package events
+
+import (
+  "io/ioutil"
+  "net/http"
+  "strings"
+  "sync"
+  // -----------
+  "api"
+  "configuration"
+  "configuration/auth"
+  "events"
+  "httpresponse"
+  "jobs"
+  "logger"
+)
+
+// the bus : the subscriptions of the routes (filtered by route), and the
+// publication of an event (its body) on a topic, a job by subscription
+
+const Path = "/api/events"
+
+type HandlerApi struct {
+  Logger *logger.Logger
+  ConfMutext *sync.RWMutex
+  Conf *configuration.Conf
+}
+
+// the jobs of an event published
+type Published struct {
+  Event events.Event `json:"event"`
+  Jobs []string `json:"jobs"`
+}
+
+func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Request ) {
+  handlerApi.Logger = api.Logger( handlerApi.Logger, r )
+  httpResponse := httpresponse.Response {
+    Code: http.StatusInternalServerError,
+    MessageError: "an unexpected error has occurred",
+  }
+  defer httpResponse.Respond( handlerApi.Logger, w )
+  handlerApi.ConfMutext.RLock()
+  principal := api.Authenticate( handlerApi.Conf, r )
+  bus := handlerApi.Conf.Events
+  handlerApi.ConfMutext.RUnlock()
+  if principal == nil {
+    httpResponse.Code = http.StatusUnauthorized
+    httpResponse.MessageError = "you must be authentified"
+    return
+  }
+  if bus == nil {
+    httpResponse.Code = http.StatusServiceUnavailable
+    httpResponse.MessageError = "bus unavailable"
+    return
+  }
+  topic := strings.TrimPrefix( strings.TrimPrefix( r.URL.Path, Path ), "/" )
+  switch {
+  case topic == "" && r.Method == http.MethodGet:
+    handlerApi.List( &httpResponse, bus, principal )
+  case topic == "":
+    httpResponse.Code = http.StatusMethodNotAllowed
+    httpResponse.MessageError = "HTTP verb incorrect"
+  case r.Method == http.MethodPost:
+    handlerApi.Publish( &httpResponse, w, r, bus, principal, topic )
+  default:
+    httpResponse.Code = http.StatusMethodNotAllowed
+    httpResponse.MessageError = "HTTP verb incorrect"
+  }
+}
+
+// only the routes the principal can read
+func ( handlerApi *HandlerApi ) List ( httpResponse *httpresponse.Response, bus *events.Bus, principal *auth.Principal ) {
+  states := []events.State{}
+  for _, state := range bus.States() {
+    if principal.Allow( auth.ScopeRead, state.Route ) {
+      states = append( states, state )
+    }
+  }
+  defer handlerApi.Logger.Infof( "List subscriptions asked (%v)", len( states ) )
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = states
+}
+
+// the subscribers are served as deployed functions : the same scope
+func ( handlerApi *HandlerApi ) Publish ( httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request, bus *events.Bus, principal *auth.Principal, topic string ) {
+  if principal.HasScope( auth.ScopeDeployFunctions ) != true {
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, auth.ScopeDeployFunctions )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  }
+  if events.ValidTopic( topic ) != true {
+    httpResponse.Code = http.StatusBadRequest
+    httpResponse.MessageError = "topic invalid (segments separated by '.')"
+    return
+  }
+  body, err := ioutil.ReadAll( http.MaxBytesReader( w, r.Body, jobs.BodySizeMax ) )
+  if err != nil {
+    httpResponse.Code = http.StatusRequestEntityTooLarge
+    httpResponse.MessageError = "the event is too large"
+    return
+  }
+  event, submitted, err := bus.Publish( events.Event {
+    Topic: topic,
+    Source: "api:"+principal.Name,
+    ContentType: r.Header.Get( "Content-Type" ),
+    Data: body,
+  } )
+  if err != nil {
+    defer handlerApi.Logger.Infof( "Publish on '%v' failed : %v", topic, err )
+    httpResponse.Code = http.StatusBadRequest
+    httpResponse.MessageError = err.Error()
+    return
+  }
+  published := Published { Event: event, Jobs: []string{} }
+  for _, job := range submitted {
+    published.Jobs = append( published.Jobs, job.Id )
+  }
+  defer handlerApi.Logger.Infof( "Publish on '%v' by '%v' (%v job(s))", topic, principal.Name, len( published.Jobs ) )
+  httpResponse.Code = http.StatusAccepted
+  httpResponse.Payload = published
+}
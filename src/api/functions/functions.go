@@ -1,22 +1,24 @@
 package functions
 
 import (
+  "errors"
   "net/http"
   "sync"
-  "io"
   "io/ioutil"
   "encoding/json"
-  "path/filepath"
-  "os"
   // "fmt"
   // -----------
   "api"
+  "artifacts"
   "itinerary"
   "configuration"
+  "configuration/auth"
   "httpresponse"
   "logger"
 )
 
+const Path = "/api/functions/"
+
 type HandlerApi struct {
   Logger *logger.Logger
   ConfMutext *sync.RWMutex
@@ -24,24 +26,36 @@ type HandlerApi struct {
 }
 
 func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Request ) {
+  handlerApi.Logger = api.Logger( handlerApi.Logger, r )
   httpResponse := httpresponse.Response {
     Code: http.StatusInternalServerError,
     MessageError: "an unexpected error has occurred",
   }
   defer httpResponse.Respond( handlerApi.Logger, w )
   handlerApi.ConfMutext.RLock()
-  auth := api.VerifyAuthorization( handlerApi.Conf, r )
+  principal := api.Authenticate( handlerApi.Conf, r )
   handlerApi.ConfMutext.RUnlock()
-  if auth != true {
+  if principal == nil {
     httpResponse.Code = http.StatusUnauthorized
     httpResponse.MessageError = "you must be authentified"
     return
   }
+  scope := auth.ScopeDeployFunctions
+  if r.Method == http.MethodGet {
+    scope = auth.ScopeRead
+  }
+  if principal.Allow( scope, api.RouteKey( r, Path ) ) != true {
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, scope )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  }
+  r = api.WithPrincipal( r, principal )
   switch r.Method  {
     case http.MethodGet:
       handlerApi.Get( &httpResponse, r )
     case http.MethodPost:
-      handlerApi.Post( &httpResponse, r )
+      handlerApi.Post( &httpResponse, w, r )
     case http.MethodPatch:
       handlerApi.Patch( &httpResponse, r )
     case http.MethodDelete:
@@ -52,45 +66,103 @@ func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Reques
   }
 }
 
-func ( handlerApi *HandlerApi ) Post ( httpResponse *httpresponse.Response, r *http.Request ) {
+// false (the response given) when the route in effect can't be changed as a 
+// function by this API ; to call with the conf's mutex held
+func ( handlerApi *HandlerApi ) changeable ( httpResponse *httpresponse.Response, action string, routeId string, route *itinerary.Route ) bool {
+  switch {
+  case route == nil:
+    return true
+  case route.TypeNum == itinerary.RouteTypeService:
+    defer handlerApi.Logger.Infof( "%v function '%v' failed : existent but not a function", action, routeId )
+    httpResponse.Code = http.StatusPreconditionFailed
+    httpResponse.MessageError = "this route is a service, not a function"
+    return false
+  case route.Source != "":
+    defer handlerApi.Logger.Infof( "%v function '%v' failed : defined in routes dir (%v)", action, routeId, route.Source )
+    httpResponse.Code = http.StatusConflict
+    httpResponse.MessageError = "this route is defined in routes dir"
+    return false
+  case action == "Post" && route.Build != nil && route.Build.Source != "":
+    defer handlerApi.Logger.Infof( "Post function '%v' failed : built from source (%v)", routeId, route.Build.Source )
+    httpResponse.Code = http.StatusConflict
+    httpResponse.MessageError = "this function is built from a source dir"
+    return false
+  }
+  return true
+}
+
+// the route after a change, with its ETag
+func ( handlerApi *HandlerApi ) changed ( httpResponse *httpresponse.Response, routeId string ) *itinerary.Route {
   handlerApi.ConfMutext.RLock()
   defer handlerApi.ConfMutext.RUnlock()
-  routeId := r.URL.Path[15:] // /api/functions/
   route, _ := handlerApi.Conf.GetRoute( routeId )
-  if route != nil && route.TypeNum == itinerary.RouteTypeService {
-    defer handlerApi.Logger.Infof( "Post function '%v' failed : existent but not a function", routeId )
-    httpResponse.Code = http.StatusPreconditionFailed
-    httpResponse.MessageError = "this route is a service, not a function"
-    return
+  httpResponse.ETag = api.RouteETag( route )
+  if route == nil {
+    return nil
   }
-  functionPath := filepath.Join(
-    handlerApi.Conf.TmpDir,
-    routeId,
-  )
-  functionFile, err := os.Create( functionPath )
-  defer functionFile.Close()
+  // exported : the references of authorizations, not their secrets
+  exported, _ := route.Export( true )
+  return &exported
+}
+
+// the code is stored as a file artifact (never overwritten : the containers
+// in flight keep their own) ; an existing function is switched to it
+func ( handlerApi *HandlerApi ) Post ( httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request ) {
+  routeId := api.RouteKey( r, Path )
+  handlerApi.ConfMutext.RLock()
+  route, _ := handlerApi.Conf.GetRoute( routeId )
+  allowed := handlerApi.changeable( httpResponse, "Post", routeId, route ) && api.Precondition( r, httpResponse, api.RouteETag( route ) )
+  store := handlerApi.Conf.Artifacts
+  handlerApi.ConfMutext.RUnlock()
+  if allowed != true {
+    defer handlerApi.Logger.Infof( "Post function '%v' refused", routeId )
+    return 
+  }
+  // stored without the lock ; an artifact not used is collected later
+  artifact, err := store.Put( http.MaxBytesReader( w, r.Body, artifacts.FileSizeMax ) )
   if err != nil {
-    defer handlerApi.Logger.Infof( "Post function '%v' failed : impossible to create file function (%v)", routeId, err )
+    defer handlerApi.Logger.Infof( "Post function '%v' failed : impossible to store artifact (%v)", routeId, err )
     httpResponse.Code = http.StatusInternalServerError
     httpResponse.MessageError = "impossible to create file function"
+    var tooLarge *http.MaxBytesError
+    if errors.As( err, &tooLarge ) {
+      httpResponse.Code = http.StatusRequestEntityTooLarge
+      httpResponse.MessageError = "the function is too large"
+    }
+    return
+  }
+  if route == nil {
+    defer handlerApi.Logger.Infof( "Post function '%v' executed : artifact %v stored", routeId, artifact.Digest )
+    httpResponse.Code = http.StatusCreated
+    httpResponse.MessageError = ""
+    httpResponse.Payload = artifact
+    return
+  }
+  // the route can have changed since : checked again
+  applied := api.ChangeRoute( handlerApi.Conf, handlerApi.ConfMutext, handlerApi.Logger, httpResponse, r, routeId, "post function '"+routeId+"' (artifact "+artifact.Digest+")", func( route *itinerary.Route, current map[string]interface{} ) ( map[string]interface{}, error ) {
+    if handlerApi.changeable( httpResponse, "Post", routeId, route ) != true || api.Precondition( r, httpResponse, api.RouteETag( route ) ) != true {
+      return nil, api.ErrRefused
+    }
+    if current == nil {
+      return nil, nil
+    }
+    current["artifact"] = artifact.Digest
+    current["script"] = ""
+    return current, nil
+  } )
+  if applied != true {
     return
   }
-  io.Copy( functionFile, r.Body )
+  defer handlerApi.Logger.Warningf( "Post function '%v' executed : artifact %v used", routeId, artifact.Digest )
   httpResponse.Code = http.StatusCreated
   httpResponse.MessageError = ""
+  httpResponse.Payload = artifact
+  handlerApi.changed( httpResponse, routeId )
 }
 
+// the whole route, created if needed
 func ( handlerApi *HandlerApi ) Patch ( httpResponse *httpresponse.Response, r *http.Request ) {
-  handlerApi.ConfMutext.Lock()
-  defer handlerApi.ConfMutext.Unlock()
-  routeId := r.URL.Path[15:] // /api/functions/
-  route, _ := handlerApi.Conf.GetRoute( routeId )
-  if route != nil && route.TypeNum == itinerary.RouteTypeService {
-    defer handlerApi.Logger.Infof( "Patch function '%v' failed : existent but not a function", routeId )
-    httpResponse.Code = http.StatusPreconditionFailed
-    httpResponse.MessageError = "this route is a service, not a function"
-    return
-  }
+  routeId := api.RouteKey( r, Path )
   body, err := ioutil.ReadAll( r.Body )
   if err != nil {
     defer handlerApi.Logger.Warningf( "Patch function '%v' ; can't read body : %v", routeId, err )
@@ -98,64 +170,60 @@ func ( handlerApi *HandlerApi ) Patch ( httpResponse *httpresponse.Response, r *
     httpResponse.MessageError = "the request's body is an invalid"
     return
   }
-  var newRoute = itinerary.Route {}
-  err = json.Unmarshal( body, &newRoute )
-  if err != nil {
+  var newRoute map[string]interface{}
+  if err := json.Unmarshal( body, &newRoute ) ; err != nil || newRoute == nil {
     defer handlerApi.Logger.Warningf( "Patch function '%v' ; can't parse body : %v", routeId, err )
     httpResponse.Code = http.StatusBadRequest
     httpResponse.MessageError = "the request's body is an invalid"
     return
   }
-  if err := newRoute.Check(); err != nil {
-    defer handlerApi.Logger.Warningf( "Post function '%v' ; error in request conf : %v", routeId, err )
-    httpResponse.Code = http.StatusBadRequest 
-    httpResponse.MessageError = "the request's body is an invalid"
-    return 
-  }
-  if newRoute.TypeName != "function" {
-    defer handlerApi.Logger.Warningf( "Post function '%v' ; this route is an existing non-function", routeId )
+  if newRoute["type"] != "function" {
+    defer handlerApi.Logger.Warningf( "Patch function '%v' ; this route is a non-function", routeId )
     httpResponse.Code = http.StatusBadRequest 
     httpResponse.MessageError = "this route is an existing non-function"
     return 
   }
-  if route != nil {
-    route.Mutex.Lock()
-    defer route.Mutex.Unlock()
-  } 
-  handlerApi.Conf.Routes[routeId] = &newRoute
-  defer handlerApi.Logger.Warningf( "Post function '%v' executed", routeId )
+  applied := api.ChangeRoute( handlerApi.Conf, handlerApi.ConfMutext, handlerApi.Logger, httpResponse, r, routeId, "patch function '"+routeId+"'", func( route *itinerary.Route, current map[string]interface{} ) ( map[string]interface{}, error ) {
+    if handlerApi.changeable( httpResponse, "Patch", routeId, route ) != true || api.Precondition( r, httpResponse, api.RouteETag( route ) ) != true {
+      return nil, api.ErrRefused
+    }
+    return newRoute, nil
+  } )
+  if applied != true {
+    return
+  }
+  defer handlerApi.Logger.Warningf( "Patch function '%v' executed", routeId )
   httpResponse.Code = http.StatusOK
-  httpResponse.Payload = route
+  httpResponse.MessageError = ""
+  httpResponse.Payload = handlerApi.changed( httpResponse, routeId )
 }
 
 func ( handlerApi *HandlerApi ) Delete ( httpResponse *httpresponse.Response, r *http.Request ) {
-  handlerApi.ConfMutext.Lock()
-  defer handlerApi.ConfMutext.Unlock()
-  routeId := r.URL.Path[15:] // /api/functions/
-  route, _ := handlerApi.Conf.GetRoute( routeId )
-  if route == nil {
-    defer handlerApi.Logger.Infof( "Delete function '%v' failed : non-existent", routeId )
-    httpResponse.Code = http.StatusNotFound
-    httpResponse.MessageError = "unknow route"
-  } else if route.TypeNum == itinerary.RouteTypeService {
-    defer handlerApi.Logger.Infof( "Delete function '%v' failed : existent but not a function", routeId )
-    httpResponse.Code = http.StatusPreconditionFailed
-    httpResponse.MessageError = "this route is a service, no a function"
-  } else {
-    defer handlerApi.Logger.Infof( "Delete function '%v' asked : existent", routeId )
-    route.Mutex.Lock()
-    defer route.Mutex.Unlock()
-    delete( handlerApi.Conf.Routes, routeId )
-    httpResponse.Code = http.StatusNoContent
-    httpResponse.MessageError = "route deleted"
+  routeId := api.RouteKey( r, Path )
+  applied := api.ChangeRoute( handlerApi.Conf, handlerApi.ConfMutext, handlerApi.Logger, httpResponse, r, routeId, "delete function '"+routeId+"'", func( route *itinerary.Route, current map[string]interface{} ) ( map[string]interface{}, error ) {
+    if route == nil {
+      defer handlerApi.Logger.Infof( "Delete function '%v' failed : non-existent", routeId )
+      httpResponse.Code = http.StatusNotFound
+      httpResponse.MessageError = "unknow route"
+      return nil, api.ErrRefused
+    }
+    if handlerApi.changeable( httpResponse, "Delete", routeId, route ) != true || api.Precondition( r, httpResponse, api.RouteETag( route ) ) != true {
+      return nil, api.ErrRefused
+    }
+    return nil, nil
+  } )
+  if applied != true {
+    return
   }
-
+  defer handlerApi.Logger.Infof( "Delete function '%v' executed", routeId )
+  httpResponse.Code = http.StatusNoContent
+  httpResponse.MessageError = "route deleted"
 }
 
 func ( handlerApi *HandlerApi ) Get ( httpResponse *httpresponse.Response, r *http.Request ) {
     handlerApi.ConfMutext.RLock()
     defer handlerApi.ConfMutext.RUnlock()
-    routeId := r.URL.Path[15:] // /api/functions/
+    routeId := api.RouteKey( r, Path )
     route, _ := handlerApi.Conf.GetRoute( routeId )
     if route == nil {
       defer handlerApi.Logger.Infof( "Get function '%v' failed : non-existent", routeId )
@@ -165,10 +233,13 @@ func ( handlerApi *HandlerApi ) Get ( httpResponse *httpresponse.Response, r *ht
       defer handlerApi.Logger.Infof( "Get function '%v' failed : non-existent but not a function", routeId )
       httpResponse.Code = http.StatusPreconditionFailed
       httpResponse.MessageError = "this route is a service, no a function"
+    } else if api.NotModified( r, httpResponse, api.RouteETag( route ) ) {
+      defer handlerApi.Logger.Infof( "Get function '%v' asked (not modified)", routeId )
     } else {
       defer handlerApi.Logger.Infof( "Get function '%v' asked (existent)", routeId )
       httpResponse.Code = http.StatusOK
-      routeToJson := *route
-      httpResponse.Payload = routeToJson
+      httpResponse.ETag = api.RouteETag( route )
+      exported, _ := route.Export( true )
+      httpResponse.Payload = &exported
     }
 }
@@ -0,0 +1,223 @@
+package jobs
+
+import (
+  "bytes"
+  "io/ioutil"
+  "net/http"
+  "strings"
+  "sync"
+  // -----------
+  "api"
+  "configuration"
+  "configuration/auth"
+  "httpresponse"
+  "jobs"
+  "logger"
+)
+
+// the async requests : the list needs a principal (filtered by route), a
+// job is reached by its id only (given to the client, as capability) ; its
+// result is the response of the request, as is ; the dead letters (jobs
+// failed at their last attempt) are listed, replayed or removed by a principal
+
+const (
+  ResultResource                        = "result"
+  DeadLetterResource                    = "deadletter"
+)
+
+type HandlerApi struct {
+  Logger *logger.Logger
+  ConfMutext *sync.RWMutex
+  Conf *configuration.Conf
+}
+
+func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Request ) {
+  handlerApi.Logger = api.Logger( handlerApi.Logger, r )
+  httpResponse := httpresponse.Response {
+    Code: http.StatusInternalServerError,
+    MessageError: "an unexpected error has occurred",
+  }
+  defer httpResponse.Respond( handlerApi.Logger, w )
+  handlerApi.ConfMutext.RLock()
+  pool := handlerApi.Conf.Jobs
+  handlerApi.ConfMutext.RUnlock()
+  id, resource, _ := strings.Cut( strings.TrimPrefix( strings.TrimPrefix( r.URL.Path, jobs.Path ), "/" ), "/" )
+  switch {
+  case id == "" && r.Method == http.MethodGet:
+    handlerApi.List( &httpResponse, r, pool, false )
+  case id == DeadLetterResource:
+    handlerApi.DeadLetter( &httpResponse, w, r, pool, resource )
+  case id == "", resource != "" && resource != ResultResource:
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow resource"
+  case r.Method == http.MethodGet && resource == ResultResource:
+    handlerApi.Result( &httpResponse, w, pool, id )
+  case r.Method == http.MethodGet:
+    handlerApi.Get( &httpResponse, pool, id )
+  case r.Method == http.MethodDelete && resource == "":
+    handlerApi.Delete( &httpResponse, pool, id )
+  default:
+    httpResponse.Code = http.StatusMethodNotAllowed
+    httpResponse.MessageError = "HTTP verb incorrect"
+  }
+}
+
+// nil if refused (the response is given)
+func ( handlerApi *HandlerApi ) principal ( httpResponse *httpresponse.Response, r *http.Request, scope string ) *auth.Principal {
+  handlerApi.ConfMutext.RLock()
+  principal := api.Authenticate( handlerApi.Conf, r )
+  handlerApi.ConfMutext.RUnlock()
+  if principal == nil {
+    httpResponse.Code = http.StatusUnauthorized
+    httpResponse.MessageError = "you must be authentified"
+    return nil
+  }
+  if principal.HasScope( scope ) != true {
+    handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, scope )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return nil
+  }
+  return principal
+}
+
+func ( handlerApi *HandlerApi ) List ( httpResponse *httpresponse.Response, r *http.Request, pool *jobs.Pool, deadLetters bool ) {
+  principal := handlerApi.principal( httpResponse, r, auth.ScopeRead )
+  if principal == nil {
+    return
+  }
+  query := r.URL.Query()
+  list := []jobs.Job{}
+  for _, job := range pool.List() {
+    if principal.Allow( auth.ScopeRead, job.Route ) != true {
+      continue
+    }
+    if deadLetters && job.DeadLetter != true {
+      continue
+    }
+    if route := query.Get( "route" ) ; route != "" && route != job.Route {
+      continue
+    }
+    if status := query.Get( "status" ) ; status != "" && status != job.Status {
+      continue
+    }
+    list = append( list, job )
+  }
+  defer handlerApi.Logger.Infof( "List jobs asked by '%v' (%v, dead letters only : %v)", principal.Name, len( list ), deadLetters )
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = list
+}
+
+func ( handlerApi *HandlerApi ) Get ( httpResponse *httpresponse.Response, pool *jobs.Pool, id string ) {
+  job, ok := pool.Get( id )
+  if ok != true {
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow job"
+    return
+  }
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = job
+}
+
+// not ended : 202 and the job
+func ( handlerApi *HandlerApi ) Result ( httpResponse *httpresponse.Response, w http.ResponseWriter, pool *jobs.Pool, id string ) {
+  result, job, ok := pool.Result( id )
+  switch {
+  case ok != true:
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow job"
+  case job.Done() != true:
+    httpResponse.Code = http.StatusAccepted
+    httpResponse.MessageError = ""
+    httpResponse.Payload = job
+  case result == nil:
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "job without result ("+job.Status+")"
+  default:
+    for header, values := range result.Header {
+      w.Header()[header] = append( []string{}, values... )
+    }
+    httpResponse.Code = result.Code
+    httpResponse.MessageError = ""
+    httpResponse.IOFile = ioutil.NopCloser( bytes.NewReader( result.Body ) )
+  }
+}
+
+// a job not ended is canceled (a running one ends soon), an ended one removed
+func ( handlerApi *HandlerApi ) Delete ( httpResponse *httpresponse.Response, pool *jobs.Pool, id string ) {
+  job, removed, ok := pool.Cancel( id )
+  switch {
+  case ok != true:
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow job"
+  case removed:
+    defer handlerApi.Logger.Infof( "Delete job '%v' executed : removed", id )
+    httpResponse.Code = http.StatusNoContent
+    httpResponse.MessageError = "job deleted"
+  case job.Done():
+    defer handlerApi.Logger.Infof( "Delete job '%v' executed : canceled", id )
+    httpResponse.Code = http.StatusOK
+    httpResponse.Payload = job
+  default:
+    defer handlerApi.Logger.Infof( "Delete job '%v' asked : cancellation of the running job", id )
+    httpResponse.Code = http.StatusAccepted
+    httpResponse.MessageError = ""
+    httpResponse.Payload = job
+  }
+}
+
+// the replay (POST) or the removal (DELETE) of a dead letter is a deployment
+// of the route : the request is served again
+func ( handlerApi *HandlerApi ) DeadLetter ( httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request, pool *jobs.Pool, id string ) {
+  switch {
+  case id == "" && r.Method == http.MethodGet:
+    handlerApi.List( httpResponse, r, pool, true )
+    return
+  case id == "", strings.Contains( id, "/" ):
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow resource"
+    return
+  case r.Method != http.MethodPost && r.Method != http.MethodDelete:
+    httpResponse.Code = http.StatusMethodNotAllowed
+    httpResponse.MessageError = "HTTP verb incorrect"
+    return
+  }
+  principal := handlerApi.principal( httpResponse, r, auth.ScopeDeployFunctions )
+  if principal == nil {
+    return
+  }
+  job, ok := pool.Get( id )
+  if ok != true || job.DeadLetter != true {
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow dead letter"
+    return
+  }
+  if principal.Allow( auth.ScopeDeployFunctions, job.Route ) != true {
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (route '%v')", principal.Name, job.Route )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  }
+  if r.Method == http.MethodDelete {
+    pool.Cancel( id )
+    defer handlerApi.Logger.Infof( "Delete dead letter '%v' executed by '%v'", id, principal.Name )
+    httpResponse.Code = http.StatusNoContent
+    httpResponse.MessageError = "dead letter deleted"
+    return
+  }
+  replay, err := pool.Replay( id )
+  switch {
+  case err == jobs.ErrUnknown, err == jobs.ErrNotDeadLetter:
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow dead letter"
+  case err != nil:
+    httpResponse.Code = http.StatusServiceUnavailable
+    httpResponse.MessageError = "replay not accepted : "+err.Error()
+  default:
+    defer handlerApi.Logger.Infof( "Replay of dead letter '%v' executed by '%v' (job '%v')", id, principal.Name, replay.Id )
+    w.Header().Set( "Location", jobs.Location( replay.Id ) )
+    httpResponse.Code = http.StatusAccepted
+    httpResponse.MessageError = ""
+    httpResponse.Payload = replay
+  }
+}
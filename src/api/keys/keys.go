@@ -0,0 +1,168 @@
+package keys
+
+import (
+  "net/http"
+  "io/ioutil"
+  "encoding/json"
+  "strings"
+  "regexp"
+  "time"
+  "sync"
+  // -----------
+  "api"
+  "configuration"
+  "configuration/auth"
+  "httpresponse"
+  "logger"
+)
+
+var keyNameRegex = regexp.MustCompile( "^[a-z0-9_-]+$" )
+
+// a key's request is only a few scopes and routes
+const KeyRequestSizeMax = 64 << 10
+
+type HandlerApi struct {
+  Logger *logger.Logger
+  ConfMutext *sync.RWMutex
+  Conf *configuration.Conf
+}
+
+type KeyRequest struct {
+  Scopes []string `json:"scopes"`
+  Routes []string `json:"routes"`
+}
+
+type KeyDescription struct {
+  Name string `json:"name"`
+  Scopes []string `json:"scopes"`
+  Routes []string `json:"routes"`
+  Created time.Time `json:"created"`
+  Token string `json:"token,omitempty"`
+}
+
+func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Request ) {
+  handlerApi.Logger = api.Logger( handlerApi.Logger, r )
+  httpResponse := httpresponse.Response {
+    Code: http.StatusInternalServerError,
+    MessageError: "an unexpected error has occurred",
+  }
+  defer httpResponse.Respond( handlerApi.Logger, w )
+  handlerApi.ConfMutext.RLock()
+  principal := api.Authenticate( handlerApi.Conf, r )
+  handlerApi.ConfMutext.RUnlock()
+  if principal == nil {
+    httpResponse.Code = http.StatusUnauthorized
+    httpResponse.MessageError = "you must be authentified"
+    return
+  }
+  if principal.Allow( auth.ScopeAdminConfig, "" ) != true {
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, auth.ScopeAdminConfig )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  }
+  r = api.WithPrincipal( r, principal )
+  keyName := strings.TrimPrefix( strings.TrimPrefix( r.URL.Path, "/api/keys" ), "/" )
+  switch r.Method  {
+    case http.MethodGet:
+      handlerApi.Get( &httpResponse, keyName )
+    case http.MethodPost:
+      handlerApi.Post( &httpResponse, keyName, w, r )
+    case http.MethodDelete:
+      handlerApi.Delete( &httpResponse, keyName, r )
+    default:
+      httpResponse.Code = http.StatusMethodNotAllowed
+      httpResponse.MessageError = "HTTP verb incorrect"
+  }
+}
+
+func ( handlerApi *HandlerApi ) Get ( httpResponse *httpresponse.Response, keyName string ) {
+  handlerApi.ConfMutext.RLock()
+  defer handlerApi.ConfMutext.RUnlock()
+  if keyName == "" {
+    list := []KeyDescription{}
+    for name, key := range handlerApi.Conf.APIKeys {
+      list = append( list, KeyDescription { Name: name, Scopes: key.Scopes, Routes: key.Routes, Created: key.Created } )
+    }
+    defer handlerApi.Logger.Infof( "List keys asked" )
+    httpResponse.Code = http.StatusOK
+    httpResponse.Payload = list
+    return
+  }
+  key, ok := handlerApi.Conf.APIKeys[keyName]
+  if !ok {
+    defer handlerApi.Logger.Infof( "Get key '%v' failed : non-existent", keyName )
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow key"
+    return
+  }
+  defer handlerApi.Logger.Infof( "Get key '%v' asked (existent)", keyName )
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = KeyDescription { Name: keyName, Scopes: key.Scopes, Routes: key.Routes, Created: key.Created }
+}
+
+func ( handlerApi *HandlerApi ) Post ( httpResponse *httpresponse.Response, keyName string, w http.ResponseWriter, r *http.Request ) {
+  if keyNameRegex.MatchString( keyName ) != true {
+    httpResponse.Code = http.StatusBadRequest
+    httpResponse.MessageError = "key's name invalid"
+    return
+  }
+  // the body is read before locking : a slow client doesn't hold the conf
+  body, err := ioutil.ReadAll( http.MaxBytesReader( w, r.Body, KeyRequestSizeMax ) )
+  if err != nil {
+    defer handlerApi.Logger.Warningf( "Post key '%v' ; can't read body : %v", keyName, err )
+    httpResponse.Code = http.StatusBadRequest
+    httpResponse.MessageError = "the request's body is an invalid"
+    return
+  }
+  var keyRequest KeyRequest
+  if err := json.Unmarshal( body, &keyRequest ) ; err != nil {
+    defer handlerApi.Logger.Warningf( "Post key '%v' ; can't parse body : %v", keyName, err )
+    httpResponse.Code = http.StatusBadRequest
+    httpResponse.MessageError = "the request's body is an invalid"
+    return
+  }
+  key, token, err := auth.NewAPIKey( keyRequest.Scopes, keyRequest.Routes )
+  if err != nil {
+    defer handlerApi.Logger.Warningf( "Post key '%v' ; invalid key : %v", keyName, err )
+    httpResponse.Code = http.StatusBadRequest
+    httpResponse.MessageError = "the request's body is an invalid"
+    return
+  }
+  handlerApi.ConfMutext.Lock()
+  defer handlerApi.ConfMutext.Unlock()
+  if _, ok := handlerApi.Conf.APIKeys[keyName] ; ok {
+    defer handlerApi.Logger.Infof( "Post key '%v' failed : existent", keyName )
+    httpResponse.Code = http.StatusConflict
+    httpResponse.MessageError = "key already exists ; revoke it before"
+    return
+  }
+  if handlerApi.Conf.APIKeys == nil {
+    handlerApi.Conf.APIKeys = make( map[string]*auth.APIKey )
+  }
+  handlerApi.Conf.APIKeys[keyName] = key
+  httpResponse.Code = http.StatusCreated
+  httpResponse.Payload = KeyDescription { Name: keyName, Scopes: key.Scopes, Routes: key.Routes, Created: key.Created, Token: token }
+  api.Commit( handlerApi.Conf, handlerApi.Logger, httpResponse, r, "create api key '"+keyName+"'" )
+  if httpResponse.Code != http.StatusCreated {
+    // the token is never given : a key kept would be unusable
+    delete( handlerApi.Conf.APIKeys, keyName )
+    return
+  }
+  defer handlerApi.Logger.Warningf( "Post key '%v' executed by '%v'", keyName, api.PrincipalName( r ) )
+}
+
+func ( handlerApi *HandlerApi ) Delete ( httpResponse *httpresponse.Response, keyName string, r *http.Request ) {
+  handlerApi.ConfMutext.Lock()
+  defer handlerApi.ConfMutext.Unlock()
+  if _, ok := handlerApi.Conf.APIKeys[keyName] ; !ok {
+    defer handlerApi.Logger.Infof( "Delete key '%v' failed : non-existent", keyName )
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow key"
+    return
+  }
+  delete( handlerApi.Conf.APIKeys, keyName )
+  defer handlerApi.Logger.Warningf( "Delete key '%v' executed by '%v'", keyName, api.PrincipalName( r ) )
+  httpResponse.Code = http.StatusNoContent
+  api.Commit( handlerApi.Conf, handlerApi.Logger, httpResponse, r, "revoke api key '"+keyName+"'" )
+}
@@ -0,0 +1,133 @@
+package routes
+
+import (
+  "errors"
+  "net/http"
+  "encoding/json"
+  "fmt"
+  // -----------
+  "configuration"
+  "configuration/auth"
+  "deploy"
+  "httpresponse"
+)
+
+const DeployResource = "deploy"
+
+type Deployment struct {
+  Digest string `json:"digest"`
+  Files int `json:"files"`
+  Size int64 `json:"size"`
+  Route interface{} `json:"route"`
+}
+
+// POST /api/routes/<key>/deploy : a bundle (multipart, tar, tar.gz or zip) of
+// the function's files with its manifest, the route's definition without
+// script nor artifact (the bundle is mounted as /function). The bundle is
+// stored as a tree artifact then the route is switched in one change ; an
+// artifact left without reference is collected later
+func ( handlerApi *HandlerApi ) Deploy( httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request, principal *auth.Principal, key string ) {
+  if principal.Allow( auth.ScopeDeployFunctions, key ) != true {
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, auth.ScopeDeployFunctions )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  }
+  if configuration.ValidRouteKey( key ) != true {
+    httpResponse.Code = http.StatusUnprocessableEntity
+    httpResponse.MessageError = "the route's key is invalid"
+    return
+  }
+  handlerApi.ConfMutext.RLock()
+  store := handlerApi.Conf.Artifacts
+  handlerApi.ConfMutext.RUnlock()
+  staging, err := deploy.NewStaging( store.Dir )
+  if err != nil {
+    defer handlerApi.Logger.Errorf( "Deploy of route '%v' failed : no staging dir (%v)", key, err )
+    httpResponse.MessageError = "impossible to store the bundle"
+    return
+  }
+  defer staging.Discard()
+  // the multipart's envelope is tolerated
+  body := http.MaxBytesReader( w, r.Body, deploy.BundleSizeMax+1<<20 )
+  if err := staging.Read( r.Header.Get( "Content-type" ), body ) ; err != nil {
+    handlerApi.deployFailed( httpResponse, key, err )
+    return
+  }
+  definition, problems := manifest( key, staging.Manifest )
+  if problems != nil {
+    handlerApi.deployFailed( httpResponse, key, problems )
+    return
+  }
+  artifact, err := store.PutTree( staging.Dir )
+  if err != nil {
+    handlerApi.deployFailed( httpResponse, key, err )
+    return
+  }
+  definition["artifact"] = artifact.Digest
+  applied := handlerApi.change( httpResponse, r, principal, key, fmt.Sprintf( "deploy route '%v' (artifact %v)", key, artifact.Digest ), func( current interface{} ) ( interface{}, error ) {
+    if fields, _ := current.( map[string]interface{} ) ; fields != nil && fields["type"] != "function" {
+      return nil, configuration.Problems{ { Path: "/routes/"+key+"/type", Message: "the existing route isn't a function" } }
+    }
+    return definition, nil
+  } )
+  if applied != true || httpResponse.Code != http.StatusOK {
+    return
+  }
+  defer handlerApi.Logger.Warningf( "Deploy of route '%v' executed : artifact %v (%v files)", key, artifact.Digest, staging.Files )
+  httpResponse.Code = http.StatusCreated
+  httpResponse.Payload = Deployment {
+    Digest: artifact.Digest,
+    Files: staging.Files,
+    Size: artifact.Size,
+    Route: httpResponse.Payload,
+  }
+}
+
+func manifest( key string, content []byte ) ( map[string]interface{}, configuration.Problems ) {
+  pointer := "/routes/"+key
+  if content == nil {
+    return nil, configuration.Problems{ { Path: "", Message: "manifest missing ('"+deploy.ManifestName+"')" } }
+  }
+  var definition map[string]interface{}
+  if err := json.Unmarshal( content, &definition ) ; err != nil || definition == nil {
+    return nil, configuration.Problems{ { Path: "", Message: "manifest invalid : an object is expected" } }
+  }
+  for _, field := range []string{ "script", "artifact" } {
+    if _, ok := definition[field] ; ok {
+      return nil, configuration.Problems{ { Path: pointer+"/"+field, Message: "set by the deploy (the bundle is mounted as /function)" } }
+    }
+  }
+  if _, ok := definition["type"] ; ok != true {
+    definition["type"] = "function"
+  }
+  if definition["type"] != "function" {
+    return nil, configuration.Problems{ { Path: pointer+"/type", Message: "only functions can be deployed" } }
+  }
+  return definition, nil
+}
+
+func ( handlerApi *HandlerApi ) deployFailed( httpResponse *httpresponse.Response, key string, err error ) {
+  defer handlerApi.Logger.Warningf( "Deploy of route '%v' refused : %v", key, err )
+  var problems configuration.Problems
+  var unsupported *deploy.UnsupportedError
+  var tooLarge *http.MaxBytesError
+  switch {
+  case errors.As( err, &problems ):
+    httpResponse.Code = http.StatusUnprocessableEntity
+    httpResponse.MessageError = "the bundle's manifest is invalid"
+    httpResponse.Details = problems
+  case errors.As( err, &unsupported ):
+    httpResponse.Code = http.StatusUnsupportedMediaType
+    httpResponse.MessageError = "you must have 'multipart/form-data', 'application/x-tar', 'application/gzip' or 'application/zip' content-type header"
+  case errors.As( err, &tooLarge ):
+    httpResponse.Code = http.StatusRequestEntityTooLarge
+    httpResponse.MessageError = "the bundle is too large"
+  case deploy.IsBundleError( err ):
+    httpResponse.Code = http.StatusBadRequest
+    httpResponse.MessageError = "the bundle is invalid : "+err.Error()
+  default:
+    httpResponse.Code = http.StatusInternalServerError
+    httpResponse.MessageError = "impossible to store the bundle"
+  }
+}
@@ -0,0 +1,454 @@
+package routes
+
+import (
+  "errors"
+  "net/http"
+  "sort"
+  "strconv"
+  "strings"
+  "io/ioutil"
+  "encoding/json"
+  "sync"
+  // -----------
+  "api"
+  "itinerary"
+  "configuration"
+  "configuration/auth"
+  "configuration/utils"
+  "formats/patch"
+  "httpresponse"
+  "logger"
+)
+
+// every type of route, by its key ; the changes are patches of the conf
+// (utils.PatchConf) : checked, recorded and persisted like the others
+
+const (
+  Path                                  = "/api/routes"
+
+  PageLimitDefault                      = 50
+  PageLimitMax                          = 500
+)
+
+type HandlerApi struct {
+  Logger *logger.Logger
+  ConfMutext *sync.RWMutex
+  Conf *configuration.Conf
+}
+
+// the route as exported (references, not secrets) with its runtime state
+type RouteView struct {
+  Key string `json:"key"`
+  Source string `json:"source,omitempty"`
+  Route *itinerary.Route `json:"route"`
+  State itinerary.RouteState `json:"state"`
+}
+
+type Page struct {
+  Total int `json:"total"`
+  Offset int `json:"offset"`
+  Limit int `json:"limit"`
+  Routes []RouteView `json:"routes"`
+}
+
+var (
+  errNotFound = errors.New( "unknow route" )
+  errForbidden = errors.New( "insufficient scope" )
+  errRoutesDir = errors.New( "this route is defined in routes dir" )
+  errPrecondition = errors.New( "precondition failed" )
+)
+
+func view( key string, route *itinerary.Route ) RouteView {
+  exported, _ := route.Export( true )
+  return RouteView {
+    Key: key,
+    Source: route.Source,
+    Route: &exported,
+    State: route.State(),
+  }
+}
+
+// -----------------------------------------------
+
+func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Request ) {
+  handlerApi.Logger = api.Logger( handlerApi.Logger, r )
+  httpResponse := httpresponse.Response {
+    Code: http.StatusInternalServerError,
+    MessageError: "an unexpected error has occurred",
+  }
+  defer httpResponse.Respond( handlerApi.Logger, w )
+  handlerApi.ConfMutext.RLock()
+  principal := api.Authenticate( handlerApi.Conf, r )
+  handlerApi.ConfMutext.RUnlock()
+  if principal == nil {
+    httpResponse.Code = http.StatusUnauthorized
+    httpResponse.MessageError = "you must be authentified"
+    return
+  }
+  r = api.WithPrincipal( r, principal )
+  key, resource, _ := strings.Cut( strings.TrimPrefix( strings.TrimPrefix( r.URL.Path, Path ), "/" ), "/" )
+  if resource == DeployResource && key != "" {
+    if r.Method != http.MethodPost {
+      httpResponse.Code = http.StatusMethodNotAllowed
+      httpResponse.MessageError = "HTTP verb incorrect"
+      return
+    }
+    handlerApi.Deploy( &httpResponse, w, r, principal, key )
+    return
+  }
+  if resource != "" {
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow resource"
+    return
+  }
+  if key == "" {
+    if r.Method != http.MethodGet {
+      httpResponse.Code = http.StatusMethodNotAllowed
+      httpResponse.MessageError = "HTTP verb incorrect"
+      return
+    }
+    handlerApi.List( &httpResponse, r, principal )
+    return
+  }
+  switch r.Method  {
+    case http.MethodGet:
+      handlerApi.Get( &httpResponse, r, principal, key )
+    case http.MethodPut:
+      handlerApi.Put( &httpResponse, r, principal, key )
+    case http.MethodPatch:
+      handlerApi.Patch( &httpResponse, r, principal, key )
+    case http.MethodDelete:
+      handlerApi.Delete( &httpResponse, r, principal, key )
+    default:
+      httpResponse.Code = http.StatusMethodNotAllowed
+      httpResponse.MessageError = "HTTP verb incorrect"
+  }
+}
+
+// -----------------------------------------------
+
+type filter struct {
+  types map[string]bool
+  labels map[string]*string
+  status string
+}
+
+func parseFilter( r *http.Request ) ( f filter, err error ) {
+  query := r.URL.Query()
+  f.types = make( map[string]bool )
+  for _, value := range query["type"] {
+    for _, typeName := range strings.Split( value, "," ) {
+      switch typeName {
+      case "function", "service", "shell", "pipeline":
+        f.types[typeName] = true
+      default:
+        return f, errors.New( "unknow type '"+typeName+"'" )
+      }
+    }
+  }
+  // "key=value" or "key" for the presence only
+  f.labels = make( map[string]*string )
+  for _, value := range query["label"] {
+    key, labelValue, hasValue := strings.Cut( value, "=" )
+    if key == "" {
+      return f, errors.New( "label without key" )
+    }
+    f.labels[key] = nil
+    if hasValue {
+      f.labels[key] = &labelValue
+    }
+  }
+  f.status = query.Get( "status" )
+  switch f.status {
+  case "", itinerary.RouteStatusRunning, itinerary.RouteStatusIdle:
+  default:
+    return f, errors.New( "unknow status '"+f.status+"'" )
+  }
+  return f, nil
+}
+
+func ( f filter ) match( route *itinerary.Route, state itinerary.RouteState ) bool {
+  if len( f.types ) > 0 && f.types[route.TypeName] != true {
+    return false
+  }
+  for key, value := range f.labels {
+    routeValue, ok := route.Labels[key]
+    if ok != true || ( value != nil && *value != routeValue ) {
+      return false
+    }
+  }
+  return f.status == "" || f.status == state.Status
+}
+
+func queryInt( r *http.Request, name string, value int, min int, max int ) ( int, error ) {
+  raw := r.URL.Query().Get( name )
+  if raw == "" {
+    return value, nil
+  }
+  value, err := strconv.Atoi( raw )
+  if err != nil || value < min || value > max {
+    return 0, errors.New( name+" invalid (integer from "+strconv.Itoa( min )+" to "+strconv.Itoa( max )+")" )
+  }
+  return value, nil
+}
+
+// sorted by key ; only the routes readable by the principal are given
+func ( handlerApi *HandlerApi ) List( httpResponse *httpresponse.Response, r *http.Request, principal *auth.Principal ) {
+  if principal.HasScope( auth.ScopeRead ) != true {
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, auth.ScopeRead )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  }
+  f, err := parseFilter( r )
+  if err == nil {
+    page := Page{}
+    if page.Limit, err = queryInt( r, "limit", PageLimitDefault, 1, PageLimitMax ) ; err == nil {
+      page.Offset, err = queryInt( r, "offset", 0, 0, int( ^uint( 0 ) >> 1 ) )
+    }
+    if err == nil {
+      handlerApi.list( &page, f, principal )
+      defer handlerApi.Logger.Infof( "Routes asked (%v of %v)", len( page.Routes ), page.Total )
+      httpResponse.Code = http.StatusOK
+      httpResponse.Payload = page
+      return
+    }
+  }
+  defer handlerApi.Logger.Infof( "Routes asked ; incorrect query : %v", err )
+  httpResponse.Code = http.StatusBadRequest
+  httpResponse.MessageError = err.Error()
+}
+
+func ( handlerApi *HandlerApi ) list( page *Page, f filter, principal *auth.Principal ) {
+  handlerApi.ConfMutext.RLock()
+  defer handlerApi.ConfMutext.RUnlock()
+  keys := make( []string, 0, len( handlerApi.Conf.Routes ) )
+  for key := range handlerApi.Conf.Routes {
+    keys = append( keys, key )
+  }
+  sort.Strings( keys )
+  page.Routes = []RouteView{}
+  for _, key := range keys {
+    route := handlerApi.Conf.Routes[key]
+    if principal.Allow( auth.ScopeRead, key ) != true {
+      continue
+    }
+    state := route.State()
+    if f.match( route, state ) != true {
+      continue
+    }
+    if page.Total >= page.Offset && len( page.Routes ) < page.Limit {
+      routeView := view( key, route )
+      routeView.State = state
+      page.Routes = append( page.Routes, routeView )
+    }
+    page.Total++
+  }
+}
+
+func ( handlerApi *HandlerApi ) Get( httpResponse *httpresponse.Response, r *http.Request, principal *auth.Principal, key string ) {
+  if principal.Allow( auth.ScopeRead, key ) != true {
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, auth.ScopeRead )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  }
+  handlerApi.ConfMutext.RLock()
+  defer handlerApi.ConfMutext.RUnlock()
+  route, err := handlerApi.Conf.GetRoute( key )
+  if err != nil {
+    defer handlerApi.Logger.Infof( "Get route '%v' failed : non-existent", key )
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow route"
+    return
+  }
+  if api.NotModified( r, httpResponse, api.RouteETag( route ) ) {
+    defer handlerApi.Logger.Infof( "Get route '%v' asked (not modified)", key )
+    return
+  }
+  defer handlerApi.Logger.Infof( "Get route '%v' asked (existent)", key )
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = view( key, route )
+  httpResponse.ETag = api.RouteETag( route )
+}
+
+// -----------------------------------------------
+
+// the whole route, created if needed
+func ( handlerApi *HandlerApi ) Put( httpResponse *httpresponse.Response, r *http.Request, principal *auth.Principal, key string ) {
+  var newRoute map[string]interface{}
+  if body, err := ioutil.ReadAll( r.Body ) ; err != nil || json.Unmarshal( body, &newRoute ) != nil || newRoute == nil {
+    defer handlerApi.Logger.Warningf( "Put route '%v' ; can't parse body", key )
+    httpResponse.Code = http.StatusBadRequest
+    httpResponse.MessageError = "the request's body is an invalid"
+    return
+  }
+  created := false
+  handlerApi.change( httpResponse, r, principal, key, "put route '"+key+"'", func( current interface{} ) ( interface{}, error ) {
+    created = current == nil
+    return newRoute, nil
+  } )
+  if created && httpResponse.Code == http.StatusOK {
+    httpResponse.Code = http.StatusCreated
+  }
+}
+
+// JSON Merge Patch ("application/json" too) or JSON Patch on the route only ;
+// the pointers of a JSON Patch are relative to the route
+func ( handlerApi *HandlerApi ) Patch( httpResponse *httpresponse.Response, r *http.Request, principal *auth.Principal, key string ) {
+  contentType := strings.TrimSpace( strings.Split( r.Header.Get( "Content-type" ), ";" )[0] )
+  body, err := ioutil.ReadAll( r.Body )
+  if err != nil {
+    defer handlerApi.Logger.Warningf( "Patch route '%v' ; can't read body : %v", key, err )
+    httpResponse.Code = http.StatusInternalServerError
+    httpResponse.MessageError = "the request's body is an invalid"
+    return
+  }
+  var apply func( current interface{} ) ( interface{}, error )
+  switch contentType {
+  case patch.ContentTypeMergePatch, "application/json":
+    var mergePatch interface{}
+    err = json.Unmarshal( body, &mergePatch )
+    apply = func( current interface{} ) ( interface{}, error ) {
+      return patch.Merge( current, mergePatch ), nil
+    }
+  case patch.ContentTypeJSONPatch:
+    var operations []patch.Operation
+    err = json.Unmarshal( body, &operations )
+    apply = func( current interface{} ) ( interface{}, error ) {
+      return patch.Apply( current, operations )
+    }
+  default:
+    httpResponse.Code = http.StatusUnsupportedMediaType
+    httpResponse.MessageError = "you must have '"+patch.ContentTypeMergePatch+"', '"+patch.ContentTypeJSONPatch+"' or 'application/json' content-type header"
+    return
+  }
+  if err != nil {
+    defer handlerApi.Logger.Warningf( "Patch route '%v' ; can't parse body : %v", key, err )
+    httpResponse.Code = http.StatusBadRequest
+    httpResponse.MessageError = "the request's body is an invalid"
+    return
+  }
+  handlerApi.change( httpResponse, r, principal, key, "patch route '"+key+"' ("+contentType+")", func( current interface{} ) ( interface{}, error ) {
+    if current == nil {
+      return nil, errNotFound
+    }
+    return apply( current )
+  } )
+}
+
+func ( handlerApi *HandlerApi ) Delete( httpResponse *httpresponse.Response, r *http.Request, principal *auth.Principal, key string ) {
+  handlerApi.change( httpResponse, r, principal, key, "delete route '"+key+"'", func( current interface{} ) ( interface{}, error ) {
+    if current == nil {
+      return nil, errNotFound
+    }
+    return nil, nil
+  } )
+  if httpResponse.Code == http.StatusOK {
+    httpResponse.Code = http.StatusNoContent
+    httpResponse.MessageError = "route deleted"
+    httpResponse.Payload = nil
+  }
+}
+
+// edit gives the new route's document from the current one (nil when absent) ;
+// nil removes the route. The scope is checked for the old and the new type, 
+// If-Match and If-None-Match against the route in effect. False when nothing 
+// was applied
+func ( handlerApi *HandlerApi ) change( httpResponse *httpresponse.Response, r *http.Request, principal *auth.Principal, key string, summary string, edit func( current interface{} ) ( interface{}, error ) ) ( applied bool ) {
+  refusedScope := ""
+  allow := func( route interface{} ) bool {
+    fields, _ := route.( map[string]interface{} )
+    if scope := api.RouteScope( fields ) ; principal.Allow( scope, key ) != true {
+      refusedScope = scope
+      return false
+    }
+    return true
+  }
+  apply := func( document interface{} ) ( interface{}, error ) {
+    // called with the conf's mutex held
+    route := handlerApi.Conf.Routes[key]
+    if route != nil && route.Source != "" {
+      return nil, errRoutesDir
+    }
+    if api.Precondition( r, httpResponse, api.RouteETag( route ) ) != true {
+      return nil, errPrecondition
+    }
+    root, ok := document.( map[string]interface{} )
+    if ok != true {
+      return nil, errors.New( "conf is not an object" )
+    }
+    routes, _ := root["routes"].( map[string]interface{} )
+    if routes == nil {
+      routes = map[string]interface{}{}
+      root["routes"] = routes
+    }
+    current, exists := routes[key]
+    if exists && allow( current ) != true {
+      return nil, errForbidden
+    }
+    updated, err := edit( current )
+    if err != nil {
+      return nil, err
+    }
+    if updated == nil {
+      delete( routes, key )
+      return document, nil
+    }
+    if _, ok := updated.( map[string]interface{} ) ; ok != true {
+      return nil, configuration.Problems{ { Path: "/routes/"+key, Message: "an object is expected" } }
+    }
+    if allow( updated ) != true {
+      return nil, errForbidden
+    }
+    routes[key] = updated
+    return document, nil
+  }
+  changes, err := utils.PatchConf(
+    apply,
+    api.PrincipalName( r ),
+    summary,
+    handlerApi.ConfMutext,
+    handlerApi.Conf,
+    handlerApi.Logger,
+  )
+  switch {
+  case err != nil && changes != nil:
+    handlerApi.Logger.Errorf( "API change applied but not persisted : %v", err )
+    httpResponse.Code = http.StatusInternalServerError
+    httpResponse.MessageError = "change applied but not persisted"
+    return true
+  case err == errNotFound:
+    defer handlerApi.Logger.Infof( "Change of route '%v' failed : non-existent", key )
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow route"
+    return
+  case err == errForbidden:
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, refusedScope )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  case err == errPrecondition:
+    defer handlerApi.Logger.Infof( "Change of route '%v' failed : precondition failed", key )
+    return
+  case err == errRoutesDir:
+    defer handlerApi.Logger.Infof( "Change of route '%v' failed : defined in routes dir", key )
+    httpResponse.Code = http.StatusConflict
+    httpResponse.MessageError = err.Error()
+    return
+  case err != nil:
+    api.PatchFailed( handlerApi.Logger, httpResponse, err )
+    return
+  }
+  defer handlerApi.Logger.Warningf( "Change of route '%v' executed ; %v change(s)", key, len( changes ) )
+  httpResponse.Code = http.StatusOK
+  httpResponse.MessageError = ""
+  handlerApi.ConfMutext.RLock()
+  defer handlerApi.ConfMutext.RUnlock()
+  applied = true
+  if route, err := handlerApi.Conf.GetRoute( key ) ; err == nil {
+    // no ETag : the lock was released, a concurrent change can be there
+    httpResponse.Payload = view( key, route )
+  }
+  return applied
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+  "net/http/httptest"
+  "testing"
+  // -----------
+  "itinerary"
+)
+
+func TestFilter( t *testing.T ) {
+  route := &itinerary.Route { TypeName: "shell", Labels: map[string]string { "team": "data" } }
+  for query, match := range map[string]bool {
+    "": true,
+    "type=function,shell": true,
+    "type=service": false,
+    "label=team": true,
+    "label=team=data&label=tier": false,
+    "label=team=web": false,
+    "status=idle": true,
+    "status=running": false,
+  } {
+    f, err := parseFilter( httptest.NewRequest( "GET", Path+"?"+query, nil ) )
+    if err != nil {
+      t.Fatalf( "'%v' : %v", query, err )
+    }
+    if f.match( route, route.State() ) != match {
+      t.Errorf( "'%v' : match %v expected", query, match )
+    }
+  }
+  route.Begin()
+  if state := route.State() ; state.Status != itinerary.RouteStatusRunning || state.InFlight != 1 || state.LastRequest == nil {
+    t.Errorf( "unexpected state while serving : %+v", state )
+  }
+  route.End()
+  for _, query := range []string { "type=lambda", "status=up", "label==x" } {
+    if _, err := parseFilter( httptest.NewRequest( "GET", Path+"?"+query, nil ) ) ; err == nil {
+      t.Errorf( "'%v' : error expected", query )
+    }
+  }
+}
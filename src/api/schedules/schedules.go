@@ -0,0 +1,97 @@
+package schedules
+
+import (
+  "net/http"
+  "strings"
+  "sync"
+  // -----------
+  "api"
+  "configuration"
+  "configuration/auth"
+  "httpresponse"
+  "logger"
+  "schedule"
+)
+
+// the routes' timers : next and last runs (the last job), by route
+
+const Path = "/api/schedules"
+
+type HandlerApi struct {
+  Logger *logger.Logger
+  ConfMutext *sync.RWMutex
+  Conf *configuration.Conf
+}
+
+func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Request ) {
+  handlerApi.Logger = api.Logger( handlerApi.Logger, r )
+  httpResponse := httpresponse.Response {
+    Code: http.StatusInternalServerError,
+    MessageError: "an unexpected error has occurred",
+  }
+  defer httpResponse.Respond( handlerApi.Logger, w )
+  handlerApi.ConfMutext.RLock()
+  principal := api.Authenticate( handlerApi.Conf, r )
+  scheduler := handlerApi.Conf.Scheduler
+  handlerApi.ConfMutext.RUnlock()
+  if principal == nil {
+    httpResponse.Code = http.StatusUnauthorized
+    httpResponse.MessageError = "you must be authentified"
+    return
+  }
+  key := strings.TrimPrefix( strings.TrimPrefix( r.URL.Path, Path ), "/" )
+  // the list is filtered by route
+  allowed := principal.HasScope( auth.ScopeRead )
+  if key != "" {
+    allowed = principal.Allow( auth.ScopeRead, key )
+  }
+  if allowed != true {
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, auth.ScopeRead )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  }
+  if scheduler == nil {
+    httpResponse.Code = http.StatusServiceUnavailable
+    httpResponse.MessageError = "scheduler unavailable"
+    return
+  }
+  switch {
+  case r.Method != http.MethodGet:
+    httpResponse.Code = http.StatusMethodNotAllowed
+    httpResponse.MessageError = "HTTP verb incorrect"
+  case strings.Contains( key, "/" ):
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "unknow resource"
+  case key == "":
+    handlerApi.List( &httpResponse, scheduler, principal )
+  default:
+    handlerApi.Get( &httpResponse, scheduler, key )
+  }
+}
+
+// only the routes the principal can read
+func ( handlerApi *HandlerApi ) List ( httpResponse *httpresponse.Response, scheduler *schedule.Scheduler, principal *auth.Principal ) {
+  states := []schedule.State{}
+  for _, state := range scheduler.States() {
+    if principal.Allow( auth.ScopeRead, state.Route ) {
+      states = append( states, state )
+    }
+  }
+  defer handlerApi.Logger.Infof( "List schedules asked (%v)", len( states ) )
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = states
+}
+
+func ( handlerApi *HandlerApi ) Get ( httpResponse *httpresponse.Response, scheduler *schedule.Scheduler, key string ) {
+  states, ok := scheduler.Route( key )
+  if ok != true {
+    defer handlerApi.Logger.Infof( "Get schedules '%v' failed : non-existent", key )
+    httpResponse.Code = http.StatusNotFound
+    httpResponse.MessageError = "this route has no schedule"
+    return
+  }
+  defer handlerApi.Logger.Infof( "Get schedules '%v' asked (%v)", key, len( states ) )
+  httpResponse.Code = http.StatusOK
+  httpResponse.Payload = states
+}
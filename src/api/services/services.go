@@ -4,17 +4,19 @@ import (
   "net/http"
   "io/ioutil"
   "encoding/json"
-  "time"
   "sync"
   // "fmt"
   // -----------
   "api"
   "itinerary"
   "configuration"
+  "configuration/auth"
   "httpresponse"
   "logger"
 )
 
+const Path = "/api/services/"
+
 type HandlerApi struct {
   Logger *logger.Logger
   ConfMutext *sync.RWMutex
@@ -22,19 +24,31 @@ type HandlerApi struct {
 }
 
 func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Request ) {
+  handlerApi.Logger = api.Logger( handlerApi.Logger, r )
   httpResponse := httpresponse.Response {
     Code: http.StatusInternalServerError,
     MessageError: "an unexpected error has occurred",
   }
   defer httpResponse.Respond( handlerApi.Logger, w )
   handlerApi.ConfMutext.RLock()
-  auth := api.VerifyAuthorization( handlerApi.Conf, r )
+  principal := api.Authenticate( handlerApi.Conf, r )
   handlerApi.ConfMutext.RUnlock()
-  if auth != true {
+  if principal == nil {
     httpResponse.Code = http.StatusUnauthorized
     httpResponse.MessageError = "you must be authentified"
     return
   }
+  scope := auth.ScopeManageServices
+  if r.Method == http.MethodGet {
+    scope = auth.ScopeRead
+  }
+  if principal.Allow( scope, api.RouteKey( r, Path ) ) != true {
+    defer handlerApi.Logger.Infof( "API request refused for principal '%v' (scope '%v')", principal.Name, scope )
+    httpResponse.Code = http.StatusForbidden
+    httpResponse.MessageError = "insufficient scope"
+    return
+  }
+  r = api.WithPrincipal( r, principal )
   switch r.Method  {
     case http.MethodGet:
       handlerApi.Get( &httpResponse, r )
@@ -48,18 +62,30 @@ func ( handlerApi HandlerApi ) ServeHTTP ( w http.ResponseWriter, r *http.Reques
   }
 }
 
-func ( handlerApi *HandlerApi ) Post ( httpResponse *httpresponse.Response, r *http.Request ) {
-  handlerApi.ConfMutext.Lock()
-  defer handlerApi.ConfMutext.Unlock()
-  routeId := r.URL.Path[14:] // /api/services/
-  route, _ := handlerApi.Conf.GetRoute( routeId )
-  if route != nil && route.TypeNum == itinerary.RouteTypeFunction {
-    defer handlerApi.Logger.Infof( "Post service '%v' failed : existent but not a service", routeId )
+// false (the response given) when the route in effect can't be changed as a 
+// service by this API ; to call with the conf's mutex held
+func ( handlerApi *HandlerApi ) changeable ( httpResponse *httpresponse.Response, action string, routeId string, route *itinerary.Route ) bool {
+  switch {
+  case route == nil:
+    return true
+  case route.TypeNum == itinerary.RouteTypeFunction:
+    defer handlerApi.Logger.Infof( "%v service '%v' failed : existent but not a service", action, routeId )
     httpResponse.Code = http.StatusPreconditionFailed
     httpResponse.MessageError = "this route is a function, no a service"
-    return 
+    return false
+  case route.Source != "":
+    defer handlerApi.Logger.Infof( "%v service '%v' failed : defined in routes dir (%v)", action, routeId, route.Source )
+    httpResponse.Code = http.StatusConflict
+    httpResponse.MessageError = "this route is defined in routes dir"
+    return false
   }
+  return true
+}
 
+// the container of a changed or removed service is stopped after the swap 
+// (utils.PatchConf)
+func ( handlerApi *HandlerApi ) Post ( httpResponse *httpresponse.Response, r *http.Request ) {
+  routeId := api.RouteKey( r, Path )
   body, err := ioutil.ReadAll( r.Body )
   if err != nil { 
     defer handlerApi.Logger.Warningf( "Post service '%v' ; can't read body : %v", routeId, err )
@@ -67,94 +93,65 @@ func ( handlerApi *HandlerApi ) Post ( httpResponse *httpresponse.Response, r *h
     httpResponse.MessageError = "the request's body is an invalid"
     return 
   } 
-  var newRoute = itinerary.Route {}
-  err = json.Unmarshal( body, &newRoute ) 
-  if err != nil { 
-    defer handlerApi.Logger.Warningf( "Post function '%v' ; can't parse body : %v", routeId, err )
+  var newRoute map[string]interface{}
+  if err := json.Unmarshal( body, &newRoute ) ; err != nil || newRoute == nil { 
+    defer handlerApi.Logger.Warningf( "Post service '%v' ; can't parse body : %v", routeId, err )
     httpResponse.Code = http.StatusBadRequest 
     httpResponse.MessageError = "the request's body is an invalid"
     return 
   } 
-  if err := newRoute.Check(); err != nil {
-    defer handlerApi.Logger.Warningf( "Post function '%v' ; error in request conf : %v", routeId, err )
-    httpResponse.Code = http.StatusBadRequest 
-    httpResponse.MessageError = "the request's body is an invalid"
-    return 
-  }
-  if newRoute.TypeName != "service" {
-    defer handlerApi.Logger.Warningf( "Post function '%v' ; this route is an existing non-service", routeId )
+  if newRoute["type"] != "service" {
+    defer handlerApi.Logger.Warningf( "Post service '%v' ; this route is a non-service", routeId )
     httpResponse.Code = http.StatusBadRequest 
     httpResponse.MessageError = "this route is an existing non-service"
     return 
   }
-  if route != nil {
-    route.Mutex.Lock()
-    defer route.Mutex.Unlock()
-    cId := route.Id 
-    if cId != "" {
-      _, err := handlerApi.Conf.Containers.Stop( route )
-      if err != nil {
-        handlerApi.Logger.Errorf( "Delete service '%v' (cId %v) not stopped - maybe he is still active ?", routeId, cId )
-      } 
-      handlerApi.Logger.Warningf( "Delete service '%v' (cId %v) stopped", routeId, cId )
-      time.Sleep( time.Duration( route.Timeout ) * time.Millisecond )
-      _, err = handlerApi.Conf.Containers.Remove( route )
-      if err != nil {
-        handlerApi.Logger.Errorf( "Delete service '%v' (cId %v) not terminated", routeId, cId )
-      } else {
-        handlerApi.Logger.Warningf( "Delete service '%v' (cId %v) terminated", routeId, cId )
-      } 
+  applied := api.ChangeRoute( handlerApi.Conf, handlerApi.ConfMutext, handlerApi.Logger, httpResponse, r, routeId, "post service '"+routeId+"'", func( route *itinerary.Route, current map[string]interface{} ) ( map[string]interface{}, error ) {
+    if handlerApi.changeable( httpResponse, "Post", routeId, route ) != true || api.Precondition( r, httpResponse, api.RouteETag( route ) ) != true {
+      return nil, api.ErrRefused
     }
-  } 
+    return newRoute, nil
+  } )
+  if applied != true {
+    return
+  }
   defer handlerApi.Logger.Warningf( "Post service '%v' executed", routeId )
-  handlerApi.Conf.Routes[routeId] = &newRoute 
   httpResponse.Code = http.StatusOK 
+  httpResponse.MessageError = ""
   httpResponse.Payload = nil 
+  handlerApi.ConfMutext.RLock()
+  route, _ := handlerApi.Conf.GetRoute( routeId )
+  httpResponse.ETag = api.RouteETag( route )
+  handlerApi.ConfMutext.RUnlock()
 }
 
 func ( handlerApi *HandlerApi ) Delete ( httpResponse *httpresponse.Response, r *http.Request ) {
-  handlerApi.ConfMutext.Lock()
-  defer handlerApi.ConfMutext.Unlock()
-  routeId := r.URL.Path[14:] // /api/services/
-  route, _ := handlerApi.Conf.GetRoute( routeId )
-  if route == nil {
-    defer handlerApi.Logger.Infof( "Delete service '%v' failed : non-existent", routeId )
-    httpResponse.Code = http.StatusNotFound 
-    httpResponse.MessageError = "unknow route"
-    return 
-  } else if route.TypeNum == itinerary.RouteTypeFunction {
-    defer handlerApi.Logger.Infof( "Delete service '%v' failed : existent but not a service", routeId )
-    httpResponse.Code = http.StatusPreconditionFailed
-    httpResponse.MessageError = "this route is a function, no a service"
-    return 
-  }
-  route.Mutex.Lock()
-  defer route.Mutex.Unlock()
-  cId := route.Id 
-  if cId != "" {
-    _, err := handlerApi.Conf.Containers.Stop( route )
-    if err != nil {
-      handlerApi.Logger.Errorf( "Delete service '%v' (cId %v) not stopped - maybe he is still active ?", routeId, cId )
-    } 
-    handlerApi.Logger.Warningf( "Delete service '%v' (cId %v) stopped", routeId, cId )
-    time.Sleep( time.Duration( route.Timeout ) * time.Millisecond )
-    _, err = handlerApi.Conf.Containers.Remove( route )
-    if err != nil {
-      handlerApi.Logger.Errorf( "Delete service '%v' (cId %v) not terminated", routeId, cId )
-    } else {
-      handlerApi.Logger.Warningf( "Delete service '%v' (cId %v) terminated", routeId, cId )
-    } 
+  routeId := api.RouteKey( r, Path )
+  applied := api.ChangeRoute( handlerApi.Conf, handlerApi.ConfMutext, handlerApi.Logger, httpResponse, r, routeId, "delete service '"+routeId+"'", func( route *itinerary.Route, current map[string]interface{} ) ( map[string]interface{}, error ) {
+    if route == nil {
+      defer handlerApi.Logger.Infof( "Delete service '%v' failed : non-existent", routeId )
+      httpResponse.Code = http.StatusNotFound 
+      httpResponse.MessageError = "unknow route"
+      return nil, api.ErrRefused
+    }
+    if handlerApi.changeable( httpResponse, "Delete", routeId, route ) != true || api.Precondition( r, httpResponse, api.RouteETag( route ) ) != true {
+      return nil, api.ErrRefused
+    }
+    return nil, nil
+  } )
+  if applied != true {
+    return
   }
-  handlerApi.Logger.Warningf( "Delete service '%v' (cId %v) executed", routeId, cId )
   handlerApi.Logger.Warningf( "Delete service '%v' removed from routes", routeId )
   httpResponse.Code = http.StatusOK 
+  httpResponse.MessageError = ""
   httpResponse.Payload = nil 
 }
 
 func ( handlerApi *HandlerApi ) Get ( httpResponse *httpresponse.Response, r *http.Request ) {
   handlerApi.ConfMutext.RLock()
   defer handlerApi.ConfMutext.RUnlock()
-    routeId := r.URL.Path[14:] // /api/services/
+    routeId := api.RouteKey( r, Path )
     route, _ := handlerApi.Conf.GetRoute( routeId )
   if route == nil {
     defer handlerApi.Logger.Infof( "Get service '%v' failed : non-existent", routeId )
@@ -167,9 +164,15 @@ func ( handlerApi *HandlerApi ) Get ( httpResponse *httpresponse.Response, r *ht
     httpResponse.MessageError = "this route is not a service"
     return 
   }
+  httpResponse.ETag = api.RouteETag( route )
+  if api.NotModified( r, httpResponse, httpResponse.ETag ) {
+    defer handlerApi.Logger.Infof( "Get service '%v' asked (not modified)", routeId )
+    return 
+  }
   defer handlerApi.Logger.Infof( "Get service '%v' asked (existent)", routeId )
   httpResponse.Code = http.StatusOK 
-  routeToJson := *route
-  httpResponse.Payload = routeToJson 
+  // exported : the references of authorizations, not their secrets
+  exported, _ := route.Export( true )
+  httpResponse.Payload = &exported 
 }
 
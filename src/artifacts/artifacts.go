@@ -0,0 +1,429 @@
+package artifacts
+
+import (
+  "archive/tar"
+  "crypto/sha256"
+  "encoding/hex"
+  "errors"
+  "hash"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "regexp"
+  "sort"
+  "strings"
+  "sync"
+  "time"
+  "fmt"
+  // -----------
+)
+
+// -----------------------------------------------
+
+// artifacts are stored by their SHA-256, read-only : a file (a script) or a
+// tree (a bundle, mounted as a whole). The digest of a tree is the one of its
+// listing : paths, executable bits and digests of files
+
+const (
+  DirName                               = "artifacts"
+  DigestPrefix                          = "sha256:"
+  StagingPrefix                         = ".staging-"
+
+  KindFile                              = "file"
+  KindTree                              = "tree"
+
+  FileSizeMax                           = 64 << 20
+  GraceDelay                            = time.Hour
+  CollectInterval                       = 10 * time.Minute
+)
+
+var digestRegex = regexp.MustCompile( "^"+DigestPrefix+"[0-9a-f]{64}$" )
+
+func ValidDigest( digest string ) bool {
+  return digestRegex.MatchString( digest )
+}
+
+type Artifact struct {
+  Digest string `json:"digest"`
+  Kind string `json:"kind"`
+  Size int64 `json:"size"`
+  Created time.Time `json:"created"`
+  References []string `json:"references"`
+}
+
+// -----------------------------------------------
+
+// the stamp of a verified artifact : a new verification only when it changes
+type stamp struct {
+  modTime time.Time
+  size int64
+  entries int
+}
+
+type Store struct {
+  Dir string
+  mutex sync.Mutex
+  verified map[string]stamp
+}
+
+func NewStore( dir string ) *Store {
+  return &Store {
+    Dir: dir,
+    verified: make( map[string]stamp ),
+  }
+}
+
+func ( store *Store ) Path( digest string ) ( string, error ) {
+  if ValidDigest( digest ) != true {
+    return "", errors.New( "digest invalid : '"+digest+"'" )
+  }
+  return filepath.Join( store.Dir, strings.TrimPrefix( digest, DigestPrefix ) ), nil
+}
+
+func digestOf( h hash.Hash ) string {
+  return DigestPrefix+hex.EncodeToString( h.Sum( nil ) )
+}
+
+// -----------------------------------------------
+
+// an existing artifact is kept (same content) and its date refreshed : the
+// grace delay restarts
+func ( store *Store ) Put( content io.Reader ) ( artifact Artifact, err error ) {
+  if err := os.MkdirAll( store.Dir, 0755 ) ; err != nil {
+    return artifact, err
+  }
+  file, err := ioutil.TempFile( store.Dir, StagingPrefix )
+  if err != nil {
+    return artifact, err
+  }
+  defer os.Remove( file.Name() )
+  h := sha256.New()
+  size, err := io.Copy( io.MultiWriter( file, h ), content )
+  if closeErr := file.Close() ; err == nil {
+    err = closeErr
+  }
+  if err != nil {
+    return artifact, err
+  }
+  if err := os.Chmod( file.Name(), 0444 ) ; err != nil {
+    return artifact, err
+  }
+  return store.commit( file.Name(), digestOf( h ), KindFile, size )
+}
+
+// the dir is moved in the store (same filesystem) or removed if the artifact
+// exists already
+func ( store *Store ) PutTree( dir string ) ( artifact Artifact, err error ) {
+  digest, size, err := TreeDigest( dir )
+  if err != nil {
+    return artifact, err
+  }
+  if err := readOnly( dir ) ; err != nil {
+    return artifact, err
+  }
+  artifact, err = store.commit( dir, digest, KindTree, size )
+  removeTree( dir )
+  return artifact, err
+}
+
+func ( store *Store ) commit( staged string, digest string, kind string, size int64 ) ( Artifact, error ) {
+  target, _ := store.Path( digest )
+  now := time.Now()
+  if _, err := os.Lstat( target ) ; err == nil {
+    os.Chtimes( target, now, now )
+  } else if err := os.Rename( staged, target ) ; err != nil {
+    return Artifact{}, err
+  } else {
+    os.Chtimes( target, now, now )
+  }
+  return Artifact { Digest: digest, Kind: kind, Size: size, Created: now }, nil
+}
+
+// -----------------------------------------------
+
+func walk( dir string, visit func( name string, info os.FileInfo ) error ) error {
+  return filepath.Walk( dir, func( path string, info os.FileInfo, err error ) error {
+    if err != nil {
+      return err
+    }
+    name, err := filepath.Rel( dir, path )
+    if err != nil || name == "." {
+      return err
+    }
+    if info.IsDir() != true && info.Mode().IsRegular() != true {
+      return errors.New( "only files and directories in tree : '"+name+"'" )
+    }
+    return visit( filepath.ToSlash( name ), info )
+  } )
+}
+
+func TreeDigest( dir string ) ( digest string, size int64, err error ) {
+  listing := sha256.New()
+  err = walk( dir, func( name string, info os.FileInfo ) error {
+    if info.IsDir() {
+      fmt.Fprintf( listing, "d %v\n", name )
+      return nil
+    }
+    file, err := os.Open( filepath.Join( dir, filepath.FromSlash( name ) ) )
+    if err != nil {
+      return err
+    }
+    defer file.Close()
+    h := sha256.New()
+    written, err := io.Copy( h, file )
+    if err != nil {
+      return err
+    }
+    size += written
+    mode := "-"
+    if info.Mode()&0111 != 0 {
+      mode = "x"
+    }
+    fmt.Fprintf( listing, "f %v %x %v\n", mode, h.Sum( nil ), name )
+    return nil
+  } )
+  if err != nil {
+    return "", 0, err
+  }
+  return digestOf( listing ), size, nil
+}
+
+func fileDigest( path string ) ( string, error ) {
+  file, err := os.Open( path )
+  if err != nil {
+    return "", err
+  }
+  defer file.Close()
+  h := sha256.New()
+  if _, err := io.Copy( h, file ) ; err != nil {
+    return "", err
+  }
+  return digestOf( h ), nil
+}
+
+// files and dirs without write permission (executable bits kept)
+func readOnly( dir string ) error {
+  var dirs []string
+  err := walk( dir, func( name string, info os.FileInfo ) error {
+    path := filepath.Join( dir, filepath.FromSlash( name ) )
+    if info.IsDir() {
+      dirs = append( dirs, path )
+      return nil
+    }
+    return os.Chmod( path, info.Mode().Perm()&0555|0444 )
+  } )
+  if err != nil {
+    return err
+  }
+  // the deepest first : a read-only dir can't be changed anymore
+  for i := len( dirs )-1 ; i >= 0 ; i-- {
+    if err := os.Chmod( dirs[i], 0555 ) ; err != nil {
+      return err
+    }
+  }
+  return os.Chmod( dir, 0555 )
+}
+
+// the dirs are read-only : they are made writable before the removal
+func removeTree( path string ) error {
+  filepath.Walk( path, func( path string, info os.FileInfo, err error ) error {
+    if err == nil && info.IsDir() {
+      os.Chmod( path, 0755 )
+    }
+    return nil
+  } )
+  return os.RemoveAll( path )
+}
+
+// -----------------------------------------------
+
+func ( store *Store ) stamp( path string, info os.FileInfo ) ( stamp, error ) {
+  current := stamp { modTime: info.ModTime(), size: info.Size() }
+  if info.IsDir() != true {
+    return current, nil
+  }
+  err := walk( path, func( name string, entry os.FileInfo ) error {
+    current.entries++
+    current.size += entry.Size()
+    if entry.ModTime().After( current.modTime ) {
+      current.modTime = entry.ModTime()
+    }
+    return nil
+  } )
+  return current, err
+}
+
+// the path to mount, once its content is checked against the digest ; the
+// content is hashed again only when the artifact's stamp changed
+func ( store *Store ) Verify( digest string ) ( string, error ) {
+  path, err := store.Path( digest )
+  if err != nil {
+    return "", err
+  }
+  info, err := os.Stat( path )
+  if err != nil {
+    return "", errors.New( "artifact not found : '"+digest+"'" )
+  }
+  current, err := store.stamp( path, info )
+  if err != nil {
+    return "", err
+  }
+  store.mutex.Lock()
+  known, ok := store.verified[digest]
+  store.mutex.Unlock()
+  if ok && known == current {
+    return path, nil
+  }
+  var actual string
+  if info.IsDir() {
+    actual, _, err = TreeDigest( path )
+  } else {
+    actual, err = fileDigest( path )
+  }
+  if err != nil {
+    return "", err
+  }
+  if actual != digest {
+    return "", errors.New( "artifact corrupted : '"+digest+"' has content '"+actual+"'" )
+  }
+  store.mutex.Lock()
+  store.verified[digest] = current
+  store.mutex.Unlock()
+  return path, nil
+}
+
+func ( store *Store ) Stat( digest string ) ( artifact Artifact, err error ) {
+  path, err := store.Path( digest )
+  if err != nil {
+    return artifact, err
+  }
+  info, err := os.Stat( path )
+  if err != nil {
+    return artifact, err
+  }
+  artifact = Artifact { Digest: digest, Kind: KindFile, Size: info.Size(), Created: info.ModTime() }
+  if info.IsDir() {
+    artifact.Kind = KindTree
+    artifact.Size = 0
+    err = walk( path, func( name string, entry os.FileInfo ) error {
+      if entry.IsDir() != true {
+        artifact.Size += entry.Size()
+      }
+      return nil
+    } )
+  }
+  return artifact, err
+}
+
+// sorted by digest, with their references (digest to users)
+func ( store *Store ) List( references map[string][]string ) ( []Artifact, error ) {
+  entries, err := ioutil.ReadDir( store.Dir )
+  if err != nil && os.IsNotExist( err ) != true {
+    return nil, err
+  }
+  list := []Artifact{}
+  for _, entry := range entries {
+    digest := DigestPrefix+entry.Name()
+    if ValidDigest( digest ) != true {
+      continue
+    }
+    artifact, err := store.Stat( digest )
+    if err != nil {
+      continue
+    }
+    artifact.References = append( []string{}, references[digest]... )
+    list = append( list, artifact )
+  }
+  sort.Slice( list, func( i int, j int ) bool { return list[i].Digest < list[j].Digest } )
+  return list, nil
+}
+
+func ( store *Store ) Remove( digest string ) error {
+  path, err := store.Path( digest )
+  if err != nil {
+    return err
+  }
+  store.mutex.Lock()
+  delete( store.verified, digest )
+  store.mutex.Unlock()
+  return removeTree( path )
+}
+
+// the artifacts without reference and older than the grace delay are removed
+// (the staged ones too, abandoned) ; the references must not change meanwhile
+func ( store *Store ) Collect( references map[string][]string, grace time.Duration ) ( removed []string ) {
+  entries, err := ioutil.ReadDir( store.Dir )
+  if err != nil {
+    return nil
+  }
+  limit := time.Now().Add( -grace )
+  for _, entry := range entries {
+    if entry.ModTime().After( limit ) {
+      continue
+    }
+    if strings.HasPrefix( entry.Name(), StagingPrefix ) {
+      removeTree( filepath.Join( store.Dir, entry.Name() ) )
+      continue
+    }
+    digest := DigestPrefix+entry.Name()
+    if ValidDigest( digest ) != true || len( references[digest] ) > 0 {
+      continue
+    }
+    if store.Remove( digest ) == nil {
+      removed = append( removed, digest )
+    }
+  }
+  return removed
+}
+
+// -----------------------------------------------
+
+// the content of a file, or a tree as tar
+func ( store *Store ) Open( digest string ) ( io.ReadCloser, string, error ) {
+  path, err := store.Path( digest )
+  if err != nil {
+    return nil, "", err
+  }
+  info, err := os.Stat( path )
+  if err != nil {
+    return nil, "", err
+  }
+  if info.IsDir() != true {
+    file, err := os.Open( path )
+    return file, KindFile, err
+  }
+  reader, writer := io.Pipe()
+  go func() {
+    writer.CloseWithError( writeTar( path, writer ) )
+  }()
+  return reader, KindTree, nil
+}
+
+func writeTar( dir string, w io.Writer ) error {
+  tarWriter := tar.NewWriter( w )
+  err := walk( dir, func( name string, info os.FileInfo ) error {
+    header, err := tar.FileInfoHeader( info, "" )
+    if err != nil {
+      return err
+    }
+    header.Name = name
+    if info.IsDir() {
+      header.Name += "/"
+    }
+    if err := tarWriter.WriteHeader( header ) ; err != nil || info.IsDir() {
+      return err
+    }
+    file, err := os.Open( filepath.Join( dir, filepath.FromSlash( name ) ) )
+    if err != nil {
+      return err
+    }
+    defer file.Close()
+    _, err = io.Copy( tarWriter, file )
+    return err
+  } )
+  if err != nil {
+    return err
+  }
+  return tarWriter.Close()
+}
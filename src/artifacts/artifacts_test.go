@@ -0,0 +1,48 @@
+package artifacts
+
+import (
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestStore( t *testing.T ) {
+  store := NewStore( filepath.Join( t.TempDir(), DirName ) )
+  file, err := store.Put( strings.NewReader( "print(1)" ) )
+  if err != nil || file.Kind != KindFile || ValidDigest( file.Digest ) != true {
+    t.Fatalf( "unexpected file artifact : %+v (%v)", file, err )
+  }
+  if again, _ := store.Put( strings.NewReader( "print(1)" ) ) ; again.Digest != file.Digest {
+    t.Error( "same content, same digest expected" )
+  }
+  dir := filepath.Join( store.Dir, StagingPrefix+"tree" )
+  os.MkdirAll( filepath.Join( dir, "lib" ), 0755 )
+  os.WriteFile( filepath.Join( dir, "lib", "util.py" ), []byte( "x=1" ), 0644 )
+  tree, err := store.PutTree( dir )
+  if err != nil || tree.Kind != KindTree || tree.Size != 3 {
+    t.Fatalf( "unexpected tree artifact : %+v (%v)", tree, err )
+  }
+  if _, err := store.Verify( tree.Digest ) ; err != nil {
+    t.Fatal( err )
+  }
+  // corrupted in place : the stamp changes, the content is hashed again
+  path, _ := store.Path( file.Digest )
+  os.Chmod( path, 0644 )
+  os.WriteFile( path, []byte( "print(2)" ), 0644 )
+  if _, err := store.Verify( file.Digest ) ; err == nil {
+    t.Error( "corrupted artifact must be refused" )
+  }
+  list, _ := store.List( map[string][]string { tree.Digest: { "routes/a" } } )
+  if len( list ) != 2 {
+    t.Fatalf( "2 artifacts expected : %v", list )
+  }
+  if removed := store.Collect( map[string][]string { tree.Digest: { "routes/a" } }, time.Hour ) ; len( removed ) != 0 {
+    t.Errorf( "nothing to collect in grace delay : %v", removed )
+  }
+  removed := store.Collect( map[string][]string { tree.Digest: { "routes/a" } }, -time.Second )
+  if len( removed ) != 1 || removed[0] != file.Digest {
+    t.Errorf( "only the file must be collected : %v", removed )
+  }
+}
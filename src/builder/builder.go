@@ -0,0 +1,446 @@
+package builder
+
+import (
+  "bytes"
+  "context"
+  "crypto/sha256"
+  "encoding/hex"
+  "errors"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "sort"
+  "sync"
+  "text/template"
+  "time"
+  "fmt"
+  // -----------
+  "artifacts"
+  "logger"
+)
+
+// -----------------------------------------------
+
+// the images of functions built from their source (a dir of the host or a
+// bundle stored as artifact) with a runtime's template or their own
+// Dockerfile. The tag is given by the fingerprint of the inputs : a change
+// of the code (or of the template) is a new build, the same inputs an
+// existing image. One build at once ; the last image built is used while
+// the next one runs
+
+const (
+  RuntimeDockerfile                     = "dockerfile"
+  DockerfileDefault                     = "Dockerfile"
+  ImageRepository                       = "faass/build"
+
+  StatusPending                         = "pending"
+  StatusRunning                         = "running"
+  StatusSucceeded                       = "succeeded"
+  StatusFailed                          = "failed"
+  StatusSuperseded                      = "superseded"
+
+  ReasonCreated                         = "created"
+  ReasonChanged                         = "changed"
+  ReasonAsked                           = "asked"
+
+  LogSizeMax                            = 1 << 20
+  BuildTimeout                          = 30 * time.Minute
+  SyncInterval                          = 10 * time.Second
+)
+
+type Runtime struct {
+  Base string
+  Dockerfile string
+}
+
+// the code is copied in /function, like the script is mounted for the
+// other functions ; the base is the route's image, if any
+var Runtimes = map[string]Runtime {
+  "python": {
+    Base: "python:3-slim",
+    Dockerfile: `FROM {{.Base}}
+WORKDIR /function
+COPY . /function
+RUN if [ -f requirements.txt ] ; then pip install --no-cache-dir -r requirements.txt ; fi
+CMD ["python3", "/function/main.py"]
+`,
+  },
+  "node": {
+    Base: "node:lts-slim",
+    Dockerfile: `FROM {{.Base}}
+WORKDIR /function
+COPY . /function
+RUN if [ -f package.json ] ; then npm install --omit=dev ; fi
+CMD ["node", "/function/index.js"]
+`,
+  },
+  "go": {
+    Base: "golang:1",
+    Dockerfile: `FROM {{.Base}} AS build
+WORKDIR /src
+COPY . /src
+RUN if [ ! -f go.mod ] ; then go mod init function ; fi && CGO_ENABLED=0 go build -o /function/main .
+FROM alpine:3
+COPY --from=build /function/main /function/main
+CMD ["/function/main"]
+`,
+  },
+  "shell": {
+    Base: "alpine:3",
+    Dockerfile: `FROM {{.Base}}
+COPY . /function
+RUN chmod -R a+rX /function
+CMD ["/bin/sh", "/function/main.sh"]
+`,
+  },
+}
+
+func ValidRuntime( name string ) bool {
+  _, ok := Runtimes[name]
+  return ok || name == RuntimeDockerfile
+}
+
+func RuntimeNames() []string {
+  names := []string{ RuntimeDockerfile }
+  for name := range Runtimes {
+    names = append( names, name )
+  }
+  sort.Strings( names )
+  return names
+}
+
+// the build of a function's route ; without source, the route's artifact
+// (a bundle) is built
+type Definition struct {
+  Runtime string `json:"runtime"`
+  Source string `json:"source"`
+  Dockerfile string `json:"dockerfile"`
+}
+
+// -----------------------------------------------
+
+// a route to build, its context resolved (or the reason why it can't be)
+type Wanted struct {
+  Key string
+  Definition Definition
+  Base string
+  Context string
+  Problem string
+}
+
+type Target struct {
+  Key string
+  Context string
+  Dockerfile []byte
+  Fingerprint string
+  Image string
+}
+
+func NewTarget( wanted Wanted ) ( *Target, error ) {
+  if wanted.Problem != "" {
+    return nil, errors.New( wanted.Problem )
+  }
+  info, err := os.Stat( wanted.Context )
+  if err != nil || info.IsDir() != true {
+    return nil, errors.New( "build's context isn't a directory : '"+wanted.Context+"'" )
+  }
+  target := &Target { Key: wanted.Key, Context: wanted.Context }
+  if wanted.Definition.Runtime == RuntimeDockerfile {
+    name := wanted.Definition.Dockerfile
+    if name == "" {
+      name = DockerfileDefault
+    }
+    if target.Dockerfile, err = ioutil.ReadFile( filepath.Join( wanted.Context, filepath.FromSlash( name ) ) ) ; err != nil {
+      return nil, errors.New( "Dockerfile not found in source : '"+name+"'" )
+    }
+  } else {
+    runtime, ok := Runtimes[wanted.Definition.Runtime]
+    if ok != true {
+      return nil, errors.New( "runtime unknown : '"+wanted.Definition.Runtime+"'" )
+    }
+    base := wanted.Base
+    if base == "" {
+      base = runtime.Base
+    }
+    var dockerfile bytes.Buffer
+    if err := template.Must( template.New( "" ).Parse( runtime.Dockerfile ) ).Execute( &dockerfile, map[string]string{ "Base": base } ) ; err != nil {
+      return nil, err
+    }
+    target.Dockerfile = dockerfile.Bytes()
+  }
+  treeDigest, _, err := artifacts.TreeDigest( wanted.Context )
+  if err != nil {
+    return nil, errors.New( fmt.Sprintf( "source unreadable : %v", err ) )
+  }
+  h := sha256.New()
+  h.Write( target.Dockerfile )
+  h.Write( []byte( "\n"+treeDigest ) )
+  target.Fingerprint = artifacts.DigestPrefix+hex.EncodeToString( h.Sum( nil ) )
+  // the route's key can start with '-' : not the tag
+  target.Image = ImageRepository+":"+target.Fingerprint[len( artifacts.DigestPrefix ):][:12]+"-"+wanted.Key
+  return target, nil
+}
+
+// -----------------------------------------------
+
+type Job struct {
+  Id int `json:"id"`
+  Key string `json:"key"`
+  Image string `json:"image"`
+  Fingerprint string `json:"fingerprint"`
+  Reason string `json:"reason"`
+  Status string `json:"status"`
+  Error string `json:"error,omitempty"`
+  Created time.Time `json:"created"`
+  Started *time.Time `json:"started"`
+  Ended *time.Time `json:"ended"`
+  target *Target
+  force bool
+  log *Log
+}
+
+type Builder struct {
+  PathCmd string
+  Logger *logger.Logger
+  mutex sync.Mutex
+  sequence int
+  wanted map[string]Wanted
+  jobs map[string]*Job
+  images map[string]string
+  queue []*Job
+  wake chan struct{}
+}
+
+func New( pathCmd string, logger *logger.Logger ) *Builder {
+  return &Builder {
+    PathCmd: pathCmd,
+    Logger: logger,
+    wanted: make( map[string]Wanted ),
+    jobs: make( map[string]*Job ),
+    images: make( map[string]string ),
+    wake: make( chan struct{}, 1 ),
+  }
+}
+
+// the last image built for the route ; "" if none yet
+func ( builder *Builder ) Image( key string ) string {
+  builder.mutex.Lock()
+  defer builder.mutex.Unlock()
+  return builder.images[key]
+}
+
+func ( builder *Builder ) Job( key string ) ( job Job, ok bool ) {
+  builder.mutex.Lock()
+  defer builder.mutex.Unlock()
+  if current, ok := builder.jobs[key] ; ok {
+    return *current, true
+  }
+  return job, false
+}
+
+func ( builder *Builder ) Jobs() []Job {
+  builder.mutex.Lock()
+  defer builder.mutex.Unlock()
+  jobs := make( []Job, 0, len( builder.jobs ) )
+  for _, job := range builder.jobs {
+    jobs = append( jobs, *job )
+  }
+  sort.Slice( jobs, func( i int, j int ) bool { return jobs[i].Key < jobs[j].Key } )
+  return jobs
+}
+
+func ( builder *Builder ) Log( key string ) *Log {
+  builder.mutex.Lock()
+  defer builder.mutex.Unlock()
+  if job, ok := builder.jobs[key] ; ok {
+    return job.log
+  }
+  return nil
+}
+
+// -----------------------------------------------
+
+// to call with the builder's mutex held ; the job replaces the previous one of
+// the route
+func ( builder *Builder ) add( key string, target *Target, reason string, force bool ) *Job {
+  builder.sequence++
+  job := &Job {
+    Id: builder.sequence,
+    Key: key,
+    Reason: reason,
+    Status: StatusPending,
+    Created: time.Now(),
+    target: target,
+    force: force,
+    log: NewLog(),
+  }
+  if target != nil {
+    job.Image = target.Image
+    job.Fingerprint = target.Fingerprint
+  }
+  if previous, ok := builder.jobs[key] ; ok && previous.Status == StatusPending {
+    previous.Status = StatusSuperseded
+    previous.log.Close()
+  }
+  builder.jobs[key] = job
+  return job
+}
+
+func ( builder *Builder ) fail( job *Job, err error ) {
+  now := time.Now()
+  job.Status = StatusFailed
+  job.Error = err.Error()
+  job.Ended = &now
+  job.log.Printf( "build failed : %v\n", err )
+  job.log.Close()
+}
+
+func ( builder *Builder ) enqueue( job *Job ) {
+  builder.queue = append( builder.queue, job )
+  select {
+  case builder.wake <- struct{}{}:
+  default:
+  }
+}
+
+// the routes to build : a new build for the new or changed ones (a failed
+// build isn't retried with the same inputs), nothing kept for the others
+func ( builder *Builder ) Sync( wanted []Wanted ) {
+  targets := make( map[string]*Target )
+  problems := make( map[string]error )
+  for _, w := range wanted {
+    targets[w.Key], problems[w.Key] = NewTarget( w )
+  }
+  builder.mutex.Lock()
+  defer builder.mutex.Unlock()
+  for key := range builder.jobs {
+    if _, ok := targets[key] ; ok != true {
+      delete( builder.jobs, key )
+      delete( builder.images, key )
+    }
+  }
+  builder.wanted = make( map[string]Wanted )
+  for _, w := range wanted {
+    builder.wanted[w.Key] = w
+    current, exists := builder.jobs[w.Key]
+    reason := ReasonCreated
+    if exists {
+      reason = ReasonChanged
+    }
+    if err := problems[w.Key] ; err != nil {
+      if exists != true || current.Fingerprint != "" || current.Error != err.Error() {
+        builder.Logger.Warningf( "build of route '%v' impossible : %v", w.Key, err )
+        builder.fail( builder.add( w.Key, nil, reason, false ), err )
+      }
+      continue
+    }
+    if exists && current.Fingerprint == targets[w.Key].Fingerprint {
+      continue
+    }
+    builder.Logger.Infof( "build of route '%v' requested (%v)", w.Key, reason )
+    builder.enqueue( builder.add( w.Key, targets[w.Key], reason, false ) )
+  }
+}
+
+// a new build of the route, without cache ; the inputs are read again
+func ( builder *Builder ) Rebuild( key string ) ( job Job, err error ) {
+  builder.mutex.Lock()
+  w, ok := builder.wanted[key]
+  builder.mutex.Unlock()
+  if ok != true {
+    return job, errors.New( "route without build : '"+key+"'" )
+  }
+  target, err := NewTarget( w )
+  builder.mutex.Lock()
+  defer builder.mutex.Unlock()
+  if _, ok := builder.wanted[key] ; ok != true {
+    return job, errors.New( "route without build : '"+key+"'" )
+  }
+  added := builder.add( key, target, ReasonAsked, true )
+  if err != nil {
+    builder.fail( added, err )
+  } else {
+    builder.enqueue( added )
+  }
+  return *added, nil
+}
+
+// -----------------------------------------------
+
+// the builds, one by one, until the context is done
+func ( builder *Builder ) Run( ctx context.Context ) {
+  for {
+    builder.mutex.Lock()
+    var job *Job
+    for len( builder.queue ) > 0 && job == nil {
+      job, builder.queue = builder.queue[0], builder.queue[1:]
+      if job.Status != StatusPending {
+        job = nil
+      }
+    }
+    if job != nil {
+      now := time.Now()
+      job.Status = StatusRunning
+      job.Started = &now
+    }
+    builder.mutex.Unlock()
+    if job != nil {
+      builder.build( ctx, job )
+      continue
+    }
+    select {
+    case <-builder.wake:
+    case <-ctx.Done():
+      return
+    }
+  }
+}
+
+func ( builder *Builder ) exists( ctx context.Context, image string ) bool {
+  return exec.CommandContext( ctx, builder.PathCmd, "image", "inspect", "--format", "{{.Id}}", image ).Run() == nil
+}
+
+func ( builder *Builder ) build( ctx context.Context, job *Job ) {
+  ctx, cancel := context.WithTimeout( ctx, BuildTimeout )
+  defer cancel()
+  target := job.target
+  var err error
+  if job.force != true && builder.exists( ctx, target.Image ) {
+    job.log.Printf( "image '%v' exists : nothing to build\n", target.Image )
+  } else {
+    job.log.Printf( "build of image '%v' (context '%v')\n", target.Image, target.Context )
+    args := []string{
+      "build",
+        "--tag", target.Image,
+        "--label", "faass=true",
+        "--label", "faass.route="+target.Key,
+        "--file", "-",
+    }
+    if job.force {
+      args = append( args, "--no-cache" )
+    }
+    cmd := exec.CommandContext( ctx, builder.PathCmd, append( args, target.Context )... )
+    cmd.Stdin = bytes.NewReader( target.Dockerfile )
+    cmd.Stdout = job.log
+    cmd.Stderr = job.log
+    err = cmd.Run()
+  }
+  builder.mutex.Lock()
+  defer builder.mutex.Unlock()
+  if err != nil {
+    builder.Logger.Warningf( "build of route '%v' failed : %v", job.Key, err )
+    builder.fail( job, err )
+    return
+  }
+  now := time.Now()
+  job.Status = StatusSucceeded
+  job.Ended = &now
+  job.log.Printf( "image '%v' built\n", target.Image )
+  job.log.Close()
+  // a build superseded meanwhile is kept, as long as the route is
+  if _, ok := builder.wanted[job.Key] ; ok {
+    builder.images[job.Key] = target.Image
+  }
+  builder.Logger.Infof( "build of route '%v' succeeded : image '%v'", job.Key, target.Image )
+}
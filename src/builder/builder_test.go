@@ -0,0 +1,90 @@
+package builder
+
+import (
+  "context"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+  // -----------
+  "logger"
+)
+
+// a container's command : no image exists, a build prints its Dockerfile
+func fakeCommand( t *testing.T ) string {
+  path := filepath.Join( t.TempDir(), "docker" )
+  script := "#!/bin/sh\n[ \"$1\" = image ] && exit 1\ncat\n"
+  if err := ioutil.WriteFile( path, []byte( script ), 0755 ) ; err != nil {
+    t.Fatal( err )
+  }
+  return path
+}
+
+func wait( t *testing.T, b *Builder, key string, status string ) Job {
+  for i := 0 ; i < 200 ; i++ {
+    if job, ok := b.Job( key ) ; ok && job.Status == status {
+      return job
+    }
+    time.Sleep( 10 * time.Millisecond )
+  }
+  job, _ := b.Job( key )
+  t.Fatalf( "status '%v' expected : %+v", status, job )
+  return job
+}
+
+func TestBuilder( t *testing.T ) {
+  l := &logger.Logger{}
+  l.Init()
+  source := t.TempDir()
+  ioutil.WriteFile( filepath.Join( source, "main.py" ), []byte( "print(1)" ), 0644 )
+  b := New( fakeCommand( t ), l )
+  ctx, cancel := context.WithCancel( context.Background() )
+  defer cancel()
+  go b.Run( ctx )
+  wanted := []Wanted{ { Key: "fn", Definition: Definition{ Runtime: "python" }, Context: source } }
+  b.Sync( wanted )
+  first := wait( t, b, "fn", StatusSucceeded )
+  if b.Image( "fn" ) != first.Image || strings.HasPrefix( first.Image, ImageRepository+":" ) != true {
+    t.Errorf( "unexpected image : %v", b.Image( "fn" ) )
+  }
+  if log := string( b.Log( "fn" ).Bytes() ) ; strings.Contains( log, "FROM python:3-slim" ) != true {
+    t.Errorf( "the Dockerfile is expected in the log : %v", log )
+  }
+  // same inputs : nothing to do ; the code changes : a new build
+  b.Sync( wanted )
+  if job, _ := b.Job( "fn" ) ; job.Id != first.Id {
+    t.Errorf( "no build expected : %+v", job )
+  }
+  ioutil.WriteFile( filepath.Join( source, "main.py" ), []byte( "print(2)" ), 0644 )
+  b.Sync( wanted )
+  second := wait( t, b, "fn", StatusSucceeded )
+  if second.Reason != ReasonChanged || second.Image == first.Image {
+    t.Errorf( "a new image expected : %+v", second )
+  }
+  // the route without build is forgotten
+  b.Sync( nil )
+  if _, ok := b.Job( "fn" ) ; ok || b.Image( "fn" ) != "" {
+    t.Error( "the build must be forgotten" )
+  }
+}
+
+func TestTargetProblems( t *testing.T ) {
+  source := t.TempDir()
+  for name, wanted := range map[string]Wanted {
+    "problem": { Problem: "artifact corrupted" },
+    "missing": { Definition: Definition{ Runtime: "go" }, Context: filepath.Join( source, "missing" ) },
+    "runtime": { Definition: Definition{ Runtime: "cobol" }, Context: source },
+    "dockerfile": { Definition: Definition{ Runtime: RuntimeDockerfile }, Context: source },
+  } {
+    if _, err := NewTarget( wanted ) ; err == nil {
+      t.Errorf( "%v : error expected", name )
+    }
+  }
+  os.WriteFile( filepath.Join( source, "Build" ), []byte( "FROM scratch\n" ), 0644 )
+  target, err := NewTarget( Wanted{ Key: "-a", Definition: Definition{ Runtime: RuntimeDockerfile, Dockerfile: "Build" }, Context: source } )
+  if err != nil || string( target.Dockerfile ) != "FROM scratch\n" || strings.Contains( target.Image, ":-" ) {
+    t.Errorf( "unexpected target : %+v (%v)", target, err )
+  }
+}
@@ -0,0 +1,107 @@
+package builder
+
+import (
+  "context"
+  "io"
+  "sync"
+  "fmt"
+  // -----------
+)
+
+// -----------------------------------------------
+
+// the output of a build, kept in memory (limited) and followed by the readers
+// until the build ends
+type Log struct {
+  mutex sync.Mutex
+  content []byte
+  truncated bool
+  closed bool
+  changed chan struct{}
+}
+
+func NewLog() *Log {
+  return &Log { changed: make( chan struct{} ) }
+}
+
+// the readers waiting are woken up ; to call with the mutex held
+func ( log *Log ) notify() {
+  close( log.changed )
+  log.changed = make( chan struct{} )
+}
+
+func ( log *Log ) Write( p []byte ) ( int, error ) {
+  log.mutex.Lock()
+  defer log.mutex.Unlock()
+  if log.closed || log.truncated {
+    return len( p ), nil
+  }
+  if len( log.content )+len( p ) > LogSizeMax {
+    log.content = append( log.content, p[:LogSizeMax-len( log.content )]... )
+    log.content = append( log.content, "\n[log truncated]\n"... )
+    log.truncated = true
+  } else {
+    log.content = append( log.content, p... )
+  }
+  log.notify()
+  return len( p ), nil
+}
+
+func ( log *Log ) Printf( format string, a ...interface{} ) {
+  fmt.Fprintf( log, format, a... )
+}
+
+func ( log *Log ) Close() {
+  log.mutex.Lock()
+  defer log.mutex.Unlock()
+  if log.closed != true {
+    log.closed = true
+    log.notify()
+  }
+}
+
+func ( log *Log ) Bytes() []byte {
+  log.mutex.Lock()
+  defer log.mutex.Unlock()
+  return append( []byte{}, log.content... )
+}
+
+// -----------------------------------------------
+
+// from the start, then what is written until the log is closed (or the
+// context done)
+func ( log *Log ) Follow( ctx context.Context ) io.ReadCloser {
+  return &follower { log: log, ctx: ctx }
+}
+
+type follower struct {
+  log *Log
+  ctx context.Context
+  offset int
+}
+
+func ( f *follower ) Read( p []byte ) ( int, error ) {
+  for {
+    f.log.mutex.Lock()
+    if f.offset < len( f.log.content ) {
+      n := copy( p, f.log.content[f.offset:] )
+      f.offset += n
+      f.log.mutex.Unlock()
+      return n, nil
+    }
+    closed, changed := f.log.closed, f.log.changed
+    f.log.mutex.Unlock()
+    if closed {
+      return 0, io.EOF
+    }
+    select {
+    case <-changed:
+    case <-f.ctx.Done():
+      return 0, f.ctx.Err()
+    }
+  }
+}
+
+func ( f *follower ) Close() error {
+  return nil
+}
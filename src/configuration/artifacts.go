@@ -0,0 +1,58 @@
+package configuration
+
+import(
+  "encoding/json"
+  "path/filepath"
+  "sort"
+  "strconv"
+  // -----------
+  "artifacts"
+)
+
+// -----------------------------------------------
+
+func ( c *Conf ) ArtifactsDir() string {
+  return filepath.Join( c.TmpDir, artifacts.DirName )
+}
+
+// digest to its users : the routes ("routes/<key>") then the revisions of 
+// history ("revision/<id>"), a rollback needs their artifacts too ; to call 
+// with the conf's mutex held
+func ( c *Conf ) ArtifactReferences() map[string][]string {
+  references := make( map[string][]string )
+  keys := make( []string, 0, len( c.Routes ) )
+  for key := range c.Routes {
+    keys = append( keys, key )
+  }
+  sort.Strings( keys )
+  for _, key := range keys {
+    if digest := c.Routes[key].Artifact ; digest != "" {
+      references[digest] = append( references[digest], "routes/"+key )
+    }
+  }
+  if c.History == nil {
+    return references
+  }
+  for _, listed := range c.History.List() {
+    revision, ok := c.History.Get( listed.Id )
+    if ok != true {
+      continue
+    }
+    var content struct {
+      Routes map[string]struct {
+        Artifact string `json:"artifact"`
+      } `json:"routes"`
+    }
+    if json.Unmarshal( revision.Content, &content ) != nil {
+      continue
+    }
+    seen := make( map[string]bool )
+    for _, route := range content.Routes {
+      if route.Artifact != "" && seen[route.Artifact] != true {
+        seen[route.Artifact] = true
+        references[route.Artifact] = append( references[route.Artifact], "revision/"+strconv.Itoa( revision.Id ) )
+      }
+    }
+  }
+  return references
+}
@@ -1,4 +1,416 @@
 package auth
 
+import (
+  "crypto/hmac"
+  "crypto/rand"
+  "crypto/subtle"
+  "crypto/sha256"
+  "crypto/x509"
+  "crypto/tls"
+  "encoding/hex"
+  "net/http"
+  "strconv"
+  "strings"
+  "path"
+  "errors"
+  "sync"
+  "time"
+  // -----------
+)
+
+// -----------------------------------------------
+
 type Authorization = string
 
+// -----------------------------------------------
+
+const (
+  AuthTypeHeader                        = "header"
+  AuthTypeCertificate                   = "certificate"
+  AuthTypeSignature                     = "hmac"
+)
+
+// -----------------------------------------------
+
+const (
+  ClientAuthNone                        = "none"
+  ClientAuthRequest                     = "request"
+  ClientAuthRequire                     = "require"
+  ClientAuthVerifyIfGiven               = "verify-if-given"
+  ClientAuthRequireAndVerify            = "require-and-verify"
+)
+
+func ClientAuthType( mode string ) ( tls.ClientAuthType, bool ) {
+  switch mode {
+  case "", ClientAuthNone:
+    return tls.NoClientCert, true
+  case ClientAuthRequest:
+    return tls.RequestClientCert, true
+  case ClientAuthRequire:
+    return tls.RequireAnyClientCert, true
+  case ClientAuthVerifyIfGiven:
+    return tls.VerifyClientCertIfGiven, true
+  case ClientAuthRequireAndVerify:
+    return tls.RequireAndVerifyClientCert, true
+  }
+  return tls.NoClientCert, false
+}
+
+// a verifying mode needs its own CA : else the system's roots would be trusted
+func ClientAuthVerifies( mode string ) bool {
+  return mode == ClientAuthVerifyIfGiven || mode == ClientAuthRequireAndVerify
+}
+
+// -----------------------------------------------
+
+// a rule matches when all of its non-empty fields match the client certificate
+type CertificateRule struct {
+  Subject string `json:"subject"`
+  SAN string `json:"san"`
+  Fingerprint string `json:"fingerprint"`
+}
+
+func Fingerprint( cert *x509.Certificate ) string {
+  sum := sha256.Sum256( cert.Raw )
+  return hex.EncodeToString( sum[:] )
+}
+
+func normalizeFingerprint( fingerprint string ) string {
+  return strings.ToLower( strings.ReplaceAll( fingerprint, ":", "" ) )
+}
+
+func ( rule *CertificateRule ) IsEmpty() bool {
+  return rule.Subject == "" && rule.SAN == "" && rule.Fingerprint == ""
+}
+
+func ( rule *CertificateRule ) Match( cert *x509.Certificate ) bool {
+  if rule.IsEmpty() {
+    return false
+  }
+  if rule.Subject != "" {
+    if rule.Subject != cert.Subject.CommonName && rule.Subject != cert.Subject.String() {
+      return false
+    }
+  }
+  if rule.SAN != "" {
+    found := false
+    for _, name := range cert.DNSNames {
+      if name == rule.SAN {
+        found = true
+      }
+    }
+    for _, email := range cert.EmailAddresses {
+      if email == rule.SAN {
+        found = true
+      }
+    }
+    for _, ip := range cert.IPAddresses {
+      if ip.String() == rule.SAN {
+        found = true
+      }
+    }
+    for _, uri := range cert.URIs {
+      if uri.String() == rule.SAN {
+        found = true
+      }
+    }
+    if found == false {
+      return false
+    }
+  }
+  if rule.Fingerprint != "" {
+    if normalizeFingerprint( rule.Fingerprint ) != Fingerprint( cert ) {
+      return false
+    }
+  }
+  return true
+}
+
+// only verified chains are taken : an unverified certificate (mode "request") never matches
+func MatchCertificate( rules []CertificateRule, state *tls.ConnectionState ) bool {
+  if state == nil || len( state.VerifiedChains ) == 0 || len( state.VerifiedChains[0] ) == 0 {
+    return false
+  }
+  cert := state.VerifiedChains[0][0]
+  for i := range rules {
+    if rules[i].Match( cert ) {
+      return true
+    }
+  }
+  return false
+}
+
+// -----------------------------------------------
+
+const (
+  SignatureHeaderDefault                = "X-Hub-Signature-256"
+  SignaturePrefixDefault                = "sha256="
+  SignatureDeliveryDefault              = "X-GitHub-Delivery"
+  SignatureToleranceDefault             = 300
+  SignatureReplayWindow                 = 24 * time.Hour
+  SignatureBodyMax                      = 10 << 20
+)
+
+// the secret is a reference to conf's authorizations, resolved as route's authorization ; 
+// the signed content is the body (Git forges' webhooks), or "<timestamp>.<body>" 
+// with a timestamp header. A captured request can't be replayed : the used 
+// signatures and deliveries (id given by the delivery header) are kept for the 
+// tolerance with a timestamp, else for the replay window 
+type SignatureRule struct {
+  Header string `json:"header"`
+  Prefix string `json:"prefix"`
+  Secret string `json:"secret"`
+  SecretDefault string `json:"-"`
+  TimestampHeader string `json:"timestamp"`
+  DeliveryHeader string `json:"delivery"`
+  Tolerance int `json:"tolerance"`
+}
+
+// GitHub's headers by default
+func ( rule *SignatureRule ) PopulateDefaults() {
+  if rule.Header == "" {
+    rule.Header = SignatureHeaderDefault
+  }
+  if rule.Header == SignatureHeaderDefault {
+    if rule.Prefix == "" {
+      rule.Prefix = SignaturePrefixDefault
+    }
+    if rule.DeliveryHeader == "" {
+      rule.DeliveryHeader = SignatureDeliveryDefault
+    }
+  }
+  if rule.Tolerance < 1 {
+    rule.Tolerance = SignatureToleranceDefault
+  }
+}
+
+func ( rule *SignatureRule ) sum( timestamp string, body []byte ) []byte {
+  mac := hmac.New( sha256.New, []byte( rule.Secret ) )
+  if timestamp != "" {
+    mac.Write( []byte( timestamp+"." ) )
+  }
+  mac.Write( body )
+  return mac.Sum( nil )
+}
+
+func ( rule *SignatureRule ) Sign( timestamp string, body []byte ) string {
+  return rule.Prefix+hex.EncodeToString( rule.sum( timestamp, body ) )
+}
+
+// the prefix is taken as it is, the hex in any case 
+func ( rule *SignatureRule ) Verify( header http.Header, body []byte, replays *ReplayCache, now time.Time ) error {
+  if rule.Secret == "" {
+    return errors.New( "signature secret undefined" )
+  }
+  signature := header.Get( rule.Header )
+  if signature == "" {
+    return errors.New( "signature header missing" )
+  }
+  if strings.HasPrefix( signature, rule.Prefix ) != true {
+    return errors.New( "signature prefix invalid" )
+  }
+  given, err := hex.DecodeString( signature[len( rule.Prefix ):] )
+  if err != nil {
+    return errors.New( "signature invalid" )
+  }
+  delivery := ""
+  if rule.DeliveryHeader != "" {
+    if delivery = header.Get( rule.DeliveryHeader ) ; delivery == "" {
+      return errors.New( "signature delivery missing" )
+    }
+  }
+  timestamp := ""
+  window := SignatureReplayWindow
+  if rule.TimestampHeader != "" {
+    timestamp = header.Get( rule.TimestampHeader )
+    seconds, err := strconv.ParseInt( timestamp, 10, 64 )
+    if err != nil {
+      return errors.New( "signature timestamp invalid" )
+    }
+    window = time.Duration( rule.Tolerance ) * time.Second
+    delta := now.Sub( time.Unix( seconds, 0 ) )
+    if delta > window || delta < -window {
+      return errors.New( "signature timestamp out of tolerance" )
+    }
+  }
+  expected := rule.sum( timestamp, body )
+  if hmac.Equal( given, expected ) != true {
+    return errors.New( "signature mismatch" )
+  }
+  if replays != nil {
+    // the delivery isn't signed : the signature is kept too
+    keys := []string{ "signature:"+hex.EncodeToString( expected ) }
+    if delivery != "" {
+      keys = append( keys, "delivery:"+delivery )
+    }
+    if replays.Seen( keys, now.Add( window ), now ) {
+      return errors.New( "signature already used" )
+    }
+  }
+  return nil
+}
+
+// -----------------------------------------------
+
+type ReplayCache struct {
+  mutex sync.Mutex
+  seen map[string]time.Time
+}
+
+func NewReplayCache() *ReplayCache {
+  return &ReplayCache {
+    seen: make( map[string]time.Time ),
+  }
+}
+
+// true when one of the keys is known ; else all of them are kept until expire
+func ( cache *ReplayCache ) Seen( keys []string, expire time.Time, now time.Time ) bool {
+  cache.mutex.Lock()
+  defer cache.mutex.Unlock()
+  for k, e := range cache.seen {
+    if e.Before( now ) {
+      delete( cache.seen, k )
+    }
+  }
+  for _, key := range keys {
+    if _, ok := cache.seen[key] ; ok {
+      return true
+    }
+  }
+  for _, key := range keys {
+    cache.seen[key] = expire
+  }
+  return false
+}
+
+// -----------------------------------------------
+
+const (
+  ScopeRead                             = "read"
+  ScopeDeployFunctions                  = "deploy-functions"
+  ScopeManageServices                   = "manage-services"
+  ScopeAdminConfig                      = "admin-config"
+
+  APIKeyPrefix                          = "Bearer "
+  APIKeySize                            = 32
+  PrincipalLegacy                       = "authapi"
+)
+
+var Scopes = []string{ ScopeRead, ScopeDeployFunctions, ScopeManageServices, ScopeAdminConfig }
+
+// only the hash of the token is kept : the token is given once, at creation 
+type APIKey struct {
+  Hash string `json:"hash"`
+  Scopes []string `json:"scopes"`
+  Routes []string `json:"routes"`
+  Created time.Time `json:"created"`
+}
+
+func HashToken( token string ) string {
+  sum := sha256.Sum256( []byte( token ) )
+  return hex.EncodeToString( sum[:] )
+}
+
+func NewAPIKey( scopes []string, routes []string ) ( key *APIKey, token string, err error ) {
+  raw := make( []byte, APIKeySize )
+  if _, err := rand.Read( raw ) ; err != nil {
+    return nil, "", errors.New( "unable to generate token" )
+  }
+  token = hex.EncodeToString( raw )
+  key = &APIKey {
+    Hash: HashToken( token ),
+    Scopes: append( []string{}, scopes... ),
+    Routes: append( []string{}, routes... ),
+    Created: time.Now(),
+  }
+  if err := key.Check() ; err != nil {
+    return nil, "", err
+  }
+  return key, token, nil
+}
+
+func ( key *APIKey ) Check() error {
+  if len( key.Hash ) != sha256.Size*2 {
+    return errors.New( "api key hash invalid" )
+  }
+  if len( key.Scopes ) == 0 {
+    return errors.New( "api key without scope" )
+  }
+  for _, scope := range key.Scopes {
+    valid := false
+    for _, known := range Scopes {
+      if scope == known {
+        valid = true
+      }
+    }
+    if valid == false {
+      return errors.New( "api key scope invalid : '"+scope+"'" )
+    }
+  }
+  for _, pattern := range key.Routes {
+    if _, err := path.Match( pattern, "" ) ; err != nil {
+      return errors.New( "api key route pattern invalid : '"+pattern+"'" )
+    }
+  }
+  return nil
+}
+
+// -----------------------------------------------
+
+type Principal struct {
+  Name string
+  Scopes []string
+  Routes []string
+}
+
+// "admin-config" covers every scope
+func ( principal *Principal ) HasScope( scope string ) bool {
+  for _, s := range principal.Scopes {
+    if s == scope || s == ScopeAdminConfig {
+      return true
+    }
+  }
+  return false
+}
+
+// an empty route name (global resource) is only allowed for principals without route restriction 
+func ( principal *Principal ) Allow( scope string, routeName string ) bool {
+  if principal == nil || principal.HasScope( scope ) != true {
+    return false
+  }
+  if len( principal.Routes ) == 0 {
+    return true
+  }
+  for _, pattern := range principal.Routes {
+    if ok, _ := path.Match( pattern, routeName ) ; ok && routeName != "" {
+      return true
+    }
+  }
+  return false
+}
+
+func Authenticate( header string, legacy string, keys map[string]*APIKey ) *Principal {
+  if header == "" {
+    return nil
+  }
+  if legacy != "" && subtle.ConstantTimeCompare( []byte( header ), []byte( legacy ) ) == 1 {
+    return &Principal {
+      Name: PrincipalLegacy,
+      Scopes: []string{ ScopeAdminConfig },
+    }
+  }
+  if strings.HasPrefix( header, APIKeyPrefix ) != true {
+    return nil
+  }
+  hash := HashToken( strings.TrimPrefix( header, APIKeyPrefix ) )
+  for name, key := range keys {
+    if subtle.ConstantTimeCompare( []byte( hash ), []byte( key.Hash ) ) == 1 {
+      return &Principal {
+        Name: name,
+        Scopes: key.Scopes,
+        Routes: key.Routes,
+      }
+    }
+  }
+  return nil
+}
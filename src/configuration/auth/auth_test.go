@@ -0,0 +1,156 @@
+package auth
+
+import (
+  "crypto/ecdsa"
+  "crypto/elliptic"
+  "crypto/rand"
+  "crypto/tls"
+  "crypto/x509"
+  "crypto/x509/pkix"
+  "math/big"
+  "net/http"
+  "strconv"
+  "strings"
+  "testing"
+  "time"
+)
+
+func createCertificate( t *testing.T ) *x509.Certificate {
+  key, err := ecdsa.GenerateKey( elliptic.P256(), rand.Reader )
+  if err != nil {
+    t.Fatal( err )
+  }
+  template := x509.Certificate {
+    SerialNumber: big.NewInt( 1 ),
+    Subject: pkix.Name { CommonName: "internal-service" },
+    DNSNames: []string{ "internal.local" },
+    NotBefore: time.Now(),
+    NotAfter: time.Now().Add( time.Hour ),
+  }
+  raw, err := x509.CreateCertificate( rand.Reader, &template, &template, &key.PublicKey, key )
+  if err != nil {
+    t.Fatal( err )
+  }
+  cert, err := x509.ParseCertificate( raw )
+  if err != nil {
+    t.Fatal( err )
+  }
+  return cert
+}
+
+func TestCertificateRuleMatch( t *testing.T ) {
+  cert := createCertificate( t )
+  state := &tls.ConnectionState {
+    VerifiedChains: [][]*x509.Certificate{ { cert } },
+  }
+  if !MatchCertificate( []CertificateRule{ { Subject: "internal-service" } }, state ) {
+    t.Error( "subject rule must match" )
+  }
+  if !MatchCertificate( []CertificateRule{ { SAN: "internal.local", Fingerprint: Fingerprint( cert ) } }, state ) {
+    t.Error( "san+fingerprint rule must match" )
+  }
+  if MatchCertificate( []CertificateRule{ { Subject: "internal-service", SAN: "other.local" } }, state ) {
+    t.Error( "rule with wrong san must not match" )
+  }
+  if MatchCertificate( []CertificateRule{ { Subject: "internal-service" } }, &tls.ConnectionState{ PeerCertificates: []*x509.Certificate{ cert } } ) {
+    t.Error( "unverified certificate must not match" )
+  }
+}
+
+func TestSignatureRuleVerify( t *testing.T ) {
+  rule := SignatureRule { Secret: "s3cret", TimestampHeader: "X-Timestamp" }
+  rule.PopulateDefaults()
+  now := time.Now()
+  body := []byte( `{"ref":"main"}` )
+  timestamp := strconv.FormatInt( now.Unix(), 10 )
+  header := http.Header{}
+  header.Set( "X-Timestamp", timestamp )
+  header.Set( SignatureDeliveryDefault, "1" )
+  header.Set( SignatureHeaderDefault, rule.Sign( timestamp, body ) )
+  replays := NewReplayCache()
+  if err := rule.Verify( header, body, replays, now ) ; err != nil {
+    t.Errorf( "valid signature refused : %v", err )
+  }
+  if err := rule.Verify( header, body, replays, now ) ; err == nil {
+    t.Error( "replayed signature accepted" )
+  }
+  if err := rule.Verify( header, []byte( "altered" ), NewReplayCache(), now ) ; err == nil {
+    t.Error( "altered body accepted" )
+  }
+  if err := rule.Verify( header, body, NewReplayCache(), now.Add( time.Hour ) ) ; err == nil {
+    t.Error( "expired timestamp accepted" )
+  }
+  header.Del( "X-Timestamp" )
+  if err := rule.Verify( header, body, NewReplayCache(), now ) ; err == nil {
+    t.Error( "signature without timestamp accepted" )
+  }
+}
+
+// the example of GitHub's documentation : the body alone is signed
+func TestSignatureRuleGitHub( t *testing.T ) {
+  rule := SignatureRule { Secret: "It's a Secret to Everybody" }
+  rule.PopulateDefaults()
+  body := []byte( "Hello, World!" )
+  header := http.Header{}
+  header.Set( "X-Hub-Signature-256", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17" )
+  header.Set( "X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958" )
+  replays := NewReplayCache()
+  now := time.Now()
+  if err := rule.Verify( header, body, replays, now ) ; err != nil {
+    t.Fatalf( "GitHub's signature refused : %v", err )
+  }
+  if err := rule.Verify( header, body, replays, now ) ; err == nil {
+    t.Error( "replayed delivery accepted" )
+  }
+  header.Set( "X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0959" )
+  if err := rule.Verify( header, body, replays, now ) ; err == nil {
+    t.Error( "replayed signature with another delivery accepted" )
+  }
+  header.Del( "X-GitHub-Delivery" )
+  if err := rule.Verify( header, body, NewReplayCache(), now ) ; err == nil {
+    t.Error( "signature without delivery accepted" )
+  }
+}
+
+func TestSignatureRuleCase( t *testing.T ) {
+  rule := SignatureRule { Header: "X-Signature", Prefix: "SHA256=", Secret: "s3cret", TimestampHeader: "X-Timestamp" }
+  rule.PopulateDefaults()
+  now := time.Now()
+  body := []byte( `{"ref":"main"}` )
+  timestamp := strconv.FormatInt( now.Unix(), 10 )
+  signature := rule.Sign( timestamp, body )
+  header := http.Header{}
+  header.Set( "X-Timestamp", timestamp )
+  header.Set( "X-Signature", "SHA256="+strings.ToUpper( strings.TrimPrefix( signature, "SHA256=" ) ) )
+  if err := rule.Verify( header, body, nil, now ) ; err != nil {
+    t.Errorf( "hex in upper case refused : %v", err )
+  }
+  header.Set( "X-Signature", strings.ToLower( signature ) )
+  if err := rule.Verify( header, body, nil, now ) ; err == nil {
+    t.Error( "prefix in another case accepted" )
+  }
+}
+
+func TestAuthenticateScopes( t *testing.T ) {
+  key, token, err := NewAPIKey( []string{ ScopeDeployFunctions }, []string{ "team-a-*" } )
+  if err != nil {
+    t.Fatal( err )
+  }
+  keys := map[string]*APIKey{ "team-a": key }
+  principal := Authenticate( APIKeyPrefix+token, "Basic legacy", keys )
+  if principal == nil || principal.Name != "team-a" {
+    t.Fatal( "valid token refused" )
+  }
+  if !principal.Allow( ScopeDeployFunctions, "team-a-resize" ) {
+    t.Error( "route in pattern refused" )
+  }
+  if principal.Allow( ScopeDeployFunctions, "team-b-resize" ) || principal.Allow( ScopeManageServices, "team-a-resize" ) {
+    t.Error( "route or scope out of key accepted" )
+  }
+  if Authenticate( APIKeyPrefix+"wrong", "Basic legacy", keys ) != nil {
+    t.Error( "invalid token accepted" )
+  }
+  if legacy := Authenticate( "Basic legacy", "Basic legacy", keys ) ; legacy == nil || !legacy.Allow( ScopeManageServices, "" ) {
+    t.Error( "legacy authorization must be admin" )
+  }
+}
@@ -6,15 +6,20 @@ import(
   "path/filepath"
   "io/ioutil"
   "encoding/json"
-  "strconv"
-  "net"
-  "strings"
   "fmt"
   // -----------
+  "artifacts"
+  "builder"
   "itinerary"
   "executors"
+  "jobs"
   "logger"
   "configuration/auth"
+  "configuration/history"
+  "network"
+  "events"
+  "schedule"
+  "triggers"
 )
 
 // -----------------------------------------------
@@ -34,12 +39,17 @@ const (
   ConfIncomingAdressDefault             = "0.0.0.0"
   ConfIncomingPortDefault               = 9090
   ConfIncomingTLSDefault                = ""
+  ConfIncomingTLSClientCADefault        = ""
+  ConfIncomingTLSClientAuthDefault      = auth.ClientAuthNone
   ConfDelayCleaningContainersDefault    = 60
   ConfDelayCleaningContainersMin        = 5
   ConfDelayCleaningContainersMax        = 3600
   ConfAuthorizationDefault              = "Basic YWRtaW46YXplcnR5" // admin:azerty
   ConfRefAuthorizationsDefault          = "default"
   ConfPrefixDefault                     = "lambda"
+  ConfPersistDefault                    = false
+  ConfPersistBackupsDefault             = 3
+  ConfPersistBackupsMax                 = 100
 
   FunctionTimeoutDefault                = 1500
 
@@ -73,29 +83,58 @@ type Conf struct {
   Authorizations map[string]auth.Authorization `json:"authorizations"`
   AuthorizationAPI string `json:"authapi"`
   AuthorizationAPIDefault string `json:"-"`
+  APIKeys map[string]*auth.APIKey `json:"apikeys"`
   IncomingAdress string `json:"adress"`
   IncomingPort int `json:"listen"`
   IncomingTLS string `json:"tls"`
   IncomingTLSCrt string `json:"-"`
   IncomingTLSKey string `json:"-"`
+  IncomingTLSClientCA string `json:"tlsclientca"`
+  IncomingTLSClientAuth string `json:"tlsclientauth"`
+  Access network.Access `json:"access"`
   DelayCleaningContainers int `json:"delay"`
   UI string `json:"ui"`
   TmpDir string `json:"tmp"`
   Prefix string `json:"prefix"`
+  Persist bool `json:"persist"`
+  PersistBackups int `json:"persistbackups"`
+  Path string `json:"-"`
+  Templates map[string]Template `json:"-"`
+  HistorySize int `json:"historysize"`
+  History *history.History `json:"-"`
+  LogLevel string `json:"loglevel"`
+  LogFormat string `json:"logformat"`
+  LogFile string `json:"logfile"`
+  LogFileSize int `json:"logfilesize"`
+  LogFileBackups int `json:"logfilebackups"`
+  Artifacts *artifacts.Store `json:"-"`
+  Builder *builder.Builder `json:"-"`
+  JobsWorkers int `json:"jobsworkers"`
+  JobsRetention int `json:"jobsretention"`
+  JobsTimeout int `json:"jobstimeout"`
+  Jobs *jobs.Pool `json:"-"`
+  Scheduler *schedule.Scheduler `json:"-"`
+  Triggers *triggers.Manager `json:"-"`
+  Events *events.Bus `json:"-"`
+  RoutesDir string `json:"routesdir"`
   Routes map[string]*itinerary.Route `json:"routes"`
 }
 
 func Import( pathRoot string, c *Conf ) error {
-  jsonFileInput, err := os.Open( pathRoot )
+  fileInput, err := os.Open( pathRoot )
   if err != nil {
     return errors.New( "impossible to open conf's file" )
   }
-  defer jsonFileInput.Close()
-  byteValue, err := ioutil.ReadAll(jsonFileInput)
+  defer fileInput.Close()
+  byteValue, err := ioutil.ReadAll( fileInput )
   if err != nil {
     return errors.New( "impossible to read conf's file" )
   }
-  if err := json.Unmarshal( byteValue, c ) ; err != nil {
+  c.Templates = make( map[string]Template )
+  if err := Unmarshal( FormatOf( pathRoot ), byteValue, c, c.Templates ) ; err != nil {
+    if problems, ok := err.( Problems ) ; ok {
+      return problems
+    }
     return errors.New( 
       fmt.Sprintf( "impossible to parse conf's file : %v", err ),
     ) 
@@ -116,59 +155,64 @@ func ( c *Conf ) ResolveAuth() error {
   c.AuthorizationAPIDefault = c.AuthorizationAPI
   c.AuthorizationAPI = c.Authorizations[c.AuthorizationAPI]
   for routeName, route := range c.Routes {
-    if route.Authorization == "" {
-      continue 
+    if err := c.ResolveRouteAuth( routeName, route ) ; err != nil {
+      return err
     }
-    if _, ok := c.Authorizations[route.Authorization] ; !ok { 
+  }
+  c.Logger.Info( "stop of auth resolving ; all success" )
+  return nil
+}
+
+func ( c *Conf ) ResolveRouteAuth( routeName string, route *itinerary.Route ) error {
+  if route.Signature != nil {
+    if _, ok := c.Authorizations[route.Signature.Secret] ; !ok { 
       return errors.New( 
         fmt.Sprintf( 
-          "resolve auth failed for route '%v' ; auth '%v' not exists", 
+          "resolve auth failed for route '%v' ; signature secret '%v' not exists", 
           routeName,
-          route.Authorization,
+          route.Signature.Secret,
         ),
       )
-    } 
-    c.Logger.Debugf( "route '%v' auth  resolved", routeName )
-    route.AuthorizationDefault = route.Authorization
-    route.Authorization = c.Authorizations[route.Authorization]
+    }
+    route.Signature.SecretDefault = route.Signature.Secret
+    route.Signature.Secret = c.Authorizations[route.Signature.Secret]
   }
-  c.Logger.Info( "stop of auth resolving ; all success" )
+  if route.Jobs != nil && route.Jobs.Callback != nil {
+    callback := route.Jobs.Callback
+    if _, ok := c.Authorizations[callback.Secret] ; !ok { 
+      return errors.New( 
+        fmt.Sprintf( 
+          "resolve auth failed for route '%v' ; callback secret '%v' not exists", 
+          routeName,
+          callback.Secret,
+        ),
+      )
+    }
+    callback.SecretDefault = callback.Secret
+    callback.Secret = c.Authorizations[callback.Secret]
+  }
+  if route.Authorization == "" {
+    return nil 
+  }
+  if _, ok := c.Authorizations[route.Authorization] ; !ok { 
+    return errors.New( 
+      fmt.Sprintf( 
+        "resolve auth failed for route '%v' ; auth '%v' not exists", 
+        routeName,
+        route.Authorization,
+      ),
+    )
+  } 
+  c.Logger.Debugf( "route '%v' auth  resolved", routeName )
+  route.AuthorizationDefault = route.Authorization
+  route.Authorization = c.Authorizations[route.Authorization]
   return nil
 }
 
+// with the filesystem checks ; see Validate
 func ( c *Conf ) Check() ( err error ) {
-  message := "" 
-  if c.IncomingTLS != "" {
-    r := strings.Split( c.IncomingTLS, ":" )
-    if len( r ) != 2 {
-      message = "tls has no ':' separator"
-    } else {
-      c.IncomingTLSCrt = r[0]
-      c.IncomingTLSKey = r[1]
-    }
-  }
-  if net.ParseIP( c.IncomingAdress ) == nil {
-    message = "incomming adress is not an ip"
-  }
-  if c.DelayCleaningContainers < ConfDelayCleaningContainersMin {
-    c.DelayCleaningContainers = ConfDelayCleaningContainersMin
-    message = "new value for delay cleaning containers : min 5 (seconds)"
-  }
-  if c.DelayCleaningContainers > ConfDelayCleaningContainersMax {
-    c.DelayCleaningContainers = ConfDelayCleaningContainersMax
-    message = "new value for delay cleaning containers : max 60 (seconds)"
-  }
-  if c.IncomingPort < 1 || c.IncomingPort > 65535 {
-    message = "bad configuration : incorrect port '"+strconv.Itoa( c.IncomingPort )+"'"
-  }
-  for name, route := range c.Routes {
-    if err := route.Check(); err != nil {
-      message = fmt.Sprintf( "bad route '%v' : %v", name, err )
-      break
-    }
-  }
-  if message != "" { 
-    err = errors.New( message ) 
+  if problems := c.Validate( true ) ; len( problems ) > 0 {
+    err = problems
   }
   return err 
 }
@@ -191,10 +235,15 @@ func ( c *Conf ) PopulateDefaults( rootPath string ) bool {
   c.IncomingAdress = ConfIncomingAdressDefault
   c.IncomingPort = ConfIncomingPortDefault
   c.IncomingTLS = ConfIncomingTLSDefault 
+  c.IncomingTLSClientCA = ConfIncomingTLSClientCADefault
+  c.IncomingTLSClientAuth = ConfIncomingTLSClientAuthDefault
   c.DelayCleaningContainers = ConfDelayCleaningContainersDefault
   c.UI = uiTmpDir
   c.TmpDir = pathTmpDir
   c.Prefix = ConfPrefix
+  c.Persist = ConfPersistDefault
+  c.PersistBackups = ConfPersistBackupsDefault
+  c.HistorySize = history.HistorySizeDefault
   newMapRoutes := make( map[string]*itinerary.Route )
   newMapEnvironmentRoute := make( map[string]string )
   newMapEnvironmentRoute["faass-example"] = "true"
@@ -230,7 +279,8 @@ func ( c *Conf ) PopulateDefaults( rootPath string ) bool {
       Timeout : FunctionTimeoutDefault,
   }
   c.Routes = newMapRoutes
-  if err := c.Check() ; err != nil {
+  // the example function's script is created with the environment
+  if problems := c.Validate( false ) ; len( problems ) > 0 {
     return false 
   }
   return true
@@ -243,7 +293,29 @@ func ( c *Conf ) GetRoute( key string ) ( route *itinerary.Route, err error ) {
   return nil, errors.New( "unknow itinerary.Routes" )
 }
 
+func ( c *Conf ) JobsDir() string {
+  return filepath.Join( c.TmpDir, jobs.DirName )
+}
+
 func ( c *Conf ) Export( pathRoot string, reverseResolveAuth bool ) error {
+  v, err := c.Marshal( reverseResolveAuth )
+  if err != nil {
+    return err
+  }
+  if v, err = EncodeFormat( FormatOf( pathRoot ), v ) ; err != nil {
+    return errors.New( 
+      fmt.Sprintf( "export conf failed durint encoding step : %v", err ), 
+    )
+  }
+  if err := WriteFileAtomic( pathRoot, v, 0 ) ; err != nil {
+    return errors.New( 
+      fmt.Sprintf( "export conf failed durint writing step : %v", err ), 
+    )
+  }
+  return nil
+}
+
+func ( c *Conf ) Marshal( reverseResolveAuth bool ) ( []byte, error ) {
   newConfExport := Conf{}
   newConfExport.PathCmdContainer = c.PathCmdContainer
   newConfExport.Domain = c.Domain
@@ -252,24 +324,49 @@ func ( c *Conf ) Export( pathRoot string, reverseResolveAuth bool ) error {
     authTmp[key] = value
   }
   newConfExport.Authorizations = authTmp
-  fmt.Println( "c.AuthorizationAPIDefault", c.AuthorizationAPI, "----" )
-  fmt.Println( "c.AuthorizationAPIDefault", c.AuthorizationAPIDefault, "----" )
   if  reverseResolveAuth {
     newConfExport.AuthorizationAPI = c.AuthorizationAPIDefault
   } else {
     newConfExport.AuthorizationAPI = c.AuthorizationAPI
   }
+  if c.APIKeys != nil {
+    keysTmp := make( map[string]*auth.APIKey )
+    for key, value := range c.APIKeys {
+      keyTmp := *value
+      keysTmp[key] = &keyTmp
+    }
+    newConfExport.APIKeys = keysTmp
+  }
   newConfExport.IncomingAdress = c.IncomingAdress
   newConfExport.IncomingPort = c.IncomingPort
   newConfExport.IncomingTLS = c.IncomingTLS
+  newConfExport.IncomingTLSClientCA = c.IncomingTLSClientCA
+  newConfExport.IncomingTLSClientAuth = c.IncomingTLSClientAuth
+  newConfExport.Access.ACL = *c.Access.ACL.Copy()
+  newConfExport.Access.TrustedProxies = append( []string{}, c.Access.TrustedProxies... )
   newConfExport.DelayCleaningContainers = c.DelayCleaningContainers
   newConfExport.UI = c.UI
   newConfExport.TmpDir = c.TmpDir
   newConfExport.Prefix = c.Prefix
+  newConfExport.Persist = c.Persist
+  newConfExport.PersistBackups = c.PersistBackups
+  newConfExport.HistorySize = c.HistorySize
+  newConfExport.LogLevel = c.LogLevel
+  newConfExport.LogFormat = c.LogFormat
+  newConfExport.LogFile = c.LogFile
+  newConfExport.LogFileSize = c.LogFileSize
+  newConfExport.LogFileBackups = c.LogFileBackups
+  newConfExport.JobsWorkers = c.JobsWorkers
+  newConfExport.JobsRetention = c.JobsRetention
+  newConfExport.JobsTimeout = c.JobsTimeout
   routeTmp := make( map[string]*itinerary.Route ) 
+  newConfExport.RoutesDir = c.RoutesDir
   for key, value := range c.Routes {
+    if value.Source != "" {
+      continue
+    }
     if newRoute, err := value.Export( reverseResolveAuth ) ; err != nil {
-      return errors.New( 
+      return nil, errors.New( 
         fmt.Sprintf( "export conf failed durint Route '%v' copying : %v", key, err ), 
       )
     } else { 
@@ -279,24 +376,20 @@ func ( c *Conf ) Export( pathRoot string, reverseResolveAuth bool ) error {
   newConfExport.Routes = routeTmp
   v, err := json.Marshal( newConfExport )
   if err != nil {
-    return errors.New( 
+    return nil, errors.New( 
       fmt.Sprintf( "export conf failed durint Marshal step : %v", err ), 
     )
   }
-  jsonFileOutput, err := os.Create( pathRoot )
-  defer jsonFileOutput.Close()
+  value, err := DecodeFormat( FormatJSON, v )
   if err != nil {
-    return errors.New( 
-      fmt.Sprintf( "export conf failed durint opening step : %v", err ), 
-    )
+    return nil, err
   }
-  _, err = jsonFileOutput.Write( v )
-  if err != nil {
-    return errors.New( 
-      fmt.Sprintf( "export conf failed durint writing step : %v", err ), 
+  if v, err = json.Marshal( restoreTemplates( value, "", c.Templates ) ) ; err != nil {
+    return nil, errors.New( 
+      fmt.Sprintf( "export conf failed durint templates step : %v", err ), 
     )
   }
-  return nil
+  return v, nil
 }
 
 func ( c *Conf ) GetHead() map[string]map[string]interface{} {
@@ -357,10 +450,37 @@ func ( c *Conf ) GetHead() map[string]map[string]interface{} {
       "help" : "Separator between two parts \":\"", 
       "value": c.IncomingTLS,
     },
+    "IncomingTLSClientCA": map[string]interface{} { 
+      "default": ConfIncomingTLSClientCADefault, 
+      "type": "string", 
+      "realtype": "path", 
+      "edit": false,
+      "title": "Path of CA bundle for client certificates",
+      "help" : "PEM file ; needs TLS", 
+      "value": c.IncomingTLSClientCA,
+    },
+    "IncomingTLSClientAuth": map[string]interface{} { 
+      "default": ConfIncomingTLSClientAuthDefault, 
+      "type": "string", 
+      "realtype": "enum(none,request,require,verify-if-given,require-and-verify)", 
+      "edit": false,
+      "title": "Verify mode for client certificates",
+      "help" : "Routes with \"certificate\" authorization need a verified certificate", 
+      "value": c.IncomingTLSClientAuth,
+    },
+    "Access": map[string]interface{} { 
+      "default": network.Access{}, 
+      "type": "object", 
+      "realtype": "access(allow,deny,trustedproxies)", 
+      "edit": true,
+      "title": "Network access control",
+      "help" : "Lists of IP or CIDR ; deny is checked before allow", 
+      "value": c.Access,
+    },
     "DelayCleaningContainers": map[string]interface{} { 
       "default": ConfDelayCleaningContainersDefault, 
       "type": "number", 
-      "realtype": "range(5,60)", 
+      "realtype": "range(5,3600)", 
       "edit": true, 
       "title": "Delay",
       "help" : "", 
@@ -384,6 +504,114 @@ func ( c *Conf ) GetHead() map[string]map[string]interface{} {
       "help" : "Can be relative or absolute root ; no default value (system-dependent)", 
       "value": c.TmpDir,
     },
+    "Persist": map[string]interface{} { 
+      "default": ConfPersistDefault, 
+      "type": "boolean", 
+      "realtype": "boolean", 
+      "edit": true, 
+      "title": "Persist API changes in conf's file",
+      "help" : "Atomic write after every successful mutation", 
+      "value": c.Persist,
+    },
+    "PersistBackups": map[string]interface{} { 
+      "default": ConfPersistBackupsDefault, 
+      "type": "number", 
+      "realtype": "range(0,100)", 
+      "edit": true, 
+      "title": "Backups of conf's file kept",
+      "help" : "Previous versions kept as \"<conf>.<timestamp>.bak\"", 
+      "value": c.PersistBackups,
+    },
+    "HistorySize": map[string]interface{} { 
+      "default": history.HistorySizeDefault, 
+      "type": "number", 
+      "realtype": "range(0,1000)", 
+      "edit": true, 
+      "title": "Revisions kept in history",
+      "help" : "0 for the default size", 
+      "value": c.HistorySize,
+    },
+    "LogLevel": map[string]interface{} { 
+      "default": logger.LevelInfo, 
+      "type": "string", 
+      "realtype": "enum(debug,info,warning,error,panic)", 
+      "edit": true, 
+      "title": "Minimum level of logs",
+      "help" : "The flag \"-loglevel\" prevails", 
+      "value": c.LogLevel,
+    },
+    "LogFormat": map[string]interface{} { 
+      "default": logger.FormatText, 
+      "type": "string", 
+      "realtype": "enum(text,json,logfmt)", 
+      "edit": true, 
+      "title": "Format of logs",
+      "help" : "One record per line", 
+      "value": c.LogFormat,
+    },
+    "LogFile": map[string]interface{} { 
+      "default": nil, 
+      "type": "string", 
+      "realtype": "path", 
+      "edit": true, 
+      "title": "File of logs",
+      "help" : "Written in addition to the standard output ; empty for none", 
+      "value": c.LogFile,
+    },
+    "LogFileSize": map[string]interface{} { 
+      "default": logger.FileSizeDefault, 
+      "type": "number", 
+      "realtype": "range(0,1024)", 
+      "edit": true, 
+      "title": "Size of the file of logs (MB)",
+      "help" : "Rotated beyond ; 0 for the default", 
+      "value": c.LogFileSize,
+    },
+    "LogFileBackups": map[string]interface{} { 
+      "default": logger.FileBackupsDefault, 
+      "type": "number", 
+      "realtype": "range(0,100)", 
+      "edit": true, 
+      "title": "Files of logs rotated kept",
+      "help" : "As \"<file>.1\", \"<file>.2\"... ; 0 for the default", 
+      "value": c.LogFileBackups,
+    },
+    "JobsWorkers": map[string]interface{} { 
+      "default": jobs.WorkersDefault, 
+      "type": "number", 
+      "realtype": "range(0,64)", 
+      "edit": true, 
+      "title": "Workers of async requests",
+      "help" : "Jobs run at once ; 0 for the default", 
+      "value": c.JobsWorkers,
+    },
+    "JobsRetention": map[string]interface{} { 
+      "default": jobs.RetentionDefault, 
+      "type": "number", 
+      "realtype": "range(0,604800)", 
+      "edit": true, 
+      "title": "Retention of jobs (seconds)",
+      "help" : "Jobs and results kept once ended ; 0 for the default", 
+      "value": c.JobsRetention,
+    },
+    "JobsTimeout": map[string]interface{} { 
+      "default": 0, 
+      "type": "number", 
+      "realtype": "range(0,3600000)", 
+      "edit": true, 
+      "title": "Timeout of async requests (milliseconds)",
+      "help" : "Used when greater than the route's timeout ; 0 for the route's one", 
+      "value": c.JobsTimeout,
+    },
+    "RoutesDir": map[string]interface{} { 
+      "default": nil, 
+      "type": "string", 
+      "realtype": "path", 
+      "edit": false, 
+      "title": "Directory of declarative routes",
+      "help" : "One route per JSON or YAML file, named by the file ; watched and hot-applied", 
+      "value": c.RoutesDir,
+    },
     "Prefix": map[string]interface{} { 
       "default": ConfPrefixDefault, 
       "type": "string", 
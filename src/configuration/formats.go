@@ -0,0 +1,255 @@
+package configuration
+
+import(
+  "bytes"
+  "errors"
+  "os"
+  "io/ioutil"
+  "encoding/json"
+  "path/filepath"
+  "reflect"
+  "strconv"
+  "strings"
+  "fmt"
+  // -----------
+  "formats/yaml"
+  "formats/toml"
+)
+
+// -----------------------------------------------
+
+const (
+  FormatJSON                            = "json"
+  FormatYAML                            = "yaml"
+  FormatTOML                            = "toml"
+
+  InterpolationFileSuffix               = "_FILE"
+)
+
+// -----------------------------------------------
+
+// the format is given by the file's extension ; JSON by default
+func FormatOf( path string ) string {
+  switch strings.ToLower( filepath.Ext( path ) ) {
+  case ".yaml", ".yml":
+    return FormatYAML
+  case ".toml":
+    return FormatTOML
+  }
+  return FormatJSON
+}
+
+func DecodeFormat( format string, content []byte ) ( value interface{}, err error ) {
+  switch format {
+  case FormatYAML:
+    value, err = yaml.Decode( content )
+  case FormatTOML:
+    value, err = toml.Decode( content )
+  default:
+    decoder := json.NewDecoder( bytes.NewReader( content ) )
+    decoder.UseNumber()
+    err = decoder.Decode( &value )
+  }
+  return value, err
+}
+
+// content is the JSON given by Marshal
+func EncodeFormat( format string, content []byte ) ( []byte, error ) {
+  if format == FormatJSON {
+    return content, nil
+  }
+  value, err := DecodeFormat( FormatJSON, content )
+  if err != nil {
+    return nil, err
+  }
+  if format == FormatTOML {
+    return toml.Encode( value )
+  }
+  return yaml.Encode( value )
+}
+
+// -----------------------------------------------
+
+// "${VAR}", "${VAR:-default}" ; "$$" for a literal "$" ; when VAR is undefined,
+// "VAR_FILE" gives the path of a file holding the value (secrets mounted as files)
+func Interpolate( raw string ) ( string, error ) {
+  var builder strings.Builder
+  for i := 0 ; i < len( raw ) ; i++ {
+    if raw[i] != '$' || i+1 >= len( raw ) {
+      builder.WriteByte( raw[i] )
+      continue
+    }
+    switch raw[i+1] {
+    case '$':
+      builder.WriteByte( '$' )
+      i++
+      continue
+    case '{':
+    default:
+      builder.WriteByte( raw[i] )
+      continue
+    }
+    end := strings.IndexByte( raw[i:], '}' )
+    if end < 0 {
+      return "", errors.New( "unterminated variable in '"+raw+"'" )
+    }
+    expression := raw[i+2:i+end]
+    name, fallback, hasFallback := strings.Cut( expression, ":-" )
+    if name == "" {
+      return "", errors.New( "empty variable name in '"+raw+"'" )
+    }
+    value, err := lookupVariable( name )
+    if err != nil {
+      return "", err
+    }
+    if value == nil {
+      if hasFallback != true {
+        return "", errors.New( "variable '"+name+"' undefined" )
+      }
+      value = &fallback
+    }
+    builder.WriteString( *value )
+    i += end
+  }
+  return builder.String(), nil
+}
+
+func lookupVariable( name string ) ( *string, error ) {
+  if value, ok := os.LookupEnv( name ) ; ok {
+    return &value, nil
+  }
+  path, ok := os.LookupEnv( name+InterpolationFileSuffix )
+  if ok != true {
+    return nil, nil
+  }
+  content, err := ioutil.ReadFile( path )
+  if err != nil {
+    return nil, errors.New( fmt.Sprintf( "unable to read file of variable '%v' : %v", name, err ) )
+  }
+  value := strings.TrimRight( string( content ), "\r\n" )
+  return &value, nil
+}
+
+// -----------------------------------------------
+
+// the raw value of an interpolated string, found by its JSON pointer in the conf
+type Template struct {
+  Raw string
+  Value string
+}
+
+func pointerToken( key string ) string {
+  return strings.ReplaceAll( strings.ReplaceAll( key, "~", "~0" ), "/", "~1" )
+}
+
+// only strings are interpolated (not the keys) ; raw values are kept by pointer
+func interpolateTree( value interface{}, pointer string, templates map[string]Template ) ( interface{}, error ) {
+  switch v := value.( type ) {
+  case string:
+    if strings.Contains( v, "$" ) != true {
+      return v, nil
+    }
+    result, err := Interpolate( v )
+    if err != nil {
+      return nil, errors.New( fmt.Sprintf( "interpolation of '%v' failed : %v", pointer, err ) )
+    }
+    if templates != nil {
+      templates[pointer] = Template { Raw: v, Value: result }
+    }
+    return result, nil
+  case map[string]interface{}:
+    for key, child := range v {
+      result, err := interpolateTree( child, pointer+"/"+pointerToken( key ), templates )
+      if err != nil {
+        return nil, err
+      }
+      v[key] = result
+    }
+  case []interface{}:
+    for i, child := range v {
+      result, err := interpolateTree( child, pointer+"/"+strconv.Itoa( i ), templates )
+      if err != nil {
+        return nil, err
+      }
+      v[i] = result
+    }
+  }
+  return value, nil
+}
+
+// a raw value is given back while the interpolated one is unchanged : exports
+// don't disclose the secrets coming from the environment
+func restoreTemplates( value interface{}, pointer string, templates map[string]Template ) interface{} {
+  switch v := value.( type ) {
+  case string:
+    if template, ok := templates[pointer] ; ok && template.Value == v {
+      return template.Raw
+    }
+    if strings.Contains( v, "$" ) {
+      // a literal "$" must survive the next import
+      return strings.ReplaceAll( v, "$", "$$" )
+    }
+  case map[string]interface{}:
+    for key, child := range v {
+      v[key] = restoreTemplates( child, pointer+"/"+pointerToken( key ), templates )
+    }
+  case []interface{}:
+    for i, child := range v {
+      v[i] = restoreTemplates( child, pointer+"/"+strconv.Itoa( i ), templates )
+    }
+  }
+  return value
+}
+
+// the strings of a patched document which differ from the original one (at the
+// same pointer) get their "$" escaped : only the conf's files are interpolated, 
+// a content given through the API is taken literally 
+func EscapeChanges( original interface{}, patched interface{} ) interface{} {
+  switch v := patched.( type ) {
+  case string:
+    if o, ok := original.( string ) ; ok && o == v {
+      return v
+    }
+    return strings.ReplaceAll( v, "$", "$$" )
+  case map[string]interface{}:
+    o, _ := original.( map[string]interface{} )
+    for key, child := range v {
+      v[key] = EscapeChanges( o[key], child )
+    }
+  case []interface{}:
+    o, _ := original.( []interface{} )
+    for i, child := range v {
+      var originalChild interface{}
+      if i < len( o ) {
+        originalChild = o[i]
+      }
+      v[i] = EscapeChanges( originalChild, child )
+    }
+  }
+  return patched
+}
+
+// decoding, interpolation then standard JSON unmarshalling (json tags are the
+// only mapping, for every format) ; the unknown fields are given as Problems, 
+// after the unmarshalling 
+func Unmarshal( format string, content []byte, v interface{}, templates map[string]Template ) error {
+  value, err := DecodeFormat( format, content )
+  if err != nil {
+    return err
+  }
+  value, err = interpolateTree( value, "", templates )
+  if err != nil {
+    return err
+  }
+  content, err = json.Marshal( value )
+  if err != nil {
+    return err
+  }
+  if err := json.Unmarshal( content, v ) ; err != nil {
+    return err
+  }
+  if problems := unknownFields( value, reflect.TypeOf( v ), "" ) ; len( problems ) > 0 {
+    return problems
+  }
+  return nil
+}
@@ -0,0 +1,68 @@
+package configuration
+
+import (
+  "io/ioutil"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestInterpolate( t *testing.T ) {
+  dir := t.TempDir()
+  secretPath := filepath.Join( dir, "secret" )
+  if err := ioutil.WriteFile( secretPath, []byte( "Basic c2VjcmV0\n" ), 0600 ) ; err != nil {
+    t.Fatal( err )
+  }
+  t.Setenv( "FAASS_TEST_DOMAIN", "example.org" )
+  t.Setenv( "FAASS_TEST_AUTH_FILE", secretPath )
+  for raw, expected := range map[string]string {
+    "https://${FAASS_TEST_DOMAIN}": "https://example.org",
+    "${FAASS_TEST_UNDEFINED:-9090}": "9090",
+    "${FAASS_TEST_AUTH}": "Basic c2VjcmV0",
+    "$$HOME and $PATH": "$HOME and $PATH",
+  } {
+    if value, err := Interpolate( raw ) ; err != nil || value != expected {
+      t.Errorf( "'%v' : '%v' expected, found '%v' (%v)", raw, expected, value, err )
+    }
+  }
+  for _, raw := range []string{ "${FAASS_TEST_UNDEFINED}", "${FAASS_TEST_DOMAIN", "${}" } {
+    if _, err := Interpolate( raw ) ; err == nil {
+      t.Errorf( "error expected for '%v'", raw )
+    }
+  }
+}
+
+func TestImportExportFormats( t *testing.T ) {
+  t.Setenv( "FAASS_TEST_AUTH", "Basic c2VjcmV0" )
+  for _, name := range []string{ "conf.yaml", "conf.toml", "conf.json" } {
+    confPath := filepath.Join( t.TempDir(), name )
+    source := Conf{}
+    if !source.PopulateDefaults( filepath.Dir( confPath ) ) {
+      t.Fatal( "defaults invalid" )
+    }
+    source.Authorizations["default"] = "Basic c2VjcmV0"
+    source.Templates = map[string]Template {
+      "/authorizations/default": Template { Raw: "${FAASS_TEST_AUTH}", Value: "Basic c2VjcmV0" },
+    }
+    if err := source.Export( confPath, false ) ; err != nil {
+      t.Fatalf( "%v : %v", name, err )
+    }
+    imported := Conf{}
+    if err := Import( confPath, &imported ) ; err != nil {
+      t.Fatalf( "%v : %v", name, err )
+    }
+    if imported.Authorizations["default"] != "Basic c2VjcmV0" {
+      t.Errorf( "%v : secret not interpolated, found '%v'", name, imported.Authorizations["default"] )
+    }
+    if imported.Routes["example-function"] == nil || imported.Routes["example-function"].ScriptCmd[0] != "python3" {
+      t.Errorf( "%v : routes not imported", name )
+    }
+    if err := imported.Export( confPath, false ) ; err != nil {
+      t.Fatalf( "%v : %v", name, err )
+    }
+    content, _ := ioutil.ReadFile( confPath )
+    if strings.Contains( string( content ), "c2VjcmV0" ) || strings.Contains( string( content ), "${FAASS_TEST_AUTH}" ) != true {
+      t.Errorf( "%v : secret exported instead of its reference :\n%s", name, content )
+    }
+  }
+}
@@ -0,0 +1,176 @@
+package history
+
+import (
+  "encoding/json"
+  "reflect"
+  "sort"
+  "strings"
+  "sync"
+  "time"
+  // -----------
+)
+
+// -----------------------------------------------
+
+const (
+  HistorySizeDefault                    = 50
+  HistorySizeMax                        = 1000
+
+  PrincipalSystem                       = "system"
+
+  ChangeAdded                           = "added"
+  ChangeRemoved                         = "removed"
+  ChangeModified                        = "modified"
+)
+
+// -----------------------------------------------
+
+type Revision struct {
+  Id int `json:"id"`
+  Time time.Time `json:"time"`
+  Principal string `json:"principal"`
+  Summary string `json:"summary"`
+  Content json.RawMessage `json:"content,omitempty"`
+}
+
+// the oldest revisions are dropped when the size is reached ; ids never restart 
+type History struct {
+  mutex sync.RWMutex
+  size int
+  lastId int
+  revisions []*Revision
+}
+
+func New( size int ) *History {
+  history := &History{}
+  history.Resize( size )
+  return history
+}
+
+func ( history *History ) Resize( size int ) {
+  history.mutex.Lock()
+  defer history.mutex.Unlock()
+  if size < 1 {
+    size = HistorySizeDefault
+  }
+  history.size = size
+  history.truncate()
+}
+
+func ( history *History ) truncate() {
+  if len( history.revisions ) > history.size {
+    history.revisions = history.revisions[len( history.revisions )-history.size:]
+  }
+}
+
+func ( history *History ) Record( principal string, summary string, content []byte ) Revision {
+  history.mutex.Lock()
+  defer history.mutex.Unlock()
+  history.lastId++
+  revision := &Revision {
+    Id: history.lastId,
+    Time: time.Now(),
+    Principal: principal,
+    Summary: summary,
+    Content: append( json.RawMessage{}, content... ),
+  }
+  history.revisions = append( history.revisions, revision )
+  history.truncate()
+  return *revision
+}
+
+// revisions without content, oldest first 
+func ( history *History ) List() []Revision {
+  history.mutex.RLock()
+  defer history.mutex.RUnlock()
+  list := make( []Revision, 0, len( history.revisions ) )
+  for _, revision := range history.revisions {
+    list = append( list, Revision {
+      Id: revision.Id,
+      Time: revision.Time,
+      Principal: revision.Principal,
+      Summary: revision.Summary,
+    } )
+  }
+  return list
+}
+
+func ( history *History ) Get( id int ) ( Revision, bool ) {
+  history.mutex.RLock()
+  defer history.mutex.RUnlock()
+  for _, revision := range history.revisions {
+    if revision.Id == id {
+      return *revision, true
+    }
+  }
+  return Revision{}, false
+}
+
+func ( history *History ) Last() ( Revision, bool ) {
+  history.mutex.RLock()
+  defer history.mutex.RUnlock()
+  if len( history.revisions ) == 0 {
+    return Revision{}, false
+  }
+  return *history.revisions[len( history.revisions )-1], true
+}
+
+// -----------------------------------------------
+
+// paths are JSON pointers (RFC 6901) ; arrays are compared as a whole 
+type Change struct {
+  Path string `json:"path"`
+  Type string `json:"type"`
+  Old interface{} `json:"old,omitempty"`
+  New interface{} `json:"new,omitempty"`
+}
+
+func escapePointer( key string ) string {
+  return strings.ReplaceAll( strings.ReplaceAll( key, "~", "~0" ), "/", "~1" )
+}
+
+func diffValues( path string, oldValue interface{}, newValue interface{}, changes []Change ) []Change {
+  oldMap, oldIsMap := oldValue.( map[string]interface{} )
+  newMap, newIsMap := newValue.( map[string]interface{} )
+  if oldIsMap && newIsMap {
+    keys := []string{}
+    for key := range oldMap {
+      keys = append( keys, key )
+    }
+    for key := range newMap {
+      if _, ok := oldMap[key] ; !ok {
+        keys = append( keys, key )
+      }
+    }
+    sort.Strings( keys )
+    for _, key := range keys {
+      subPath := path+"/"+escapePointer( key )
+      oldSub, oldOk := oldMap[key]
+      newSub, newOk := newMap[key]
+      switch {
+      case oldOk && !newOk:
+        changes = append( changes, Change { Path: subPath, Type: ChangeRemoved, Old: oldSub } )
+      case !oldOk && newOk:
+        changes = append( changes, Change { Path: subPath, Type: ChangeAdded, New: newSub } )
+      default:
+        changes = diffValues( subPath, oldSub, newSub, changes )
+      }
+    }
+    return changes
+  }
+  if reflect.DeepEqual( oldValue, newValue ) != true {
+    changes = append( changes, Change { Path: path, Type: ChangeModified, Old: oldValue, New: newValue } )
+  }
+  return changes
+}
+
+func Diff( oldContent []byte, newContent []byte ) ( []Change, error ) {
+  var oldValue, newValue interface{}
+  if err := json.Unmarshal( oldContent, &oldValue ) ; err != nil {
+    return nil, err
+  }
+  if err := json.Unmarshal( newContent, &newValue ) ; err != nil {
+    return nil, err
+  }
+  return diffValues( "", oldValue, newValue, []Change{} ), nil
+}
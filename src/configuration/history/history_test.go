@@ -0,0 +1,42 @@
+package history
+
+import (
+  "testing"
+)
+
+func TestHistoryBounded( t *testing.T ) {
+  history := New( 2 )
+  for _, summary := range []string{ "a", "b", "c" } {
+    history.Record( PrincipalSystem, summary, []byte( `{}` ) )
+  }
+  list := history.List()
+  if len( list ) != 2 || list[0].Id != 2 || list[1].Summary != "c" {
+    t.Fatalf( "unexpected revisions : %+v", list )
+  }
+  if _, ok := history.Get( 1 ) ; ok {
+    t.Error( "dropped revision still available" )
+  }
+}
+
+func TestDiff( t *testing.T ) {
+  changes, err := Diff( 
+    []byte( `{"delay":60,"routes":{"a/b":{"timeout":10},"old":{}}}` ), 
+    []byte( `{"delay":90,"routes":{"a/b":{"timeout":10},"new":{}}}` ), 
+  )
+  if err != nil {
+    t.Fatal( err )
+  }
+  expected := []Change {
+    { Path: "/delay", Type: ChangeModified },
+    { Path: "/routes/new", Type: ChangeAdded },
+    { Path: "/routes/old", Type: ChangeRemoved },
+  }
+  if len( changes ) != len( expected ) {
+    t.Fatalf( "unexpected changes : %+v", changes )
+  }
+  for i := range expected {
+    if changes[i].Path != expected[i].Path || changes[i].Type != expected[i].Type {
+      t.Errorf( "change %v : %+v (expected %+v)", i, changes[i], expected[i] )
+    }
+  }
+}
@@ -0,0 +1,156 @@
+package configuration
+
+import(
+  "errors"
+  "os"
+  "io"
+  "path/filepath"
+  "sort"
+  "time"
+  "fmt"
+  // -----------
+  "configuration/history"
+)
+
+// -----------------------------------------------
+
+const (
+  PersistBackupSuffix                   = ".bak"
+  PersistTmpSuffix                      = ".tmp"
+)
+
+// -----------------------------------------------
+
+func copyFile( source string, destination string ) error {
+  input, err := os.Open( source )
+  if err != nil {
+    return err
+  }
+  defer input.Close()
+  output, err := os.Create( destination )
+  if err != nil {
+    return err
+  }
+  if _, err := io.Copy( output, input ) ; err != nil {
+    output.Close()
+    return err
+  }
+  if err := output.Sync() ; err != nil {
+    output.Close()
+    return err
+  }
+  return output.Close()
+}
+
+func rotateBackups( pathRoot string, backups int ) error {
+  matches, err := filepath.Glob( pathRoot+".*"+PersistBackupSuffix )
+  if err != nil {
+    return err
+  }
+  sort.Strings( matches )
+  for len( matches ) > backups {
+    if err := os.Remove( matches[0] ) ; err != nil {
+      return err
+    }
+    matches = matches[1:]
+  }
+  return nil
+}
+
+// the content is written in a temporary file of the same directory, synced, 
+// then renamed on the destination : a reader sees the old or the new file, never 
+// a partial one ; with backups > 0, the previous version is copied before 
+func WriteFileAtomic( pathRoot string, content []byte, backups int ) error {
+  dir := filepath.Dir( pathRoot )
+  if backups > 0 {
+    if _, err := os.Stat( pathRoot ) ; err == nil {
+      backupPath := fmt.Sprintf( 
+        "%v.%v%v", 
+        pathRoot, 
+        time.Now().UTC().Format( "20060102T150405.000000000" ), 
+        PersistBackupSuffix, 
+      )
+      if err := copyFile( pathRoot, backupPath ) ; err != nil {
+        return errors.New( fmt.Sprintf( "backup failed : %v", err ) )
+      }
+      if err := rotateBackups( pathRoot, backups ) ; err != nil {
+        return errors.New( fmt.Sprintf( "backups rotation failed : %v", err ) )
+      }
+    }
+  }
+  tmpFile, err := os.CreateTemp( dir, filepath.Base( pathRoot )+".*"+PersistTmpSuffix )
+  if err != nil {
+    return err
+  }
+  tmpPath := tmpFile.Name()
+  defer os.Remove( tmpPath )
+  if _, err := tmpFile.Write( content ) ; err != nil {
+    tmpFile.Close()
+    return err
+  }
+  if err := tmpFile.Sync() ; err != nil {
+    tmpFile.Close()
+    return err
+  }
+  if err := tmpFile.Close() ; err != nil {
+    return err
+  }
+  if info, err := os.Stat( pathRoot ) ; err == nil {
+    os.Chmod( tmpPath, info.Mode() )
+  }
+  if err := os.Rename( tmpPath, pathRoot ) ; err != nil {
+    return err
+  }
+  dirFile, err := os.Open( dir )
+  if err != nil {
+    return err
+  }
+  defer dirFile.Close()
+  return dirFile.Sync()
+}
+
+// -----------------------------------------------
+
+// to call with the conf's mutex held, after every successful mutation 
+func ( c *Conf ) Save() error {
+  if c.Persist != true || c.Path == "" {
+    return nil
+  }
+  content, err := c.Marshal( true )
+  if err != nil {
+    return err
+  }
+  if content, err = EncodeFormat( FormatOf( c.Path ), content ) ; err != nil {
+    return errors.New( 
+      fmt.Sprintf( "persist conf failed : %v", err ), 
+    )
+  }
+  if err := WriteFileAtomic( c.Path, content, c.PersistBackups ) ; err != nil {
+    return errors.New( 
+      fmt.Sprintf( "persist conf failed : %v", err ), 
+    )
+  }
+  return nil
+}
+
+// the revision is recorded before the save : an API change not persisted still 
+// appears in history 
+func ( c *Conf ) Record( principal string, summary string ) ( history.Revision, error ) {
+  content, err := c.Marshal( true )
+  if err != nil {
+    return history.Revision{}, err
+  }
+  if c.History == nil {
+    c.History = history.New( c.HistorySize )
+  }
+  return c.History.Record( principal, summary, content ), nil
+}
+
+func ( c *Conf ) Commit( principal string, summary string ) error {
+  if _, err := c.Record( principal, summary ) ; err != nil {
+    return errors.New( 
+      fmt.Sprintf( "record conf failed : %v", err ), 
+    )
+  }
+  return c.Save()
+}
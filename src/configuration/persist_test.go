@@ -0,0 +1,31 @@
+package configuration
+
+import (
+  "io/ioutil"
+  "path/filepath"
+  "testing"
+)
+
+func TestWriteFileAtomicBackups( t *testing.T ) {
+  dir := t.TempDir()
+  confPath := filepath.Join( dir, "conf.json" )
+  for _, content := range []string{ "v1", "v2", "v3", "v4" } {
+    if err := WriteFileAtomic( confPath, []byte( content ), 2 ) ; err != nil {
+      t.Fatal( err )
+    }
+  }
+  content, err := ioutil.ReadFile( confPath )
+  if err != nil || string( content ) != "v4" {
+    t.Fatalf( "last version expected, found '%s' (%v)", content, err )
+  }
+  backups, _ := filepath.Glob( confPath+".*"+PersistBackupSuffix )
+  if len( backups ) != 2 {
+    t.Fatalf( "2 backups expected, found %v", len( backups ) )
+  }
+  if content, _ := ioutil.ReadFile( backups[1] ) ; string( content ) != "v3" {
+    t.Errorf( "newest backup must be previous version, found '%s'", content )
+  }
+  if tmp, _ := filepath.Glob( filepath.Join( dir, "*"+PersistTmpSuffix ) ) ; len( tmp ) != 0 {
+    t.Errorf( "temporary files left : %v", tmp )
+  }
+}
@@ -0,0 +1,112 @@
+package configuration
+
+import(
+  "errors"
+  "os"
+  "io/ioutil"
+  "path/filepath"
+  "regexp"
+  "strings"
+  "fmt"
+  // -----------
+  "itinerary"
+)
+
+// -----------------------------------------------
+
+var routeFileNameRegex = regexp.MustCompile( "^[a-z0-9_-]+$" )
+
+func IsRouteFile( path string ) bool {
+  base := filepath.Base( path )
+  if strings.HasPrefix( base, "." ) {
+    return false
+  }
+  switch strings.ToLower( filepath.Ext( base ) ) {
+  case ".json", ".yaml", ".yml", ".toml":
+    return true
+  }
+  return false
+}
+
+func ReadRouteFile( path string ) ( name string, route *itinerary.Route, err error ) {
+  ext := filepath.Ext( path )
+  name = strings.TrimSuffix( filepath.Base( path ), ext )
+  if routeFileNameRegex.MatchString( name ) != true {
+    return name, nil, errors.New( "route's name (file name) invalid" )
+  }
+  content, err := ioutil.ReadFile( path )
+  if err != nil {
+    return name, nil, err
+  }
+  route = &itinerary.Route{}
+  if err := Unmarshal( FormatOf( path ), content, route, nil ) ; err != nil {
+    return name, nil, errors.New( fmt.Sprintf( "unable to parse : %v", err ) )
+  }
+  if route.Name == "" {
+    route.Name = name
+  }
+  if err := route.Check() ; err != nil {
+    return name, nil, err
+  }
+  route.Source = path
+  return name, route, nil
+}
+
+// one route per file, named by the file ; a route can't be defined both in the 
+// directory and in the conf's file 
+func ( c *Conf ) LoadRoutesDir() error {
+  if c.RoutesDir == "" {
+    return nil
+  }
+  entries, err := os.ReadDir( c.RoutesDir )
+  if err != nil {
+    return errors.New( fmt.Sprintf( "unable to read routes dir : %v", err ) )
+  }
+  if c.Routes == nil {
+    c.Routes = make( map[string]*itinerary.Route )
+  }
+  for _, entry := range entries {
+    path := filepath.Join( c.RoutesDir, entry.Name() )
+    if entry.IsDir() || IsRouteFile( path ) != true {
+      continue
+    }
+    name, route, err := ReadRouteFile( path )
+    if err != nil {
+      return errors.New( fmt.Sprintf( "bad route file '%v' : %v", path, err ) )
+    }
+    if existing, ok := c.Routes[name] ; ok {
+      if existing.Source != "" {
+        return errors.New( fmt.Sprintf( "route '%v' defined twice in routes dir ('%v' and '%v')", name, existing.Source, path ) )
+      }
+      return errors.New( fmt.Sprintf( "route '%v' defined both in conf and routes dir ('%v')", name, path ) )
+    }
+    c.Routes[name] = route
+  }
+  return nil
+}
+
+// the routes of the directory as loaded by another conf, without reading it 
+// again : copies (references, not secrets), to check and resolve as read
+func ( c *Conf ) AdoptRoutesDir( from *Conf ) error {
+  if c.Routes == nil {
+    c.Routes = make( map[string]*itinerary.Route )
+  }
+  for name, route := range from.Routes {
+    if route.Source == "" {
+      continue
+    }
+    if _, ok := c.Routes[name] ; ok {
+      return errors.New( fmt.Sprintf( "route '%v' defined both in conf and routes dir ('%v')", name, route.Source ) )
+    }
+    copied, err := route.Export( true )
+    if err != nil {
+      return err
+    }
+    if err := copied.Check() ; err != nil {
+      return err
+    }
+    copied.Source = route.Source
+    c.Routes[name] = &copied
+  }
+  return nil
+}
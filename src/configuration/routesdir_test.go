@@ -0,0 +1,33 @@
+package configuration
+
+import (
+  "io/ioutil"
+  "path/filepath"
+  "testing"
+  // -----------
+  "itinerary"
+)
+
+func TestAdoptRoutesDir( t *testing.T ) {
+  dir := t.TempDir()
+  content := `{ "type": "shell", "script": "/bin/true", "timeout": 1000, "authorization": "default" }`
+  if err := ioutil.WriteFile( filepath.Join( dir, "hello.json" ), []byte( content ), 0600 ) ; err != nil {
+    t.Fatal( err )
+  }
+  from := Conf { RoutesDir: dir }
+  if err := from.LoadRoutesDir() ; err != nil {
+    t.Fatal( err )
+  }
+  c := Conf{}
+  if err := c.AdoptRoutesDir( &from ) ; err != nil {
+    t.Fatal( err )
+  }
+  route := c.Routes["hello"]
+  if route == nil || route == from.Routes["hello"] || route.Source != from.Routes["hello"].Source || route.TypeNum != itinerary.RouteTypeShell {
+    t.Errorf( "a checked copy expected : %+v", route )
+  }
+  c = Conf { Routes: map[string]*itinerary.Route { "hello": &itinerary.Route{} } }
+  if err := c.AdoptRoutesDir( &from ) ; err == nil {
+    t.Error( "a route both in conf and routes dir must be refused" )
+  }
+}
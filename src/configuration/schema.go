@@ -0,0 +1,169 @@
+package configuration
+
+import(
+  "reflect"
+  "strconv"
+  "strings"
+  "time"
+  // -----------
+  "itinerary"
+)
+
+// -----------------------------------------------
+
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// -----------------------------------------------
+
+// the JSON Schema of the conf is generated from the json tags and completed by
+// the heads (title, help, default, edit, realtype) ; routes are given in $defs
+func Schema() map[string]interface{} {
+  schema := objectSchema( reflect.TypeOf( Conf{} ), ( &Conf{} ).GetHead() )
+  schema["$schema"] = SchemaDialect
+  schema["title"] = "faass configuration"
+  schema["$defs"] = map[string]interface{} {
+    "route": objectSchema( reflect.TypeOf( itinerary.Route{} ), ( &itinerary.Route{} ).GetHead() ),
+  }
+  properties := schema["properties"].( map[string]interface{} )
+  properties["routes"] = map[string]interface{} {
+    "type": []string{ "object", "null" },
+    "propertyNames": map[string]interface{}{ "pattern": routeKeyRegex.String() },
+    "additionalProperties": map[string]interface{}{ "$ref": "#/$defs/route" },
+  }
+  return schema
+}
+
+func RouteSchema() map[string]interface{} {
+  schema := objectSchema( reflect.TypeOf( itinerary.Route{} ), ( &itinerary.Route{} ).GetHead() )
+  schema["$schema"] = SchemaDialect
+  schema["title"] = "faass route"
+  return schema
+}
+
+// -----------------------------------------------
+
+func nullable( schema map[string]interface{} ) map[string]interface{} {
+  if kind, ok := schema["type"].( string ) ; ok {
+    schema["type"] = []string{ kind, "null" }
+  }
+  return schema
+}
+
+func typeSchema( t reflect.Type ) map[string]interface{} {
+  if t.Kind() == reflect.Ptr {
+    return nullable( typeSchema( t.Elem() ) )
+  }
+  if t == reflect.TypeOf( time.Time{} ) {
+    return map[string]interface{}{ "type": "string", "format": "date-time" }
+  }
+  if reflect.PtrTo( t ).Implements( unmarshalerType ) {
+    return map[string]interface{}{}
+  }
+  switch t.Kind() {
+  case reflect.String:
+    return map[string]interface{}{ "type": "string" }
+  case reflect.Bool:
+    return map[string]interface{}{ "type": "boolean" }
+  case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, 
+    reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+    return map[string]interface{}{ "type": "integer" }
+  case reflect.Float32, reflect.Float64:
+    return map[string]interface{}{ "type": "number" }
+  case reflect.Slice, reflect.Array:
+    return map[string]interface{}{ "type": []string{ "array", "null" }, "items": typeSchema( t.Elem() ) }
+  case reflect.Map:
+    return map[string]interface{}{ "type": []string{ "object", "null" }, "additionalProperties": typeSchema( t.Elem() ) }
+  case reflect.Struct:
+    return objectSchema( t, nil )
+  }
+  return map[string]interface{}{}
+}
+
+// "range(min,max)" (bounds optional) and "enum(a,b)" of the heads are constraints
+func realtypeConstraints( schema map[string]interface{}, realtype string ) {
+  open := strings.IndexByte( realtype, '(' )
+  if open < 0 || strings.HasSuffix( realtype, ")" ) != true {
+    return
+  }
+  values := strings.Split( realtype[open+1:len( realtype )-1], "," )
+  switch realtype[:open] {
+  case "range":
+    if len( values ) != 2 {
+      return
+    }
+    for i, keyword := range []string{ "minimum", "maximum" } {
+      if bound, err := strconv.Atoi( values[i] ) ; err == nil {
+        schema[keyword] = bound
+      }
+    }
+  case "enum":
+    schema["enum"] = values
+  }
+}
+
+// fields out of the head, or not editable, are read-only
+func objectSchema( t reflect.Type, head map[string]map[string]interface{} ) map[string]interface{} {
+  properties := map[string]interface{}{}
+  for _, field := range structFields( t ) {
+    schema := typeSchema( field.Type )
+    description, ok := head[field.GoName]
+    if ok {
+      schema["title"] = description["title"]
+      if help, _ := description["help"].( string ) ; help != "" {
+        schema["description"] = help
+      }
+      if description["default"] != nil {
+        schema["default"] = description["default"]
+      }
+      if realtype, ok := description["realtype"].( string ) ; ok {
+        realtypeConstraints( schema, realtype )
+      }
+    }
+    if head != nil && ( ok != true || description["edit"] != true ) {
+      schema["readOnly"] = true
+    }
+    properties[field.Name] = schema
+  }
+  return map[string]interface{} {
+    "type": "object",
+    "properties": properties,
+    "additionalProperties": false,
+  }
+}
+
+// -----------------------------------------------
+
+// a change at this JSON pointer of the conf is allowed through the API : fields 
+// with "edit" in the heads, and routes (created, removed or edited by field)
+func Editable( pointer string ) bool {
+  tokens := strings.Split( strings.TrimPrefix( pointer, "/" ), "/" )
+  for i := range tokens {
+    tokens[i] = strings.ReplaceAll( strings.ReplaceAll( tokens[i], "~1", "/" ), "~0", "~" )
+  }
+  if tokens[0] == "routes" {
+    if len( tokens ) <= 2 {
+      return true
+    }
+    return editableField( reflect.TypeOf( itinerary.Route{} ), ( &itinerary.Route{} ).GetHead(), tokens[2] )
+  }
+  return editableField( reflect.TypeOf( Conf{} ), ( &Conf{} ).GetHead(), tokens[0] )
+}
+
+func editableField( t reflect.Type, head map[string]map[string]interface{}, name string ) bool {
+  for _, field := range structFields( t ) {
+    if field.Name == name {
+      return head[field.GoName]["edit"] == true
+    }
+  }
+  return false
+}
+
+// json name of a conf's field, by its name in the heads
+func FieldName( goName string ) ( string, bool ) {
+  for _, field := range structFields( reflect.TypeOf( Conf{} ) ) {
+    if field.GoName == goName {
+      return field.Name, true
+    }
+  }
+  return "", false
+}
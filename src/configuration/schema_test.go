@@ -0,0 +1,31 @@
+package configuration
+
+import (
+  "testing"
+)
+
+func TestSchemaAndEditable( t *testing.T ) {
+  properties := Schema()["properties"].( map[string]interface{} )
+  delay := properties["delay"].( map[string]interface{} )
+  if delay["minimum"] != ConfDelayCleaningContainersMin || delay["maximum"] != ConfDelayCleaningContainersMax || delay["readOnly"] != nil {
+    t.Errorf( "unexpected schema for delay : %v", delay )
+  }
+  if properties["listen"].( map[string]interface{} )["readOnly"] != true {
+    t.Error( "listen must be read-only" )
+  }
+  if _, ok := properties["Logger"] ; ok {
+    t.Error( "fields without json must not be in schema" )
+  }
+  for pointer, editable := range map[string]bool {
+    "/delay": true,
+    "/listen": false,
+    "/authorizations/default": false,
+    "/routes/new": true,
+    "/routes/a/env/MODE": true,
+    "/routes/a/unknown": false,
+  } {
+    if Editable( pointer ) != editable {
+      t.Errorf( "'%v' : editable %v expected", pointer, editable )
+    }
+  }
+}
@@ -1,9 +1,12 @@
 package utils
 
 import (
+  "bytes"
+  "encoding/json"
   "os"
   "path/filepath"
   "regexp"
+  "strings"
   "errors"
   "flag"
   "time"
@@ -12,10 +15,24 @@ import (
   "sync"
   "os/exec"
   // -----------
+  "artifacts"
+  "builder"
   "logger"
+  "itinerary"
+  "jobs"
+  "events"
+  "schedule"
+  "triggers"
   "configuration"
+  "configuration/history"
+  "watcher"
 )
 
+const RoutesDirDebounce = 500 * time.Millisecond
+
+// the level given by the flag, prevailing on the conf's one (reloads too)
+var LogLevelFlag string
+
 // -----------------------------------------------
 
 func CreateRegexUrl() *regexp.Regexp {
@@ -46,7 +63,7 @@ func CreateEnv( pathExport string ) ( bool, string ) {
     return false, fmt.Sprintf( "Unable to export environment's conf" )
   }
   if err := newConf.Export( pathExport, false ) ; err != nil {
-    return false, fmt.Sprintf( "Unable to export environment's conf :", err )
+    return false, fmt.Sprintf( "Unable to export environment's conf : %v", err )
   }
   if err := os.Mkdir( newConf.UI, os.ModePerm ); err != nil {
     return false, fmt.Sprintf( "Unable to create environment for UI contents \"%v\" : %v ; pass", newConf.UI, err )
@@ -59,17 +76,19 @@ func CreateEnv( pathExport string ) ( bool, string ) {
 
 func StartEnv( globalConfMutex *sync.RWMutex, globalConfPath *string, globalConf *configuration.Conf, logger *logger.Logger ) {
   testLogger := flag.String( "testlogger", "", "test logger (value of print ; string)" ) 
-  confPath := flag.String( "conf", "./conf.json", "path to conf (JSON ; string)" ) 
+  confPath := flag.String( "conf", "./conf.json", "path to conf (JSON, YAML or TOML by extension ; string)" ) 
   prepareEnv := flag.Bool( "prepare", false, "create environment (conf+dir ; bool)" )
+  checkConf := flag.Bool( "check", false, "validate conf, print all problems and exit (bool)" )
   pullImageContainer := flag.Bool( "pulling", false, "pull image's containers (bool)" )
   pullImageContainerOnly := flag.Bool( "pulling-only", false, "pull image's containers and exit (bool)" )
+  flag.StringVar( &LogLevelFlag, "loglevel", "", "minimum level of logs, prevailing on the conf (debug, info, warning, error or panic ; string)" )
   flag.Parse()
   if *testLogger != "" {
     logger.Test( *testLogger ) 
   }
   globalConfMutex.Lock() 
   defer globalConfMutex.Unlock() 
-  globalConfPath = confPath
+  *globalConfPath = *confPath
   if *prepareEnv {
     if state, mError := CreateEnv( *globalConfPath ) ; state {
       os.Exit( configuration.ExitOk )
@@ -78,21 +97,19 @@ func StartEnv( globalConfMutex *sync.RWMutex, globalConfPath *string, globalConf
       os.Exit( configuration.ExitConfCreateKo )
     }
   }
-  err := configuration.Import( *globalConfPath, globalConf )  
-  if err != nil {
-    logger.Panicf( "unable to load configuration with error : %v", err )
+  if *checkConf {
+    os.Exit( CheckConf( *globalConfPath ) )
+  }
+  if exitCode, err := LoadConf( *globalConfPath, globalConf, logger ) ; err != nil {
+    logger.Panicf( "%v", err )
+    os.Exit( exitCode )
+  }
+  if err := ConfigureLogger( globalConf, logger ) ; err != nil {
+    logger.Panicf( "unable to configure logs : %v", err )
     os.Exit( configuration.ExitConfLoadKo )
-  } 
-  if err := globalConf.Check() ; err != nil {
-    logger.Panicf( "check of conf failed : %v", err ) 
-    os.Exit( configuration.ExitConfCheckKo )
   }
-  globalConf.Logger = logger
-  globalConf.Containers.PathCmd = globalConf.PathCmdContainer
-  globalConf.Containers.Logger = logger
-  if err := globalConf.ResolveAuth() ; err != nil {
-    logger.Panicf( "check of conf (auth part's) failed : %v", err ) 
-    os.Exit( configuration.ExitConfAuthCheckKo )
+  if _, err := globalConf.Record( history.PrincipalSystem, "startup" ) ; err != nil {
+    logger.Warningf( "unable to record startup revision : %v", err )
   }
   if *pullImageContainerOnly || *pullImageContainer {
     if err := PullImageContainers( globalConf, logger ) ; err != nil {
@@ -108,6 +125,380 @@ func StartEnv( globalConfMutex *sync.RWMutex, globalConfPath *string, globalConf
   }
 }
 
+// the previous settings are kept on error
+func ConfigureLogger( conf *configuration.Conf, l *logger.Logger ) error {
+  level := conf.LogLevel
+  if LogLevelFlag != "" {
+    level = LogLevelFlag
+  }
+  return l.Configure( logger.Options {
+    Level: level,
+    Format: conf.LogFormat,
+    File: conf.LogFile,
+    FileSize: conf.LogFileSize,
+    FileBackups: conf.LogFileBackups,
+  } )
+}
+
+// the report is given on standard outputs, one problem by line 
+func CheckConf( confPath string ) int {
+  problems := configuration.CheckFile( confPath )
+  if len( problems ) == 0 {
+    fmt.Printf( "conf '%v' is valid\n", confPath )
+    return configuration.ExitOk
+  }
+  for _, problem := range problems {
+    fmt.Fprintf( os.Stderr, "%v\n", problem )
+  }
+  fmt.Printf( "conf '%v' is invalid : %v problem(s)\n", confPath, len( problems ) )
+  return configuration.ExitConfCheckKo
+}
+
+func LoadConf( confPath string, conf *configuration.Conf, logger *logger.Logger ) ( exitCode int, err error ) {
+  if exitCode, err := readConf( confPath, conf, logger ) ; err != nil {
+    return exitCode, err
+  }
+  prepareSubsystems( conf, nil, logger )
+  return configuration.ExitOk, nil
+}
+
+func readConf( confPath string, conf *configuration.Conf, logger *logger.Logger ) ( exitCode int, err error ) {
+  if err := configuration.Import( confPath, conf ) ; err != nil {
+    return configuration.ExitConfLoadKo, errors.New( 
+      fmt.Sprintf( "unable to load configuration with error : %v", err ), 
+    )
+  } 
+  conf.Path = confPath
+  return PrepareConf( conf, logger )
+}
+
+// the routes dir read, then the conf checked ; the subsystems (jobs, builds...) 
+// aren't there : the ones in effect are given at the swap (swapConf)
+func PrepareConf( conf *configuration.Conf, logger *logger.Logger ) ( exitCode int, err error ) {
+  if err := conf.LoadRoutesDir() ; err != nil {
+    return configuration.ExitConfLoadKo, err
+  }
+  return ValidateConf( conf, logger )
+}
+
+// checked and its auth resolved, nothing read nor created : cheap enough for 
+// the write lock held
+func ValidateConf( conf *configuration.Conf, logger *logger.Logger ) ( exitCode int, err error ) {
+  // the logger given may be the one of an API's request
+  logger = logger.Root()
+  if err := conf.Check() ; err != nil {
+    // the problems stay reachable with errors.As
+    return configuration.ExitConfCheckKo, fmt.Errorf( "check of conf failed : %w", err )
+  }
+  conf.Logger = logger
+  conf.Containers.PathCmd = conf.PathCmdContainer
+  conf.Containers.Logger = logger
+  if err := conf.ResolveAuth() ; err != nil {
+    return configuration.ExitConfAuthCheckKo, errors.New( 
+      fmt.Sprintf( "check of conf (auth part's) failed : %v", err ), 
+    )
+  }
+  return configuration.ExitOk, nil
+}
+
+// the subsystems of the new conf : the ones of the current conf (nil at the 
+// startup) are kept when possible, the others are created. To call with the 
+// conf's mutex held 
+func prepareSubsystems( newConf *configuration.Conf, globalConf *configuration.Conf, logger *logger.Logger ) {
+  logger = logger.Root()
+  if globalConf == nil {
+    globalConf = &configuration.Conf{}
+  }
+  // the verifications already done are kept
+  if globalConf.Artifacts != nil && globalConf.Artifacts.Dir == newConf.ArtifactsDir() {
+    newConf.Artifacts = globalConf.Artifacts
+  } else {
+    newConf.Artifacts = artifacts.NewStore( newConf.ArtifactsDir() )
+  }
+  // the builds and their images too
+  if globalConf.Builder != nil && globalConf.Builder.PathCmd == newConf.PathCmdContainer {
+    newConf.Builder = globalConf.Builder
+  } else {
+    newConf.Builder = builder.New( newConf.PathCmdContainer, logger )
+  }
+  // the jobs stay (queued, running or kept), in their first dir until the 
+  // restart ; the timers unchanged too
+  if globalConf.Jobs != nil {
+    newConf.Jobs = globalConf.Jobs
+  } else {
+    newConf.Jobs = jobs.NewPool( newConf.JobsDir(), logger )
+  }
+  newConf.Jobs.Configure( newConf.JobsWorkers, newConf.JobsRetention, newConf.JobsTimeout )
+  if globalConf.Scheduler != nil {
+    newConf.Scheduler = globalConf.Scheduler
+    newConf.Scheduler.Sync( schedulesWanted( newConf ) )
+  } else {
+    newConf.Scheduler = schedule.New( newConf.Jobs, logger )
+  }
+  if globalConf.Triggers != nil {
+    newConf.Triggers = globalConf.Triggers
+    newConf.Triggers.Sync( triggersWanted( newConf ) )
+  } else {
+    newConf.Triggers = triggers.New( newConf.Jobs, logger )
+  }
+  if globalConf.Events != nil {
+    newConf.Events = globalConf.Events
+  } else {
+    newConf.Events = events.New( newConf.Jobs, logger )
+  }
+  newConf.Events.Sync( subscriptionsWanted( newConf ) )
+  if globalConf.History != nil {
+    newConf.History = globalConf.History
+    newConf.History.Resize( newConf.HistorySize )
+  }
+}
+
+// -----------------------------------------------
+
+func sameRoute( oldRoute *itinerary.Route, newRoute *itinerary.Route ) bool {
+  if oldRoute.TypeName != newRoute.TypeName {
+    return false
+  }
+  oldExport, err := oldRoute.Export( false )
+  if err != nil {
+    return false
+  }
+  newExport, err := newRoute.Export( false )
+  if err != nil {
+    return false
+  }
+  oldJson, err := json.Marshal( &oldExport )
+  if err != nil {
+    return false
+  }
+  newJson, err := json.Marshal( &newExport )
+  if err != nil {
+    return false
+  }
+  return bytes.Equal( oldJson, newJson )
+}
+
+func stopRouteContainer( conf *configuration.Conf, route *itinerary.Route, logger *logger.Logger ) {
+  route.Mutex.Lock()
+  defer route.Mutex.Unlock()
+  cId := route.Id
+  if cId == "" {
+    return
+  }
+  if _, err := conf.Containers.Stop( route ) ; err != nil {
+    logger.Warningf( "reload : container '%v' (cId %v) not stopped - maybe he is still active ?", route.Name, cId )
+  }
+  time.Sleep( time.Duration( route.Timeout ) * time.Millisecond )
+  if _, err := conf.Containers.Remove( route ) ; err != nil {
+    logger.Warningf( "reload : container '%v' (cId %v) not terminated", route.Name, cId )
+  } else {
+    logger.Infof( "reload : container '%v' (ex-cId %v) terminated", route.Name, cId )
+  }
+}
+
+// the new conf is fully loaded and checked before the swap : if invalid, the 
+// current conf is kept untouched ; unchanged service routes keep their running 
+// container, containers of removed or changed routes are stopped after the swap 
+func ReloadConf( confPath string, globalConfMutex *sync.RWMutex, globalConf *configuration.Conf, logger *logger.Logger ) error {
+  newConf := configuration.Conf{}
+  if _, err := readConf( confPath, &newConf, logger ) ; err != nil {
+    return err
+  }
+  return SwapConf( &newConf, globalConfMutex, globalConf, logger, history.PrincipalSystem, "reload from file", false )
+}
+
+// same path as a reload, but from a revision's content ; the result is persisted 
+func RollbackConf( revision history.Revision, principal string, globalConfMutex *sync.RWMutex, globalConf *configuration.Conf, logger *logger.Logger ) error {
+  newConf := configuration.Conf{ Templates: make( map[string]configuration.Template ) }
+  if err := configuration.Unmarshal( configuration.FormatJSON, revision.Content, &newConf, newConf.Templates ) ; err != nil {
+    return errors.New( 
+      fmt.Sprintf( "unable to parse revision %v : %v", revision.Id, err ), 
+    )
+  }
+  if _, err := PrepareConf( &newConf, logger ) ; err != nil {
+    return err
+  }
+  globalConfMutex.RLock()
+  newConf.Path = globalConf.Path
+  globalConfMutex.RUnlock()
+  return SwapConf( &newConf, globalConfMutex, globalConf, logger, principal, fmt.Sprintf( "rollback to revision %v", revision.Id ), true )
+}
+
+// routes of the directory are read again on the current conf (API changes kept) 
+func ReloadRoutesDir( globalConfMutex *sync.RWMutex, globalConf *configuration.Conf, logger *logger.Logger, summary string ) error {
+  globalConfMutex.RLock()
+  content, err := globalConf.Marshal( true )
+  confPath := globalConf.Path
+  globalConfMutex.RUnlock()
+  if err != nil {
+    return err
+  }
+  newConf := configuration.Conf{ Templates: make( map[string]configuration.Template ) }
+  if err := configuration.Unmarshal( configuration.FormatJSON, content, &newConf, newConf.Templates ) ; err != nil {
+    return err
+  }
+  newConf.Path = confPath
+  if _, err := PrepareConf( &newConf, logger ) ; err != nil {
+    return err
+  }
+  return SwapConf( &newConf, globalConfMutex, globalConf, logger, history.PrincipalSystem, summary, false )
+}
+
+func WatchRoutesDir( ctx context.Context, globalConfMutex *sync.RWMutex, globalConf *configuration.Conf, globalWaitGroup *sync.WaitGroup, logger *logger.Logger ) {
+  globalConfMutex.RLock()
+  dir := globalConf.RoutesDir
+  globalConfMutex.RUnlock()
+  if dir == "" {
+    return
+  }
+  events, err := watcher.Watch( ctx, dir )
+  if err != nil {
+    logger.Warningf( "routes dir not watched : %v", err )
+    return
+  }
+  globalWaitGroup.Add( 1 )
+  defer globalWaitGroup.Done()
+  logger.Infof( "routes dir '%v' watched", dir )
+  for event := range watcher.Debounce( ctx, events, RoutesDirDebounce ) {
+    if configuration.IsRouteFile( event.Path ) != true {
+      continue
+    }
+    summary := fmt.Sprintf( "routes dir : '%v' changed", filepath.Base( event.Path ) )
+    if event.Removed {
+      summary = fmt.Sprintf( "routes dir : '%v' removed", filepath.Base( event.Path ) )
+    }
+    if err := ReloadRoutesDir( globalConfMutex, globalConf, logger, summary ) ; err != nil {
+      logger.Errorf( "%v refused ; current conf kept : %v", summary, err )
+    } else {
+      logger.Infof( "%v applied", summary )
+    }
+  }
+}
+
+// to call with the conf's mutex held ; the containers to stop are given back 
+func swapConf( newConf *configuration.Conf, globalConf *configuration.Conf, logger *logger.Logger ) ( toStop []*itinerary.Route ) {
+  kept := 0
+  for routeName, oldRoute := range globalConf.Routes {
+    newRoute, ok := newConf.Routes[routeName]
+    if ok && sameRoute( oldRoute, newRoute ) {
+      newConf.Routes[routeName] = oldRoute
+      kept++
+      continue
+    }
+    if oldRoute.Id != "" {
+      toStop = append( toStop, oldRoute )
+    }
+  }
+  prepareSubsystems( newConf, globalConf, logger )
+  if err := ConfigureLogger( newConf, logger ) ; err != nil {
+    logger.Warningf( "reload : logs not configured, previous settings kept : %v", err )
+  }
+  *globalConf = *newConf
+  logger.Infof( "reload : conf swapped (%v routes, %v kept, %v containers to stop)", len( newConf.Routes ), kept, len( toStop ) )
+  return toStop
+}
+
+func stopRouteContainers( globalConf *configuration.Conf, toStop []*itinerary.Route, logger *logger.Logger ) {
+  for _, route := range toStop {
+    stopRouteContainer( globalConf, route, logger )
+  }
+}
+
+func SwapConf( newConf *configuration.Conf, globalConfMutex *sync.RWMutex, globalConf *configuration.Conf, logger *logger.Logger, principal string, summary string, persist bool ) ( err error ) {
+  globalConfMutex.Lock()
+  toStop := swapConf( newConf, globalConf, logger )
+  if persist {
+    err = globalConf.Commit( principal, summary )
+  } else {
+    _, err = globalConf.Record( principal, summary )
+  }
+  globalConfMutex.Unlock()
+  stopRouteContainers( globalConf, toStop, logger )
+  return err
+}
+
+// the patch is applied on the exported conf (references, not secrets) with the 
+// write lock held all along : no concurrent change is lost. Only the editable 
+// paths can change, then the result is checked like a reload ; the problems are 
+// given as configuration.Problems. The strings it changes aren't interpolated 
+func PatchConf( apply func( document interface{} ) ( interface{}, error ), principal string, summary string, globalConfMutex *sync.RWMutex, globalConf *configuration.Conf, logger *logger.Logger ) ( changes []history.Change, err error ) {
+  globalConfMutex.Lock()
+  locked := true
+  defer func() {
+    if locked {
+      globalConfMutex.Unlock()
+    }
+  }()
+  content, err := globalConf.Marshal( true )
+  if err != nil {
+    return nil, err
+  }
+  document, err := configuration.DecodeFormat( configuration.FormatJSON, content )
+  if err != nil {
+    return nil, err
+  }
+  if document, err = apply( document ) ; err != nil {
+    return nil, err
+  }
+  // the edit may change the document in place : the original is decoded again
+  original, err := configuration.DecodeFormat( configuration.FormatJSON, content )
+  if err != nil {
+    return nil, err
+  }
+  patchedContent, err := json.Marshal( configuration.EscapeChanges( original, document ) )
+  if err != nil {
+    return nil, err
+  }
+  if changes, err = history.Diff( content, patchedContent ) ; err != nil {
+    return nil, err
+  }
+  if len( changes ) == 0 {
+    return changes, nil
+  }
+  problems := configuration.Problems{}
+  for _, change := range changes {
+    if configuration.Editable( change.Path ) != true {
+      problems = append( problems, configuration.Problem { Path: change.Path, Message: "field not editable" } )
+      continue
+    }
+    tokens := strings.Split( change.Path, "/" )
+    if len( tokens ) > 2 && tokens[1] == "routes" {
+      if route, ok := globalConf.Routes[tokens[2]] ; ok && route.Source != "" {
+        problems = append( problems, configuration.Problem { Path: change.Path, Message: "route defined in routes dir ('"+route.Source+"')" } )
+      }
+    }
+  }
+  if len( problems ) > 0 {
+    return nil, problems
+  }
+  newConf := configuration.Conf{ Templates: make( map[string]configuration.Template ) }
+  if err := configuration.Unmarshal( configuration.FormatJSON, patchedContent, &newConf, newConf.Templates ) ; err != nil {
+    return nil, err
+  }
+  for routeName, route := range newConf.Routes {
+    if route != nil && route.Name == "" {
+      route.Name = routeName
+    }
+  }
+  newConf.Path = globalConf.Path
+  // the routes of the dir as loaded : not read again with the lock held
+  if err := newConf.AdoptRoutesDir( globalConf ) ; err != nil {
+    return nil, err
+  }
+  if _, err := ValidateConf( &newConf, logger ) ; err != nil {
+    if errors.As( err, &problems ) {
+      return nil, problems
+    }
+    return nil, err
+  }
+  toStop := swapConf( &newConf, globalConf, logger )
+  err = globalConf.Commit( principal, summary )
+  globalConfMutex.Unlock()
+  locked = false
+  stopRouteContainers( globalConf, toStop, logger )
+  return changes, err
+}
+
 // -----------------------------------------------
 
 func PullImageContainers( globalConf *configuration.Conf, logger *logger.Logger ) ( err error ) {
@@ -136,17 +527,193 @@ func PullImageContainers( globalConf *configuration.Conf, logger *logger.Logger
 
 // -----------------------------------------------
 
+// the artifacts without route or revision using them ; the conf can't change 
+// meanwhile 
+func CollectArtifacts( ctx context.Context, globalConfMutex *sync.RWMutex, globalConf *configuration.Conf, globalWaitGroup *sync.WaitGroup, logger *logger.Logger ) {
+  globalWaitGroup.Add( 1 )
+  defer globalWaitGroup.Done()
+  ticker := time.NewTicker( artifacts.CollectInterval )
+  defer ticker.Stop()
+  for {
+    select {
+    case <-ticker.C:
+      globalConfMutex.RLock()
+      if globalConf.Artifacts != nil {
+        for _, digest := range globalConf.Artifacts.Collect( globalConf.ArtifactReferences(), artifacts.GraceDelay ) {
+          logger.Infof( "artifact '%v' collected (without reference)", digest )
+        }
+      }
+      globalConfMutex.RUnlock()
+    case <-ctx.Done():
+      return
+    }
+  }
+}
+
+// the routes to build, their artifact verified without the conf's lock
+func buildsWanted( globalConfMutex *sync.RWMutex, globalConf *configuration.Conf ) ( *builder.Builder, []builder.Wanted ) {
+  globalConfMutex.RLock()
+  current := globalConf.Builder
+  store := globalConf.Artifacts
+  wanted := []builder.Wanted{}
+  artifactOf := make( map[int]string )
+  for key, route := range globalConf.Routes {
+    if route.Build == nil || route.TypeNum != itinerary.RouteTypeFunction {
+      continue
+    }
+    if route.Build.Source == "" {
+      artifactOf[len( wanted )] = route.Artifact
+    }
+    wanted = append( wanted, builder.Wanted {
+      Key: key,
+      Definition: *route.Build,
+      Base: route.Image,
+      Context: route.Build.Source,
+    } )
+  }
+  globalConfMutex.RUnlock()
+  for i, digest := range artifactOf {
+    path, err := store.Verify( digest )
+    if err != nil {
+      wanted[i].Problem = err.Error()
+    } else {
+      wanted[i].Context = path
+    }
+  }
+  return current, wanted
+}
+
+// the builds follow the routes and their code (checked at each interval) ; 
+// the builder's worker is replaced with the builder 
+func WatchBuilds( ctx context.Context, globalConfMutex *sync.RWMutex, globalConf *configuration.Conf, globalWaitGroup *sync.WaitGroup, logger *logger.Logger ) {
+  globalWaitGroup.Add( 1 )
+  defer globalWaitGroup.Done()
+  var running *builder.Builder
+  stop := func() {}
+  defer func() { stop() }()
+  ticker := time.NewTicker( builder.SyncInterval )
+  defer ticker.Stop()
+  for {
+    current, wanted := buildsWanted( globalConfMutex, globalConf )
+    if current != nil && current != running {
+      if running != nil {
+        logger.Infof( "builder replaced (command '%v')", current.PathCmd )
+      }
+      stop()
+      workerCtx, cancel := context.WithCancel( ctx )
+      go current.Run( workerCtx )
+      running, stop = current, cancel
+    }
+    if current != nil {
+      current.Sync( wanted )
+    }
+    select {
+    case <-ticker.C:
+    case <-ctx.Done():
+      return
+    }
+  }
+}
+
+// the async requests' workers (the jobs of the last stop first) and the 
+// removal of the expired jobs ; the pool is kept by the reloads 
+func RunJobs( ctx context.Context, globalConfMutex *sync.RWMutex, globalConf *configuration.Conf, globalWaitGroup *sync.WaitGroup, logger *logger.Logger ) {
+  globalWaitGroup.Add( 1 )
+  defer globalWaitGroup.Done()
+  globalConfMutex.RLock()
+  pool := globalConf.Jobs
+  globalConfMutex.RUnlock()
+  if loaded, err := pool.Load() ; err != nil {
+    logger.Warningf( "jobs not loaded (kept in memory only) : %v", err )
+  } else if loaded > 0 {
+    logger.Infof( "%v job(s) loaded from '%v'", loaded, pool.Dir )
+  }
+  var workers sync.WaitGroup
+  workers.Add( 1 )
+  go func() {
+    defer workers.Done()
+    pool.Run( ctx )
+  }()
+  defer workers.Wait()
+  ticker := time.NewTicker( jobs.CollectInterval )
+  defer ticker.Stop()
+  for {
+    select {
+    case <-ticker.C:
+      if removed := pool.Collect() ; removed > 0 {
+        logger.Infof( "%v expired job(s) removed", removed )
+      }
+    case <-ctx.Done():
+      return
+    }
+  }
+}
+
+// to call with the conf's mutex held
+func schedulesWanted( conf *configuration.Conf ) ( wanted []schedule.Wanted ) {
+  for key, route := range conf.Routes {
+    if len( route.Schedules ) > 0 {
+      wanted = append( wanted, schedule.Wanted { Key: key, Definitions: route.Schedules, Policy: route.Jobs } )
+    }
+  }
+  return wanted
+}
+
+// the routes' timers ; the scheduler is kept by the reloads (synchronized 
+// with the new routes) 
+func RunSchedules( ctx context.Context, globalConfMutex *sync.RWMutex, globalConf *configuration.Conf, globalWaitGroup *sync.WaitGroup, logger *logger.Logger ) {
+  globalWaitGroup.Add( 1 )
+  defer globalWaitGroup.Done()
+  globalConfMutex.RLock()
+  scheduler := globalConf.Scheduler
+  scheduler.Sync( schedulesWanted( globalConf ) )
+  globalConfMutex.RUnlock()
+  scheduler.Run( ctx )
+}
+
+// to call with the conf's mutex held
+func subscriptionsWanted( conf *configuration.Conf ) ( wanted []events.Wanted ) {
+  for key, route := range conf.Routes {
+    if len( route.Subscriptions ) > 0 {
+      wanted = append( wanted, events.Wanted { Key: key, Subscriptions: route.Subscriptions, Policy: route.Jobs } )
+    }
+  }
+  return wanted
+}
+
+// to call with the conf's mutex held
+func triggersWanted( conf *configuration.Conf ) ( wanted []triggers.Wanted ) {
+  for key, route := range conf.Routes {
+    if len( route.Triggers ) > 0 {
+      wanted = append( wanted, triggers.Wanted { Key: key, Definitions: route.Triggers, Policy: route.Jobs } )
+    }
+  }
+  return wanted
+}
+
+// the routes' watched dirs ; the manager is kept by the reloads (synchronized 
+// with the new routes) 
+func RunTriggers( ctx context.Context, globalConfMutex *sync.RWMutex, globalConf *configuration.Conf, globalWaitGroup *sync.WaitGroup, logger *logger.Logger ) {
+  globalWaitGroup.Add( 1 )
+  defer globalWaitGroup.Done()
+  globalConfMutex.RLock()
+  manager := globalConf.Triggers
+  manager.Sync( triggersWanted( globalConf ) )
+  globalConfMutex.RUnlock()
+  manager.Run( ctx )
+}
+
 func CleanContainers( ctx context.Context, force bool, globalConfMutex *sync.RWMutex, globalConf *configuration.Conf, globalWaitGroup *sync.WaitGroup, logger *logger.Logger ) {
   globalWaitGroup.Add( 1 )
   for {
     tt := time.After( time.Duration( globalConf.DelayCleaningContainers ) * time.Second )
     select {
     case <-tt:
+      globalConfMutex.RLock()
       for routeName := range globalConf.Routes {
         route := globalConf.Routes[routeName]
         if route.Id != "" {
           routeDelayLastRequest := route.LastRequest.Add( time.Duration( route.Delay ) * time.Second )
-          globalConfMutex.RLock()
           state, err := globalConf.Containers.Check( route ) 
           if err != nil {
             logger.Warning( "Container ", route.Name, "(cId ", route.Id, ") : state unknow ; ", err )
@@ -158,9 +725,9 @@ func CleanContainers( ctx context.Context, force bool, globalConfMutex *sync.RWM
               logger.Info( "Container", route.Name, "(cId ", route.Id, ") stopped"  )
             }
           }
-          globalConfMutex.RUnlock()
         }
       }
+      globalConfMutex.RUnlock()
     case <-ctx.Done():
       globalConfMutex.RLock()
       defer globalConfMutex.RUnlock()
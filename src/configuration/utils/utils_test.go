@@ -0,0 +1,54 @@
+package utils
+
+import (
+  "io/ioutil"
+  "path/filepath"
+  "sync"
+  "testing"
+  // -----------
+  "configuration"
+  "logger"
+)
+
+// a content given through the API is taken literally : only the conf's files
+// are interpolated
+func TestPatchConfLiteral( t *testing.T ) {
+  t.Setenv( "FAASS_TEST_AUTH", "Basic x" )
+  dir := t.TempDir()
+  confPath := filepath.Join( dir, "conf.json" )
+  content := `{ "adress": "127.0.0.1", "listen": 9090, "delay": 45, "prefix": "lambda", "tmp": "`+dir+`",
+    "pathcmdcontainer": "/bin/true", "authorizations": { "default": "${FAASS_TEST_AUTH}" }, "authapi": "default", "persist": true,
+    "routes": { "a": { "name": "a", "type": "shell", "script": "/bin/true", "timeout": 1000 } } }`
+  if err := ioutil.WriteFile( confPath, []byte( content ), 0600 ) ; err != nil {
+    t.Fatal( err )
+  }
+  l := &logger.Logger{}
+  l.Init()
+  c := configuration.Conf{}
+  if _, err := LoadConf( confPath, &c, l ) ; err != nil {
+    t.Fatal( err )
+  }
+  m := sync.RWMutex{}
+  apply := func( document interface{} ) ( interface{}, error ) {
+    route := document.( map[string]interface{} )["routes"].( map[string]interface{} )["a"].( map[string]interface{} )
+    route["env"] = map[string]interface{}{ "HOME": "${HOME}", "AUTH": "${FAASS_TEST_AUTH_FILE:-none}" }
+    return document, nil
+  }
+  if _, err := PatchConf( apply, "test", "env of 'a'", &m, &c, l ) ; err != nil {
+    t.Fatal( err )
+  }
+  env := c.Routes["a"].Environment
+  if env["HOME"] != "${HOME}" || env["AUTH"] != "${FAASS_TEST_AUTH_FILE:-none}" {
+    t.Errorf( "patched variables interpolated : %v", env )
+  }
+  if c.Authorizations["default"] != "Basic x" {
+    t.Errorf( "conf's variables must stay interpolated : '%v'", c.Authorizations["default"] )
+  }
+  reloaded := configuration.Conf{}
+  if _, err := LoadConf( confPath, &reloaded, l ) ; err != nil {
+    t.Fatal( err )
+  }
+  if reloaded.Routes["a"].Environment["HOME"] != "${HOME}" {
+    t.Errorf( "persisted variable interpolated : %v", reloaded.Routes["a"].Environment )
+  }
+}
@@ -0,0 +1,377 @@
+package configuration
+
+import(
+  "crypto/tls"
+  "crypto/x509"
+  "encoding/json"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "io/ioutil"
+  "net"
+  "reflect"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+  "fmt"
+  // -----------
+  "artifacts"
+  "itinerary"
+  "configuration/auth"
+  "configuration/history"
+  "jobs"
+  "logger"
+)
+
+// -----------------------------------------------
+
+// a problem of the conf, found by its JSON pointer ("" for the whole file)
+type Problem struct {
+  Path string `json:"path"`
+  Message string `json:"message"`
+}
+
+type Problems []Problem
+
+func ( problems Problems ) Error() string {
+  messages := make( []string, len( problems ) )
+  for i, problem := range problems {
+    messages[i] = problem.String()
+  }
+  return strings.Join( messages, " ; " )
+}
+
+func ( problem Problem ) String() string {
+  if problem.Path == "" {
+    return problem.Message
+  }
+  return problem.Path+" : "+problem.Message
+}
+
+// -----------------------------------------------
+
+var routeKeyRegex = regexp.MustCompile( "^[a-z0-9_-]+$" )
+
+// the keys are used in paths (deploys)
+func ValidRouteKey( key string ) bool {
+  return routeKeyRegex.MatchString( key )
+}
+
+var unmarshalerType = reflect.TypeOf( ( *json.Unmarshaler )( nil ) ).Elem()
+
+type structField struct {
+  Name string
+  GoName string
+  Type reflect.Type
+}
+
+// fields by json name, in order ; the untagged embedded structs are flattened, 
+// like json does
+func structFields( t reflect.Type ) ( fields []structField ) {
+  for i := 0 ; i < t.NumField() ; i++ {
+    field := t.Field( i )
+    tag := field.Tag.Get( "json" )
+    name := strings.Split( tag, "," )[0]
+    if tag == "-" {
+      continue
+    }
+    if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+      fields = append( fields, structFields( field.Type )... )
+      continue
+    }
+    if field.IsExported() != true {
+      continue
+    }
+    if name == "" {
+      name = field.Name
+    }
+    fields = append( fields, structField { Name: name, GoName: field.Name, Type: field.Type } )
+  }
+  return fields
+}
+
+// keys without field are silently dropped by json.Unmarshal : they are reported
+// (json matches the names without case, so do we)
+func unknownFields( value interface{}, t reflect.Type, pointer string ) ( problems Problems ) {
+  for t.Kind() == reflect.Ptr {
+    t = t.Elem()
+  }
+  if reflect.PtrTo( t ).Implements( unmarshalerType ) {
+    return nil
+  }
+  switch v := value.( type ) {
+  case map[string]interface{}:
+    keys := make( []string, 0, len( v ) )
+    for key := range v {
+      keys = append( keys, key )
+    }
+    sort.Strings( keys )
+    switch t.Kind() {
+    case reflect.Struct:
+      fields := structFields( t )
+      for _, key := range keys {
+        var fieldType reflect.Type
+        ok := false
+        for _, field := range fields {
+          if field.Name == key || ( ok != true && strings.EqualFold( field.Name, key ) ) {
+            fieldType, ok = field.Type, true
+          }
+        }
+        if ok != true {
+          problems = append( problems, Problem { Path: pointer+"/"+pointerToken( key ), Message: "unknown field" } )
+          continue
+        }
+        problems = append( problems, unknownFields( v[key], fieldType, pointer+"/"+pointerToken( key ) )... )
+      }
+    case reflect.Map:
+      for _, key := range keys {
+        problems = append( problems, unknownFields( v[key], t.Elem(), pointer+"/"+pointerToken( key ) )... )
+      }
+    }
+  case []interface{}:
+    if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+      for i, child := range v {
+        problems = append( problems, unknownFields( child, t.Elem(), pointer+"/"+strconv.Itoa( i ) )... )
+      }
+    }
+  }
+  return problems
+}
+
+// -----------------------------------------------
+
+func checkScript( route *itinerary.Route ) string {
+  if route.ScriptPath == "" {
+    return ""
+  }
+  // a shell's script without separator is searched in PATH, like exec does
+  if route.TypeNum == itinerary.RouteTypeShell && strings.ContainsRune( route.ScriptPath, os.PathSeparator ) != true {
+    if _, err := exec.LookPath( route.ScriptPath ) ; err != nil {
+      return "script not found in PATH : '"+route.ScriptPath+"'"
+    }
+    return ""
+  }
+  info, err := os.Stat( route.ScriptPath )
+  if err != nil {
+    return "script not found : '"+route.ScriptPath+"'"
+  }
+  // a function's bundle is a directory, mounted as a whole
+  if info.IsDir() && route.TypeNum != itinerary.RouteTypeFunction {
+    return "script is a directory : '"+route.ScriptPath+"'"
+  }
+  if route.TypeNum == itinerary.RouteTypeShell && info.Mode()&0111 == 0 {
+    return "script not executable : '"+route.ScriptPath+"'"
+  }
+  return ""
+}
+
+// every problem is reported, nothing is corrected ; the derived fields (tls paths,
+// routes' types) are set. With filesystem, the files (TLS, scripts, routes dir)
+// are checked too. Authorizations are checked by reference : to call before
+// ResolveAuth
+func ( c *Conf ) Validate( filesystem bool ) ( problems Problems ) {
+  add := func( path string, message string ) {
+    problems = append( problems, Problem { Path: path, Message: message } )
+  }
+  if net.ParseIP( c.IncomingAdress ) == nil {
+    add( "/adress", "incomming adress is not an ip" )
+  }
+  if c.IncomingPort < 1 || c.IncomingPort > 65535 {
+    add( "/listen", "incorrect port '"+strconv.Itoa( c.IncomingPort )+"' (1 to 65535)" )
+  }
+  if c.IncomingTLS != "" {
+    r := strings.Split( c.IncomingTLS, ":" )
+    if len( r ) != 2 {
+      add( "/tls", "tls has no ':' separator" )
+    } else {
+      c.IncomingTLSCrt = r[0]
+      c.IncomingTLSKey = r[1]
+      if filesystem {
+        if _, err := tls.LoadX509KeyPair( c.IncomingTLSCrt, c.IncomingTLSKey ) ; err != nil {
+          add( "/tls", fmt.Sprintf( "unable to load certificate and key : %v", err ) )
+        }
+      }
+    }
+  }
+  if _, ok := auth.ClientAuthType( c.IncomingTLSClientAuth ) ; !ok {
+    add( "/tlsclientauth", "tls client auth mode invalid : '"+c.IncomingTLSClientAuth+"'" )
+  } else if c.IncomingTLSClientAuth != "" && c.IncomingTLSClientAuth != auth.ClientAuthNone && c.IncomingTLS == "" {
+    add( "/tlsclientauth", "tls client auth mode needs tls" )
+  } else if auth.ClientAuthVerifies( c.IncomingTLSClientAuth ) && c.IncomingTLSClientCA == "" {
+    add( "/tlsclientca", "tls client auth mode '"+c.IncomingTLSClientAuth+"' needs a client CA" )
+  }
+  if c.IncomingTLSClientCA != "" {
+    if c.IncomingTLS == "" {
+      add( "/tlsclientca", "tls client CA needs tls" )
+    }
+    if filesystem {
+      if content, err := ioutil.ReadFile( c.IncomingTLSClientCA ) ; err != nil {
+        add( "/tlsclientca", fmt.Sprintf( "unable to read client CA : %v", err ) )
+      } else if x509.NewCertPool().AppendCertsFromPEM( content ) != true {
+        add( "/tlsclientca", "no PEM certificate in client CA" )
+      }
+    }
+  }
+  if err := c.Access.Check() ; err != nil {
+    add( "/access", err.Error() )
+  }
+  if c.DelayCleaningContainers < ConfDelayCleaningContainersMin || c.DelayCleaningContainers > ConfDelayCleaningContainersMax {
+    add( "/delay", fmt.Sprintf(
+      "delay cleaning containers out of range (%v to %v seconds)",
+      ConfDelayCleaningContainersMin,
+      ConfDelayCleaningContainersMax,
+    ) )
+  }
+  if c.PersistBackups < 0 || c.PersistBackups > ConfPersistBackupsMax {
+    add( "/persistbackups", "persist backups out of range (0 to "+strconv.Itoa( ConfPersistBackupsMax )+")" )
+  }
+  if c.HistorySize < 0 || c.HistorySize > history.HistorySizeMax {
+    add( "/historysize", "history size out of range (0 to "+strconv.Itoa( history.HistorySizeMax )+")" )
+  }
+  if logger.ValidLevel( c.LogLevel ) != true {
+    add( "/loglevel", "log level unknow : '"+c.LogLevel+"'" )
+  }
+  if logger.ValidFormat( c.LogFormat ) != true {
+    add( "/logformat", "log format unknow : '"+c.LogFormat+"'" )
+  }
+  if c.LogFile != "" && filesystem {
+    if info, err := os.Stat( filepath.Dir( c.LogFile ) ) ; err != nil || info.IsDir() != true {
+      add( "/logfile", "directory of log file not exists" )
+    }
+  }
+  if c.LogFileSize < 0 || c.LogFileSize > logger.FileSizeMax {
+    add( "/logfilesize", "log file size out of range (0 to "+strconv.Itoa( logger.FileSizeMax )+" MB)" )
+  }
+  if c.LogFileBackups < 0 || c.LogFileBackups > logger.FileBackupsMax {
+    add( "/logfilebackups", "log file backups out of range (0 to "+strconv.Itoa( logger.FileBackupsMax )+")" )
+  }
+  if c.JobsWorkers < 0 || c.JobsWorkers > jobs.WorkersMax {
+    add( "/jobsworkers", "jobs' workers out of range (0 to "+strconv.Itoa( jobs.WorkersMax )+")" )
+  }
+  if c.JobsRetention < 0 || c.JobsRetention > jobs.RetentionMax {
+    add( "/jobsretention", "jobs' retention out of range (0 to "+strconv.Itoa( jobs.RetentionMax )+" seconds)" )
+  }
+  if c.JobsTimeout < 0 || c.JobsTimeout > jobs.TimeoutMax {
+    add( "/jobstimeout", "jobs' timeout out of range (0 to "+strconv.Itoa( jobs.TimeoutMax )+" milliseconds)" )
+  }
+  if c.AuthorizationAPI != "" {
+    if _, ok := c.Authorizations[c.AuthorizationAPI] ; !ok {
+      add( "/authapi", "authorization '"+c.AuthorizationAPI+"' not exists" )
+    }
+  }
+  keyNames := make( []string, 0, len( c.APIKeys ) )
+  for name := range c.APIKeys {
+    keyNames = append( keyNames, name )
+  }
+  sort.Strings( keyNames )
+  for _, name := range keyNames {
+    if c.APIKeys[name] == nil {
+      add( "/apikeys/"+pointerToken( name ), "api key undefined" )
+    } else if err := c.APIKeys[name].Check() ; err != nil {
+      add( "/apikeys/"+pointerToken( name ), err.Error() )
+    }
+  }
+  if c.RoutesDir != "" && filesystem {
+    if info, err := os.Stat( c.RoutesDir ) ; err != nil || info.IsDir() != true {
+      add( "/routesdir", "routes dir is not a directory : '"+c.RoutesDir+"'" )
+    }
+  }
+  routeKeys := make( []string, 0, len( c.Routes ) )
+  for key := range c.Routes {
+    routeKeys = append( routeKeys, key )
+  }
+  sort.Strings( routeKeys )
+  names := make( map[string]string )
+  for _, key := range routeKeys {
+    pointer := "/routes/"+pointerToken( key )
+    route := c.Routes[key]
+    if route == nil {
+      add( pointer, "route undefined" )
+      continue
+    }
+    // routes of the routes dir are reported with their file
+    suffix := ""
+    if route.Source != "" {
+      suffix = " (file '"+route.Source+"')"
+    }
+    if routeKeyRegex.MatchString( key ) != true {
+      add( pointer, "route's key invalid (a-z, 0-9, '_' and '-' only)"+suffix )
+    }
+    for _, problem := range route.Validate() {
+      add( pointer+"/"+problem.Field, problem.Message+suffix )
+    }
+    if other, ok := names[route.Name] ; ok && route.Name != "" {
+      add( pointer+"/name", "name '"+route.Name+"' already used by route '"+other+"'"+suffix )
+    } else {
+      names[route.Name] = key
+    }
+    if route.Authorization != "" {
+      if _, ok := c.Authorizations[route.Authorization] ; !ok {
+        add( pointer+"/authorization", "authorization '"+route.Authorization+"' not exists"+suffix )
+      }
+    }
+    if route.Signature != nil && route.Signature.Secret != "" {
+      if _, ok := c.Authorizations[route.Signature.Secret] ; !ok {
+        add( pointer+"/signature/secret", "authorization '"+route.Signature.Secret+"' not exists"+suffix )
+      }
+    }
+    if route.Jobs != nil && route.Jobs.Callback != nil && route.Jobs.Callback.Secret != "" {
+      if _, ok := c.Authorizations[route.Jobs.Callback.Secret] ; !ok {
+        add( pointer+"/jobs/callback/secret", "authorization '"+route.Jobs.Callback.Secret+"' not exists"+suffix )
+      }
+    }
+    if filesystem && route.TypeNum != itinerary.RouteTypeService {
+      if message := checkScript( route ) ; message != "" {
+        add( pointer+"/script", message+suffix )
+      }
+    }
+    if filesystem && route.Artifact != "" && artifacts.ValidDigest( route.Artifact ) {
+      path, _ := artifacts.NewStore( c.ArtifactsDir() ).Path( route.Artifact )
+      if _, err := os.Stat( path ) ; err != nil {
+        add( pointer+"/artifact", "artifact not found : '"+route.Artifact+"'"+suffix )
+      }
+    }
+    for i, step := range route.Steps {
+      for _, stepRoute := range step.Routes() {
+        target, ok := c.Routes[stepRoute]
+        switch {
+        case ok != true || target == nil:
+          add( pointer+"/steps/"+strconv.Itoa( i ), "route '"+stepRoute+"' not exists"+suffix )
+        case target.TypeName != "function" && target.TypeName != "shell":
+          add( pointer+"/steps/"+strconv.Itoa( i ), "route '"+stepRoute+"' is not a function or a shell"+suffix )
+        }
+      }
+    }
+    for i, definition := range route.Triggers {
+      if filesystem != true || definition.Dir == "" {
+        continue
+      }
+      if info, err := os.Stat( definition.Dir ) ; err != nil || info.IsDir() != true {
+        add( pointer+"/triggers/"+strconv.Itoa( i )+"/dir", "dir of trigger isn't a directory : '"+definition.Dir+"'"+suffix )
+      }
+    }
+    if filesystem && route.Build != nil && route.Build.Source != "" {
+      if info, err := os.Stat( route.Build.Source ) ; err != nil || info.IsDir() != true {
+        add( pointer+"/build/source", "source of build isn't a directory : '"+route.Build.Source+"'"+suffix )
+      }
+    }
+  }
+  return problems
+}
+
+// the full report of a conf's file, without starting anything
+func CheckFile( pathRoot string ) ( problems Problems ) {
+  c := Conf{}
+  if err := Import( pathRoot, &c ) ; err != nil {
+    unknown, ok := err.( Problems )
+    if ok != true {
+      return Problems{ { Path: "", Message: err.Error() } }
+    }
+    problems = append( problems, unknown... )
+  }
+  if err := c.LoadRoutesDir() ; err != nil {
+    problems = append( problems, Problem { Path: "/routesdir", Message: err.Error() } )
+  }
+  return append( problems, c.Validate( true )... )
+}
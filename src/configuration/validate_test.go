@@ -0,0 +1,54 @@
+package configuration
+
+import (
+  "io/ioutil"
+  "path/filepath"
+  "testing"
+)
+
+func TestCheckFileReportsAll( t *testing.T ) {
+  confPath := filepath.Join( t.TempDir(), "conf.json" )
+  content := `{
+    "adress": "0.0.0.0", "listen": 9090, "delay": 1, "prefixx": "lambda",
+    "loglevel": "verbose", "logfile": "/non/existent/faass.log", "logfilebackups": 1000,
+    "authorizations": { "default": "Basic x" },
+    "routes": {
+      "a": { "name": "same", "type": "service", "port": 0, "bogus": true },
+      "b": { "name": "same", "type": "shell", "script": "/non/existent", "timeout": 10,
+        "schedules": [ { "cron": "61 * * * *", "timezone": "Mars/Olympus" } ], "jobs": { "callback": { "secret": "none" } },
+        "triggers": [ { "dir": "/non/existent", "done": "/non/existent/" } ] },
+      "c": { "name": "c", "type": "pipeline", "timeout": 10, "steps": [ { "route": "a" }, { "route": "none", "onerror": "retry" } ] },
+      "d": { "name": "d", "type": "shell", "script": "/non/existent", "timeout": 10, "authtype": "hmac", "signature": { "timestamp": "X-Timestamp" } }
+    }
+  }`
+  if err := ioutil.WriteFile( confPath, []byte( content ), 0600 ) ; err != nil {
+    t.Fatal( err )
+  }
+  found := map[string]bool{}
+  for _, problem := range CheckFile( confPath ) {
+    found[problem.Path] = true
+  }
+  for _, path := range []string{ "/prefixx", "/delay", "/loglevel", "/logfile", "/logfilebackups", "/routes/a/bogus", "/routes/a/image", "/routes/a/port", "/routes/b/name", "/routes/b/script", "/routes/b/schedules/0/cron", "/routes/b/schedules/0/timezone", "/routes/b/jobs/callback/secret", "/routes/b/triggers/0/dir", "/routes/b/triggers/0/done", "/routes/c/steps/0", "/routes/c/steps/1", "/routes/c/steps/1/onerror", "/routes/d/signature" } {
+    if found[path] != true {
+      t.Errorf( "problem expected for '%v', found %v", path, found )
+    }
+  }
+  c := Conf{}
+  if err := Import( confPath, &c ) ; err == nil {
+    t.Error( "unknown fields must be refused at import" )
+  }
+  if c.DelayCleaningContainers != 1 || len( c.Validate( false ) ) == 0 {
+    t.Error( "delay must be reported, not clamped" )
+  }
+}
+
+func TestClientCARequired( t *testing.T ) {
+  c := Conf { IncomingTLS: "faass.crt:faass.key", IncomingTLSClientAuth: "require-and-verify" }
+  found := false
+  for _, problem := range c.Validate( false ) {
+    found = found || problem.Path == "/tlsclientca"
+  }
+  if found != true {
+    t.Error( "verifying mode without client CA must be reported" )
+  }
+}
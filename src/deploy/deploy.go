@@ -0,0 +1,300 @@
+package deploy
+
+import (
+  "archive/tar"
+  "archive/zip"
+  "bufio"
+  "bytes"
+  "compress/gzip"
+  "errors"
+  "io"
+  "io/ioutil"
+  "mime"
+  "mime/multipart"
+  "os"
+  "path"
+  "path/filepath"
+  "strings"
+  "fmt"
+  // -----------
+  "artifacts"
+)
+
+// -----------------------------------------------
+
+// a bundle (code, dependencies and manifest) is extracted in a staging dir
+// of the artifacts' store, then stored as a tree artifact
+
+const (
+  ManifestName                          = "manifest.json"
+  MultipartManifest                     = "manifest"
+  MultipartFile                         = "file"
+
+  BundleSizeMax                         = 64 << 20
+  BundleFilesMax                        = 10000
+)
+
+// errors of the bundle itself (the client's fault)
+type Error struct {
+  Message string
+}
+
+func ( err *Error ) Error() string {
+  return err.Message
+}
+
+func bundleError( format string, a ...interface{} ) error {
+  return &Error { Message: fmt.Sprintf( format, a... ) }
+}
+
+// -----------------------------------------------
+
+type Staging struct {
+  Dir string
+  Manifest []byte
+  Files int
+  Size int64
+}
+
+// root is the store's directory (same filesystem)
+func NewStaging( root string ) ( *Staging, error ) {
+  if err := os.MkdirAll( root, 0755 ) ; err != nil {
+    return nil, err
+  }
+  dir, err := ioutil.TempDir( root, artifacts.StagingPrefix )
+  if err != nil {
+    return nil, err
+  }
+  // mounted in containers, whatever their user
+  if err := os.Chmod( dir, 0755 ) ; err != nil {
+    os.RemoveAll( dir )
+    return nil, err
+  }
+  return &Staging { Dir: dir }, nil
+}
+
+func ( staging *Staging ) Discard() {
+  if staging.Dir != "" {
+    os.RemoveAll( staging.Dir )
+  }
+}
+
+// relative, slash separated and inside the bundle ; "." is the bundle itself
+func cleanName( name string ) ( string, error ) {
+  name = strings.ReplaceAll( name, "\\", "/" )
+  cleaned := path.Clean( name )
+  if path.IsAbs( name ) || cleaned == ".." || strings.HasPrefix( cleaned, "../" ) {
+    return "", bundleError( "path outside of bundle : '%v'", name )
+  }
+  return cleaned, nil
+}
+
+func ( staging *Staging ) AddDir( name string ) error {
+  name, err := cleanName( name )
+  if err != nil || name == "." {
+    return err
+  }
+  return os.MkdirAll( filepath.Join( staging.Dir, filepath.FromSlash( name ) ), 0755 )
+}
+
+// the manifest at the root is kept aside : it isn't a file of the function
+func ( staging *Staging ) AddFile( name string, mode os.FileMode, content io.Reader ) error {
+  name, err := cleanName( name )
+  if err != nil {
+    return err
+  }
+  if name == "." {
+    return bundleError( "file without name in bundle" )
+  }
+  limited := io.LimitReader( content, BundleSizeMax-staging.Size+1 )
+  if name == ManifestName {
+    if staging.Manifest != nil {
+      return bundleError( "manifest twice in bundle" )
+    }
+    if staging.Manifest, err = ioutil.ReadAll( limited ) ; err != nil {
+      return err
+    }
+    staging.Size += int64( len( staging.Manifest ) )
+    return staging.checkSize()
+  }
+  if staging.Files++ ; staging.Files > BundleFilesMax {
+    return bundleError( "too many files in bundle (%v max)", BundleFilesMax )
+  }
+  target := filepath.Join( staging.Dir, filepath.FromSlash( name ) )
+  if err := os.MkdirAll( filepath.Dir( target ), 0755 ) ; err != nil {
+    return err
+  }
+  // only the executable bit is kept
+  perm := os.FileMode( 0644 )
+  if mode&0111 != 0 {
+    perm = 0755
+  }
+  file, err := os.OpenFile( target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm )
+  if err != nil {
+    if os.IsExist( err ) {
+      return bundleError( "file twice in bundle : '%v'", name )
+    }
+    return err
+  }
+  defer file.Close()
+  written, err := io.Copy( file, limited )
+  staging.Size += written
+  if err != nil {
+    return err
+  }
+  return staging.checkSize()
+}
+
+func ( staging *Staging ) checkSize() error {
+  if staging.Size > BundleSizeMax {
+    return bundleError( "bundle too large (%v bytes max)", BundleSizeMax )
+  }
+  return nil
+}
+
+// -----------------------------------------------
+
+// by the request's content type ; gzip is detected for tar. A bundle without
+// file is refused
+func ( staging *Staging ) Read( contentType string, body io.Reader ) error {
+  if err := staging.read( contentType, body ) ; err != nil {
+    return err
+  }
+  if staging.Files == 0 {
+    return bundleError( "bundle without file" )
+  }
+  return nil
+}
+
+func ( staging *Staging ) read( contentType string, body io.Reader ) error {
+  mediaType, params, err := mime.ParseMediaType( contentType )
+  if err != nil {
+    return bundleError( "content type invalid : '%v'", contentType )
+  }
+  switch mediaType {
+  case "multipart/form-data":
+    return staging.ReadMultipart( multipart.NewReader( body, params["boundary"] ) )
+  case "application/zip":
+    content, err := ioutil.ReadAll( io.LimitReader( body, BundleSizeMax+1 ) )
+    if err != nil {
+      return err
+    }
+    if len( content ) > BundleSizeMax {
+      return bundleError( "bundle too large (%v bytes max)", BundleSizeMax )
+    }
+    return staging.ReadZip( bytes.NewReader( content ), int64( len( content ) ) )
+  case "application/x-tar", "application/gzip", "application/x-gzip", "application/x-gtar":
+    return staging.ReadTar( body )
+  }
+  return &UnsupportedError { ContentType: mediaType }
+}
+
+type UnsupportedError struct {
+  ContentType string
+}
+
+func ( err *UnsupportedError ) Error() string {
+  return "bundle's content type unsupported : '"+err.ContentType+"'"
+}
+
+// the form's field "manifest" and the fields "file" : their filename is the
+// relative path (directories included)
+func ( staging *Staging ) ReadMultipart( reader *multipart.Reader ) error {
+  for {
+    part, err := reader.NextPart()
+    if err == io.EOF {
+      return nil
+    }
+    if err != nil {
+      return bundleError( "multipart invalid : %v", err )
+    }
+    // part.FileName() drops the directories
+    _, params, _ := mime.ParseMediaType( part.Header.Get( "Content-Disposition" ) )
+    switch part.FormName() {
+    case MultipartManifest:
+      err = staging.AddFile( ManifestName, 0644, part )
+    case MultipartFile:
+      if params["filename"] == ManifestName {
+        err = bundleError( "the manifest must be sent as field '%v'", MultipartManifest )
+      } else {
+        err = staging.AddFile( params["filename"], 0644, part )
+      }
+    default:
+      err = bundleError( "unknown field in multipart : '%v'", part.FormName() )
+    }
+    part.Close()
+    if err != nil {
+      return err
+    }
+  }
+}
+
+func ( staging *Staging ) ReadTar( body io.Reader ) error {
+  buffered := bufio.NewReader( body )
+  var reader io.Reader = buffered
+  if magic, err := buffered.Peek( 2 ) ; err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+    gzipReader, err := gzip.NewReader( buffered )
+    if err != nil {
+      return bundleError( "gzip invalid : %v", err )
+    }
+    defer gzipReader.Close()
+    reader = gzipReader
+  }
+  tarReader := tar.NewReader( reader )
+  for {
+    header, err := tarReader.Next()
+    if err == io.EOF {
+      return nil
+    }
+    if err != nil {
+      return bundleError( "tar invalid : %v", err )
+    }
+    switch header.Typeflag {
+    case tar.TypeDir:
+      err = staging.AddDir( header.Name )
+    case tar.TypeReg:
+      err = staging.AddFile( header.Name, header.FileInfo().Mode(), tarReader )
+    case tar.TypeXGlobalHeader, tar.TypeXHeader:
+    default:
+      // links could point outside of the bundle
+      err = bundleError( "only files and directories in bundle : '%v'", header.Name )
+    }
+    if err != nil {
+      return err
+    }
+  }
+}
+
+func ( staging *Staging ) ReadZip( body io.ReaderAt, size int64 ) error {
+  zipReader, err := zip.NewReader( body, size )
+  if err != nil {
+    return bundleError( "zip invalid : %v", err )
+  }
+  for _, file := range zipReader.File {
+    mode := file.Mode()
+    switch {
+    case mode.IsDir():
+      err = staging.AddDir( file.Name )
+    case mode.IsRegular():
+      var content io.ReadCloser
+      if content, err = file.Open() ; err != nil {
+        return bundleError( "zip invalid : %v", err )
+      }
+      err = staging.AddFile( file.Name, mode, content )
+      content.Close()
+    default:
+      err = bundleError( "only files and directories in bundle : '%v'", file.Name )
+    }
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// -----------------------------------------------
+
+func IsBundleError( err error ) bool {
+  var bundleErr *Error
+  return errors.As( err, &bundleErr )
+}
@@ -0,0 +1,75 @@
+package deploy
+
+import (
+  "archive/tar"
+  "bytes"
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+func tarBundle( t *testing.T, entries []tar.Header ) *bytes.Buffer {
+  buffer := &bytes.Buffer{}
+  writer := tar.NewWriter( buffer )
+  for _, header := range entries {
+    header.Size = int64( len( header.Name ) )
+    if header.Typeflag != tar.TypeReg {
+      header.Size = 0
+    }
+    if err := writer.WriteHeader( &header ) ; err != nil {
+      t.Fatal( err )
+    }
+    writer.Write( []byte( header.Name )[:header.Size] )
+  }
+  writer.Close()
+  return buffer
+}
+
+func TestStaging( t *testing.T ) {
+  staging, err := NewStaging( t.TempDir() )
+  if err != nil {
+    t.Fatal( err )
+  }
+  defer staging.Discard()
+  bundle := tarBundle( t, []tar.Header {
+    { Name: "./", Typeflag: tar.TypeDir, Mode: 0755 },
+    { Name: "./manifest.json", Typeflag: tar.TypeReg, Mode: 0644 },
+    { Name: "./bin/run", Typeflag: tar.TypeReg, Mode: 0755 },
+  } )
+  if err := staging.Read( "application/x-tar", bundle ) ; err != nil {
+    t.Fatal( err )
+  }
+  if string( staging.Manifest ) != "./manifest.json" || staging.Files != 1 {
+    t.Fatalf( "unexpected staging : %+v", staging )
+  }
+  if info, err := os.Stat( filepath.Join( staging.Dir, "bin", "run" ) ) ; err != nil || info.Mode()&0111 == 0 {
+    t.Error( "executable file expected" )
+  }
+  if _, err := os.Stat( filepath.Join( staging.Dir, ManifestName ) ) ; err == nil {
+    t.Error( "the manifest isn't a file of the bundle" )
+  }
+}
+
+func TestStagingRejects( t *testing.T ) {
+  for name, entries := range map[string][]tar.Header {
+    "traversal": { { Name: "../evil", Typeflag: tar.TypeReg } },
+    "absolute": { { Name: "/etc/evil", Typeflag: tar.TypeReg } },
+    "symlink": { { Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd" } },
+    "twice": { { Name: "a", Typeflag: tar.TypeReg }, { Name: "./a", Typeflag: tar.TypeReg } },
+    "empty": { { Name: "manifest.json", Typeflag: tar.TypeReg } },
+  } {
+    root := t.TempDir()
+    staging, err := NewStaging( root )
+    if err != nil {
+      t.Fatal( err )
+    }
+    err = staging.Read( "application/x-tar", tarBundle( t, entries ) )
+    if IsBundleError( err ) != true {
+      t.Errorf( "%v : bundle error expected, got %v", name, err )
+    }
+    staging.Discard()
+    if _, err := os.Stat( filepath.Join( filepath.Dir( root ), "evil" ) ) ; err == nil {
+      t.Errorf( "%v : file written outside of bundle", name )
+    }
+  }
+}
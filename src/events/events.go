@@ -0,0 +1,318 @@
+package events
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "net/http"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+  // -----------
+  "jobs"
+  "logger"
+)
+
+// -----------------------------------------------
+
+// the bus of the routes : an event published (by the API, or by a function's
+// response) is a job of the pool for each subscription matching it (at least
+// once : the route's retries and dead letters) ; an ordered subscription
+// receives its events one at a time, in the order of publication
+
+const (
+  HeaderPublish                         = "X-Faass-Publish"
+  HeaderEvent                           = "X-Faass-Event"
+  HeaderTopic                           = "X-Faass-Topic"
+  HeaderSource                          = "X-Faass-Source"
+  HeaderDepth                           = "X-Faass-Event-Depth"
+  EnvEvent                              = "FAASS_EVENT"
+  EnvTopic                              = "FAASS_TOPIC"
+  EnvSource                             = "FAASS_SOURCE"
+  OriginPrefix                          = "event:"
+
+  // a route publishing to its own topic can't loop forever
+  DepthMax                              = 8
+  SubscriptionsMax                      = 16
+  ContentTypeDefault                    = "application/json"
+)
+
+var (
+  ErrDepth = errors.New( fmt.Sprintf( "too many events chained (%v at most)", DepthMax ) )
+)
+
+// segments separated by '.', "*" for any segment, a last ">" for the rest
+var topicRegex = regexp.MustCompile( `^[a-zA-Z0-9_-]+(\.[a-zA-Z0-9_-]+)*$` )
+var patternRegex = regexp.MustCompile( `^([a-zA-Z0-9_-]+|\*)(\.([a-zA-Z0-9_-]+|\*))*(\.>)?$|^>$` )
+
+func ValidTopic( topic string ) bool {
+  return topicRegex.MatchString( topic )
+}
+
+// the filter's fields (a path of the event's json, "order.status") must have
+// the values given
+type Subscription struct {
+  Topic string `json:"topic"`
+  Filter map[string]string `json:"filter"`
+  Ordered bool `json:"ordered"`
+}
+
+// the problems of a subscription, by field
+func ( subscription Subscription ) Problems() map[string]string {
+  problems := make( map[string]string )
+  if patternRegex.MatchString( subscription.Topic ) != true {
+    problems["topic"] = "topic invalid : '"+subscription.Topic+"' (segments separated by '.', '*' or a last '>')"
+  }
+  for field := range subscription.Filter {
+    if field == "" || strings.HasPrefix( field, "." ) || strings.HasSuffix( field, "." ) {
+      problems["filter"] = "field of filter invalid : '"+field+"'"
+    }
+  }
+  return problems
+}
+
+func ( subscription Subscription ) Matches( event Event ) bool {
+  if matchTopic( subscription.Topic, event.Topic ) != true {
+    return false
+  }
+  if len( subscription.Filter ) == 0 {
+    return true
+  }
+  var data interface{}
+  if json.Unmarshal( event.Data, &data ) != nil {
+    return false
+  }
+  for field, expected := range subscription.Filter {
+    value, ok := lookup( data, field )
+    if ok != true || value != expected {
+      return false
+    }
+  }
+  return true
+}
+
+func matchTopic( pattern string, topic string ) bool {
+  patternParts, topicParts := strings.Split( pattern, "." ), strings.Split( topic, "." )
+  for i, part := range patternParts {
+    switch {
+    case part == ">":
+      return len( topicParts ) > i
+    case i >= len( topicParts ):
+      return false
+    case part != "*" && part != topicParts[i]:
+      return false
+    }
+  }
+  return len( patternParts ) == len( topicParts )
+}
+
+// the value of a path, as a string (a number, a boolean or null as in json)
+func lookup( data interface{}, path string ) ( string, bool ) {
+  for _, part := range strings.Split( path, "." ) {
+    object, ok := data.( map[string]interface{} )
+    if ok != true {
+      return "", false
+    }
+    if data, ok = object[part] ; ok != true {
+      return "", false
+    }
+  }
+  switch value := data.( type ) {
+  case string:
+    return value, true
+  case map[string]interface{}, []interface{}:
+    return "", false
+  }
+  content, _ := json.Marshal( data )
+  return string( content ), true
+}
+
+// -----------------------------------------------
+
+type Event struct {
+  Id string `json:"id"`
+  Topic string `json:"topic"`
+  Source string `json:"source"`
+  Time time.Time `json:"time"`
+  ContentType string `json:"contenttype"`
+  Data []byte `json:"-"`
+  Depth int `json:"depth"`
+}
+
+// the events of a route's request : the depth is the one of its own event
+// (never below 0)
+func Depth( r *http.Request ) int {
+  depth, _ := strconv.Atoi( r.Header.Get( HeaderDepth ) )
+  if depth < 0 {
+    return 0
+  }
+  return depth
+}
+
+// the headers of the bus are only trusted on the jobs it submits : a client's
+// ones are removed
+func Untrust( header http.Header ) {
+  for _, name := range []string{ HeaderEvent, HeaderTopic, HeaderSource, HeaderDepth } {
+    header.Del( name )
+  }
+}
+
+type Wanted struct {
+  Key string
+  Subscriptions []Subscription
+  Policy *jobs.Policy
+}
+
+// a subscription of a route, for the API
+type State struct {
+  Route string `json:"route"`
+  Index int `json:"index"`
+  Subscription
+  Delivered int `json:"delivered"`
+}
+
+type entry struct {
+  state State
+  policy *jobs.Policy
+}
+
+type Bus struct {
+  Pool *jobs.Pool
+  logger *logger.Logger
+  mutex sync.Mutex
+  entries map[string][]*entry
+  sequence int64
+}
+
+func New( pool *jobs.Pool, logger *logger.Logger ) *Bus {
+  return &Bus {
+    Pool: pool,
+    logger: logger,
+    entries: make( map[string][]*entry ),
+  }
+}
+
+func ( entry *entry ) same( subscription Subscription ) bool {
+  current := entry.state.Subscription
+  if current.Topic != subscription.Topic || current.Ordered != subscription.Ordered || len( current.Filter ) != len( subscription.Filter ) {
+    return false
+  }
+  for field, value := range subscription.Filter {
+    if expected, ok := current.Filter[field] ; ok != true || expected != value {
+      return false
+    }
+  }
+  return true
+}
+
+// the routes' subscriptions ; one unchanged keeps its count
+func ( bus *Bus ) Sync( wanted []Wanted ) {
+  bus.mutex.Lock()
+  defer bus.mutex.Unlock()
+  entries := make( map[string][]*entry )
+  for _, route := range wanted {
+    previous := bus.entries[route.Key]
+    for i, subscription := range route.Subscriptions {
+      if i < len( previous ) && previous[i].same( subscription ) {
+        previous[i].policy = route.Policy.Copy()
+        entries[route.Key] = append( entries[route.Key], previous[i] )
+        continue
+      }
+      entries[route.Key] = append( entries[route.Key], &entry {
+        state: State { Route: route.Key, Index: i, Subscription: subscription },
+        policy: route.Policy.Copy(),
+      } )
+    }
+  }
+  bus.entries = entries
+}
+
+func ( bus *Bus ) States() []State {
+  bus.mutex.Lock()
+  defer bus.mutex.Unlock()
+  states := []State{}
+  for _, entries := range bus.entries {
+    for _, e := range entries {
+      states = append( states, e.state )
+    }
+  }
+  sort.Slice( states, func( i int, j int ) bool {
+    if states[i].Route != states[j].Route {
+      return states[i].Route < states[j].Route
+    }
+    return states[i].Index < states[j].Index
+  } )
+  return states
+}
+
+// -----------------------------------------------
+
+// a job for each subscription matching (the routes in order) ; the event is
+// refused beyond the depth. A subscription's job refused is only logged : the
+// others are kept
+func ( bus *Bus ) Publish( event Event ) ( Event, []jobs.Job, error ) {
+  if ValidTopic( event.Topic ) != true {
+    return event, nil, errors.New( fmt.Sprintf( "topic invalid : '%v'", event.Topic ) )
+  }
+  if event.Depth > DepthMax {
+    return event, nil, ErrDepth
+  }
+  if event.ContentType == "" {
+    event.ContentType = ContentTypeDefault
+  }
+  bus.mutex.Lock()
+  defer bus.mutex.Unlock()
+  bus.sequence++
+  event.Time = time.Now()
+  event.Id = strconv.FormatInt( event.Time.UnixNano(), 36 )+"-"+strconv.FormatInt( bus.sequence, 36 )
+  keys := make( []string, 0, len( bus.entries ) )
+  for key := range bus.entries {
+    keys = append( keys, key )
+  }
+  sort.Strings( keys )
+  submitted := []jobs.Job{}
+  for _, key := range keys {
+    for _, e := range bus.entries[key] {
+      if e.state.Subscription.Matches( event ) != true {
+        continue
+      }
+      job, err := bus.Pool.Submit( key, e.request( event ), e.policy )
+      if err != nil {
+        bus.logger.Warningf( "event '%v' (topic '%v') not delivered to route '%v' : %v", event.Id, event.Topic, key, err )
+        continue
+      }
+      e.state.Delivered++
+      submitted = append( submitted, job )
+    }
+  }
+  bus.logger.Infof( "event '%v' published on '%v' by '%v' (%v subscription(s))", event.Id, event.Topic, event.Source, len( submitted ) )
+  return event, submitted, nil
+}
+
+func ( e *entry ) request( event Event ) *jobs.Request {
+  request := &jobs.Request {
+    Origin: OriginPrefix+event.Topic,
+    Method: http.MethodPost,
+    URL: "/lambda/"+e.state.Route,
+    Header: http.Header {
+      "Content-Type": []string{ event.ContentType },
+      HeaderEvent: []string{ event.Id },
+      HeaderTopic: []string{ event.Topic },
+      HeaderSource: []string{ event.Source },
+      HeaderDepth: []string{ strconv.Itoa( event.Depth+1 ) },
+    },
+    Body: event.Data,
+    Env: map[string]string {
+      EnvEvent: event.Id,
+      EnvTopic: event.Topic,
+      EnvSource: event.Source,
+    },
+  }
+  if e.state.Ordered {
+    request.Sequence = OriginPrefix+e.state.Route+"/"+strconv.Itoa( e.state.Index )
+  }
+  return request
+}
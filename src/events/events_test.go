@@ -0,0 +1,94 @@
+package events
+
+import (
+  "net/http"
+  "testing"
+  // -----------
+  "jobs"
+  "logger"
+)
+
+func TestMatchTopic( t *testing.T ) {
+  for pattern, topics := range map[string]map[string]bool {
+    "orders.created": { "orders.created": true, "orders": false, "orders.created.eu": false },
+    "orders.*": { "orders.created": true, "orders": false, "orders.created.eu": false },
+    "orders.>": { "orders.created": true, "orders": false, "orders.created.eu": true },
+    ">": { "orders": true, "users.deleted": true },
+  } {
+    for topic, expected := range topics {
+      if matchTopic( pattern, topic ) != expected {
+        t.Errorf( "'%v' on '%v' : %v expected", pattern, topic, expected )
+      }
+    }
+  }
+  for _, pattern := range []string{ "", "orders.", "a.>.b", "a..b", "a.b*" } {
+    if _, ok := ( Subscription { Topic: pattern } ).Problems()["topic"] ; ok != true {
+      t.Errorf( "pattern '%v' must be refused", pattern )
+    }
+  }
+}
+
+func TestMatches( t *testing.T ) {
+  subscription := Subscription { Topic: "orders.*", Filter: map[string]string { "status": "paid", "customer.vip": "true", "total": "12.5" } }
+  event := Event { Topic: "orders.updated", Data: []byte( `{"status":"paid","total":12.5,"customer":{"vip":true}}` ) }
+  if subscription.Matches( event ) != true {
+    t.Error( "the filter must match" )
+  }
+  event.Data = []byte( `{"status":"paid","total":12.5,"customer":{"vip":false}}` )
+  if subscription.Matches( event ) {
+    t.Error( "a field different mustn't match" )
+  }
+  event.Data = []byte( "paid" )
+  if subscription.Matches( event ) {
+    t.Error( "an event not json mustn't match a filter" )
+  }
+}
+
+func TestPublish( t *testing.T ) {
+  l := &logger.Logger{}
+  l.Init()
+  pool := jobs.NewPool( "", l )
+  bus := New( pool, l )
+  bus.Sync( []Wanted {
+    { Key: "audit", Subscriptions: []Subscription { { Topic: ">" } } },
+    { Key: "billing", Subscriptions: []Subscription { { Topic: "orders.paid", Ordered: true }, { Topic: "users.*" } } },
+  } )
+  event, submitted, err := bus.Publish( Event { Topic: "orders.paid", Source: "shop", Data: []byte( "{}" ), Depth: 2 } )
+  if err != nil || len( submitted ) != 2 || submitted[0].Route != "audit" || submitted[1].Route != "billing" {
+    t.Fatalf( "a job for audit and billing expected : %+v (%v)", submitted, err )
+  }
+  if submitted[0].Sequence != "" || submitted[1].Sequence == "" || submitted[1].Origin != OriginPrefix+"orders.paid" {
+    t.Errorf( "only the ordered subscription has a sequence : %+v", submitted )
+  }
+  states := bus.States()
+  if len( states ) != 3 || states[1].Delivered != 1 || states[2].Delivered != 0 {
+    t.Errorf( "unexpected states : %+v", states )
+  }
+  if event.Id == "" || event.ContentType != ContentTypeDefault {
+    t.Errorf( "unexpected event : %+v", event )
+  }
+  // unchanged, the subscription keeps its count
+  bus.Sync( []Wanted { { Key: "billing", Subscriptions: []Subscription { { Topic: "orders.paid", Ordered: true } } } } )
+  if states := bus.States() ; len( states ) != 1 || states[0].Delivered != 1 {
+    t.Errorf( "the count must be kept : %+v", states )
+  }
+  if _, _, err := bus.Publish( Event { Topic: "orders.paid", Depth: DepthMax+1 } ) ; err != ErrDepth {
+    t.Errorf( "an event too deep must be refused : %v", err )
+  }
+  if _, _, err := bus.Publish( Event { Topic: "orders.*" } ) ; err == nil {
+    t.Error( "a pattern isn't a topic" )
+  }
+}
+
+func TestDepth( t *testing.T ) {
+  r, _ := http.NewRequest( http.MethodPost, "/lambda/billing", nil )
+  r.Header.Set( HeaderDepth, "-100" )
+  if depth := Depth( r ) ; depth != 0 {
+    t.Errorf( "a negative depth must be 0 : %v", depth )
+  }
+  r.Header.Set( HeaderTopic, "orders.paid" )
+  Untrust( r.Header )
+  if Depth( r ) != 0 || r.Header.Get( HeaderTopic ) != "" {
+    t.Errorf( "the headers of the bus must be removed : %v", r.Header )
+  }
+}
@@ -19,13 +19,10 @@ type Containers struct {
   Logger *logger.Logger
 }
 
-func ( container *Containers ) ExecuteRequest ( ctx context.Context, routeName string, scriptPath string, fileEnvPath string, imageContainer string, scriptCmd []string ) ( cmd *exec.Cmd, err error ) {
+func ( container *Containers ) ExecuteRequest ( ctx context.Context, routeName string, scriptPath string, fileEnvPath string, imageContainer string, scriptCmd []string, requestEnv map[string]string ) ( cmd *exec.Cmd, err error ) {
   if routeName == "" {
     return nil, errors.New( "image's name undefined" ) 
   } 
-  if scriptPath == "" {
-    return nil, errors.New( "script's path undefined" ) 
-  } 
   if fileEnvPath == "" {
     return nil, errors.New( "env file's path undefined" ) 
   } 
@@ -40,11 +37,17 @@ func ( container *Containers ) ExecuteRequest ( ctx context.Context, routeName s
       "-a", "stdout", 
       "-a", "stdin", 
       "--label", "faass=true",
-      "--mount", "type=bind,source="+scriptPath+",target=/function,readonly",
       "--hostname", routeName,
       "--env-file", fileEnvPath,
-      imageContainer, 
   } 
+  // without script, the code is in the image (built)
+  if scriptPath != "" {
+    args = append( args, "--mount", "type=bind,source="+scriptPath+",target=/function,readonly" )
+  }
+  for envName, envValue := range requestEnv {
+    args = append( args, "--env", envName+"="+envValue )
+  }
+  args = append( args, imageContainer )
   args = append(args, scriptCmd[:]...)
   cmd = exec.CommandContext( ctx, container.PathCmd, args... )
   return cmd, nil 
@@ -140,7 +143,7 @@ func ( container *Containers ) Create ( tmpDir string, route *itinerary.Route )
   route.Id = cId 
   cIP, err := container.GetInfos( route, "{{range .NetworkSettings.Networks}}{{.IPAddress}}{{end}}" )
   if err != nil {
-    container.Logger.Errorf( "container '%v' (cId %v) check failed", route.Name, route.Id, err )
+    container.Logger.With( logger.FieldContainer, route.Id ).Errorf( "container '%v' check failed : %v", route.Name, err )
     return "undetermined", errors.New( cIP )
   }
   route.IpAdress = cIP
@@ -154,7 +157,7 @@ func ( container *Containers ) Check ( route *itinerary.Route ) ( state string,
   }
   cState, err := container.GetInfos( route, "{{.State.Status}}" )
   if err != nil {
-    container.Logger.Errorf( "container '%s' check failed", route.Name, err )
+    container.Logger.With( logger.FieldContainer, route.Id ).Errorf( "container '%s' check failed : %v", route.Name, err )
     return "undetermined", errors.New( cState )
   }
   return cState, nil
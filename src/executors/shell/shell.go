@@ -8,7 +8,7 @@ import (
   // -----------
 )
 
-func ExecuteRequest ( ctx context.Context, routeName string, scriptPath string, scriptCmd []string, routeEnv map[string]string ) ( cmd *exec.Cmd, err error ) {
+func ExecuteRequest ( ctx context.Context, routeName string, scriptPath string, scriptCmd []string, routeEnv map[string]string, requestEnv map[string]string ) ( cmd *exec.Cmd, err error ) {
   if routeName == "" {
     return nil, errors.New( "route's name undefined" ) 
   } 
@@ -29,6 +29,12 @@ func ExecuteRequest ( ctx context.Context, routeName string, scriptPath string,
       fmt.Sprintf( "%v=%v", envName, envValue ),
     ) 
   }
+  for envName, envValue := range requestEnv {
+    envLocal = append( 
+      envLocal, 
+      fmt.Sprintf( "%v=%v", envName, envValue ),
+    ) 
+  }
   cmd.Env = envLocal
   return cmd, nil 
 }
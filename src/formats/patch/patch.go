@@ -0,0 +1,325 @@
+package patch
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "reflect"
+  "strconv"
+  "strings"
+  // -----------
+)
+
+// -----------------------------------------------
+
+// JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902) on decoded JSON values
+// (map[string]interface{}, []interface{} and scalars)
+
+const (
+  ContentTypeMergePatch                 = "application/merge-patch+json"
+  ContentTypeJSONPatch                  = "application/json-patch+json"
+)
+
+// -----------------------------------------------
+
+// null removes a member ; an object is merged, any other value replaces
+func Merge( target interface{}, patch interface{} ) interface{} {
+  patchObject, ok := patch.( map[string]interface{} )
+  if ok != true {
+    return patch
+  }
+  targetObject, ok := target.( map[string]interface{} )
+  if ok != true {
+    targetObject = map[string]interface{}{}
+  }
+  for key, value := range patchObject {
+    if value == nil {
+      delete( targetObject, key )
+      continue
+    }
+    targetObject[key] = Merge( targetObject[key], value )
+  }
+  return targetObject
+}
+
+// -----------------------------------------------
+
+type Operation struct {
+  Op string `json:"op"`
+  Path string `json:"path"`
+  From string `json:"from,omitempty"`
+  Value interface{} `json:"value,omitempty"`
+  hasValue bool
+}
+
+func ( operation *Operation ) UnmarshalJSON( data []byte ) error {
+  var raw map[string]json.RawMessage
+  if err := json.Unmarshal( data, &raw ) ; err != nil {
+    return err
+  }
+  for key, target := range map[string]*string { "op": &operation.Op, "path": &operation.Path, "from": &operation.From } {
+    if value, ok := raw[key] ; ok {
+      if err := json.Unmarshal( value, target ) ; err != nil {
+        return errors.New( "member '"+key+"' must be a string" )
+      }
+    }
+  }
+  // a null value is a value
+  if value, ok := raw["value"] ; ok {
+    operation.hasValue = true
+    return json.Unmarshal( value, &operation.Value )
+  }
+  return nil
+}
+
+// an error of a JSON Patch, by operation
+type Error struct {
+  Index int
+  Path string
+  Message string
+  Failed bool
+}
+
+func ( err *Error ) Error() string {
+  return fmt.Sprintf( "operation %v on '%v' : %v", err.Index, err.Path, err.Message )
+}
+
+// the operations are applied in order on a copy : all or nothing ; a failed
+// "test" gives an Error with Failed
+func Apply( document interface{}, operations []Operation ) ( interface{}, error ) {
+  document = deepCopy( document )
+  for i, operation := range operations {
+    var err error
+    document, err = apply( document, operation )
+    if err != nil {
+      patchErr := &Error { Index: i, Path: operation.Path, Message: err.Error() }
+      if err == errTestFailed {
+        patchErr.Failed = true
+      }
+      return nil, patchErr
+    }
+  }
+  return document, nil
+}
+
+var errTestFailed = errors.New( "test failed" )
+
+func apply( document interface{}, operation Operation ) ( interface{}, error ) {
+  switch operation.Op {
+  case "add", "replace", "test":
+    if operation.hasValue != true {
+      return nil, errors.New( "member 'value' missing" )
+    }
+  case "move", "copy":
+    if _, err := Split( operation.From ) ; err != nil {
+      return nil, errors.New( "member 'from' invalid" )
+    }
+  case "remove":
+  default:
+    return nil, errors.New( "unknown operation '"+operation.Op+"'" )
+  }
+  tokens, err := Split( operation.Path )
+  if err != nil {
+    return nil, err
+  }
+  switch operation.Op {
+  case "add":
+    return add( document, tokens, deepCopy( operation.Value ) )
+  case "remove":
+    document, _, err = remove( document, tokens )
+    return document, err
+  case "replace":
+    if _, err := Get( document, tokens ) ; err != nil {
+      return nil, err
+    }
+    if document, _, err = remove( document, tokens ) ; err != nil {
+      return nil, err
+    }
+    return add( document, tokens, deepCopy( operation.Value ) )
+  case "test":
+    value, err := Get( document, tokens )
+    if err != nil {
+      return nil, err
+    }
+    if equal( value, operation.Value ) != true {
+      return nil, errTestFailed
+    }
+    return document, nil
+  }
+  from, _ := Split( operation.From )
+  value, err := Get( document, from )
+  if err != nil {
+    return nil, err
+  }
+  if operation.Op == "move" {
+    if strings.HasPrefix( operation.Path+"/", operation.From+"/" ) && operation.Path != operation.From {
+      return nil, errors.New( "a value can't be moved into itself" )
+    }
+    if document, _, err = remove( document, from ) ; err != nil {
+      return nil, err
+    }
+  } else {
+    value = deepCopy( value )
+  }
+  return add( document, tokens, value )
+}
+
+// -----------------------------------------------
+
+// "" is the whole document
+func Split( pointer string ) ( []string, error ) {
+  if pointer == "" {
+    return []string{}, nil
+  }
+  if strings.HasPrefix( pointer, "/" ) != true {
+    return nil, errors.New( "pointer must start with '/'" )
+  }
+  tokens := strings.Split( pointer[1:], "/" )
+  for i, token := range tokens {
+    tokens[i] = strings.ReplaceAll( strings.ReplaceAll( token, "~1", "/" ), "~0", "~" )
+  }
+  return tokens, nil
+}
+
+func arrayIndex( list []interface{}, token string, appending bool ) ( int, error ) {
+  if appending && token == "-" {
+    return len( list ), nil
+  }
+  index, err := strconv.Atoi( token )
+  if err != nil || index < 0 || ( token != "0" && strings.HasPrefix( token, "0" ) ) {
+    return 0, errors.New( "array index invalid : '"+token+"'" )
+  }
+  max := len( list )-1
+  if appending {
+    max = len( list )
+  }
+  if index > max {
+    return 0, errors.New( "array index out of range : '"+token+"'" )
+  }
+  return index, nil
+}
+
+func Get( document interface{}, tokens []string ) ( interface{}, error ) {
+  current := document
+  for _, token := range tokens {
+    switch v := current.( type ) {
+    case map[string]interface{}:
+      value, ok := v[token]
+      if ok != true {
+        return nil, errors.New( "path not found" )
+      }
+      current = value
+    case []interface{}:
+      index, err := arrayIndex( v, token, false )
+      if err != nil {
+        return nil, err
+      }
+      current = v[index]
+    default:
+      return nil, errors.New( "path not found" )
+    }
+  }
+  return current, nil
+}
+
+func add( document interface{}, tokens []string, value interface{} ) ( interface{}, error ) {
+  if len( tokens ) == 0 {
+    return value, nil
+  }
+  parent, err := Get( document, tokens[:len( tokens )-1] )
+  if err != nil {
+    return nil, err
+  }
+  last := tokens[len( tokens )-1]
+  switch v := parent.( type ) {
+  case map[string]interface{}:
+    v[last] = value
+    return document, nil
+  case []interface{}:
+    index, err := arrayIndex( v, last, true )
+    if err != nil {
+      return nil, err
+    }
+    list := append( v[:index:index], append( []interface{}{ value }, v[index:]... )... )
+    return add( document, tokens[:len( tokens )-1], list )
+  }
+  return nil, errors.New( "parent is not a container" )
+}
+
+func remove( document interface{}, tokens []string ) ( interface{}, interface{}, error ) {
+  if len( tokens ) == 0 {
+    return nil, document, nil
+  }
+  parent, err := Get( document, tokens[:len( tokens )-1] )
+  if err != nil {
+    return nil, nil, err
+  }
+  last := tokens[len( tokens )-1]
+  switch v := parent.( type ) {
+  case map[string]interface{}:
+    value, ok := v[last]
+    if ok != true {
+      return nil, nil, errors.New( "path not found" )
+    }
+    delete( v, last )
+    return document, value, nil
+  case []interface{}:
+    index, err := arrayIndex( v, last, false )
+    if err != nil {
+      return nil, nil, err
+    }
+    value := v[index]
+    list := append( v[:index:index], v[index+1:]... )
+    document, err = add( document, tokens[:len( tokens )-1], list )
+    return document, value, err
+  }
+  return nil, nil, errors.New( "path not found" )
+}
+
+// numbers can be float64 or json.Number : they are compared by their value
+func equal( a interface{}, b interface{} ) bool {
+  return reflect.DeepEqual( normalize( a ), normalize( b ) )
+}
+
+func normalize( value interface{} ) interface{} {
+  switch v := value.( type ) {
+  case json.Number:
+    f, _ := v.Float64()
+    return f
+  case int:
+    return float64( v )
+  case int64:
+    return float64( v )
+  case map[string]interface{}:
+    copied := make( map[string]interface{}, len( v ) )
+    for key, child := range v {
+      copied[key] = normalize( child )
+    }
+    return copied
+  case []interface{}:
+    copied := make( []interface{}, len( v ) )
+    for i, child := range v {
+      copied[i] = normalize( child )
+    }
+    return copied
+  }
+  return value
+}
+
+func deepCopy( value interface{} ) interface{} {
+  switch v := value.( type ) {
+  case map[string]interface{}:
+    copied := make( map[string]interface{}, len( v ) )
+    for key, child := range v {
+      copied[key] = deepCopy( child )
+    }
+    return copied
+  case []interface{}:
+    copied := make( []interface{}, len( v ) )
+    for i, child := range v {
+      copied[i] = deepCopy( child )
+    }
+    return copied
+  }
+  return value
+}
@@ -0,0 +1,66 @@
+package patch
+
+import (
+  "encoding/json"
+  "reflect"
+  "testing"
+)
+
+func decode( t *testing.T, content string ) interface{} {
+  var value interface{}
+  if err := json.Unmarshal( []byte( content ), &value ) ; err != nil {
+    t.Fatal( err )
+  }
+  return value
+}
+
+func TestMerge( t *testing.T ) {
+  target := decode( t, `{"delay":40,"routes":{"a":{"timeout":10,"env":{"X":"1"}},"b":{}}}` )
+  patched := Merge( target, decode( t, `{"delay":50,"routes":{"a":{"env":{"X":null,"Y":"2"}},"b":null}}` ) )
+  expected := decode( t, `{"delay":50,"routes":{"a":{"timeout":10,"env":{"Y":"2"}}}}` )
+  if !reflect.DeepEqual( patched, expected ) {
+    t.Errorf( "unexpected merge : %v", patched )
+  }
+}
+
+func TestApply( t *testing.T ) {
+  document := decode( t, `{"delay":40,"routes":{"a":{"cmd":["x","y"]}},"escaped/key":1}` )
+  var operations []Operation
+  if err := json.Unmarshal( []byte( `[
+    {"op":"test","path":"/delay","value":40},
+    {"op":"replace","path":"/delay","value":50},
+    {"op":"add","path":"/routes/a/cmd/1","value":"z"},
+    {"op":"add","path":"/routes/a/cmd/-","value":null},
+    {"op":"remove","path":"/routes/a/cmd/0"},
+    {"op":"copy","from":"/routes/a","path":"/routes/b"},
+    {"op":"move","from":"/escaped~1key","path":"/moved"}
+  ]` ), &operations ) ; err != nil {
+    t.Fatal( err )
+  }
+  patched, err := Apply( document, operations )
+  if err != nil {
+    t.Fatal( err )
+  }
+  expected := decode( t, `{"delay":50,"routes":{"a":{"cmd":["z","y",null]},"b":{"cmd":["z","y",null]}},"moved":1}` )
+  if !reflect.DeepEqual( patched, expected ) {
+    t.Errorf( "unexpected patch : %v", patched )
+  }
+  if document.( map[string]interface{} )["delay"] != float64( 40 ) {
+    t.Error( "original document modified" )
+  }
+  for content, failed := range map[string]bool {
+    `[{"op":"test","path":"/delay","value":41}]`: true,
+    `[{"op":"replace","path":"/unknown","value":1}]`: false,
+    `[{"op":"add","path":"/routes/a/cmd/9","value":1}]`: false,
+    `[{"op":"add","path":"/delay"}]`: false,
+    `[{"op":"move","from":"/routes","path":"/routes/a/x"}]`: false,
+  } {
+    operations = nil
+    json.Unmarshal( []byte( content ), &operations )
+    _, err := Apply( document, operations )
+    patchErr, ok := err.( *Error )
+    if ok != true || patchErr.Failed != failed {
+      t.Errorf( "%v : unexpected error %v", content, err )
+    }
+  }
+}
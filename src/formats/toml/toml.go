@@ -0,0 +1,651 @@
+package toml
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+  "unicode/utf8"
+  // -----------
+)
+
+// -----------------------------------------------
+
+// subset of TOML 1.0 used by faass' files : tables, arrays of tables, dotted keys,
+// basic and literal strings (multi-lines too), integers, floats, booleans, arrays
+// and inline tables ; dates are kept as strings
+
+var dateRegex = regexp.MustCompile( `^\d{4}-\d{2}-\d{2}([T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:\d{2})?)?$|^\d{2}:\d{2}:\d{2}(\.\d+)?$` )
+
+var bareKeyRegex = regexp.MustCompile( `^[A-Za-z0-9_-]+$` )
+
+// -----------------------------------------------
+
+func Unmarshal( data []byte, v interface{} ) error {
+  value, err := Decode( data )
+  if err != nil {
+    return err
+  }
+  content, err := json.Marshal( value )
+  if err != nil {
+    return err
+  }
+  return json.Unmarshal( content, v )
+}
+
+func Marshal( v interface{} ) ( []byte, error ) {
+  content, err := json.Marshal( v )
+  if err != nil {
+    return nil, err
+  }
+  decoder := json.NewDecoder( bytes.NewReader( content ) )
+  decoder.UseNumber()
+  var value interface{}
+  if err := decoder.Decode( &value ) ; err != nil {
+    return nil, err
+  }
+  return Encode( value )
+}
+
+// -----------------------------------------------
+
+type parser struct {
+  text string
+  position int
+  number int
+  root map[string]interface{}
+  current map[string]interface{}
+  defined map[string]bool
+}
+
+func isBareKeyChar( c byte ) bool {
+  return ( c >= 'A' && c <= 'Z' ) || ( c >= 'a' && c <= 'z' ) || ( c >= '0' && c <= '9' ) || c == '_' || c == '-'
+}
+
+func errorAt( number int, message string ) error {
+  return errors.New( fmt.Sprintf( "toml line %v : %v", number, message ) )
+}
+
+func Decode( data []byte ) ( interface{}, error ) {
+  p := &parser {
+    text: strings.ReplaceAll( string( data ), "\r\n", "\n" ),
+    number: 1,
+    root: map[string]interface{}{},
+    defined: map[string]bool{},
+  }
+  p.current = p.root
+  for {
+    p.skipBlank( true )
+    if p.position >= len( p.text ) {
+      break
+    }
+    var err error
+    if p.text[p.position] == '[' {
+      err = p.parseHeader()
+    } else {
+      err = p.parseKeyValue( p.current )
+    }
+    if err != nil {
+      return nil, err
+    }
+    if err := p.endOfLine() ; err != nil {
+      return nil, err
+    }
+  }
+  return p.root, nil
+}
+
+// -----------------------------------------------
+
+func ( p *parser ) peek() byte {
+  if p.position >= len( p.text ) {
+    return 0
+  }
+  return p.text[p.position]
+}
+
+// spaces and comments ; newlines too if asked
+func ( p *parser ) skipBlank( newlines bool ) {
+  for p.position < len( p.text ) {
+    switch p.text[p.position] {
+    case ' ', '\t':
+      p.position++
+    case '\n':
+      if newlines != true {
+        return
+      }
+      p.number++
+      p.position++
+    case '#':
+      for p.position < len( p.text ) && p.text[p.position] != '\n' {
+        p.position++
+      }
+    default:
+      return
+    }
+  }
+}
+
+func ( p *parser ) endOfLine() error {
+  p.skipBlank( false )
+  if p.position < len( p.text ) && p.text[p.position] != '\n' {
+    return errorAt( p.number, "end of line expected" )
+  }
+  return nil
+}
+
+func ( p *parser ) parseKeyPath() ( []string, error ) {
+  keys := []string{}
+  for {
+    p.skipBlank( false )
+    var key string
+    switch p.peek() {
+    case '"', '\'':
+      value, err := p.parseString()
+      if err != nil {
+        return nil, err
+      }
+      key = value
+    default:
+      start := p.position
+      for p.position < len( p.text ) && isBareKeyChar( p.text[p.position] ) {
+        p.position++
+      }
+      if start == p.position {
+        return nil, errorAt( p.number, "key expected" )
+      }
+      key = p.text[start:p.position]
+    }
+    keys = append( keys, key )
+    p.skipBlank( false )
+    if p.peek() != '.' {
+      return keys, nil
+    }
+    p.position++
+  }
+}
+
+// intermediate tables are created ; an array of tables gives its last element
+func ( p *parser ) descend( table map[string]interface{}, keys []string ) ( map[string]interface{}, error ) {
+  for _, key := range keys {
+    switch next := table[key].( type ) {
+    case nil:
+      created := map[string]interface{}{}
+      table[key] = created
+      table = created
+    case map[string]interface{}:
+      table = next
+    case []interface{}:
+      if len( next ) == 0 {
+        return nil, errorAt( p.number, "key '"+key+"' is not a table" )
+      }
+      last, ok := next[len( next )-1].( map[string]interface{} )
+      if ok != true {
+        return nil, errorAt( p.number, "key '"+key+"' is not a table" )
+      }
+      table = last
+    default:
+      return nil, errorAt( p.number, "key '"+key+"' is not a table" )
+    }
+  }
+  return table, nil
+}
+
+func ( p *parser ) parseHeader() error {
+  p.position++
+  array := false
+  if p.peek() == '[' {
+    array = true
+    p.position++
+  }
+  keys, err := p.parseKeyPath()
+  if err != nil {
+    return err
+  }
+  closing := "]"
+  if array {
+    closing = "]]"
+  }
+  if strings.HasPrefix( p.text[p.position:], closing ) != true {
+    return errorAt( p.number, "'"+closing+"' expected" )
+  }
+  p.position += len( closing )
+  parent, err := p.descend( p.root, keys[:len( keys )-1] )
+  if err != nil {
+    return err
+  }
+  last := keys[len( keys )-1]
+  if array {
+    list, ok := parent[last].( []interface{} )
+    if parent[last] != nil && ok != true {
+      return errorAt( p.number, "key '"+last+"' is not an array of tables" )
+    }
+    table := map[string]interface{}{}
+    parent[last] = append( list, table )
+    p.current = table
+    return nil
+  }
+  path := strings.Join( keys, "\x00" )
+  if p.defined[path] {
+    return errorAt( p.number, "table '"+strings.Join( keys, "." )+"' defined twice" )
+  }
+  p.defined[path] = true
+  table, err := p.descend( parent, []string{ last } )
+  if err != nil {
+    return err
+  }
+  p.current = table
+  return nil
+}
+
+func ( p *parser ) parseKeyValue( table map[string]interface{} ) error {
+  keys, err := p.parseKeyPath()
+  if err != nil {
+    return err
+  }
+  if p.peek() != '=' {
+    return errorAt( p.number, "'=' expected" )
+  }
+  p.position++
+  p.skipBlank( false )
+  value, err := p.parseValue()
+  if err != nil {
+    return err
+  }
+  parent, err := p.descend( table, keys[:len( keys )-1] )
+  if err != nil {
+    return err
+  }
+  last := keys[len( keys )-1]
+  if _, ok := parent[last] ; ok {
+    return errorAt( p.number, "duplicate key '"+last+"'" )
+  }
+  parent[last] = value
+  return nil
+}
+
+// -----------------------------------------------
+
+func ( p *parser ) parseValue() ( interface{}, error ) {
+  switch p.peek() {
+  case 0, '\n':
+    return nil, errorAt( p.number, "value expected" )
+  case '"', '\'':
+    return p.parseString()
+  case '[':
+    p.position++
+    list := []interface{}{}
+    for {
+      p.skipBlank( true )
+      if p.peek() == ']' {
+        p.position++
+        return list, nil
+      }
+      value, err := p.parseValue()
+      if err != nil {
+        return nil, err
+      }
+      list = append( list, value )
+      p.skipBlank( true )
+      switch p.peek() {
+      case ',':
+        p.position++
+      case ']':
+      default:
+        return nil, errorAt( p.number, "',' or ']' expected in array" )
+      }
+    }
+  case '{':
+    p.position++
+    table := map[string]interface{}{}
+    for {
+      p.skipBlank( false )
+      if p.peek() == '}' {
+        p.position++
+        return table, nil
+      }
+      if err := p.parseKeyValue( table ) ; err != nil {
+        return nil, err
+      }
+      p.skipBlank( false )
+      switch p.peek() {
+      case ',':
+        p.position++
+      case '}':
+      default:
+        return nil, errorAt( p.number, "',' or '}' expected in inline table" )
+      }
+    }
+  }
+  start := p.position
+  for p.position < len( p.text ) && strings.IndexByte( " \t\n,]}#", p.text[p.position] ) < 0 {
+    p.position++
+  }
+  // local date-time with a space separator
+  if p.position-start == 10 && strings.HasPrefix( p.text[p.position:], " " ) && dateRegex.MatchString( p.text[start:p.position] ) {
+    end := p.position+1
+    for end < len( p.text ) && strings.IndexByte( " \t\n,]}#", p.text[end] ) < 0 {
+      end++
+    }
+    if dateRegex.MatchString( p.text[start:end] ) {
+      p.position = end
+    }
+  }
+  return p.parseBare( p.text[start:p.position] )
+}
+
+func ( p *parser ) parseBare( token string ) ( interface{}, error ) {
+  switch token {
+  case "true":
+    return true, nil
+  case "false":
+    return false, nil
+  }
+  if dateRegex.MatchString( token ) {
+    return token, nil
+  }
+  clean := strings.ReplaceAll( token, "_", "" )
+  for _, prefix := range []string{ "0x", "0o", "0b" } {
+    if strings.HasPrefix( clean, prefix ) {
+      i, err := strconv.ParseInt( clean, 0, 64 )
+      if err != nil {
+        return nil, errorAt( p.number, "invalid integer '"+token+"'" )
+      }
+      return i, nil
+    }
+  }
+  if i, err := strconv.ParseInt( clean, 10, 64 ) ; err == nil {
+    return i, nil
+  }
+  if f, err := strconv.ParseFloat( clean, 64 ) ; err == nil && strings.ContainsAny( clean, "0123456789" ) {
+    return f, nil
+  }
+  return nil, errorAt( p.number, "invalid value '"+token+"'" )
+}
+
+func ( p *parser ) parseString() ( string, error ) {
+  quote := p.text[p.position]
+  multiline := strings.HasPrefix( p.text[p.position:], strings.Repeat( string( quote ), 3 ) )
+  if multiline {
+    p.position += 3
+    // a newline just after the opening delimiter is trimmed
+    if p.peek() == '\n' {
+      p.number++
+      p.position++
+    }
+  } else {
+    p.position++
+  }
+  var builder strings.Builder
+  for {
+    if p.position >= len( p.text ) {
+      return "", errorAt( p.number, "unterminated string" )
+    }
+    c := p.text[p.position]
+    if multiline && strings.HasPrefix( p.text[p.position:], strings.Repeat( string( quote ), 3 ) ) {
+      p.position += 3
+      // up to two quotes can precede the closing delimiter
+      for n := 0 ; n < 2 && p.peek() == quote ; n++ {
+        builder.WriteByte( quote )
+        p.position++
+      }
+      return builder.String(), nil
+    }
+    if multiline != true && c == quote {
+      p.position++
+      return builder.String(), nil
+    }
+    if c == '\n' {
+      if multiline != true {
+        return "", errorAt( p.number, "newline in single-line string" )
+      }
+      p.number++
+    }
+    if c == '\\' && quote == '"' {
+      if err := p.parseEscape( &builder, multiline ) ; err != nil {
+        return "", err
+      }
+      continue
+    }
+    builder.WriteByte( c )
+    p.position++
+  }
+}
+
+func ( p *parser ) parseEscape( builder *strings.Builder, multiline bool ) error {
+  p.position++
+  if p.position >= len( p.text ) {
+    return errorAt( p.number, "unterminated string" )
+  }
+  c := p.text[p.position]
+  p.position++
+  switch c {
+  case 'b':
+    builder.WriteByte( '\b' )
+  case 't':
+    builder.WriteByte( '\t' )
+  case 'n':
+    builder.WriteByte( '\n' )
+  case 'f':
+    builder.WriteByte( '\f' )
+  case 'r':
+    builder.WriteByte( '\r' )
+  case '"':
+    builder.WriteByte( '"' )
+  case '\\':
+    builder.WriteByte( '\\' )
+  case 'u', 'U':
+    size := 4
+    if c == 'U' {
+      size = 8
+    }
+    if p.position+size > len( p.text ) {
+      return errorAt( p.number, "invalid unicode escape" )
+    }
+    code, err := strconv.ParseUint( p.text[p.position:p.position+size], 16, 32 )
+    if err != nil || utf8.ValidRune( rune( code ) ) != true {
+      return errorAt( p.number, "invalid unicode escape" )
+    }
+    builder.WriteRune( rune( code ) )
+    p.position += size
+  default:
+    // line ending backslash : newline and leading whitespaces are trimmed
+    if multiline && ( c == ' ' || c == '\t' || c == '\n' ) {
+      p.position--
+      rest := strings.TrimLeft( p.text[p.position:], " \t" )
+      if strings.HasPrefix( rest, "\n" ) != true {
+        return errorAt( p.number, "invalid escape" )
+      }
+      for p.position < len( p.text ) && strings.IndexByte( " \t\n", p.text[p.position] ) >= 0 {
+        if p.text[p.position] == '\n' {
+          p.number++
+        }
+        p.position++
+      }
+      return nil
+    }
+    return errorAt( p.number, "invalid escape '\\"+string( c )+"'" )
+  }
+  return nil
+}
+
+// -----------------------------------------------
+
+// the root must be a table ; null values are omitted (no null in TOML)
+func Encode( value interface{} ) ( []byte, error ) {
+  table, ok := value.( map[string]interface{} )
+  if ok != true {
+    return nil, errors.New( "toml root must be a table" )
+  }
+  var buffer bytes.Buffer
+  if err := encodeTable( &buffer, nil, table ) ; err != nil {
+    return nil, err
+  }
+  return buffer.Bytes(), nil
+}
+
+func sortedKeys( table map[string]interface{} ) []string {
+  keys := make( []string, 0, len( table ) )
+  for key := range table {
+    keys = append( keys, key )
+  }
+  sort.Strings( keys )
+  return keys
+}
+
+func isTableArray( value interface{} ) bool {
+  list, ok := value.( []interface{} )
+  if ok != true || len( list ) == 0 {
+    return false
+  }
+  for _, item := range list {
+    if _, ok := item.( map[string]interface{} ) ; ok != true {
+      return false
+    }
+  }
+  return true
+}
+
+func encodeKey( key string ) string {
+  if bareKeyRegex.MatchString( key ) {
+    return key
+  }
+  return quote( key )
+}
+
+func encodePath( path []string ) string {
+  keys := make( []string, len( path ) )
+  for i, key := range path {
+    keys[i] = encodeKey( key )
+  }
+  return strings.Join( keys, "." )
+}
+
+func encodeTable( buffer *bytes.Buffer, path []string, table map[string]interface{} ) error {
+  keys := sortedKeys( table )
+  // key/values first, sub-tables after : a key after a header belongs to the header's table
+  for _, key := range keys {
+    value := table[key]
+    if _, ok := value.( map[string]interface{} ) ; ok || value == nil || isTableArray( value ) {
+      continue
+    }
+    inline, err := encodeInline( value )
+    if err != nil {
+      return err
+    }
+    buffer.WriteString( encodeKey( key )+" = "+inline+"\n" )
+  }
+  for _, key := range keys {
+    subPath := append( append( []string{}, path... ), key )
+    switch value := table[key].( type ) {
+    case map[string]interface{}:
+      // a table holding only sub-tables is implicitly defined by them
+      if hasValues( value ) || len( value ) == 0 {
+        buffer.WriteString( "\n["+encodePath( subPath )+"]\n" )
+      }
+      if err := encodeTable( buffer, subPath, value ) ; err != nil {
+        return err
+      }
+    case []interface{}:
+      if isTableArray( value ) != true {
+        continue
+      }
+      for _, item := range value {
+        buffer.WriteString( "\n[["+encodePath( subPath )+"]]\n" )
+        if err := encodeTable( buffer, subPath, item.( map[string]interface{} ) ) ; err != nil {
+          return err
+        }
+      }
+    }
+  }
+  return nil
+}
+
+func hasValues( table map[string]interface{} ) bool {
+  for _, value := range table {
+    if _, ok := value.( map[string]interface{} ) ; ok != true && value != nil && isTableArray( value ) != true {
+      return true
+    }
+  }
+  return false
+}
+
+func encodeInline( value interface{} ) ( string, error ) {
+  switch v := value.( type ) {
+  case nil:
+    return "", errors.New( "null value in array not supported by toml" )
+  case bool:
+    return strconv.FormatBool( v ), nil
+  case string:
+    return quote( v ), nil
+  case json.Number:
+    return v.String(), nil
+  case int:
+    return strconv.Itoa( v ), nil
+  case int64:
+    return strconv.FormatInt( v, 10 ), nil
+  case float64:
+    return strconv.FormatFloat( v, 'g', -1, 64 ), nil
+  case []interface{}:
+    items := make( []string, 0, len( v ) )
+    for _, item := range v {
+      encoded, err := encodeInline( item )
+      if err != nil {
+        return "", err
+      }
+      items = append( items, encoded )
+    }
+    if len( items ) == 0 {
+      return "[]", nil
+    }
+    return "[ "+strings.Join( items, ", " )+" ]", nil
+  case map[string]interface{}:
+    items := []string{}
+    for _, key := range sortedKeys( v ) {
+      if v[key] == nil {
+        continue
+      }
+      encoded, err := encodeInline( v[key] )
+      if err != nil {
+        return "", err
+      }
+      items = append( items, encodeKey( key )+" = "+encoded )
+    }
+    if len( items ) == 0 {
+      return "{}", nil
+    }
+    return "{ "+strings.Join( items, ", " )+" }", nil
+  }
+  return "", errors.New( fmt.Sprintf( "type %T not supported by toml", value ) )
+}
+
+func quote( s string ) string {
+  var builder strings.Builder
+  builder.WriteByte( '"' )
+  for _, r := range s {
+    switch r {
+    case '"':
+      builder.WriteString( `\"` )
+    case '\\':
+      builder.WriteString( `\\` )
+    case '\n':
+      builder.WriteString( `\n` )
+    case '\t':
+      builder.WriteString( `\t` )
+    case '\r':
+      builder.WriteString( `\r` )
+    default:
+      if r < 0x20 || r == 0x7f {
+        builder.WriteString( fmt.Sprintf( `\u%04X`, r ) )
+      } else {
+        builder.WriteRune( r )
+      }
+    }
+  }
+  builder.WriteByte( '"' )
+  return builder.String()
+}
@@ -0,0 +1,79 @@
+package toml
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestDecode( t *testing.T ) {
+  document := `
+# conf
+listen = 9_090
+domain = "https://localhost" # inline comment
+persist = true
+
+[authorizations]
+default = 'Basic YWRtaW46YXplcnR5'
+
+[routes.example-function]
+type = "function"
+cmd = [
+  "python3",
+  "/function", # trailing comma
+]
+env = { MODE = "prod", "faass-example" = "true" }
+script = """
+line 1
+line 2"""
+
+[[routes.example-function.certificates]]
+subject = "internal"
+
+[[routes.example-function.certificates]]
+fingerprint = "ab:cd"
+`
+  value, err := Decode( []byte( document ) )
+  if err != nil {
+    t.Fatal( err )
+  }
+  expected := map[string]interface{} {
+    "listen": int64( 9090 ),
+    "domain": "https://localhost",
+    "persist": true,
+    "authorizations": map[string]interface{}{ "default": "Basic YWRtaW46YXplcnR5" },
+    "routes": map[string]interface{} {
+      "example-function": map[string]interface{} {
+        "type": "function",
+        "cmd": []interface{}{ "python3", "/function" },
+        "env": map[string]interface{}{ "MODE": "prod", "faass-example": "true" },
+        "script": "line 1\nline 2",
+        "certificates": []interface{} {
+          map[string]interface{}{ "subject": "internal" },
+          map[string]interface{}{ "fingerprint": "ab:cd" },
+        },
+      },
+    },
+  }
+  if !reflect.DeepEqual( value, expected ) {
+    t.Errorf( "unexpected value :\n%#v", value )
+  }
+  encoded, err := Encode( value )
+  if err != nil {
+    t.Fatal( err )
+  }
+  decoded, err := Decode( encoded )
+  if err != nil {
+    t.Fatalf( "encoded document invalid : %v\n%s", err, encoded )
+  }
+  if !reflect.DeepEqual( decoded, expected ) {
+    t.Errorf( "round-trip failed :\n%s", encoded )
+  }
+}
+
+func TestDecodeErrors( t *testing.T ) {
+  for _, document := range []string{ "a = 1\na = 2", "a = [1, 2", "[a]\n[a]", "a = \"x", "a = yes" } {
+    if _, err := Decode( []byte( document ) ) ; err == nil {
+      t.Errorf( "error expected for %q", document )
+    }
+  }
+}
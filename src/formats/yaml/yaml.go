@@ -0,0 +1,599 @@
+package yaml
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "sort"
+  "strconv"
+  "strings"
+  // -----------
+)
+
+// -----------------------------------------------
+
+// subset of YAML 1.2 used by faass' files : block mappings and sequences, flow
+// collections on one line, quoted and plain scalars, literal ("|") and folded
+// (">") block scalars, comments ; no anchors, tags nor multi-documents
+
+type line struct {
+  number int
+  indent int
+  text string
+}
+
+type parser struct {
+  lines []line
+  position int
+}
+
+// -----------------------------------------------
+
+func Unmarshal( data []byte, v interface{} ) error {
+  value, err := Decode( data )
+  if err != nil {
+    return err
+  }
+  content, err := json.Marshal( value )
+  if err != nil {
+    return err
+  }
+  return json.Unmarshal( content, v )
+}
+
+func Marshal( v interface{} ) ( []byte, error ) {
+  content, err := json.Marshal( v )
+  if err != nil {
+    return nil, err
+  }
+  decoder := json.NewDecoder( bytes.NewReader( content ) )
+  decoder.UseNumber()
+  var value interface{}
+  if err := decoder.Decode( &value ) ; err != nil {
+    return nil, err
+  }
+  return Encode( value )
+}
+
+func Decode( data []byte ) ( interface{}, error ) {
+  p := &parser{}
+  for i, raw := range strings.Split( strings.ReplaceAll( string( data ), "\r\n", "\n" ), "\n" ) {
+    if strings.Contains( raw, "\t" ) && strings.TrimLeft( raw, " " ) != strings.TrimLeft( raw, " \t" ) {
+      return nil, errorAt( i+1, "tabulation in indentation" )
+    }
+    text := strings.TrimRight( stripComment( raw ), " \t" )
+    trimmed := strings.TrimLeft( text, " " )
+    if trimmed == "---" || trimmed == "..." {
+      continue
+    }
+    p.lines = append( p.lines, line {
+      number: i+1,
+      indent: len( text )-len( trimmed ),
+      text: trimmed,
+    } )
+  }
+  p.skipEmpty()
+  if p.position >= len( p.lines ) {
+    return nil, nil
+  }
+  value, err := p.parseBlock( p.lines[p.position].indent )
+  if err != nil {
+    return nil, err
+  }
+  p.skipEmpty()
+  if p.position < len( p.lines ) {
+    return nil, errorAt( p.lines[p.position].number, "unexpected content" )
+  }
+  return value, nil
+}
+
+// -----------------------------------------------
+
+func errorAt( number int, message string ) error {
+  return errors.New( fmt.Sprintf( "yaml line %v : %v", number, message ) )
+}
+
+func stripComment( raw string ) string {
+  quote := byte( 0 )
+  for i := 0 ; i < len( raw ) ; i++ {
+    c := raw[i]
+    switch {
+    case quote != 0:
+      if c == '\\' && quote == '"' {
+        i++
+      } else if c == quote {
+        quote = 0
+      }
+    case c == '"' || c == '\'':
+      if i == 0 || raw[i-1] == ' ' || raw[i-1] == '[' || raw[i-1] == '{' || raw[i-1] == ',' || raw[i-1] == ':' || raw[i-1] == '-' {
+        quote = c
+      }
+    case c == '#':
+      if i == 0 || raw[i-1] == ' ' || raw[i-1] == '\t' {
+        return raw[:i]
+      }
+    }
+  }
+  return raw
+}
+
+func ( p *parser ) skipEmpty() {
+  for p.position < len( p.lines ) && p.lines[p.position].text == "" {
+    p.position++
+  }
+}
+
+func isSequenceItem( text string ) bool {
+  return text == "-" || strings.HasPrefix( text, "- " )
+}
+
+// index of the ':' separating a key, outside of quotes and flow collections
+func mappingSeparator( text string ) int {
+  quote := byte( 0 )
+  depth := 0
+  for i := 0 ; i < len( text ) ; i++ {
+    c := text[i]
+    switch {
+    case quote != 0:
+      if c == '\\' && quote == '"' {
+        i++
+      } else if c == quote {
+        quote = 0
+      }
+    case c == '"' || c == '\'':
+      quote = c
+    case c == '[' || c == '{':
+      depth++
+    case c == ']' || c == '}':
+      depth--
+    case c == ':' && depth == 0:
+      if i+1 == len( text ) || text[i+1] == ' ' {
+        return i
+      }
+    }
+  }
+  return -1
+}
+
+func ( p *parser ) parseBlock( indent int ) ( interface{}, error ) {
+  p.skipEmpty()
+  if p.position >= len( p.lines ) {
+    return nil, nil
+  }
+  current := p.lines[p.position]
+  if isSequenceItem( current.text ) {
+    return p.parseSequence( current.indent )
+  }
+  if mappingSeparator( current.text ) >= 0 {
+    return p.parseMapping( current.indent )
+  }
+  p.position++
+  return parseScalar( current.text, current.number )
+}
+
+func ( p *parser ) parseSequence( indent int ) ( interface{}, error ) {
+  list := []interface{}{}
+  for {
+    p.skipEmpty()
+    if p.position >= len( p.lines ) {
+      break
+    }
+    current := p.lines[p.position]
+    if current.indent < indent || isSequenceItem( current.text ) != true {
+      break
+    }
+    if current.indent > indent {
+      return nil, errorAt( current.number, "bad indentation of sequence item" )
+    }
+    rest := strings.TrimLeft( strings.TrimPrefix( current.text, "-" ), " " )
+    if rest == "" {
+      p.position++
+      p.skipEmpty()
+      if p.position < len( p.lines ) && p.lines[p.position].indent > indent {
+        value, err := p.parseBlock( p.lines[p.position].indent )
+        if err != nil {
+          return nil, err
+        }
+        list = append( list, value )
+      } else {
+        list = append( list, nil )
+      }
+      continue
+    }
+    // the item's content is handled as a virtual line, indented after "- "
+    itemIndent := indent+len( current.text )-len( rest )
+    p.lines[p.position] = line { number: current.number, indent: itemIndent, text: rest }
+    value, err := p.parseBlock( itemIndent )
+    if err != nil {
+      return nil, err
+    }
+    list = append( list, value )
+  }
+  return list, nil
+}
+
+func ( p *parser ) parseMapping( indent int ) ( interface{}, error ) {
+  mapping := map[string]interface{}{}
+  for {
+    p.skipEmpty()
+    if p.position >= len( p.lines ) {
+      break
+    }
+    current := p.lines[p.position]
+    if current.indent < indent {
+      break
+    }
+    if current.indent > indent {
+      return nil, errorAt( current.number, "bad indentation of mapping" )
+    }
+    separator := mappingSeparator( current.text )
+    if separator < 0 {
+      if isSequenceItem( current.text ) {
+        break
+      }
+      return nil, errorAt( current.number, "mapping key expected" )
+    }
+    keyValue, err := parseScalar( strings.TrimSpace( current.text[:separator] ), current.number )
+    if err != nil {
+      return nil, err
+    }
+    key := fmt.Sprint( keyValue )
+    if keyValue == nil {
+      key = "null"
+    }
+    if _, ok := mapping[key] ; ok {
+      return nil, errorAt( current.number, "duplicate key '"+key+"'" )
+    }
+    rest := strings.TrimSpace( current.text[separator+1:] )
+    p.position++
+    switch {
+    case rest == "|" || rest == ">" || rest == "|-" || rest == ">-":
+      mapping[key] = p.parseBlockScalar( indent, rest )
+    case rest != "":
+      value, err := parseScalar( rest, current.number )
+      if err != nil {
+        return nil, err
+      }
+      mapping[key] = value
+    default:
+      p.skipEmpty()
+      if p.position < len( p.lines ) {
+        next := p.lines[p.position]
+        if next.indent > indent || ( next.indent == indent && isSequenceItem( next.text ) ) {
+          value, err := p.parseBlock( next.indent )
+          if err != nil {
+            return nil, err
+          }
+          mapping[key] = value
+          continue
+        }
+      }
+      mapping[key] = nil
+    }
+  }
+  return mapping, nil
+}
+
+func ( p *parser ) parseBlockScalar( indent int, style string ) string {
+  lines := []string{}
+  blockIndent := -1
+  for p.position < len( p.lines ) {
+    current := p.lines[p.position]
+    if current.text != "" && current.indent <= indent {
+      break
+    }
+    if current.text != "" && blockIndent < 0 {
+      blockIndent = current.indent
+    }
+    if current.text == "" {
+      lines = append( lines, "" )
+    } else {
+      lines = append( lines, strings.Repeat( " ", current.indent-blockIndent )+current.text )
+    }
+    p.position++
+  }
+  for len( lines ) > 0 && lines[len( lines )-1] == "" {
+    lines = lines[:len( lines )-1]
+  }
+  separator := "\n"
+  if strings.HasPrefix( style, ">" ) {
+    separator = " "
+  }
+  value := strings.Join( lines, separator )
+  if strings.HasSuffix( style, "-" ) != true && value != "" {
+    value += "\n"
+  }
+  return value
+}
+
+// -----------------------------------------------
+
+func parseScalar( text string, number int ) ( interface{}, error ) {
+  if text == "" {
+    return nil, nil
+  }
+  switch text[0] {
+  case '[', '{':
+    flow := &flowParser { text: text, number: number }
+    value, err := flow.parseValue()
+    if err != nil {
+      return nil, err
+    }
+    flow.skipSpaces()
+    if flow.position != len( flow.text ) {
+      return nil, errorAt( number, "unexpected content after flow collection" )
+    }
+    return value, nil
+  case '"':
+    value, err := strconv.Unquote( text )
+    if err != nil {
+      return nil, errorAt( number, "invalid double-quoted string" )
+    }
+    return value, nil
+  case '\'':
+    if len( text ) < 2 || text[len( text )-1] != '\'' {
+      return nil, errorAt( number, "invalid single-quoted string" )
+    }
+    return strings.ReplaceAll( text[1:len( text )-1], "''", "'" ), nil
+  }
+  return plainScalar( text ), nil
+}
+
+func plainScalar( text string ) interface{} {
+  switch text {
+  case "~", "null", "Null", "NULL":
+    return nil
+  case "true", "True", "TRUE":
+    return true
+  case "false", "False", "FALSE":
+    return false
+  }
+  if i, err := strconv.ParseInt( text, 10, 64 ) ; err == nil {
+    return i
+  }
+  if f, err := strconv.ParseFloat( text, 64 ) ; err == nil && strings.ContainsAny( text, "0123456789" ) {
+    return f
+  }
+  return text
+}
+
+// -----------------------------------------------
+
+type flowParser struct {
+  text string
+  position int
+  number int
+}
+
+func ( flow *flowParser ) skipSpaces() {
+  for flow.position < len( flow.text ) && flow.text[flow.position] == ' ' {
+    flow.position++
+  }
+}
+
+func ( flow *flowParser ) parseValue() ( interface{}, error ) {
+  flow.skipSpaces()
+  if flow.position >= len( flow.text ) {
+    return nil, errorAt( flow.number, "unterminated flow collection" )
+  }
+  switch flow.text[flow.position] {
+  case '[':
+    flow.position++
+    list := []interface{}{}
+    for {
+      flow.skipSpaces()
+      if flow.position < len( flow.text ) && flow.text[flow.position] == ']' {
+        flow.position++
+        return list, nil
+      }
+      value, err := flow.parseValue()
+      if err != nil {
+        return nil, err
+      }
+      list = append( list, value )
+      if err := flow.next( ']' ) ; err != nil {
+        return nil, err
+      }
+    }
+  case '{':
+    flow.position++
+    mapping := map[string]interface{}{}
+    for {
+      flow.skipSpaces()
+      if flow.position < len( flow.text ) && flow.text[flow.position] == '}' {
+        flow.position++
+        return mapping, nil
+      }
+      keyValue, err := flow.parseValue()
+      if err != nil {
+        return nil, err
+      }
+      flow.skipSpaces()
+      if flow.position >= len( flow.text ) || flow.text[flow.position] != ':' {
+        return nil, errorAt( flow.number, "':' expected in flow mapping" )
+      }
+      flow.position++
+      value, err := flow.parseValue()
+      if err != nil {
+        return nil, err
+      }
+      mapping[fmt.Sprint( keyValue )] = value
+      if err := flow.next( '}' ) ; err != nil {
+        return nil, err
+      }
+    }
+  case '"', '\'':
+    quote := flow.text[flow.position]
+    end := flow.position+1
+    for end < len( flow.text ) {
+      if flow.text[end] == '\\' && quote == '"' {
+        end += 2
+        continue
+      }
+      if flow.text[end] == quote {
+        if quote == '\'' && end+1 < len( flow.text ) && flow.text[end+1] == '\'' {
+          end += 2
+          continue
+        }
+        break
+      }
+      end++
+    }
+    if end >= len( flow.text ) {
+      return nil, errorAt( flow.number, "unterminated string" )
+    }
+    value, err := parseScalar( flow.text[flow.position:end+1], flow.number )
+    flow.position = end+1
+    return value, err
+  }
+  start := flow.position
+  for flow.position < len( flow.text ) && strings.IndexByte( ",]}:", flow.text[flow.position] ) < 0 {
+    flow.position++
+  }
+  return plainScalar( strings.TrimSpace( flow.text[start:flow.position] ) ), nil
+}
+
+func ( flow *flowParser ) next( closing byte ) error {
+  flow.skipSpaces()
+  if flow.position >= len( flow.text ) {
+    return errorAt( flow.number, "unterminated flow collection" )
+  }
+  switch flow.text[flow.position] {
+  case ',':
+    flow.position++
+    return nil
+  case closing:
+    return nil
+  }
+  return errorAt( flow.number, "',' expected in flow collection" )
+}
+
+// -----------------------------------------------
+
+// output stays in the decoded subset : block collections, keys sorted, strings 
+// double-quoted when a plain scalar would be read differently 
+func Encode( value interface{} ) ( []byte, error ) {
+  var buffer bytes.Buffer
+  if err := encodeValue( &buffer, value, 0, false ) ; err != nil {
+    return nil, err
+  }
+  return buffer.Bytes(), nil
+}
+
+func isEmptyCollection( value interface{} ) bool {
+  switch v := value.( type ) {
+  case map[string]interface{}:
+    return len( v ) == 0
+  case []interface{}:
+    return len( v ) == 0
+  }
+  return false
+}
+
+// "inline" : the value follows a "- " already written, on the same line
+func encodeValue( buffer *bytes.Buffer, value interface{}, indent int, inline bool ) error {
+  padding := strings.Repeat( " ", indent )
+  switch v := value.( type ) {
+  case map[string]interface{}:
+    if len( v ) == 0 {
+      buffer.WriteString( "{}\n" )
+      return nil
+    }
+    keys := make( []string, 0, len( v ) )
+    for key := range v {
+      keys = append( keys, key )
+    }
+    sort.Strings( keys )
+    for i, key := range keys {
+      if i > 0 || inline != true {
+        buffer.WriteString( padding )
+      }
+      buffer.WriteString( encodeString( key )+":" )
+      child := v[key]
+      switch child.( type ) {
+      case map[string]interface{}, []interface{}:
+        if isEmptyCollection( child ) != true {
+          buffer.WriteString( "\n" )
+          childIndent := indent+2
+          if _, ok := child.( []interface{} ) ; ok {
+            childIndent = indent
+          }
+          if err := encodeValue( buffer, child, childIndent, false ) ; err != nil {
+            return err
+          }
+          continue
+        }
+      }
+      buffer.WriteString( " " )
+      if err := encodeValue( buffer, child, indent+2, false ) ; err != nil {
+        return err
+      }
+    }
+    return nil
+  case []interface{}:
+    if len( v ) == 0 {
+      buffer.WriteString( "[]\n" )
+      return nil
+    }
+    for i, item := range v {
+      if i > 0 || inline != true {
+        buffer.WriteString( padding )
+      }
+      buffer.WriteString( "- " )
+      if _, ok := item.( []interface{} ) ; ok && isEmptyCollection( item ) != true {
+        buffer.WriteString( "\n" )
+        if err := encodeValue( buffer, item, indent+2, false ) ; err != nil {
+          return err
+        }
+        continue
+      }
+      if err := encodeValue( buffer, item, indent+2, true ) ; err != nil {
+        return err
+      }
+    }
+    return nil
+  }
+  scalar, err := encodeScalar( value )
+  if err != nil {
+    return err
+  }
+  buffer.WriteString( scalar+"\n" )
+  return nil
+}
+
+func encodeScalar( value interface{} ) ( string, error ) {
+  switch v := value.( type ) {
+  case nil:
+    return "null", nil
+  case bool:
+    return strconv.FormatBool( v ), nil
+  case string:
+    return encodeString( v ), nil
+  case json.Number:
+    return v.String(), nil
+  case int:
+    return strconv.Itoa( v ), nil
+  case int64:
+    return strconv.FormatInt( v, 10 ), nil
+  case float64:
+    return strconv.FormatFloat( v, 'g', -1, 64 ), nil
+  }
+  return "", errors.New( fmt.Sprintf( "type %T not supported by yaml", value ) )
+}
+
+func encodeString( s string ) string {
+  plain := s != "" && 
+    strings.TrimSpace( s ) == s && 
+    strings.ContainsAny( s[:1], "-?:,[]{}#&*!|>'\"%@`~" ) != true && 
+    strings.ContainsAny( s, "\n\t\r" ) != true && 
+    strings.Contains( s, ": " ) != true && 
+    strings.Contains( s, " #" ) != true && 
+    strings.HasSuffix( s, ":" ) != true
+  if plain {
+    if parsed, ok := plainScalar( s ).( string ) ; ok && parsed == s {
+      return s
+    }
+  }
+  return strconv.Quote( s )
+}
@@ -0,0 +1,82 @@
+package yaml
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestDecode( t *testing.T ) {
+  document := `
+# route
+type: function   # inline comment
+cmd: [ "python3", /function ]
+timeout: 1500
+env:
+  MODE: "prod # not a comment"
+  EMPTY:
+labels: { team: data, tier: 2 }
+certificates:
+  - subject: internal
+    san: 'it''s.local'
+  - fingerprint: ab:cd
+list:
+- a
+- b
+script: |
+  line 1
+  line 2
+`
+  value, err := Decode( []byte( document ) )
+  if err != nil {
+    t.Fatal( err )
+  }
+  expected := map[string]interface{} {
+    "type": "function",
+    "cmd": []interface{}{ "python3", "/function" },
+    "timeout": int64( 1500 ),
+    "env": map[string]interface{}{ "MODE": "prod # not a comment", "EMPTY": nil },
+    "labels": map[string]interface{}{ "team": "data", "tier": int64( 2 ) },
+    "certificates": []interface{} {
+      map[string]interface{}{ "subject": "internal", "san": "it's.local" },
+      map[string]interface{}{ "fingerprint": "ab:cd" },
+    },
+    "list": []interface{}{ "a", "b" },
+    "script": "line 1\nline 2\n",
+  }
+  if !reflect.DeepEqual( value, expected ) {
+    t.Errorf( "unexpected value :\n%#v", value )
+  }
+}
+
+func TestEncode( t *testing.T ) {
+  value := map[string]interface{} {
+    "cmd": []interface{}{ "python3", "/function" },
+    "env": map[string]interface{}{ "MODE": "1500", "EMPTY": "" },
+    "certificates": []interface{} {
+      map[string]interface{}{ "subject": "internal", "san": "a: b" },
+    },
+    "access": map[string]interface{}{ "allow": []interface{}{}, "deny": nil },
+    "script": "#!/bin/sh\nexit 0",
+    "timeout": int64( 1500 ),
+    "nested": []interface{}{ []interface{}{ "a" }, true },
+  }
+  encoded, err := Encode( value )
+  if err != nil {
+    t.Fatal( err )
+  }
+  decoded, err := Decode( encoded )
+  if err != nil {
+    t.Fatalf( "encoded document invalid : %v\n%s", err, encoded )
+  }
+  if !reflect.DeepEqual( decoded, value ) {
+    t.Errorf( "round-trip failed :\n%s", encoded )
+  }
+}
+
+func TestDecodeErrors( t *testing.T ) {
+  for _, document := range []string{ "a: 1\na: 2", "a: [1, 2", "a: 1\n   b: 2" } {
+    if _, err := Decode( []byte( document ) ) ; err == nil {
+      t.Errorf( "error expected for %q", document )
+    }
+  }
+}
@@ -12,42 +12,72 @@ import (
 type Response struct {
   Code int 
   MessageError string
+  Details interface{}
   Payload interface{}
   IOFile io.ReadCloser
+  ETag string
+}
+
+// each part is sent as soon as it's read (a stream can be followed)
+type flushWriter struct {
+  w http.ResponseWriter
+}
+
+func ( fw flushWriter ) Write( p []byte ) ( int, error ) {
+  n, err := fw.w.Write( p )
+  if flusher, ok := fw.w.( http.Flusher ) ; ok {
+    flusher.Flush()
+  }
+  return n, err
+}
+
+// problem+json : the message, and details (by field) if any 
+type Problem struct {
+  Message string `json:"message"`
+  Errors interface{} `json:"errors,omitempty"`
 }
 
 func ( httpR *Response ) Respond( logger *logger.Logger, w http.ResponseWriter ) bool { 
+  if httpR.ETag != "" {
+    w.Header().Set( "ETag", httpR.ETag )
+  }
+  if httpR.Code == http.StatusNotModified {
+    // without body
+    w.WriteHeader( httpR.Code ) 
+    return true
+  }
+  // a response given as is (proxied or replayed), whatever its code
+  if httpR.IOFile != nil {
+    w.WriteHeader( httpR.Code ) 
+    io.Copy( flushWriter { w }, httpR.IOFile )
+    httpR.IOFile.Close()
+    return true
+  }
   if httpR.Code < 300 {
     if httpR.Payload != nil {
       HTTPResponse, err := json.Marshal( httpR.Payload ) 
       if err != nil { 
-        w.WriteHeader( 500 ) 
         w.Header().Set( "Content-type", "application/problem+json" )
+        w.WriteHeader( 500 ) 
         logger.Error( "API export conf (Marshal) :", err ) 
         httpR.Code = 500
         return false
       } 
-      w.WriteHeader( httpR.Code ) 
       w.Header().Set( "Content-type", "application/json" ) 
-      w.Write( HTTPResponse ) 
-    } else if httpR.IOFile != nil { 
       w.WriteHeader( httpR.Code ) 
-      io.Copy( w, httpR.IOFile )
+      w.Write( HTTPResponse ) 
     } else {
       w.WriteHeader( httpR.Code ) 
     }
     return true 
   } else { 
-    w.WriteHeader( httpR.Code ) 
+    content, err := json.Marshal( Problem { Message: httpR.MessageError, Errors: httpR.Details } )
+    if err != nil {
+      content = []byte( fmt.Sprintf( `{"message":%q}`, httpR.MessageError ) )
+    }
     w.Header().Set( "Content-type", "application/problem+json" )
-    w.Write( 
-      []byte( 
-        fmt.Sprintf( 
-          `{"message":"%v"}`, 
-          httpR.MessageError, 
-        ),
-      ),
-    )
+    w.WriteHeader( httpR.Code ) 
+    w.Write( content )
     return true
   }
 }
\ No newline at end of file
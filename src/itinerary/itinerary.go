@@ -1,30 +1,68 @@
 package itinerary
 
 import( 
+  "crypto/sha256"
+  "encoding/hex"
+  "sort"
   "time"
   "sync"
   "path/filepath"
   "os"
   "errors"
+  "regexp"
+  "strconv"
+  "strings"
+  "sync/atomic"
+  // -----------
+  "builder"
+  "configuration/auth"
+  "events"
+  "jobs"
+  "network"
+  "pipeline"
+  "schedule"
+  "triggers"
 )
 
 const (
   RouteTypeFunction int   = iota
   RouteTypeService        
   RouteTypeShell          
+  RouteTypePipeline       
+)
+
+const (
+  RouteStatusRunning                    = "running"
+  RouteStatusIdle                       = "idle"
 )
 
 type Route struct {
+  // first (64 bits atomic alignment) ; changed without lock while serving
+  inFlight int64
+  lastServed int64
   Name string `json:"name"`
   TypeName string `json:"type"`
   ScriptPath string `json:"script"`
   ScriptCmd []string `json:"cmd"`
+  Artifact string `json:"artifact"`
+  Build *builder.Definition `json:"build"`
   Authorization string `json:"authorization"`
   AuthorizationDefault string `json:"-"`
+  AuthorizationType string `json:"authtype"`
+  Certificates []auth.CertificateRule `json:"certificates"`
+  Signature *auth.SignatureRule `json:"signature"`
+  Replays *auth.ReplayCache `json:"-"`
+  Access *network.ACL `json:"access"`
   Environment map[string]string `json:"env"`
+  Labels map[string]string `json:"labels"`
   Image string `json:"image"`
   Timeout int `json:"timeout"`
   Retry int `json:"retry"`
+  Jobs *jobs.Policy `json:"jobs"`
+  Schedules []schedule.Definition `json:"schedules"`
+  Triggers []triggers.Definition `json:"triggers"`
+  Steps []pipeline.Step `json:"steps"`
+  Subscriptions []events.Subscription `json:"subscriptions"`
   Delay int `json:"delay"`
   Port int `json:"port"`
   LastRequest time.Time `json:"-"`
@@ -32,6 +70,7 @@ type Route struct {
   IpAdress string `json:"-"`
   Mutex sync.RWMutex `json:"-"`
   TypeNum int `json:"-"`
+  Source string `json:"-"`
 }
 
 func ( route *Route ) Export( reverseResolveAuth bool ) ( newRouteCopied Route, error error ) {
@@ -40,25 +79,133 @@ func ( route *Route ) Export( reverseResolveAuth bool ) ( newRouteCopied Route,
   newRouteCopied.ScriptPath = route.ScriptPath
   var scriptCmdTmp []string 
   newRouteCopied.ScriptCmd =  append( scriptCmdTmp, route.ScriptCmd... )
+  newRouteCopied.Artifact = route.Artifact
+  if route.Build != nil {
+    buildTmp := *route.Build
+    newRouteCopied.Build = &buildTmp
+  }
   if reverseResolveAuth { 
     newRouteCopied.Authorization = route.AuthorizationDefault
   } else {
     newRouteCopied.Authorization = route.Authorization
   }
+  newRouteCopied.AuthorizationType = route.AuthorizationType
+  if route.Certificates != nil {
+    newRouteCopied.Certificates = append( []auth.CertificateRule{}, route.Certificates... )
+  }
+  if route.Signature != nil {
+    signatureTmp := *route.Signature
+    if reverseResolveAuth {
+      signatureTmp.Secret = route.Signature.SecretDefault
+    }
+    newRouteCopied.Signature = &signatureTmp
+  }
   envTmp := make( map[string]string )
   for key, value := range route.Environment {
     envTmp[key] = value 
   }
   newRouteCopied.Environment = envTmp
+  if route.Labels != nil {
+    newRouteCopied.Labels = make( map[string]string )
+    for key, value := range route.Labels {
+      newRouteCopied.Labels[key] = value
+    }
+  }
+  newRouteCopied.Access = route.Access.Copy()
   newRouteCopied.Image = route.Image
   newRouteCopied.Timeout = route.Timeout
   newRouteCopied.Retry = route.Retry
+  newRouteCopied.Jobs = route.Jobs.Copy()
+  if reverseResolveAuth && route.Jobs != nil && route.Jobs.Callback != nil {
+    newRouteCopied.Jobs.Callback.Secret = route.Jobs.Callback.SecretDefault
+  }
+  if route.Schedules != nil {
+    newRouteCopied.Schedules = append( []schedule.Definition{}, route.Schedules... )
+  }
+  if route.Triggers != nil {
+    newRouteCopied.Triggers = append( []triggers.Definition{}, route.Triggers... )
+  }
+  for _, step := range route.Steps {
+    step.Parallel = append( []string{}, step.Parallel... )
+    newRouteCopied.Steps = append( newRouteCopied.Steps, step )
+  }
+  for _, subscription := range route.Subscriptions {
+    if subscription.Filter != nil {
+      filterTmp := make( map[string]string )
+      for field, value := range subscription.Filter {
+        filterTmp[field] = value
+      }
+      subscription.Filter = filterTmp
+    }
+    newRouteCopied.Subscriptions = append( newRouteCopied.Subscriptions, subscription )
+  }
   newRouteCopied.Delay = route.Delay
   newRouteCopied.Port = route.Port
   return newRouteCopied, nil
 }
 
-func ( route *Route ) Check() ( error error ) {
+// -----------------------------------------------
+
+// around each request served by the route
+func ( route *Route ) Begin() {
+  atomic.AddInt64( &route.inFlight, 1 )
+  atomic.StoreInt64( &route.lastServed, time.Now().UnixNano() )
+}
+
+func ( route *Route ) End() {
+  atomic.AddInt64( &route.inFlight, -1 )
+}
+
+type RouteState struct {
+  Status string `json:"status"`
+  ContainerId string `json:"containerid"`
+  IpAdress string `json:"ip"`
+  LastRequest *time.Time `json:"lastrequest"`
+  InFlight int64 `json:"inflight"`
+}
+
+// a route is running while its container is up or a request is served ; to 
+// call with the conf's mutex held
+func ( route *Route ) State() ( state RouteState ) {
+  route.Mutex.RLock()
+  state.ContainerId = route.Id
+  state.IpAdress = route.IpAdress
+  lastRequest := route.LastRequest
+  route.Mutex.RUnlock()
+  if lastServed := atomic.LoadInt64( &route.lastServed ) ; lastServed > 0 {
+    if served := time.Unix( 0, lastServed ) ; served.After( lastRequest ) {
+      lastRequest = served
+    }
+  }
+  if lastRequest.IsZero() != true {
+    state.LastRequest = &lastRequest
+  }
+  state.InFlight = atomic.LoadInt64( &route.inFlight )
+  state.Status = RouteStatusIdle
+  if state.ContainerId != "" || state.InFlight > 0 {
+    state.Status = RouteStatusRunning
+  }
+  return state
+}
+
+// -----------------------------------------------
+
+// a problem of the route, by json field
+type FieldError struct {
+  Field string
+  Message string
+}
+
+var routeNameRegex = regexp.MustCompile( "^[a-zA-Z0-9][a-zA-Z0-9_.-]*$" )
+
+var artifactRegex = regexp.MustCompile( "^sha256:[0-9a-f]{64}$" )
+
+// every structural problem is given, not only the first one ; the filesystem 
+// isn't checked (scripts can be sent later) 
+func ( route *Route ) Validate() ( problems []FieldError ) {
+  add := func( field string, message string ) {
+    problems = append( problems, FieldError { Field: field, Message: message } )
+  }
   switch ( route.TypeName ) {
   case "function":
     route.TypeNum = RouteTypeFunction
@@ -66,27 +213,495 @@ func ( route *Route ) Check() ( error error ) {
     route.TypeNum = RouteTypeService
   case "shell":
     route.TypeNum = RouteTypeShell
+  case "pipeline":
+    route.TypeNum = RouteTypePipeline
+  default:
+    add( "type", "type of route invalid" )
+  }
+  if route.Name == "" {
+    add( "name", "name of route undefined" )
+  } else if routeNameRegex.MatchString( route.Name ) != true {
+    // the name is used for containers and files
+    add( "name", "name of route invalid : '"+route.Name+"'" )
+  }
+  switch ( route.TypeName ) {
+  case "function":
+    if route.Build != nil {
+      route.validateBuild( add )
+      break
+    }
+    if route.Image == "" {
+      add( "image", "image undefined for function" )
+    }
+    // the script's path, or the digest of a stored artifact
+    if route.ScriptPath == "" && route.Artifact == "" {
+      add( "script", "script or artifact undefined for function" )
+    }
+    if route.ScriptPath != "" && route.Artifact != "" {
+      add( "artifact", "script and artifact are exclusive" )
+    }
+  case "service":
+    if route.Image == "" {
+      add( "image", "image undefined for service" )
+    }
+    if route.Port < 1 || route.Port > 65535 {
+      add( "port", "port out of range (1 to 65535)" )
+    }
+  case "shell":
+    if route.ScriptPath == "" {
+      add( "script", "script undefined for shell" )
+    }
+  case "pipeline":
+    if len( route.Steps ) == 0 {
+      add( "steps", "steps undefined for pipeline" )
+    }
+    if len( route.Steps ) > pipeline.StepsMax {
+      add( "steps", "too many steps ("+strconv.Itoa( pipeline.StepsMax )+" at most)" )
+    }
+    if route.ScriptPath != "" || route.Image != "" {
+      add( "script", "script and image not for pipeline" )
+    }
+  }
+  if len( route.Subscriptions ) > 0 && route.TypeName == "service" {
+    add( "subscriptions", "subscriptions not for service" )
+  }
+  if len( route.Subscriptions ) > events.SubscriptionsMax {
+    add( "subscriptions", "too many subscriptions ("+strconv.Itoa( events.SubscriptionsMax )+" at most)" )
+  }
+  for i, subscription := range route.Subscriptions {
+    problems := subscription.Problems()
+    for _, field := range []string{ "topic", "filter" } {
+      if message, ok := problems[field] ; ok {
+        add( "subscriptions/"+strconv.Itoa( i )+"/"+field, message )
+      }
+    }
+  }
+  if len( route.Steps ) > 0 && route.TypeName != "pipeline" {
+    add( "steps", "steps only for pipeline" )
+  }
+  for i, step := range route.Steps {
+    problems := step.Problems()
+    for _, field := range []string{ "route", "parallel", "join", "timeout", "onerror", "fallback" } {
+      if message, ok := problems[field] ; ok {
+        add( "steps/"+strconv.Itoa( i )+"/"+field, message )
+      }
+    }
+  }
+  if route.Build != nil && route.TypeName != "function" {
+    add( "build", "build only for function" )
+  }
+  if route.Artifact != "" {
+    if route.TypeName != "function" {
+      add( "artifact", "artifact only for function" )
+    } else if artifactRegex.MatchString( route.Artifact ) != true {
+      add( "artifact", "artifact's digest invalid (sha256:<hex>)" )
+    }
+  }
+  if route.Timeout < 0 || ( route.Timeout == 0 && route.TypeName != "service" ) {
+    add( "timeout", "timeout must be positive (milliseconds)" )
+  }
+  if route.Retry < 0 {
+    add( "retry", "retry can't be negative" )
+  }
+  if route.Jobs != nil {
+    if route.TypeName == "service" {
+      add( "jobs", "jobs not for service" )
+    }
+    route.validateJobs( add )
+  }
+  if len( route.Schedules ) > 0 && route.TypeName == "service" {
+    add( "schedules", "schedules not for service" )
+  }
+  for i, definition := range route.Schedules {
+    problems := definition.Problems()
+    for _, field := range []string{ "cron", "timezone", "jitter", "payload" } {
+      if message, ok := problems[field] ; ok {
+        add( "schedules/"+strconv.Itoa( i )+"/"+field, message )
+      }
+    }
+  }
+  if len( route.Triggers ) > 0 && route.TypeName == "service" {
+    add( "triggers", "triggers not for service" )
+  }
+  for i, definition := range route.Triggers {
+    problems := definition.Problems()
+    for _, field := range []string{ "type", "dir", "pattern", "debounce", "done", "failed" } {
+      if message, ok := problems[field] ; ok {
+        add( "triggers/"+strconv.Itoa( i )+"/"+field, message )
+      }
+    }
+  }
+  if route.Delay < 0 {
+    add( "delay", "delay can't be negative" )
+  }
+  switch ( route.AuthorizationType ) {
+  case "", auth.AuthTypeHeader:
+  case auth.AuthTypeCertificate:
+    if len( route.Certificates ) == 0 {
+      add( "certificates", "certificate authorization without rule" )
+    }
+    for i := range route.Certificates {
+      if route.Certificates[i].IsEmpty() {
+        add( "certificates/"+strconv.Itoa( i ), "certificate rule without subject, san or fingerprint" )
+      }
+    }
+  case auth.AuthTypeSignature:
+    if route.Signature == nil || route.Signature.Secret == "" {
+      add( "signature", "hmac authorization without secret" )
+    } else {
+      route.Signature.PopulateDefaults()
+      if route.Replays == nil {
+        route.Replays = auth.NewReplayCache()
+      }
+    }
   default:
-    error = errors.New( "type of route invalid" ) 
+    add( "authtype", "type of authorization invalid" )
+  }
+  for key := range route.Labels {
+    if key == "" {
+      add( "labels", "label with an empty key" )
+    }
+  }
+  if route.Access != nil {
+    if err := route.Access.Check() ; err != nil {
+      add( "access", err.Error() )
+    }
+  }
+  return problems
+}
+
+// the code is in the built image (from a source dir or the artifact, a
+// bundle) ; the image is the base of the runtime's template
+func ( route *Route ) validateBuild( add func( field string, message string ) ) {
+  if route.ScriptPath != "" {
+    add( "script", "script and build are exclusive (the code is in the image)" )
+  }
+  if route.Build.Source == "" && route.Artifact == "" {
+    add( "build/source", "source or artifact undefined for build" )
+  }
+  if route.Build.Source != "" && route.Artifact != "" {
+    add( "build/source", "source and artifact are exclusive" )
+  }
+  if route.Build.Source != "" && filepath.IsAbs( route.Build.Source ) != true {
+    add( "build/source", "source must be an absolute path" )
+  }
+  if builder.ValidRuntime( route.Build.Runtime ) != true {
+    add( "build/runtime", "runtime invalid ("+strings.Join( builder.RuntimeNames(), ", " )+")" )
+  }
+  if route.Build.Runtime == builder.RuntimeDockerfile {
+    if route.Image != "" {
+      add( "image", "image unused with a Dockerfile (its FROM)" )
+    }
+  } else if route.Build.Dockerfile != "" {
+    add( "build/dockerfile", "Dockerfile only for runtime '"+builder.RuntimeDockerfile+"'" )
+  }
+  if strings.ContainsAny( route.Image, " \t\r\n" ) {
+    add( "image", "image invalid : '"+route.Image+"'" )
+  }
+}
+
+// the policy of the async requests ; 0 for the defaults (a single attempt)
+func ( route *Route ) validateJobs( add func( field string, message string ) ) {
+  if route.Jobs.Attempts < 0 || route.Jobs.Attempts > jobs.AttemptsMax {
+    add( "jobs/attempts", "attempts out of range (0 to "+strconv.Itoa( jobs.AttemptsMax )+")" )
+  }
+  if route.Jobs.Backoff < 0 || route.Jobs.Backoff > jobs.BackoffLimit {
+    add( "jobs/backoff", "backoff out of range (0 to "+strconv.Itoa( jobs.BackoffLimit )+" milliseconds)" )
+  }
+  if route.Jobs.BackoffMax < 0 || route.Jobs.BackoffMax > jobs.BackoffLimit {
+    add( "jobs/backoffmax", "maximum of backoff out of range (0 to "+strconv.Itoa( jobs.BackoffLimit )+" milliseconds)" )
+  }
+  for i, code := range route.Jobs.Codes {
+    if code < 100 || code > 599 {
+      add( "jobs/codes/"+strconv.Itoa( i ), "HTTP status code invalid : "+strconv.Itoa( code ) )
+    }
+  }
+  for i, exit := range route.Jobs.Exits {
+    if exit < 0 || exit > 255 {
+      add( "jobs/exits/"+strconv.Itoa( i ), "exit code invalid : "+strconv.Itoa( exit ) )
+    }
+  }
+  callback := route.Jobs.Callback
+  if callback == nil {
+    return
+  }
+  if callback.Secret == "" {
+    add( "jobs/callback/secret", "callback without secret" )
+  }
+  if callback.URL != "" && jobs.ValidCallbackURL( callback.URL ) != true {
+    add( "jobs/callback/url", "callback's url invalid (http or https) : '"+callback.URL+"'" )
+  }
+  if callback.Given {
+    add( "jobs/callback/given", "set by the requests only" )
+  }
+  for i, prefix := range callback.Allow {
+    if jobs.ValidCallbackURL( prefix ) != true {
+      add( "jobs/callback/allow/"+strconv.Itoa( i ), "callback's prefix invalid (http or https) : '"+prefix+"'" )
+    }
+  }
+  if callback.Attempts < 0 || callback.Attempts > jobs.AttemptsMax {
+    add( "jobs/callback/attempts", "attempts out of range (0 to "+strconv.Itoa( jobs.AttemptsMax )+")" )
+  }
+  if callback.Backoff < 0 || callback.Backoff > jobs.BackoffLimit {
+    add( "jobs/callback/backoff", "backoff out of range (0 to "+strconv.Itoa( jobs.BackoffLimit )+" milliseconds)" )
+  }
+}
+
+func ( route *Route ) Check() ( error error ) {
+  if problems := route.Validate() ; len( problems ) > 0 {
+    error = errors.New( problems[0].Field+" : "+problems[0].Message ) 
   }
   return error
 }
 
+// the file is named by its content : a reload or a patch changing the env 
+// gives a new file, an unchanged env keeps its own 
 func ( route *Route ) CreateFileEnv( tmpDir string ) ( fileEnvPath string, err error ) {
+  keys := make( []string, 0, len( route.Environment ) )
+  for key := range route.Environment {
+    keys = append( keys, key )
+  }
+  sort.Strings( keys )
+  var content strings.Builder
+  for _, key := range keys {
+    content.WriteString( key+"="+route.Environment[key]+"\n" )
+  }
+  sum := sha256.Sum256( []byte( content.String() ) )
   fileEnvPath = filepath.Join(
     tmpDir,
-    route.Name+".env", 
+    route.Name+"."+hex.EncodeToString( sum[:8] )+".env", 
   )
   if _,err := os.Stat( fileEnvPath ); err == nil {
     return fileEnvPath, nil 
   } 
-  fileEnv, err := os.Create( fileEnvPath )
+  // written aside then renamed : a concurrent call never reads a partial file
+  fileEnv, err := os.CreateTemp( tmpDir, route.Name+".*.env.tmp" )
   if err != nil {
     return "", errors.New( "env file for container failed" )
   }
-  for key, value := range route.Environment {
-    fileEnv.WriteString( key+"="+value+"\n" )
+  _, err = fileEnv.WriteString( content.String() )
+  if errClose := fileEnv.Close() ; err == nil {
+    err = errClose
+  }
+  if err == nil {
+    err = os.Rename( fileEnv.Name(), fileEnvPath )
+  }
+  if err != nil {
+    os.Remove( fileEnv.Name() )
+    return "", errors.New( "env file for container failed" )
   }
-  fileEnv.Close()
   return fileEnvPath, nil
-}
\ No newline at end of file
+}
+
+// same description as the conf's one ; every field of a route can be edited 
+func ( route *Route ) GetHead() map[string]map[string]interface{} {
+  return map[string]map[string]interface{} { 
+    "Name": map[string]interface{} { 
+      "default": nil, 
+      "type": "string", 
+      "realtype": "string", 
+      "edit": true, 
+      "title": "Name of route",
+      "help" : "Used for containers and files ; the route's key by default", 
+      "value": route.Name,
+    },
+    "TypeName": map[string]interface{} { 
+      "default": nil, 
+      "type": "string", 
+      "realtype": "enum(function,service,shell,pipeline)", 
+      "edit": true, 
+      "title": "Type of route",
+      "help" : "", 
+      "value": route.TypeName,
+    },
+    "ScriptPath": map[string]interface{} { 
+      "default": nil, 
+      "type": "string", 
+      "realtype": "path", 
+      "edit": true, 
+      "title": "Path of script",
+      "help" : "Needed for function (mounted in container) and shell (executed)", 
+      "value": route.ScriptPath,
+    },
+    "ScriptCmd": map[string]interface{} { 
+      "default": []string{}, 
+      "type": "array", 
+      "realtype": "array(string)", 
+      "edit": true, 
+      "title": "Command and arguments",
+      "help" : "", 
+      "value": route.ScriptCmd,
+    },
+    "Artifact": map[string]interface{} { 
+      "default": "", 
+      "type": "string", 
+      "realtype": "digest", 
+      "edit": true, 
+      "title": "Digest of stored artifact",
+      "help" : "For function, instead of script (sha256:<hex>)", 
+      "value": route.Artifact,
+    },
+    "Build": map[string]interface{} { 
+      "default": nil, 
+      "type": "object", 
+      "realtype": "build(runtime,source,dockerfile)", 
+      "edit": true, 
+      "title": "Build of function's image",
+      "help" : "Runtime (dockerfile, go, node, python, shell) and source dir, or the artifact ; the image is the base", 
+      "value": route.Build,
+    },
+    "Authorization": map[string]interface{} { 
+      "default": "", 
+      "type": "string", 
+      "realtype": "range(auth)", 
+      "edit": true, 
+      "title": "Reference to content of header Authorization",
+      "help" : "Empty for a public route", 
+      "value": route.AuthorizationDefault,
+    },
+    "AuthorizationType": map[string]interface{} { 
+      "default": auth.AuthTypeHeader, 
+      "type": "string", 
+      "realtype": "enum(,header,certificate,hmac)", 
+      "edit": true, 
+      "title": "Type of authorization",
+      "help" : "", 
+      "value": route.AuthorizationType,
+    },
+    "Certificates": map[string]interface{} { 
+      "default": nil, 
+      "type": "array", 
+      "realtype": "array(certificate)", 
+      "edit": true, 
+      "title": "Rules for client certificates",
+      "help" : "For \"certificate\" authorization", 
+      "value": route.Certificates,
+    },
+    "Signature": map[string]interface{} { 
+      "default": nil, 
+      "type": "object", 
+      "realtype": "signature", 
+      "edit": true, 
+      "title": "Rule for HMAC signature",
+      "help" : "For \"hmac\" authorization ; the secret is a reference to authorizations, GitHub's headers by default", 
+      "value": nil,
+    },
+    "Access": map[string]interface{} { 
+      "default": nil, 
+      "type": "object", 
+      "realtype": "access(allow,deny)", 
+      "edit": true, 
+      "title": "Network access control of route",
+      "help" : "Lists of IP or CIDR ; deny is checked before allow", 
+      "value": route.Access,
+    },
+    "Environment": map[string]interface{} { 
+      "default": map[string]string{}, 
+      "type": "object", 
+      "realtype": "map(string)", 
+      "edit": true, 
+      "title": "Environment variables",
+      "help" : "", 
+      "value": route.Environment,
+    },
+    "Labels": map[string]interface{} { 
+      "default": map[string]string{}, 
+      "type": "object", 
+      "realtype": "map(string)", 
+      "edit": true, 
+      "title": "Labels",
+      "help" : "Free key and value, to filter the routes", 
+      "value": route.Labels,
+    },
+    "Image": map[string]interface{} { 
+      "default": nil, 
+      "type": "string", 
+      "realtype": "string", 
+      "edit": true, 
+      "title": "Image of container",
+      "help" : "Needed for function and service", 
+      "value": route.Image,
+    },
+    "Timeout": map[string]interface{} { 
+      "default": nil, 
+      "type": "number", 
+      "realtype": "range(0,)", 
+      "edit": true, 
+      "title": "Timeout (milliseconds)",
+      "help" : "Must be positive for function and shell", 
+      "value": route.Timeout,
+    },
+    "Retry": map[string]interface{} { 
+      "default": 0, 
+      "type": "number", 
+      "realtype": "range(0,)", 
+      "edit": true, 
+      "title": "Retries while the service starts",
+      "help" : "", 
+      "value": route.Retry,
+    },
+    "Jobs": map[string]interface{} { 
+      "default": nil, 
+      "type": "object", 
+      "realtype": "jobs(attempts,backoff,backoffmax,codes,exits,callback)", 
+      "edit": true, 
+      "title": "Retries and callback of async requests",
+      "help" : "For function, shell and pipeline ; without codes nor exits, every failure is retried ; a job failed at its last attempt is a dead letter ; the end is posted to the callback (url, or header "+jobs.HeaderCallback+" under a prefix of allow), signed with its secret (a reference to authorizations)", 
+      "value": route.Jobs,
+    },
+    "Schedules": map[string]interface{} { 
+      "default": nil, 
+      "type": "array", 
+      "realtype": "array(schedule(cron,timezone,jitter,payload,contenttype))", 
+      "edit": true, 
+      "title": "Timers of the route",
+      "help" : "For function, shell and pipeline ; cron expression (5 fields or @daily...), IANA timezone (UTC by default), random delay (seconds) and body of the request ; a run is a job, skipped while the previous one isn't ended", 
+      "value": route.Schedules,
+    },
+    "Triggers": map[string]interface{} { 
+      "default": nil, 
+      "type": "array", 
+      "realtype": "array(trigger(type,dir,pattern,debounce,content,done,failed))", 
+      "edit": true, 
+      "title": "Files' triggers of the route",
+      "help" : "For function, shell and pipeline ; a file written in the dir (absolute path, its name matching the pattern) is a job, its metadata or its content as body, after a quiet delay (milliseconds) ; ended, the file is moved to the done or failed dir", 
+      "value": route.Triggers,
+    },
+    "Steps": map[string]interface{} { 
+      "default": nil, 
+      "type": "array", 
+      "realtype": "array(step(route,parallel,join,timeout,onerror,fallback))", 
+      "edit": true, 
+      "title": "Steps of the pipeline",
+      "help" : "For pipeline ; each step serves a function or shell route (or parallel ones, their outputs joined in an array for the join's route) with the previous output ; on error (abort, continue or fallback), the timeout (milliseconds) is the route's one without", 
+      "value": route.Steps,
+    },
+    "Subscriptions": map[string]interface{} { 
+      "default": nil, 
+      "type": "array", 
+      "realtype": "array(subscription(topic,filter,ordered))", 
+      "edit": true, 
+      "title": "Topics of events received",
+      "help" : "For function, shell and pipeline ; topic's segments separated by '.' ('*' for any, a last '>' for the rest), fields of the event's json with their value ; an event is a job (at least once), the ordered ones served one at a time ; a function publishes its response with the header "+events.HeaderPublish, 
+      "value": route.Subscriptions,
+    },
+    "Delay": map[string]interface{} { 
+      "default": 0, 
+      "type": "number", 
+      "realtype": "range(0,)", 
+      "edit": true, 
+      "title": "Delay of inactivity before stopping (seconds)",
+      "help" : "For service", 
+      "value": route.Delay,
+    },
+    "Port": map[string]interface{} { 
+      "default": nil, 
+      "type": "number", 
+      "realtype": "range(1,65535)", 
+      "edit": true, 
+      "title": "Port of service",
+      "help" : "Needed for service", 
+      "value": route.Port,
+    },
+  }
+}
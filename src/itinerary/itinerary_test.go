@@ -0,0 +1,28 @@
+package itinerary
+
+import (
+  "io/ioutil"
+  "testing"
+)
+
+// a changed env (reload, patch) gives a new file
+func TestCreateFileEnv( t *testing.T ) {
+  dir := t.TempDir()
+  route := Route { Name: "a", Environment: map[string]string{ "A": "1" } }
+  first, err := route.CreateFileEnv( dir )
+  if err != nil {
+    t.Fatal( err )
+  }
+  route.Environment = map[string]string{ "A": "2" }
+  second, err := route.CreateFileEnv( dir )
+  if err != nil {
+    t.Fatal( err )
+  }
+  content, _ := ioutil.ReadFile( second )
+  if first == second || string( content ) != "A=2\n" {
+    t.Errorf( "env file not rewritten : '%v' (%v)", string( content ), second )
+  }
+  if again, _ := route.CreateFileEnv( dir ) ; again != second {
+    t.Error( "unchanged env must keep its file" )
+  }
+}
@@ -0,0 +1,276 @@
+package jobs
+
+import (
+  "bytes"
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net"
+  "net/http"
+  "net/url"
+  "path"
+  "strconv"
+  "strings"
+  "sync"
+  "syscall"
+  "time"
+  // -----------
+  "configuration/auth"
+  "logger"
+)
+
+// -----------------------------------------------
+
+// the end of a job is posted to its callback : the job and its result, signed
+// as a route of type hmac checks it (timestamp and job as delivery) ; the
+// delivery is retried, recorded with the job
+
+const (
+  HeaderCallback                        = "X-Faass-Callback"
+  HeaderJob                             = "X-Faass-Job"
+  HeaderTimestamp                       = "X-Faass-Timestamp"
+
+  DeliveryPending                       = "pending"
+  DeliveryDelivered                     = "delivered"
+  DeliveryFailed                        = "failed"
+
+  CallbackAttemptsDefault               = 5
+  CallbackTimeout                       = 10 * time.Second
+)
+
+// the secret is a reference to conf's authorizations, resolved as route's
+// authorization ; a request can give its own url (header) when allowed (a
+// prefix : same scheme and host, path below)
+type Callback struct {
+  URL string `json:"url"`
+  Allow []string `json:"allow"`
+  Given bool `json:"given,omitempty"`
+  Secret string `json:"secret"`
+  SecretDefault string `json:"-"`
+  Attempts int `json:"attempts"`
+  Backoff int `json:"backoff"`
+}
+
+func ( callback *Callback ) Copy() *Callback {
+  if callback == nil {
+    return nil
+  }
+  copied := *callback
+  return &copied
+}
+
+func ValidCallbackURL( raw string ) bool {
+  parsed, err := url.Parse( raw )
+  return err == nil && ( parsed.Scheme == "http" || parsed.Scheme == "https" ) && parsed.Host != ""
+}
+
+// the url given by a request : under an allowed prefix, never to the host 
+// itself (loopback, link-local : metadata of clouds), checked again when 
+// connecting (names resolved then) ; the signed callback can't be sent anywhere
+func ( callback *Callback ) Permit( raw string ) error {
+  parsed, err := url.Parse( raw )
+  if err != nil || ValidCallbackURL( raw ) != true {
+    return errors.New( "callback's url invalid (http or https)" )
+  }
+  target := path.Clean( "/"+parsed.Path )
+  allowed := false
+  for _, prefix := range callback.Allow {
+    p, err := url.Parse( prefix )
+    if err != nil || p.Scheme != parsed.Scheme || p.Host != parsed.Host {
+      continue
+    }
+    base := path.Clean( "/"+p.Path )
+    if target == base || strings.HasPrefix( target, strings.TrimSuffix( base, "/" )+"/" ) {
+      allowed = true
+      break
+    }
+  }
+  if allowed != true {
+    return errors.New( "callback's url not allowed for this route" )
+  }
+  if ip := net.ParseIP( parsed.Hostname() ) ; ip != nil && refusedIP( ip ) {
+    return errors.New( "callback's host refused (loopback or link-local)" )
+  }
+  return nil
+}
+
+func refusedIP( ip net.IP ) bool {
+  return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// the client of the urls given by requests : the adress is checked when 
+// connecting (a name resolved, redirections), without proxy
+func guardedClient() *http.Client {
+  dialer := &net.Dialer {
+    Timeout: CallbackTimeout,
+    Control: func( network string, address string, c syscall.RawConn ) error {
+      host, _, err := net.SplitHostPort( address )
+      if err != nil {
+        return err
+      }
+      if ip := net.ParseIP( host ) ; ip == nil || refusedIP( ip ) {
+        return errors.New( "callback's host refused (loopback or link-local)" )
+      }
+      return nil
+    },
+  }
+  transport := http.DefaultTransport.( *http.Transport ).Clone()
+  transport.Proxy = nil
+  transport.DialContext = dialer.DialContext
+  return &http.Client { Timeout: CallbackTimeout, Transport: transport }
+}
+
+func ( callback *Callback ) Rule() *auth.SignatureRule {
+  rule := &auth.SignatureRule { Secret: callback.Secret, TimestampHeader: HeaderTimestamp, DeliveryHeader: HeaderJob }
+  rule.PopulateDefaults()
+  return rule
+}
+
+type Delivery struct {
+  URL string `json:"url"`
+  Status string `json:"status"`
+  Attempts int `json:"attempts"`
+  Code int `json:"code,omitempty"`
+  Error string `json:"error,omitempty"`
+  Next *time.Time `json:"next,omitempty"`
+  Ended *time.Time `json:"ended,omitempty"`
+}
+
+// the content posted
+type Notification struct {
+  Job Job `json:"job"`
+  Result *Result `json:"result"`
+}
+
+// -----------------------------------------------
+
+// to call with the mutex held
+func ( pool *Pool ) notify( job *Job ) {
+  if job.policy == nil || job.policy.Callback == nil || job.policy.Callback.URL == "" {
+    return
+  }
+  now := time.Now()
+  job.Callback = &Delivery {
+    URL: job.policy.Callback.URL,
+    Status: DeliveryPending,
+    Next: &now,
+  }
+  pool.deliveries = append( pool.deliveries, job )
+}
+
+// to call with the mutex held ; the wait until the next delayed delivery (0 :
+// none), as for the jobs
+func ( pool *Pool ) dispatchDeliveries( ctx context.Context, group *sync.WaitGroup ) ( wait time.Duration ) {
+  now := time.Now()
+  waiting := []*Job{}
+  for _, job := range pool.deliveries {
+    switch {
+    case pool.jobs[job.Id] != job, job.Callback == nil, job.Callback.Status != DeliveryPending:
+    case job.Callback.Next != nil && job.Callback.Next.After( now ):
+      waiting = append( waiting, job )
+      if delay := job.Callback.Next.Sub( now ) ; wait == 0 || delay < wait {
+        wait = delay
+      }
+    case pool.delivering < pool.workers:
+      content, err := json.Marshal( Notification { Job: *job, Result: job.result } )
+      if err != nil {
+        pool.delivered( job, 0, err, false )
+        continue
+      }
+      // a delivery is replaced, never changed : the copies of the job keep theirs
+      delivery := *job.Callback
+      delivery.Next = nil
+      delivery.Attempts++
+      job.Callback = &delivery
+      pool.delivering++
+      group.Add( 1 )
+      go func( job *Job, callback *Callback, target string ) {
+        defer group.Done()
+        code, err := pool.post( ctx, callback, target, job.Id, content )
+        pool.mutex.Lock()
+        defer pool.mutex.Unlock()
+        pool.delivering--
+        pool.signal()
+        if ctx.Err() != nil {
+          // the process stops : delivered at the next start
+          return
+        }
+        pool.delivered( job, code, err, true )
+      }( job, job.policy.Callback.Copy(), job.Callback.URL )
+    default:
+      waiting = append( waiting, job )
+    }
+  }
+  pool.deliveries = waiting
+  return wait
+}
+
+func ( pool *Pool ) post( ctx context.Context, callback *Callback, target string, id string, content []byte ) ( int, error ) {
+  r, err := http.NewRequestWithContext( ctx, http.MethodPost, target, bytes.NewReader( content ) )
+  if err != nil {
+    return 0, err
+  }
+  timestamp := strconv.FormatInt( time.Now().Unix(), 10 )
+  rule := callback.Rule()
+  r.Header.Set( "Content-Type", "application/json" )
+  r.Header.Set( HeaderJob, id )
+  r.Header.Set( rule.TimestampHeader, timestamp )
+  r.Header.Set( rule.Header, rule.Sign( timestamp, content ) )
+  client := pool.Client
+  if callback.Given {
+    client = pool.Guarded
+  }
+  response, err := client.Do( r )
+  if err != nil {
+    return 0, err
+  }
+  defer response.Body.Close()
+  io.Copy( ioutil.Discard, io.LimitReader( response.Body, 1 << 16 ) )
+  if response.StatusCode < 200 || response.StatusCode > 299 {
+    return response.StatusCode, errors.New( fmt.Sprintf( "callback answered %v", response.StatusCode ) )
+  }
+  return response.StatusCode, nil
+}
+
+func retryableDelivery( code int ) bool {
+  return code == 0 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// to call with the mutex held ; a job removed meanwhile isn't saved again
+func ( pool *Pool ) delivered( job *Job, code int, err error, retry bool ) {
+  if pool.jobs[job.Id] != job {
+    return
+  }
+  delivery := *job.Callback
+  delivery.Code = code
+  delivery.Error = ""
+  callback := job.policy.Callback
+  attempts := callback.Attempts
+  if attempts < 1 {
+    attempts = CallbackAttemptsDefault
+  }
+  switch {
+  case err == nil:
+    now := time.Now()
+    delivery.Status = DeliveryDelivered
+    delivery.Ended = &now
+  case retry && retryableDelivery( code ) && delivery.Attempts < attempts:
+    next := time.Now().Add( backoff( callback.Backoff, 0, delivery.Attempts ) )
+    delivery.Error = err.Error()
+    delivery.Next = &next
+    pool.deliveries = append( pool.deliveries, job )
+  default:
+    now := time.Now()
+    delivery.Status = DeliveryFailed
+    delivery.Error = err.Error()
+    delivery.Ended = &now
+  }
+  job.Callback = &delivery
+  if pool.logger != nil && delivery.Status != DeliveryPending {
+    pool.logger.With( logger.FieldJob, job.Id ).Infof( "callback of job '%v' %v (%v attempt(s))", job.Id, delivery.Status, delivery.Attempts )
+  }
+  pool.store( job )
+}
@@ -0,0 +1,105 @@
+package jobs
+
+import (
+  "bytes"
+  "context"
+  "net/http"
+  "time"
+  // -----------
+)
+
+// -----------------------------------------------
+
+type contextKey int
+
+const (
+  keyTimeout contextKey = iota
+  keyExit
+)
+
+// the exit of the job's process, if any
+type Exit struct {
+  Code *int
+  Message string
+}
+
+func withTimeout( ctx context.Context, timeout time.Duration ) context.Context {
+  return context.WithValue( ctx, keyTimeout, timeout )
+}
+
+func WithExit( ctx context.Context, exit *Exit ) context.Context {
+  return context.WithValue( ctx, keyExit, exit )
+}
+
+func SetExit( ctx context.Context, code int, message string ) {
+  if exit, ok := ctx.Value( keyExit ).( *Exit ) ; ok {
+    exit.Code = &code
+    exit.Message = message
+  }
+}
+
+// the context of a request's process : for a job, canceled with it and
+// its timeout at least the async one
+func Context( ctx context.Context, timeout time.Duration ) ( context.Context, context.CancelFunc ) {
+  parent := context.Background()
+  if async, ok := ctx.Value( keyTimeout ).( time.Duration ) ; ok {
+    parent = ctx
+    if async > timeout {
+      timeout = async
+    }
+  }
+  return context.WithTimeout( parent, timeout )
+}
+
+// the context of requests served on behalf of another one (a pipeline's
+// step) : their processes are canceled with it, after the timeout if any
+func Within( ctx context.Context, timeout time.Duration ) ( context.Context, context.CancelFunc ) {
+  cancel := context.CancelFunc( func() {} )
+  if timeout > 0 {
+    ctx, cancel = context.WithTimeout( ctx, timeout )
+  }
+  return withTimeout( ctx, timeout ), cancel
+}
+
+// -----------------------------------------------
+
+// the response of a job's request, kept in memory (limited)
+type Recorder struct {
+  header http.Header
+  code int
+  body bytes.Buffer
+}
+
+func NewRecorder() *Recorder {
+  return &Recorder { header: make( http.Header ) }
+}
+
+func ( recorder *Recorder ) Header() http.Header {
+  return recorder.header
+}
+
+func ( recorder *Recorder ) WriteHeader( code int ) {
+  if recorder.code == 0 {
+    recorder.code = code
+  }
+}
+
+func ( recorder *Recorder ) Write( p []byte ) ( int, error ) {
+  recorder.WriteHeader( http.StatusOK )
+  if room := ResultSizeMax+1-recorder.body.Len() ; room > 0 {
+    if len( p ) > room {
+      recorder.body.Write( p[:room] )
+    } else {
+      recorder.body.Write( p )
+    }
+  }
+  return len( p ), nil
+}
+
+func ( recorder *Recorder ) Result() Result {
+  code := recorder.code
+  if code == 0 {
+    code = http.StatusOK
+  }
+  return Result { Code: code, Header: recorder.header.Clone(), Body: recorder.body.Bytes() }
+}
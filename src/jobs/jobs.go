@@ -0,0 +1,492 @@
+package jobs
+
+import (
+  "context"
+  "crypto/rand"
+  "encoding/hex"
+  "errors"
+  "fmt"
+  "net/http"
+  "sort"
+  "strings"
+  "sync"
+  "time"
+  // -----------
+  "logger"
+)
+
+// -----------------------------------------------
+
+// the asynchronous invocations : the request is accepted (202 and the job's
+// id), then served by a pool of workers ; the job and its result are kept
+// during the retention. The id is random : who knows it can read the job ;
+// a job failed after its last attempt is a dead letter, kept until replayed
+// or removed
+
+const (
+  Path                                  = "/api/jobs"
+  HeaderPrefer                          = "Prefer"
+  PreferAsync                           = "respond-async"
+
+  StatusQueued                          = "queued"
+  StatusRunning                         = "running"
+  StatusSucceeded                       = "succeeded"
+  StatusFailed                          = "failed"
+  StatusCanceled                        = "canceled"
+
+  WorkersDefault                        = 4
+  WorkersMax                            = 64
+  RetentionDefault                      = 3600
+  RetentionMax                          = 7 * 24 * 3600
+  TimeoutMax                            = 3600 * 1000
+  QueueMax                              = 1000
+  DeadLettersMax                        = 1000
+  BodySizeMax                           = 10 << 20
+  ResultSizeMax                         = 10 << 20
+  CollectInterval                       = time.Minute
+)
+
+var (
+  ErrQueueFull = errors.New( "too many jobs queued" )
+  ErrUnknown = errors.New( "unknow job" )
+  ErrNotDeadLetter = errors.New( "the job isn't a dead letter" )
+)
+
+func Location( id string ) string {
+  return Path+"/"+id
+}
+
+// Prefer: respond-async (RFC 7240), among other preferences
+func WantsAsync( r *http.Request ) bool {
+  for _, value := range r.Header.Values( HeaderPrefer ) {
+    for _, preference := range strings.Split( value, "," ) {
+      name, _, _ := strings.Cut( preference, "=" )
+      if strings.EqualFold( strings.TrimSpace( name ), PreferAsync ) {
+        return true
+      }
+    }
+  }
+  return false
+}
+
+// -----------------------------------------------
+
+type Result struct {
+  Code int `json:"code"`
+  Header http.Header `json:"header"`
+  Body []byte `json:"body"`
+}
+
+type Job struct {
+  Id string `json:"id"`
+  Route string `json:"route"`
+  Origin string `json:"origin,omitempty"`
+  Sequence string `json:"sequence,omitempty"`
+  Status string `json:"status"`
+  Created time.Time `json:"created"`
+  Started *time.Time `json:"started"`
+  Ended *time.Time `json:"ended"`
+  Expires *time.Time `json:"expires"`
+  Code int `json:"code,omitempty"`
+  Exit *int `json:"exit,omitempty"`
+  Error string `json:"error,omitempty"`
+  Size int `json:"size"`
+  Truncated bool `json:"truncated,omitempty"`
+  Attempts int `json:"attempts"`
+  Next *time.Time `json:"next,omitempty"`
+  DeadLetter bool `json:"deadletter,omitempty"`
+  ReplayOf string `json:"replayof,omitempty"`
+  Callback *Delivery `json:"callback,omitempty"`
+  request *Request
+  policy *Policy
+  cancel context.CancelFunc
+  result *Result
+}
+
+func ( job *Job ) Done() bool {
+  return job.Ended != nil
+}
+
+// serves the request of an attempt in its context (canceled with the job),
+// where the process' exit is given (SetExit)
+type Handler func( ctx context.Context, route string, request *Request ) Result
+
+// -----------------------------------------------
+
+type Pool struct {
+  Dir string
+  Client *http.Client
+  Guarded *http.Client
+  logger *logger.Logger
+  mutex sync.Mutex
+  wake chan struct{}
+  workers int
+  running int
+  retention time.Duration
+  timeout time.Duration
+  handler Handler
+  queue []*Job
+  delivering int
+  deliveries []*Job
+  // the jobs running by sequence
+  sequences map[string]int
+  jobs map[string]*Job
+}
+
+// the dir is read by Load ; empty, the jobs are lost at the stop
+func NewPool( dir string, logger *logger.Logger ) *Pool {
+  pool := &Pool {
+    Dir: dir,
+    Client: &http.Client { Timeout: CallbackTimeout },
+    Guarded: guardedClient(),
+    logger: logger,
+    wake: make( chan struct{}, 1 ),
+    sequences: make( map[string]int ),
+    jobs: make( map[string]*Job ),
+  }
+  pool.Configure( 0, 0, 0 )
+  return pool
+}
+
+// 0 for the defaults ; the timeout (milliseconds) is the minimum of the
+// async requests, 0 to keep the route's one
+func ( pool *Pool ) Configure( workers int, retention int, timeout int ) {
+  if workers <= 0 {
+    workers = WorkersDefault
+  }
+  if retention <= 0 {
+    retention = RetentionDefault
+  }
+  pool.mutex.Lock()
+  pool.workers = workers
+  pool.retention = time.Duration( retention ) * time.Second
+  pool.timeout = time.Duration( timeout ) * time.Millisecond
+  pool.mutex.Unlock()
+  pool.signal()
+}
+
+// the jobs wait for their handler
+func ( pool *Pool ) Handle( handler Handler ) {
+  pool.mutex.Lock()
+  pool.handler = handler
+  pool.mutex.Unlock()
+  pool.signal()
+}
+
+func ( pool *Pool ) signal() {
+  select {
+  case pool.wake <- struct{}{}:
+  default:
+  }
+}
+
+func newId() string {
+  random := make( []byte, 16 )
+  rand.Read( random )
+  return hex.EncodeToString( random )
+}
+
+func ( pool *Pool ) Submit( route string, request *Request, policy *Policy ) ( job Job, err error ) {
+  pool.mutex.Lock()
+  defer pool.mutex.Unlock()
+  added, err := pool.submit( route, request, policy )
+  if err != nil {
+    return job, err
+  }
+  return *added, nil
+}
+
+// to call with the mutex held
+func ( pool *Pool ) submit( route string, request *Request, policy *Policy ) ( *Job, error ) {
+  if len( pool.queue ) >= QueueMax {
+    return nil, ErrQueueFull
+  }
+  added := &Job {
+    Id: newId(),
+    Route: route,
+    Origin: request.Origin,
+    Sequence: request.Sequence,
+    Status: StatusQueued,
+    Created: time.Now(),
+    request: request,
+    policy: policy.Copy(),
+  }
+  if err := pool.save( added ) ; err != nil {
+    return nil, errors.New( fmt.Sprintf( "job not saved : %v", err ) )
+  }
+  pool.jobs[added.Id] = added
+  pool.queue = append( pool.queue, added )
+  pool.signal()
+  return added, nil
+}
+
+func ( pool *Pool ) Get( id string ) ( job Job, ok bool ) {
+  pool.mutex.Lock()
+  defer pool.mutex.Unlock()
+  if current, ok := pool.jobs[id] ; ok {
+    return *current, true
+  }
+  return job, false
+}
+
+func ( pool *Pool ) Result( id string ) ( result *Result, job Job, ok bool ) {
+  pool.mutex.Lock()
+  defer pool.mutex.Unlock()
+  current, ok := pool.jobs[id]
+  if ok != true {
+    return nil, job, false
+  }
+  return current.result, *current, true
+}
+
+// the most recent first
+func ( pool *Pool ) List() []Job {
+  pool.mutex.Lock()
+  defer pool.mutex.Unlock()
+  list := make( []Job, 0, len( pool.jobs ) )
+  for _, job := range pool.jobs {
+    list = append( list, *job )
+  }
+  sort.Slice( list, func( i int, j int ) bool { return list[i].Created.After( list[j].Created ) } )
+  return list
+}
+
+// a queued job is never run (nor retried), a running one is canceled (its
+// process killed) ; a finished job is removed
+func ( pool *Pool ) Cancel( id string ) ( job Job, removed bool, ok bool ) {
+  pool.mutex.Lock()
+  defer pool.mutex.Unlock()
+  current, ok := pool.jobs[id]
+  if ok != true {
+    return job, false, false
+  }
+  switch {
+  case current.Done():
+    pool.remove( id )
+    removed = true
+  case current.Status == StatusQueued:
+    pool.end( current, StatusCanceled, "canceled before its run" )
+    pool.store( current )
+  case current.cancel != nil:
+    current.cancel()
+  }
+  return *current, removed, true
+}
+
+// to call with the mutex held ; a failed job becomes a dead letter, without
+// expiration (the oldest are dropped beyond the maximum)
+func ( pool *Pool ) end( job *Job, status string, message string ) {
+  now := time.Now()
+  job.Status = status
+  job.Ended = &now
+  job.Next = nil
+  if message != "" {
+    job.Error = message
+  }
+  job.cancel = nil
+  pool.notify( job )
+  if status != StatusFailed {
+    expires := now.Add( pool.retention )
+    job.Expires = &expires
+    return
+  }
+  job.DeadLetter = true
+  deadLetters := []*Job{}
+  for _, current := range pool.jobs {
+    if current.DeadLetter {
+      deadLetters = append( deadLetters, current )
+    }
+  }
+  if len( deadLetters ) <= DeadLettersMax {
+    return
+  }
+  sort.Slice( deadLetters, func( i int, j int ) bool { return deadLetters[i].Ended.Before( *deadLetters[j].Ended ) } )
+  for _, dropped := range deadLetters[:len( deadLetters )-DeadLettersMax] {
+    pool.remove( dropped.Id )
+  }
+}
+
+// the expired jobs are removed, once their callback delivered
+func ( pool *Pool ) Collect() ( removed int ) {
+  pool.mutex.Lock()
+  defer pool.mutex.Unlock()
+  now := time.Now()
+  for id, job := range pool.jobs {
+    if job.Callback != nil && job.Callback.Status == DeliveryPending {
+      continue
+    }
+    if job.Expires != nil && job.Expires.Before( now ) {
+      pool.remove( id )
+      removed++
+    }
+  }
+  return removed
+}
+
+// the dead letter is queued again as a new job (same request and policy), then
+// removed
+func ( pool *Pool ) Replay( id string ) ( job Job, err error ) {
+  pool.mutex.Lock()
+  defer pool.mutex.Unlock()
+  current, ok := pool.jobs[id]
+  switch {
+  case ok != true:
+    return job, ErrUnknown
+  case current.DeadLetter != true:
+    return job, ErrNotDeadLetter
+  }
+  added, err := pool.submit( current.Route, current.request, current.policy )
+  if err != nil {
+    return job, err
+  }
+  added.ReplayOf = id
+  pool.store( added )
+  pool.remove( id )
+  return *added, nil
+}
+
+// -----------------------------------------------
+
+// the queued jobs are run, as many at once as workers and once their delay
+// passed, until the context is done (the running ones are canceled)
+func ( pool *Pool ) Run( ctx context.Context ) {
+  var group sync.WaitGroup
+  defer group.Wait()
+  for {
+    pool.mutex.Lock()
+    wait := pool.dispatch( ctx, &group )
+    pool.mutex.Unlock()
+    var timer *time.Timer
+    var ready <-chan time.Time
+    if wait > 0 {
+      timer = time.NewTimer( wait )
+      ready = timer.C
+    }
+    select {
+    case <-pool.wake:
+    case <-ready:
+    case <-ctx.Done():
+    }
+    if timer != nil {
+      timer.Stop()
+    }
+    if ctx.Err() != nil {
+      return
+    }
+  }
+}
+
+// to call with the mutex held ; the wait until the next delayed job or
+// delivery (0 : none). The jobs of a sequence run one at a time, in the order
+// of their submission (a retry delayed holds the next ones)
+func ( pool *Pool ) dispatch( ctx context.Context, group *sync.WaitGroup ) ( wait time.Duration ) {
+  wait = pool.dispatchDeliveries( ctx, group )
+  if pool.handler == nil {
+    return wait
+  }
+  first := make( map[string]*Job )
+  for _, job := range pool.queue {
+    if job.Sequence == "" || job.Status != StatusQueued {
+      continue
+    }
+    if previous, ok := first[job.Sequence] ; ok != true || job.Created.Before( previous.Created ) {
+      first[job.Sequence] = job
+    }
+  }
+  now := time.Now()
+  waiting := []*Job{}
+  for _, job := range pool.queue {
+    switch {
+    case job.Status != StatusQueued:
+    case job.Sequence != "" && ( pool.sequences[job.Sequence] > 0 || first[job.Sequence] != job ):
+      waiting = append( waiting, job )
+    case job.Next != nil && job.Next.After( now ):
+      waiting = append( waiting, job )
+      if delay := job.Next.Sub( now ) ; wait == 0 || delay < wait {
+        wait = delay
+      }
+    case pool.running < pool.workers:
+      pool.start( ctx, group, job )
+    default:
+      waiting = append( waiting, job )
+    }
+  }
+  pool.queue = waiting
+  return wait
+}
+
+// to call with the mutex held
+func ( pool *Pool ) start( ctx context.Context, group *sync.WaitGroup, job *Job ) {
+  jobCtx, cancel := context.WithCancel( withTimeout( ctx, pool.timeout ) )
+  now := time.Now()
+  job.Status = StatusRunning
+  job.Started = &now
+  job.Next = nil
+  job.Attempts++
+  job.cancel = cancel
+  pool.store( job )
+  pool.running++
+  if job.Sequence != "" {
+    pool.sequences[job.Sequence]++
+  }
+  group.Add( 1 )
+  go func( handler Handler, request *Request ) {
+    defer group.Done()
+    defer cancel()
+    pool.finish( ctx, jobCtx, job, handler, request )
+  }( pool.handler, job.request )
+}
+
+func ( pool *Pool ) finish( runCtx context.Context, ctx context.Context, job *Job, handler Handler, request *Request ) {
+  exit := &Exit{}
+  var result Result
+  func() {
+    // a worker's failure mustn't stop the process
+    defer func() {
+      if recovered := recover() ; recovered != nil {
+        result = Result { Code: http.StatusInternalServerError }
+        exit.Message = "job panicked"
+      }
+    }()
+    result = handler( WithExit( ctx, exit ), job.Route, request )
+  }()
+  pool.mutex.Lock()
+  defer pool.mutex.Unlock()
+  pool.running--
+  if job.Sequence != "" {
+    pool.sequences[job.Sequence]--
+    if pool.sequences[job.Sequence] <= 0 {
+      delete( pool.sequences, job.Sequence )
+    }
+  }
+  pool.signal()
+  if len( result.Body ) > ResultSizeMax {
+    result.Body = result.Body[:ResultSizeMax]
+    job.Truncated = true
+  } else {
+    job.Truncated = false
+  }
+  job.result = &result
+  job.Code = result.Code
+  job.Exit = exit.Code
+  job.Size = len( result.Body )
+  job.cancel = nil
+  retryable := job.policy.Retryable( result.Code, exit.Code )
+  switch {
+  case runCtx.Err() != nil:
+    // the process stops : the job isn't ended, it's taken back by the next start
+  case ctx.Err() == context.Canceled:
+    pool.end( job, StatusCanceled, exit.Message )
+  case retryable && job.policy.Remains( job.Attempts ):
+    next := time.Now().Add( job.policy.Delay( job.Attempts ) )
+    job.Status = StatusQueued
+    job.Next = &next
+    job.Error = exit.Message
+    pool.queue = append( pool.queue, job )
+  case retryable, failure( result.Code, exit.Code ):
+    pool.end( job, StatusFailed, exit.Message )
+  default:
+    pool.end( job, StatusSucceeded, exit.Message )
+  }
+  pool.store( job )
+}
@@ -0,0 +1,287 @@
+package jobs
+
+import (
+  "context"
+  "encoding/json"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "strconv"
+  "strings"
+  "sync"
+  "testing"
+  "time"
+  // -----------
+  "logger"
+)
+
+func wait( t *testing.T, pool *Pool, id string ) Job {
+  for i := 0 ; i < 200 ; i++ {
+    if job, _ := pool.Get( id ) ; job.Done() {
+      return job
+    }
+    time.Sleep( 5 * time.Millisecond )
+  }
+  t.Fatalf( "job '%v' not ended", id )
+  return Job{}
+}
+
+func newPool( t *testing.T, dir string ) *Pool {
+  l := &logger.Logger{}
+  l.Init()
+  pool := NewPool( dir, l )
+  pool.Configure( 1, 0, 60000 )
+  if _, err := pool.Load() ; err != nil {
+    t.Fatal( err )
+  }
+  return pool
+}
+
+func request( t *testing.T, body string ) *Request {
+  r := httptest.NewRequest( http.MethodPost, "/lambda/a", nil )
+  r.Header.Set( HeaderPrefer, PreferAsync )
+  return NewRequest( r, []byte( body ), nil )
+}
+
+func TestPool( t *testing.T ) {
+  pool := newPool( t, "" )
+  ctx, cancel := context.WithCancel( context.Background() )
+  defer cancel()
+  go pool.Run( ctx )
+  blocked := make( chan struct{} )
+  pool.Handle( func( ctx context.Context, route string, request *Request ) Result {
+    if route == "b" {
+      t.Error( "a canceled job must not run" )
+    }
+    if request.Header.Get( HeaderPrefer ) != "" {
+      t.Error( "the preference mustn't be served" )
+    }
+    <-blocked
+    recorder := NewRecorder()
+    SetExit( ctx, 3, "exit status 3" )
+    recorder.Header().Set( "Content-type", "text/plain" )
+    recorder.WriteHeader( http.StatusTeapot )
+    recorder.Write( request.Body )
+    return recorder.Result()
+  } )
+  first, _ := pool.Submit( "a", request( t, "done" ), nil )
+  // one worker : the second job waits, then is canceled before its run
+  second, _ := pool.Submit( "b", request( t, "" ), nil )
+  if job, removed, _ := pool.Cancel( second.Id ) ; removed || job.Status != StatusCanceled {
+    t.Errorf( "queued job canceled expected : %+v", job )
+  }
+  close( blocked )
+  job := wait( t, pool, first.Id )
+  result, _, _ := pool.Result( first.Id )
+  if job.Status != StatusFailed || job.DeadLetter != true || job.Expires != nil || job.Code != http.StatusTeapot || *job.Exit != 3 || string( result.Body ) != "done" {
+    t.Errorf( "unexpected job : %+v", job )
+  }
+  if pool.Collect() != 0 {
+    t.Error( "jobs removed before their retention" )
+  }
+  if _, removed, _ := pool.Cancel( first.Id ) ; removed != true {
+    t.Error( "an ended job must be removed" )
+  }
+}
+
+func TestRetries( t *testing.T ) {
+  dir := t.TempDir()
+  pool := newPool( t, dir )
+  ctx, cancel := context.WithCancel( context.Background() )
+  defer cancel()
+  go pool.Run( ctx )
+  attempts := map[string]int{}
+  pool.Handle( func( ctx context.Context, route string, request *Request ) Result {
+    attempts[route]++
+    code, _ := strconv.Atoi( string( request.Body ) )
+    return Result { Code: code }
+  } )
+  policy := &Policy { Attempts: 3, Backoff: 1, Codes: []int{ 429 } }
+  retried, _ := pool.Submit( "retried", request( t, "429" ), policy )
+  // 503 isn't among the codes retried : one attempt only
+  failed, _ := pool.Submit( "failed", request( t, "503" ), policy )
+  if job := wait( t, pool, retried.Id ) ; attempts["retried"] != 3 || job.Attempts != 3 || job.DeadLetter != true {
+    t.Errorf( "3 attempts expected (%v) : %+v", attempts["retried"], job )
+  }
+  if job := wait( t, pool, failed.Id ) ; attempts["failed"] != 1 || job.Status != StatusFailed {
+    t.Errorf( "1 attempt expected (%v) : %+v", attempts["failed"], job )
+  }
+  // the dead letters are kept by the dir ; a replay is a new job
+  cancel()
+  time.Sleep( 10 * time.Millisecond )
+  loaded := newPool( t, dir )
+  if dead, ok := loaded.Get( retried.Id ) ; ok != true || dead.DeadLetter != true {
+    t.Fatalf( "the dead letter must be loaded : %+v", dead )
+  }
+  replay, err := loaded.Replay( retried.Id )
+  if _, ok := loaded.Get( retried.Id ) ; err != nil || ok || replay.ReplayOf != retried.Id || replay.Status != StatusQueued {
+    t.Errorf( "unexpected replay : %+v (%v)", replay, err )
+  }
+  if _, err := loaded.Replay( replay.Id ) ; err != ErrNotDeadLetter {
+    t.Errorf( "a job queued isn't a dead letter : %v", err )
+  }
+  if again := newPool( t, dir ) ; len( again.queue ) != 1 || again.queue[0].Id != replay.Id || string( again.queue[0].request.Body ) != "429" {
+    t.Error( "the queued job must be taken back with its request" )
+  }
+}
+
+func TestSequence( t *testing.T ) {
+  pool := newPool( t, "" )
+  pool.Configure( 4, 0, 60000 )
+  ctx, cancel := context.WithCancel( context.Background() )
+  defer cancel()
+  go pool.Run( ctx )
+  var mutex sync.Mutex
+  served, running, overlapped := []string{}, 0, false
+  pool.Handle( func( ctx context.Context, route string, request *Request ) Result {
+    mutex.Lock()
+    served = append( served, string( request.Body ) )
+    running++
+    overlapped = overlapped || running > 1
+    attempts := len( served )
+    mutex.Unlock()
+    time.Sleep( 5 * time.Millisecond )
+    mutex.Lock()
+    running--
+    mutex.Unlock()
+    // the first one fails once : its retry holds the next ones
+    if attempts == 1 {
+      return Result { Code: http.StatusServiceUnavailable }
+    }
+    return Result { Code: http.StatusOK }
+  } )
+  policy := &Policy { Attempts: 2, Backoff: 20 }
+  ids := []string{}
+  for _, body := range []string{ "a", "b", "c" } {
+    added := request( t, body )
+    added.Sequence = "s"
+    job, _ := pool.Submit( "a", added, policy )
+    ids = append( ids, job.Id )
+  }
+  for _, id := range ids {
+    wait( t, pool, id )
+  }
+  mutex.Lock()
+  defer mutex.Unlock()
+  if strings.Join( served, "," ) != "a,a,b,c" || overlapped {
+    t.Errorf( "the sequence must be served in order, one at a time : %v (overlapped %v)", served, overlapped )
+  }
+}
+
+func TestCallback( t *testing.T ) {
+  var mutex sync.Mutex
+  received := []string{}
+  callback := &Callback { Secret: "s3cret", Backoff: 1 }
+  receiver := httptest.NewServer( http.HandlerFunc( func( w http.ResponseWriter, r *http.Request ) {
+    body, _ := ioutil.ReadAll( r.Body )
+    mutex.Lock()
+    defer mutex.Unlock()
+    if err := callback.Rule().Verify( r.Header, body, nil, time.Now() ) ; err != nil {
+      t.Errorf( "signature refused : %v", err )
+    }
+    var notification Notification
+    json.Unmarshal( body, &notification )
+    received = append( received, notification.Job.Id+"/"+notification.Job.Status+"/"+string( notification.Result.Body ) )
+    // the first delivery fails
+    if len( received ) == 1 {
+      w.WriteHeader( http.StatusServiceUnavailable )
+    }
+  } ) )
+  defer receiver.Close()
+  pool := newPool( t, "" )
+  pool.Client = receiver.Client()
+  ctx, cancel := context.WithCancel( context.Background() )
+  defer cancel()
+  go pool.Run( ctx )
+  pool.Handle( func( ctx context.Context, route string, request *Request ) Result {
+    return Result { Code: http.StatusOK, Body: request.Body }
+  } )
+  callback.URL = receiver.URL
+  submitted, _ := pool.Submit( "a", request( t, "done" ), &Policy { Callback: callback } )
+  var job Job
+  for i := 0 ; i < 200 ; i++ {
+    if job, _ = pool.Get( submitted.Id ) ; job.Callback != nil && job.Callback.Status != DeliveryPending {
+      break
+    }
+    time.Sleep( 5 * time.Millisecond )
+  }
+  mutex.Lock()
+  defer mutex.Unlock()
+  expected := submitted.Id+"/"+StatusSucceeded+"/done"
+  if job.Callback == nil || job.Callback.Status != DeliveryDelivered || job.Callback.Attempts != 2 || len( received ) != 2 || received[1] != expected {
+    t.Errorf( "a delivery at the second attempt expected : %+v %v", job.Callback, received )
+  }
+}
+
+func TestPolicy( t *testing.T ) {
+  zero, one := 0, 1
+  policy := &Policy { Attempts: 2, Backoff: 100, BackoffMax: 300 }
+  if policy.Retryable( 200, &zero ) || policy.Retryable( 200, &one ) != true || policy.Retryable( 502, nil ) != true {
+    t.Error( "every failure is retried without codes or exits" )
+  }
+  if policy.Remains( 1 ) != true || policy.Remains( 2 ) || ( *Policy )( nil ).Remains( 0 ) {
+    t.Error( "unexpected remaining attempts" )
+  }
+  for attempts, delay := range map[int]time.Duration { 1: 100, 2: 200, 3: 300, 10: 300 } {
+    if policy.Delay( attempts ) != delay * time.Millisecond {
+      t.Errorf( "attempt %v : delay %v instead of %v", attempts, policy.Delay( attempts ), delay * time.Millisecond )
+    }
+  }
+}
+
+func TestWantsAsync( t *testing.T ) {
+  for value, async := range map[string]bool {
+    "": false,
+    "respond-async": true,
+    "return=minimal, Respond-Async": true,
+    "wait=10": false,
+  } {
+    r := httptest.NewRequest( http.MethodPost, "/lambda/a", nil )
+    r.Header.Set( HeaderPrefer, value )
+    if WantsAsync( r ) != async {
+      t.Errorf( "'%v' : %v expected", value, async )
+    }
+  }
+}
+
+func TestRequestCredentials( t *testing.T ) {
+  r := httptest.NewRequest( http.MethodPost, "/lambda/a", nil )
+  r.Header.Set( "Authorization", "Bearer secret" )
+  r.Header.Set( "Cookie", "session=secret" )
+  r.Header.Set( "X-Hub-Signature-256", "sha256=00" )
+  r.Header.Set( "X-Kept", "1" )
+  request := NewRequest( r, nil, nil, "X-Hub-Signature-256" )
+  for _, name := range []string{ "Authorization", "Cookie", "X-Hub-Signature-256" } {
+    if request.Header.Get( name ) != "" {
+      t.Errorf( "credential '%v' kept", name )
+    }
+  }
+  if request.Header.Get( "X-Kept" ) != "1" {
+    t.Error( "other headers must be kept" )
+  }
+}
+
+// a url given by a request : under an allowed prefix, never to the host itself
+func TestCallbackPermit( t *testing.T ) {
+  callback := &Callback { Secret: "s3cret", Allow: []string{ "https://192.0.2.10/hooks/", "http://127.0.0.1:8080/" } }
+  for raw, ok := range map[string]bool {
+    "https://192.0.2.10/hooks/build": true,
+    "https://192.0.2.10/hooks": true,
+    "https://192.0.2.10/hooks/../admin": false,
+    "https://192.0.2.10/other": false,
+    "http://192.0.2.10/hooks/build": false,
+    "https://192.0.2.10.example.org/hooks/": false,
+    "https://user@192.0.2.11/hooks/": false,
+    "http://127.0.0.1:8080/": false,
+    "ftp://192.0.2.10/hooks/": false,
+  } {
+    if err := callback.Permit( raw ) ; ( err == nil ) != ok {
+      t.Errorf( "'%v' : %v, allowed %v expected", raw, err, ok )
+    }
+  }
+  receiver := httptest.NewServer( http.HandlerFunc( func( w http.ResponseWriter, r *http.Request ) {} ) )
+  defer receiver.Close()
+  if _, err := guardedClient().Get( receiver.URL ) ; err == nil {
+    t.Error( "loopback reached by a given callback" )
+  }
+}
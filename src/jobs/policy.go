@@ -0,0 +1,97 @@
+package jobs
+
+import (
+  "net/http"
+  "time"
+  // -----------
+)
+
+// -----------------------------------------------
+
+const (
+  AttemptsMax                           = 20
+  BackoffDefault                        = 1000
+  BackoffMaxDefault                     = 300 * 1000
+  BackoffLimit                          = 24 * 3600 * 1000
+)
+
+// the route's policy for its jobs : a failed attempt is retried, after a delay
+// doubled at each attempt, while attempts remain ; without codes or exits,
+// every failure is retried ; the end of the job is posted to the callback
+type Policy struct {
+  Attempts int `json:"attempts"`
+  Backoff int `json:"backoff"`
+  BackoffMax int `json:"backoffmax"`
+  Codes []int `json:"codes"`
+  Exits []int `json:"exits"`
+  Callback *Callback `json:"callback"`
+}
+
+func ( policy *Policy ) Copy() *Policy {
+  if policy == nil {
+    return nil
+  }
+  copied := *policy
+  copied.Codes = append( []int{}, policy.Codes... )
+  copied.Exits = append( []int{}, policy.Exits... )
+  copied.Callback = policy.Callback.Copy()
+  return &copied
+}
+
+func failure( code int, exit *int ) bool {
+  return code >= http.StatusInternalServerError || ( exit != nil && *exit != 0 )
+}
+
+// the answer of an attempt asks a retry (if attempts remain)
+func ( policy *Policy ) Retryable( code int, exit *int ) bool {
+  if policy == nil {
+    return false
+  }
+  if len( policy.Codes ) == 0 && len( policy.Exits ) == 0 {
+    return failure( code, exit )
+  }
+  for _, retried := range policy.Codes {
+    if retried == code {
+      return true
+    }
+  }
+  for _, retried := range policy.Exits {
+    if exit != nil && retried == *exit {
+      return true
+    }
+  }
+  return false
+}
+
+func ( policy *Policy ) Remains( attempts int ) bool {
+  return policy != nil && attempts < policy.Attempts
+}
+
+// the delay after the attempt given (the first is 1)
+func ( policy *Policy ) Delay( attempts int ) time.Duration {
+  if policy == nil {
+    return backoff( 0, 0, attempts )
+  }
+  return backoff( policy.Backoff, policy.BackoffMax, attempts )
+}
+
+// doubled at each attempt ; 0 for the defaults
+func backoff( first int, max int, attempts int ) time.Duration {
+  if first <= 0 {
+    first = BackoffDefault
+  }
+  if max <= 0 {
+    max = BackoffMaxDefault
+  }
+  if max < first {
+    max = first
+  }
+  delay, limit := time.Duration( first ) * time.Millisecond, time.Duration( max ) * time.Millisecond
+  for i := 1 ; i < attempts && delay < limit ; i++ {
+    delay *= 2
+  }
+  if delay > limit {
+    delay = limit
+  }
+  return delay
+}
@@ -0,0 +1,188 @@
+package jobs
+
+import (
+  "bytes"
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "net/http"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "time"
+  // -----------
+  "logger"
+)
+
+// -----------------------------------------------
+
+// a job is a file of the pool's dir, rewritten at each change : the queue
+// survives a restart (the request is kept with its job)
+
+const (
+  DirName                               = "jobs"
+  FileSuffix                            = ".json"
+  TmpSuffix                             = ".tmp"
+)
+
+// the request as received, served again by each attempt ; the origin and the
+// sequence are given to the job (an async request has none)
+type Request struct {
+  Origin string `json:"origin"`
+  Sequence string `json:"sequence"`
+  Method string `json:"method"`
+  URL string `json:"url"`
+  Header http.Header `json:"header"`
+  Body []byte `json:"body"`
+  RemoteAddr string `json:"remoteaddr"`
+  Env map[string]string `json:"env"`
+}
+
+// the credentials, checked before, aren't kept on disk : Authorization, Cookie
+// and the given headers (a route's signature)
+var CredentialHeaders = []string{ "Authorization", "Proxy-Authorization", "Cookie" }
+
+func NewRequest( r *http.Request, body []byte, env map[string]string, credentials ...string ) *Request {
+  request := &Request {
+    Method: r.Method,
+    URL: r.URL.String(),
+    Header: r.Header.Clone(),
+    Body: body,
+    RemoteAddr: r.RemoteAddr,
+    Env: make( map[string]string ),
+  }
+  request.Header.Del( HeaderPrefer )
+  request.Header.Del( HeaderCallback )
+  for _, name := range append( CredentialHeaders, credentials... ) {
+    request.Header.Del( name )
+  }
+  for key, value := range env {
+    request.Env[key] = value
+  }
+  return request
+}
+
+func ( request *Request ) HTTP( ctx context.Context ) ( *http.Request, error ) {
+  r, err := http.NewRequestWithContext( ctx, request.Method, request.URL, bytes.NewReader( request.Body ) )
+  if err != nil {
+    return nil, err
+  }
+  r.Header = request.Header.Clone()
+  r.RemoteAddr = request.RemoteAddr
+  r.RequestURI = request.URL
+  return r, nil
+}
+
+type record struct {
+  Job *Job `json:"job"`
+  Request *Request `json:"request"`
+  Policy *Policy `json:"policy,omitempty"`
+  Result *Result `json:"result,omitempty"`
+}
+
+func ( pool *Pool ) path( id string ) string {
+  return filepath.Join( pool.Dir, id+FileSuffix )
+}
+
+// to call with the mutex held ; without dir, the jobs are only in memory
+func ( pool *Pool ) save( job *Job ) error {
+  if pool.Dir == "" {
+    return nil
+  }
+  content, err := json.Marshal( record { Job: job, Request: job.request, Policy: job.policy, Result: job.result } )
+  if err != nil {
+    return err
+  }
+  tmpPath := pool.path( job.Id )+TmpSuffix
+  if err := ioutil.WriteFile( tmpPath, content, 0600 ) ; err != nil {
+    return err
+  }
+  return os.Rename( tmpPath, pool.path( job.Id ) )
+}
+
+// the failures after the acceptance are only logged : the job goes on
+func ( pool *Pool ) store( job *Job ) {
+  if err := pool.save( job ) ; err != nil && pool.logger != nil {
+    pool.logger.With( logger.FieldJob, job.Id ).Warningf( "job '%v' not saved : %v", job.Id, err )
+  }
+}
+
+func ( pool *Pool ) remove( id string ) {
+  delete( pool.jobs, id )
+  if pool.Dir == "" {
+    return
+  }
+  if err := os.Remove( pool.path( id ) ) ; err != nil && os.IsNotExist( err ) != true && pool.logger != nil {
+    pool.logger.With( logger.FieldJob, id ).Warningf( "job '%v' not removed : %v", id, err )
+  }
+}
+
+// the jobs of the dir are taken back : the queued ones wait again, a running
+// one (stopped with the process) too if attempts remain, else it's failed
+func ( pool *Pool ) Load() ( loaded int, err error ) {
+  if pool.Dir == "" {
+    return 0, nil
+  }
+  if err := os.MkdirAll( pool.Dir, 0700 ) ; err != nil {
+    return 0, errors.New( fmt.Sprintf( "jobs' dir not created : %v", err ) )
+  }
+  entries, err := ioutil.ReadDir( pool.Dir )
+  if err != nil {
+    return 0, err
+  }
+  pool.mutex.Lock()
+  defer pool.mutex.Unlock()
+  queued := []*Job{}
+  for _, entry := range entries {
+    name := entry.Name()
+    if strings.HasSuffix( name, TmpSuffix ) {
+      os.Remove( filepath.Join( pool.Dir, name ) )
+      continue
+    }
+    if strings.HasSuffix( name, FileSuffix ) != true {
+      continue
+    }
+    content, err := ioutil.ReadFile( filepath.Join( pool.Dir, name ) )
+    var loadedRecord record
+    if err == nil {
+      err = json.Unmarshal( content, &loadedRecord )
+    }
+    if err == nil && ( loadedRecord.Job == nil || loadedRecord.Request == nil || loadedRecord.Job.Id+FileSuffix != name ) {
+      err = errors.New( "incomplete job" )
+    }
+    if err != nil {
+      if pool.logger != nil {
+        pool.logger.Warningf( "job's file '%v' ignored : %v", name, err )
+      }
+      continue
+    }
+    job := loadedRecord.Job
+    job.request = loadedRecord.Request
+    job.policy = loadedRecord.Policy
+    job.result = loadedRecord.Result
+    pool.jobs[job.Id] = job
+    loaded++
+    switch {
+    case job.Status == StatusRunning && job.policy.Remains( job.Attempts ) != true:
+      pool.end( job, StatusFailed, "interrupted by a stop" )
+      pool.store( job )
+    case job.Status == StatusRunning:
+      now := time.Now()
+      job.Status = StatusQueued
+      job.Next = &now
+      pool.store( job )
+      queued = append( queued, job )
+    case job.Status == StatusQueued:
+      queued = append( queued, job )
+    case job.Callback != nil && job.Callback.Status == DeliveryPending:
+      pool.deliveries = append( pool.deliveries, job )
+    }
+  }
+  sort.Slice( queued, func( i int, j int ) bool { return queued[i].Created.Before( queued[j].Created ) } )
+  pool.queue = append( queued, pool.queue... )
+  pool.signal()
+  return loaded, nil
+}
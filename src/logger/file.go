@@ -0,0 +1,86 @@
+package logger
+
+import (
+  "os"
+  "strconv"
+)
+
+// -----------------------------------------------
+
+// a file rotated when its size would pass the max : "faass.log" becomes
+// "faass.log.1", the previous "faass.log.1" becomes "faass.log.2"... the
+// oldest beyond the backups is removed
+
+type rotating struct {
+  path string
+  max int64
+  backups int
+  file *os.File
+  size int64
+}
+
+func openRotating( path string, max int64, backups int ) ( *rotating, error ) {
+  r := &rotating { path: path, max: max, backups: backups }
+  if err := r.open() ; err != nil {
+    return nil, err
+  }
+  return r, nil
+}
+
+func ( r *rotating ) open() error {
+  file, err := os.OpenFile( r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640 )
+  if err != nil {
+    return err
+  }
+  info, err := file.Stat()
+  if err != nil {
+    file.Close()
+    return err
+  }
+  r.file = file
+  r.size = info.Size()
+  return nil
+}
+
+func ( r *rotating ) backup( i int ) string {
+  return r.path+"."+strconv.Itoa( i )
+}
+
+func ( r *rotating ) rotate() error {
+  r.file.Close()
+  r.file = nil
+  os.Remove( r.backup( r.backups ) )
+  for i := r.backups-1 ; i >= 1 ; i-- {
+    os.Rename( r.backup( i ), r.backup( i+1 ) )
+  }
+  if err := os.Rename( r.path, r.backup( 1 ) ) ; err != nil && os.IsNotExist( err ) != true {
+    return err
+  }
+  return r.open()
+}
+
+// a record isn't split : a file holds one at least
+func ( r *rotating ) Write( p []byte ) ( int, error ) {
+  if r.file == nil {
+    if err := r.open() ; err != nil {
+      return 0, err
+    }
+  }
+  if r.size > 0 && r.size+int64( len( p ) ) > r.max {
+    if err := r.rotate() ; err != nil {
+      return 0, err
+    }
+  }
+  n, err := r.file.Write( p )
+  r.size += int64( n )
+  return n, err
+}
+
+func ( r *rotating ) Close() error {
+  if r.file == nil {
+    return nil
+  }
+  err := r.file.Close()
+  r.file = nil
+  return err
+}
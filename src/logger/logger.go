@@ -1,64 +1,219 @@
-package logger 
+package logger
 
 import (
-  "log"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
   "os"
+  "path/filepath"
+  "runtime"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
 )
 
+// -----------------------------------------------
+
+// a record is written if its level is the minimum one at least, in text (the
+// former lines, the fields after), json or logfmt ; to stdout, and to a file
+// if any (rotated by size). The children (With) share the output : a change
+// of options applies to all
+
+const (
+  LevelDebug                            = "debug"
+  LevelInfo                             = "info"
+  LevelWarning                          = "warning"
+  LevelError                            = "error"
+  LevelPanic                            = "panic"
+
+  FormatText                            = "text"
+  FormatJSON                            = "json"
+  FormatLogfmt                          = "logfmt"
+
+  FieldRoute                            = "route"
+  FieldContainer                        = "container"
+  FieldJob                              = "job"
+  FieldRequest                          = "request"
+
+  FileSizeDefault                       = 100
+  FileSizeMax                           = 1024
+  FileBackupsDefault                    = 3
+  FileBackupsMax                        = 100
+)
+
+// by severity
+var levels = []string{ LevelDebug, LevelInfo, LevelWarning, LevelError, LevelPanic }
+
+func ValidLevel( level string ) bool {
+  return level == "" || severity( level ) >= 0
+}
+
+func ValidFormat( format string ) bool {
+  switch format {
+  case "", FormatText, FormatJSON, FormatLogfmt:
+    return true
+  }
+  return false
+}
+
+func severity( level string ) int {
+  for i, name := range levels {
+    if strings.EqualFold( level, name ) {
+      return i
+    }
+  }
+  return -1
+}
+
+// empty for the defaults (info, text, no file) ; the file's size in MB, and
+// the number of files rotated kept
+type Options struct {
+  Level string
+  Format string
+  File string
+  FileSize int
+  FileBackups int
+}
+
+type Field struct {
+  Key string
+  Value interface{}
+}
+
+type output struct {
+  mutex sync.Mutex
+  severity int
+  format string
+  stdout io.Writer
+  file *rotating
+  options Options
+}
+
 type Logger struct {
-  debugRealLogger       *log.Logger
-  infoRealLogger        *log.Logger
-  warningRealLogger     *log.Logger
-  errorRealLogger       *log.Logger
-  panicRealLogger       *log.Logger
+  out *output
+  fields []Field
+}
+
+// -----------------------------------------------
+
+func ( logger *Logger ) Init() {
+  logger.out = &output {
+    severity: severity( LevelDebug ),
+    format: FormatText,
+    stdout: os.Stdout,
+  }
+  logger.fields = nil
+}
+
+// the options of all the loggers of the output ; on error, the previous ones
+// are kept
+func ( logger *Logger ) Configure( options Options ) error {
+  if ValidLevel( options.Level ) != true {
+    return errors.New( fmt.Sprintf( "log level unknow : '%v'", options.Level ) )
+  }
+  if ValidFormat( options.Format ) != true {
+    return errors.New( fmt.Sprintf( "log format unknow : '%v'", options.Format ) )
+  }
+  if options.Level == "" {
+    options.Level = LevelInfo
+  }
+  if options.Format == "" {
+    options.Format = FormatText
+  }
+  if options.FileSize <= 0 {
+    options.FileSize = FileSizeDefault
+  }
+  if options.FileBackups <= 0 {
+    options.FileBackups = FileBackupsDefault
+  }
+  out := logger.out
+  out.mutex.Lock()
+  defer out.mutex.Unlock()
+  if options.File != out.options.File || options.FileSize != out.options.FileSize || options.FileBackups != out.options.FileBackups {
+    var file *rotating
+    if options.File != "" {
+      var err error
+      if file, err = openRotating( options.File, int64( options.FileSize ) << 20, options.FileBackups ) ; err != nil {
+        return err
+      }
+    }
+    if out.file != nil {
+      out.file.Close()
+    }
+    out.file = file
+  }
+  out.severity = severity( options.Level )
+  out.format = options.Format
+  out.options = options
+  return nil
+}
+
+func ( logger *Logger ) Enabled( level string ) bool {
+  logger.out.mutex.Lock()
+  defer logger.out.mutex.Unlock()
+  return severity( level ) >= logger.out.severity
+}
+
+// a child logger, the field added to its records
+func ( logger *Logger ) With( key string, value interface{} ) *Logger {
+  fields := make( []Field, 0, len( logger.fields )+1 )
+  for _, field := range logger.fields {
+    if field.Key != key {
+      fields = append( fields, field )
+    }
+  }
+  return &Logger { out: logger.out, fields: append( fields, Field { Key: key, Value: value } ) }
+}
+
+// the logger of the output, without the fields (for the parts outliving a
+// request)
+func ( logger *Logger ) Root() *Logger {
+  return &Logger { out: logger.out }
 }
 
+// -----------------------------------------------
+
 func ( logger *Logger ) Debug ( v ...interface{} ) {
-  logger.debugRealLogger.Println( v... ) 
+  logger.write( LevelDebug, sprintln( v... ) )
 }
 
 func ( logger *Logger ) Debugf ( f string, v ...interface{} ) {
-  logger.debugRealLogger.Printf( f, v... ) 
+  logger.write( LevelDebug, fmt.Sprintf( f, v... ) )
 }
 
 func ( logger *Logger ) Info ( v ...interface{} ) {
-  logger.infoRealLogger.Println( v... ) 
+  logger.write( LevelInfo, sprintln( v... ) )
 }
 
 func ( logger *Logger ) Infof ( f string, v ...interface{} ) {
-  logger.infoRealLogger.Printf( f, v... ) 
+  logger.write( LevelInfo, fmt.Sprintf( f, v... ) )
 }
 
 func ( logger *Logger ) Error ( v ...interface{} ) {
-  logger.errorRealLogger.Println( v... ) 
+  logger.write( LevelError, sprintln( v... ) )
 }
 
 func ( logger *Logger ) Errorf ( f string, v ...interface{} ) {
-  logger.errorRealLogger.Printf( f, v... ) 
+  logger.write( LevelError, fmt.Sprintf( f, v... ) )
 }
 
 func ( logger *Logger ) Warning ( v ...interface{} ) {
-  logger.warningRealLogger.Println( v... ) 
+  logger.write( LevelWarning, sprintln( v... ) )
 }
 
 func ( logger *Logger ) Warningf ( f string, v ...interface{} ) {
-  logger.warningRealLogger.Printf( f, v... ) 
+  logger.write( LevelWarning, fmt.Sprintf( f, v... ) )
 }
 
+// only a record : the caller decides to stop
 func ( logger *Logger ) Panic ( v ...interface{} ) {
-  logger.panicRealLogger.Println( v... ) 
+  logger.write( LevelPanic, sprintln( v... ) )
 }
 
 func ( logger *Logger ) Panicf ( f string, v ...interface{} ) {
-  logger.panicRealLogger.Printf( f, v... ) 
-}
-
-func ( logger *Logger ) Init() {
-  logger.debugRealLogger      = log.New( os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile )
-  logger.infoRealLogger       = log.New( os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile )
-  logger.warningRealLogger    = log.New( os.Stdout, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile )
-  logger.errorRealLogger      = log.New( os.Stdout, "IERROR: ", log.Ldate|log.Ltime|log.Lshortfile )
-  logger.panicRealLogger      = log.New( os.Stdout, "PANIC: ", log.Ldate|log.Ltime|log.Lshortfile )
+  logger.write( LevelPanic, fmt.Sprintf( f, v... ) )
 }
 
 func ( logger *Logger ) Test ( m string ) bool {
@@ -66,6 +221,77 @@ func ( logger *Logger ) Test ( m string ) bool {
   logger.Info( m )
   logger.Warning( m )
   logger.Error( m )
-  logger.Panic( m ) 
+  logger.Panic( m )
   return true
-}
\ No newline at end of file
+}
+
+// as Println, without the last line feed
+func sprintln( v ...interface{} ) string {
+  return strings.TrimSuffix( fmt.Sprintln( v... ), "\n" )
+}
+
+// -----------------------------------------------
+
+// the caller is the one of the method (Info, Warningf...)
+func ( logger *Logger ) write( level string, message string ) {
+  out := logger.out
+  out.mutex.Lock()
+  defer out.mutex.Unlock()
+  if severity( level ) < out.severity {
+    return
+  }
+  caller := "???:0"
+  if _, file, line, ok := runtime.Caller( 2 ) ; ok {
+    caller = filepath.Base( file )+":"+strconv.Itoa( line )
+  }
+  line := format( out.format, time.Now(), level, caller, message, logger.fields )
+  out.stdout.Write( line )
+  if out.file != nil {
+    if _, err := out.file.Write( line ) ; err != nil {
+      fmt.Fprintf( os.Stderr, "log file '%v' not written : %v\n", out.file.path, err )
+    }
+  }
+}
+
+func format( kind string, now time.Time, level string, caller string, message string, fields []Field ) []byte {
+  var builder strings.Builder
+  switch kind {
+  case FormatJSON:
+    record := map[string]interface{} {
+      "time": now.Format( time.RFC3339Nano ),
+      "level": level,
+      "caller": caller,
+      "msg": message,
+    }
+    for _, field := range fields {
+      if _, ok := record[field.Key] ; ok != true {
+        record[field.Key] = field.Value
+      }
+    }
+    content, err := json.Marshal( record )
+    if err != nil {
+      content, _ = json.Marshal( map[string]string { "time": now.Format( time.RFC3339Nano ), "level": level, "caller": caller, "msg": message } )
+    }
+    builder.Write( content )
+  case FormatLogfmt:
+    builder.WriteString( "time="+now.Format( time.RFC3339Nano )+" level="+level+" caller="+caller+" msg="+logfmtValue( message ) )
+    for _, field := range fields {
+      builder.WriteString( " "+field.Key+"="+logfmtValue( fmt.Sprint( field.Value ) ) )
+    }
+  default:
+    // the former lines : "INFO: 2022/08/01 12:00:00 file.go:12: message"
+    builder.WriteString( strings.ToUpper( level )+": "+now.Format( "2006/01/02 15:04:05" )+" "+caller+": "+message )
+    for _, field := range fields {
+      builder.WriteString( " "+field.Key+"="+logfmtValue( fmt.Sprint( field.Value ) ) )
+    }
+  }
+  builder.WriteString( "\n" )
+  return []byte( builder.String() )
+}
+
+func logfmtValue( value string ) string {
+  if value != "" && strings.ContainsAny( value, " \"=\t\n\r" ) != true {
+    return value
+  }
+  return strconv.Quote( value )
+}
@@ -1,6 +1,12 @@
 package logger 
 
 import (
+  "bytes"
+  "encoding/json"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
   "testing"
 )
 
@@ -13,4 +19,75 @@ func TestTest( t *testing.T ) {
   l := Logger{}
   l.Init()
   l.Test( "ok" ) 
-} 
\ No newline at end of file
+}
+
+func TestLevel( t *testing.T ) {
+  var buffer bytes.Buffer
+  l := Logger{}
+  l.Init()
+  l.out.stdout = &buffer
+  if err := l.Configure( Options { Level: LevelWarning } ) ; err != nil {
+    t.Fatal( err )
+  }
+  l.Info( "hidden" )
+  l.Errorf( "shown %v", 1 )
+  if strings.Contains( buffer.String(), "hidden" ) || strings.HasPrefix( buffer.String(), "ERROR: " ) != true {
+    t.Errorf( "only the error expected : %q", buffer.String() )
+  }
+  if err := l.Configure( Options { Level: "verbose" } ) ; err == nil || l.Enabled( LevelInfo ) {
+    t.Error( "an unknow level must be refused, the previous one kept" )
+  }
+}
+
+func TestFormats( t *testing.T ) {
+  var buffer bytes.Buffer
+  l := Logger{}
+  l.Init()
+  l.out.stdout = &buffer
+  l.Configure( Options { Format: FormatJSON } )
+  child := l.With( FieldRoute, "hello" ).With( FieldContainer, "abc" )
+  child.Warningf( "slow %v", "start" )
+  var record map[string]interface{}
+  if err := json.Unmarshal( buffer.Bytes(), &record ) ; err != nil {
+    t.Fatalf( "json expected : %v (%q)", err, buffer.String() )
+  }
+  if record["level"] != LevelWarning || record["msg"] != "slow start" || record[FieldRoute] != "hello" || record[FieldContainer] != "abc" {
+    t.Errorf( "unexpected record : %v", record )
+  }
+  if caller, _ := record["caller"].( string ) ; strings.HasPrefix( caller, "logger_test.go:" ) != true {
+    t.Errorf( "the caller must be the test : %v", record["caller"] )
+  }
+  buffer.Reset()
+  l.Configure( Options { Format: FormatLogfmt } )
+  child.Info( "a message" )
+  if line := buffer.String() ; strings.Contains( line, ` msg="a message" route=hello container=abc` ) != true {
+    t.Errorf( "unexpected logfmt : %q", line )
+  }
+  buffer.Reset()
+  l.Info( "parent" )
+  if strings.Contains( buffer.String(), FieldRoute ) {
+    t.Error( "the parent mustn't have the child's fields" )
+  }
+}
+
+func TestRotation( t *testing.T ) {
+  path := filepath.Join( t.TempDir(), "faass.log" )
+  file, err := openRotating( path, 10, 2 )
+  if err != nil {
+    t.Fatal( err )
+  }
+  defer file.Close()
+  for _, record := range []string{ "first\n", "second\n", "third\n", "fourth\n" } {
+    if _, err := file.Write( []byte( record ) ) ; err != nil {
+      t.Fatal( err )
+    }
+  }
+  for name, expected := range map[string]string { path: "fourth\n", path+".1": "third\n", path+".2": "second\n" } {
+    if content, _ := ioutil.ReadFile( name ) ; string( content ) != expected {
+      t.Errorf( "'%v' : %q expected, %q found", name, expected, content )
+    }
+  }
+  if _, err := os.Stat( path+".3" ) ; os.IsNotExist( err ) != true {
+    t.Error( "only 2 backups must be kept" )
+  }
+}
@@ -0,0 +1,146 @@
+package network
+
+import (
+  "net"
+  "net/http"
+  "strings"
+  "errors"
+  // -----------
+)
+
+// -----------------------------------------------
+
+const (
+  HeaderForwardedFor                    = "X-Forwarded-For"
+  HeaderRealIp                          = "X-Real-Ip"
+  EnvClientIp                           = "FAASS_CLIENT_IP"
+)
+
+// -----------------------------------------------
+
+// deny is always checked before allow ; an empty allow list permits everything not denied
+type ACL struct {
+  Allow []string `json:"allow"`
+  Deny []string `json:"deny"`
+  allowNets []*net.IPNet
+  denyNets []*net.IPNet
+}
+
+func ParseCIDRs( values []string ) ( nets []*net.IPNet, err error ) {
+  for _, value := range values {
+    if strings.Contains( value, "/" ) != true {
+      ip := net.ParseIP( value )
+      if ip == nil {
+        return nil, errors.New( "invalid ip or cidr : '"+value+"'" )
+      }
+      if ip.To4() != nil {
+        value += "/32"
+      } else {
+        value += "/128"
+      }
+    }
+    _, ipNet, err := net.ParseCIDR( value )
+    if err != nil {
+      return nil, errors.New( "invalid ip or cidr : '"+value+"'" )
+    }
+    nets = append( nets, ipNet )
+  }
+  return nets, nil
+}
+
+func Contains( nets []*net.IPNet, ip net.IP ) bool {
+  for _, ipNet := range nets {
+    if ipNet.Contains( ip ) {
+      return true
+    }
+  }
+  return false
+}
+
+func ( acl *ACL ) Check() ( err error ) {
+  if acl.allowNets, err = ParseCIDRs( acl.Allow ) ; err != nil {
+    return err
+  }
+  if acl.denyNets, err = ParseCIDRs( acl.Deny ) ; err != nil {
+    return err
+  }
+  return nil
+}
+
+func ( acl *ACL ) Permit( ip net.IP ) bool {
+  if acl == nil {
+    return true
+  }
+  if ip == nil {
+    return len( acl.allowNets ) == 0 && len( acl.denyNets ) == 0
+  }
+  if Contains( acl.denyNets, ip ) {
+    return false
+  }
+  if len( acl.allowNets ) > 0 {
+    return Contains( acl.allowNets, ip )
+  }
+  return true
+}
+
+func ( acl *ACL ) Copy() *ACL {
+  if acl == nil {
+    return nil
+  }
+  return &ACL {
+    Allow: append( []string{}, acl.Allow... ),
+    Deny: append( []string{}, acl.Deny... ),
+  }
+}
+
+// -----------------------------------------------
+
+type Access struct {
+  ACL
+  TrustedProxies []string `json:"trustedproxies"`
+  trustedNets []*net.IPNet
+}
+
+func ( access *Access ) Check() ( err error ) {
+  if err = access.ACL.Check() ; err != nil {
+    return err
+  }
+  if access.trustedNets, err = ParseCIDRs( access.TrustedProxies ) ; err != nil {
+    return err
+  }
+  return nil
+}
+
+// the real client is the first untrusted adress, from right to left, of the 
+// chain "X-Forwarded-For + remote adress" ; forwarded headers of untrusted 
+// peers are ignored 
+func ( access *Access ) ClientIP( r *http.Request ) net.IP {
+  host, _, err := net.SplitHostPort( r.RemoteAddr )
+  if err != nil {
+    host = r.RemoteAddr
+  }
+  remote := net.ParseIP( host )
+  if remote == nil || Contains( access.trustedNets, remote ) != true {
+    return remote
+  }
+  chain := []string{}
+  for _, value := range r.Header.Values( HeaderForwardedFor ) {
+    for _, part := range strings.Split( value, "," ) {
+      if part = strings.TrimSpace( part ) ; part != "" {
+        chain = append( chain, part )
+      }
+    }
+  }
+  client := remote
+  for i := len( chain )-1 ; i >= 0 ; i-- {
+    ip := net.ParseIP( chain[i] )
+    if ip == nil {
+      break
+    }
+    client = ip
+    if Contains( access.trustedNets, ip ) != true {
+      break
+    }
+  }
+  return client
+}
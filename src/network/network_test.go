@@ -0,0 +1,58 @@
+package network
+
+import (
+  "net"
+  "net/http"
+  "testing"
+)
+
+func TestClientIP( t *testing.T ) {
+  access := Access { TrustedProxies: []string{ "10.0.0.0/8" } }
+  if err := access.Check() ; err != nil {
+    t.Fatal( err )
+  }
+  r := &http.Request { RemoteAddr: "10.0.0.2:4242", Header: http.Header{} }
+  r.Header.Set( HeaderForwardedFor, "203.0.113.9, 198.51.100.7, 10.0.0.1" )
+  if ip := access.ClientIP( r ) ; ip.String() != "198.51.100.7" {
+    t.Errorf( "client ip behind trusted proxies : %v", ip )
+  }
+  r.RemoteAddr = "192.0.2.1:4242"
+  if ip := access.ClientIP( r ) ; ip.String() != "192.0.2.1" {
+    t.Errorf( "forwarded header of untrusted peer must be ignored : %v", ip )
+  }
+}
+
+func TestACLPermit( t *testing.T ) {
+  acl := ACL { Allow: []string{ "192.168.0.0/16" }, Deny: []string{ "192.168.1.10" } }
+  if err := acl.Check() ; err != nil {
+    t.Fatal( err )
+  }
+  if !acl.Permit( net.ParseIP( "192.168.2.3" ) ) {
+    t.Error( "allowed ip refused" )
+  }
+  if acl.Permit( net.ParseIP( "192.168.1.10" ) ) || acl.Permit( net.ParseIP( "8.8.8.8" ) ) {
+    t.Error( "denied or not allowed ip accepted" )
+  }
+  if err := ( &ACL { Deny: []string{ "not-an-ip" } } ).Check() ; err == nil {
+    t.Error( "invalid cidr accepted" )
+  }
+}
+
+func TestRequestId( t *testing.T ) {
+  r, _ := http.NewRequest( http.MethodGet, "/lambda/hello", nil )
+  r.Header.Set( HeaderRequestId, "given-id.42" )
+  if id := RequestId( WithRequestId( r ).Context() ) ; id != "given-id.42" {
+    t.Errorf( "the client's id must be kept : '%v'", id )
+  }
+  r, _ = http.NewRequest( http.MethodGet, "/lambda/hello", nil )
+  r.Header.Set( HeaderRequestId, "bad id\nwith=line" )
+  r = WithRequestId( r )
+  id := RequestId( r.Context() )
+  if id == "" || id == "bad id\nwith=line" || r.Header.Get( HeaderRequestId ) != id {
+    t.Errorf( "an invalid id must be replaced, in the header too : '%v'", id )
+  }
+  r.Header.Set( HeaderRequestId, "other" )
+  if RequestId( WithRequestId( r ).Context() ) != id {
+    t.Error( "the id of the context must be kept" )
+  }
+}
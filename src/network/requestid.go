@@ -0,0 +1,54 @@
+package network
+
+import (
+  "context"
+  "crypto/rand"
+  "encoding/hex"
+  "net/http"
+  "regexp"
+  // -----------
+)
+
+// -----------------------------------------------
+
+// the id of a request : the client's one if valid (a proxy before), else a new
+// one ; given back in the response, to the routes (header and env) and in the
+// records of the logs
+
+const (
+  HeaderRequestId                       = "X-Request-Id"
+  EnvRequestId                          = "FAASS_REQUEST_ID"
+)
+
+var requestIdRegex = regexp.MustCompile( `^[a-zA-Z0-9._:+=/-]{1,128}$` )
+
+type requestIdKey struct{}
+
+func NewRequestId() string {
+  random := make( []byte, 16 )
+  rand.Read( random )
+  return hex.EncodeToString( random )
+}
+
+func ValidRequestId( id string ) bool {
+  return requestIdRegex.MatchString( id )
+}
+
+// the request with its id (header and context) ; an id already given is kept
+func WithRequestId( r *http.Request ) *http.Request {
+  if RequestId( r.Context() ) != "" {
+    return r
+  }
+  id := r.Header.Get( HeaderRequestId )
+  if ValidRequestId( id ) != true {
+    id = NewRequestId()
+  }
+  r = r.WithContext( context.WithValue( r.Context(), requestIdKey{}, id ) )
+  r.Header.Set( HeaderRequestId, id )
+  return r
+}
+
+func RequestId( ctx context.Context ) string {
+  id, _ := ctx.Value( requestIdKey{} ).( string )
+  return id
+}
@@ -0,0 +1,291 @@
+package pipeline
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "net/http"
+  "strconv"
+  "sync"
+  "time"
+  // -----------
+)
+
+// -----------------------------------------------
+
+// the steps of a pipeline's route : each one serves a route with the output
+// of the previous one (the request's body for the first) ; a step of branches
+// serves them together with the same input, their outputs joined in an array
+// (given to the join's route, if any). The last output is the response
+
+const (
+  HeaderPipeline                        = "X-Faass-Pipeline"
+  HeaderStep                            = "X-Faass-Step"
+  EnvPipeline                           = "FAASS_PIPELINE"
+  EnvStep                               = "FAASS_STEP"
+
+  OnErrorAbort                          = "abort"
+  OnErrorContinue                       = "continue"
+  OnErrorFallback                       = "fallback"
+
+  StepsMax                              = 32
+  BranchesMax                           = 16
+  TimeoutMax                            = 3600 * 1000
+  ContentTypeJoin                       = "application/json"
+)
+
+// the timeout (milliseconds) is the route's one without ; on error, the
+// pipeline is stopped (abort), the step ignored (continue : its input goes to
+// the next one) or served by the fallback's route
+type Step struct {
+  Route string `json:"route"`
+  Parallel []string `json:"parallel"`
+  Join string `json:"join"`
+  Timeout int `json:"timeout"`
+  OnError string `json:"onerror"`
+  Fallback string `json:"fallback"`
+}
+
+// the routes served by the step
+func ( step Step ) Routes() []string {
+  routes := []string{}
+  if step.Route != "" {
+    routes = append( routes, step.Route )
+  }
+  routes = append( routes, step.Parallel... )
+  for _, route := range []string{ step.Join, step.Fallback } {
+    if route != "" {
+      routes = append( routes, route )
+    }
+  }
+  return routes
+}
+
+// the problems of a step, by field ; the routes are checked by the conf
+func ( step Step ) Problems() map[string]string {
+  problems := make( map[string]string )
+  switch {
+  case step.Route == "" && len( step.Parallel ) == 0:
+    problems["route"] = "route or parallel undefined"
+  case step.Route != "" && len( step.Parallel ) > 0:
+    problems["parallel"] = "route and parallel are exclusive"
+  case len( step.Parallel ) > BranchesMax:
+    problems["parallel"] = "too many branches ("+strconv.Itoa( BranchesMax )+" at most)"
+  }
+  if step.Join != "" && len( step.Parallel ) == 0 {
+    problems["join"] = "join only with parallel"
+  }
+  if step.Timeout < 0 || step.Timeout > TimeoutMax {
+    problems["timeout"] = "timeout out of range (0 to "+strconv.Itoa( TimeoutMax )+" milliseconds)"
+  }
+  switch step.OnError {
+  case "", OnErrorAbort, OnErrorContinue:
+    if step.Fallback != "" {
+      problems["fallback"] = "fallback only with onerror '"+OnErrorFallback+"'"
+    }
+  case OnErrorFallback:
+    if step.Fallback == "" {
+      problems["fallback"] = "fallback undefined"
+    }
+  default:
+    problems["onerror"] = "onerror invalid ("+OnErrorAbort+", "+OnErrorContinue+" or "+OnErrorFallback+")"
+  }
+  return problems
+}
+
+// -----------------------------------------------
+
+// the response of a route served, or the request of the next one ; exit is
+// the process' one, if known
+type Output struct {
+  Code int
+  Header http.Header
+  Body []byte
+  Exit *int
+  Error string
+}
+
+func ( output Output ) Failed() bool {
+  return output.Code >= 400 || ( output.Exit != nil && *output.Exit != 0 )
+}
+
+func ( output Output ) contentType() string {
+  if output.Header == nil {
+    return ""
+  }
+  return output.Header.Get( "Content-Type" )
+}
+
+// serves a route of a step with the input ; the timeout is the step's one
+// (0 : the route's one), the context the pipeline's one
+type Runner func( ctx context.Context, step int, route string, timeout time.Duration, input Output ) Output
+
+// a route served, for the logs and the failure's report
+type Trace struct {
+  Step int `json:"step"`
+  Route string `json:"route"`
+  Code int `json:"code"`
+  Exit *int `json:"exit,omitempty"`
+  Duration int64 `json:"duration"`
+  Error string `json:"error,omitempty"`
+  Ignored bool `json:"ignored,omitempty"`
+}
+
+type StepError struct {
+  Step int
+  Route string
+  Output Output
+}
+
+func ( err *StepError ) Error() string {
+  message := fmt.Sprintf( "step %v failed (route '%v', code %v", err.Step, err.Route, err.Output.Code )
+  if err.Output.Exit != nil {
+    message += fmt.Sprintf( ", exit %v", *err.Output.Exit )
+  }
+  if err.Output.Error != "" {
+    message += ", "+err.Output.Error
+  }
+  return message+")"
+}
+
+type run struct {
+  ctx context.Context
+  runner Runner
+  mutex sync.Mutex
+  traces []Trace
+}
+
+// the steps in order ; the error is a *StepError if a step failed
+func Run( ctx context.Context, steps []Step, input Output, runner Runner ) ( Output, []Trace, error ) {
+  current := &run { ctx: ctx, runner: runner }
+  output := input
+  for i, step := range steps {
+    if err := ctx.Err() ; err != nil {
+      return output, current.traces, errors.New( fmt.Sprintf( "pipeline stopped before step %v : %v", i, err ) )
+    }
+    result, failed := current.step( i, step, output )
+    if failed != nil {
+      return result, current.traces, failed
+    }
+    output = result
+  }
+  return output, current.traces, nil
+}
+
+func ( current *run ) serve( i int, step Step, route string, input Output ) Output {
+  start := time.Now()
+  output := current.runner( current.ctx, i, route, time.Duration( step.Timeout ) * time.Millisecond, input )
+  current.mutex.Lock()
+  defer current.mutex.Unlock()
+  current.traces = append( current.traces, Trace {
+    Step: i,
+    Route: route,
+    Code: output.Code,
+    Exit: output.Exit,
+    Duration: time.Since( start ).Milliseconds(),
+    Error: output.Error,
+  } )
+  return output
+}
+
+// the last trace of the route is the one of the failure ignored
+func ( current *run ) ignored( i int, route string ) {
+  current.mutex.Lock()
+  defer current.mutex.Unlock()
+  for j := len( current.traces )-1 ; j >= 0 ; j-- {
+    if current.traces[j].Step == i && current.traces[j].Route == route {
+      current.traces[j].Ignored = true
+      return
+    }
+  }
+}
+
+// a route served with the step's policy ; ok is false on a failure ignored
+func ( current *run ) attempt( i int, step Step, route string, input Output ) ( output Output, ok bool, err error ) {
+  output = current.serve( i, step, route, input )
+  if output.Failed() != true {
+    return output, true, nil
+  }
+  switch step.OnError {
+  case OnErrorContinue:
+    current.ignored( i, route )
+    return output, false, nil
+  case OnErrorFallback:
+    current.ignored( i, route )
+    if output = current.serve( i, step, step.Fallback, input ) ; output.Failed() != true {
+      return output, true, nil
+    }
+    route = step.Fallback
+  }
+  return output, false, &StepError { Step: i, Route: route, Output: output }
+}
+
+func ( current *run ) step( i int, step Step, input Output ) ( Output, error ) {
+  if len( step.Parallel ) == 0 {
+    output, ok, err := current.attempt( i, step, step.Route, input )
+    if ok != true && err == nil {
+      return input, nil
+    }
+    return output, err
+  }
+  outputs := make( []Output, len( step.Parallel ) )
+  oks := make( []bool, len( step.Parallel ) )
+  errs := make( []error, len( step.Parallel ) )
+  var group sync.WaitGroup
+  for b, route := range step.Parallel {
+    group.Add( 1 )
+    go func( b int, route string ) {
+      defer group.Done()
+      outputs[b], oks[b], errs[b] = current.attempt( i, step, route, input )
+    }( b, route )
+  }
+  group.Wait()
+  for b := range step.Parallel {
+    if errs[b] != nil {
+      return outputs[b], errs[b]
+    }
+  }
+  joined := Output {
+    Code: http.StatusOK,
+    Header: http.Header { "Content-Type": []string{ ContentTypeJoin } },
+    Body: join( outputs, oks ),
+  }
+  if step.Join == "" {
+    return joined, nil
+  }
+  output, ok, err := current.attempt( i, step, step.Join, joined )
+  if ok != true && err == nil {
+    return input, nil
+  }
+  return output, err
+}
+
+// the outputs of the branches, in order : as is if json, else as a string ;
+// null for a failure ignored
+func join( outputs []Output, oks []bool ) []byte {
+  values := make( []json.RawMessage, len( outputs ) )
+  for b, output := range outputs {
+    switch {
+    case oks[b] != true:
+      values[b] = json.RawMessage( "null" )
+    case json.Valid( output.Body ):
+      values[b] = json.RawMessage( output.Body )
+    default:
+      values[b], _ = json.Marshal( string( output.Body ) )
+    }
+  }
+  content, _ := json.Marshal( values )
+  return content
+}
+
+// the request of a step : the input's type and the step given
+func Header( key string, step int, input Output ) http.Header {
+  header := http.Header{}
+  if contentType := input.contentType() ; contentType != "" {
+    header.Set( "Content-Type", contentType )
+  }
+  header.Set( HeaderPipeline, key )
+  header.Set( HeaderStep, strconv.Itoa( step ) )
+  return header
+}
@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+  "context"
+  "net/http"
+  "strings"
+  "testing"
+  "time"
+)
+
+// "upper" and "suffix" transform the input, "fail" exits with 1, "slow" waits
+// for its timeout
+func runner( ctx context.Context, step int, route string, timeout time.Duration, input Output ) Output {
+  output := Output { Code: http.StatusOK, Header: http.Header { "Content-Type": []string{ "text/plain" } } }
+  switch route {
+  case "upper":
+    output.Body = []byte( strings.ToUpper( string( input.Body ) ) )
+  case "suffix":
+    output.Body = append( append( []byte{}, input.Body... ), '!' )
+  case "count":
+    output.Body = []byte( `{"size":`+string( rune( '0'+len( input.Body )%10 ) )+`}` )
+  case "fail":
+    exit := 1
+    output.Exit = &exit
+  case "slow":
+    stepCtx, cancel := context.WithTimeout( ctx, timeout )
+    defer cancel()
+    <-stepCtx.Done()
+    output.Code = http.StatusGatewayTimeout
+  }
+  return output
+}
+
+func input( body string ) Output {
+  return Output { Code: http.StatusOK, Body: []byte( body ) }
+}
+
+func TestSequence( t *testing.T ) {
+  steps := []Step { { Route: "upper" }, { Route: "fail", OnError: OnErrorContinue }, { Route: "suffix" } }
+  output, traces, err := Run( context.Background(), steps, input( "abc" ), runner )
+  if err != nil || string( output.Body ) != "ABC!" {
+    t.Errorf( "'ABC!' expected : '%s' (%v)", output.Body, err )
+  }
+  if len( traces ) != 3 || traces[1].Ignored != true {
+    t.Errorf( "the failure must be traced as ignored : %+v", traces )
+  }
+  steps[1].OnError = ""
+  if _, _, err := Run( context.Background(), steps, input( "abc" ), runner ) ; err == nil || err.( *StepError ).Step != 1 {
+    t.Errorf( "abort at step 1 expected : %v", err )
+  }
+  steps[1] = Step { Route: "fail", OnError: OnErrorFallback, Fallback: "upper" }
+  if output, _, err := Run( context.Background(), steps[1:], input( "abc" ), runner ) ; err != nil || string( output.Body ) != "ABC!" {
+    t.Errorf( "the fallback's output expected : '%s' (%v)", output.Body, err )
+  }
+}
+
+func TestParallel( t *testing.T ) {
+  steps := []Step { { Parallel: []string{ "upper", "count", "fail" }, OnError: OnErrorContinue } }
+  output, _, err := Run( context.Background(), steps, input( "abc" ), runner )
+  if err != nil || string( output.Body ) != `["ABC",{"size":3},null]` || output.Header.Get( "Content-Type" ) != ContentTypeJoin {
+    t.Errorf( "unexpected join : '%s' (%v)", output.Body, err )
+  }
+  steps[0].Join = "suffix"
+  if output, _, _ := Run( context.Background(), steps, input( "abc" ), runner ) ; string( output.Body ) != `["ABC",{"size":3},null]!` {
+    t.Errorf( "the join's route must receive the array : '%s'", output.Body )
+  }
+  steps = []Step { { Parallel: []string{ "upper", "slow" }, Timeout: 10 } }
+  start := time.Now()
+  _, _, err = Run( context.Background(), steps, input( "abc" ), runner )
+  if stepError, ok := err.( *StepError ) ; ok != true || stepError.Route != "slow" || time.Since( start ) > time.Second {
+    t.Errorf( "the branch's timeout expected : %v", err )
+  }
+}
+
+func TestProblems( t *testing.T ) {
+  for field, step := range map[string]Step {
+    "route": {},
+    "parallel": { Route: "a", Parallel: []string{ "b" } },
+    "join": { Route: "a", Join: "b" },
+    "timeout": { Route: "a", Timeout: -1 },
+    "onerror": { Route: "a", OnError: "retry" },
+    "fallback": { Route: "a", OnError: OnErrorFallback },
+  } {
+    if _, ok := step.Problems()[field] ; ok != true {
+      t.Errorf( "problem of '%v' expected : %v", field, step.Problems() )
+    }
+  }
+}
@@ -0,0 +1,184 @@
+package schedule
+
+import (
+  "errors"
+  "fmt"
+  "strconv"
+  "strings"
+  "time"
+  // -----------
+)
+
+// -----------------------------------------------
+
+// the expressions of cron : minute, hour, day of month, month and day of week
+// (0 or 7 for sunday), with lists, ranges, steps and names (jan, mon) ; or a
+// shortcut (@hourly, @daily, @weekly, @monthly, @yearly). As cron, when both
+// days are restricted, one of them is enough
+
+type field struct {
+  name string
+  min int
+  max int
+  names []string
+}
+
+var fields = []field {
+  { name: "minute", min: 0, max: 59 },
+  { name: "hour", min: 0, max: 23 },
+  { name: "day of month", min: 1, max: 31 },
+  { name: "month", min: 1, max: 12, names: []string{ "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec" } },
+  { name: "day of week", min: 0, max: 7, names: []string{ "sun", "mon", "tue", "wed", "thu", "fri", "sat" } },
+}
+
+var shortcuts = map[string]string {
+  "@yearly": "0 0 1 1 *",
+  "@annually": "0 0 1 1 *",
+  "@monthly": "0 0 1 * *",
+  "@weekly": "0 0 * * 0",
+  "@daily": "0 0 * * *",
+  "@midnight": "0 0 * * *",
+  "@hourly": "0 * * * *",
+}
+
+// a search beyond isn't a schedule (ie. 30 february)
+const searchYears = 5
+
+type Expression struct {
+  minutes uint64
+  hours uint64
+  days uint64
+  months uint64
+  weekdays uint64
+  daysAny bool
+  weekdaysAny bool
+}
+
+func ( f field ) value( raw string ) ( int, error ) {
+  for i, name := range f.names {
+    if strings.EqualFold( raw, name ) {
+      return i+f.min, nil
+    }
+  }
+  value, err := strconv.Atoi( raw )
+  if err != nil || value < f.min || value > f.max {
+    return 0, errors.New( fmt.Sprintf( "%v invalid : '%v' (%v to %v)", f.name, raw, f.min, f.max ) )
+  }
+  return value, nil
+}
+
+func ( f field ) parse( raw string ) ( bits uint64, err error ) {
+  for _, part := range strings.Split( raw, "," ) {
+    span, stepRaw, stepped := strings.Cut( part, "/" )
+    step := 1
+    if stepped {
+      if step, err = strconv.Atoi( stepRaw ) ; err != nil || step < 1 {
+        return 0, errors.New( fmt.Sprintf( "step of %v invalid : '%v'", f.name, stepRaw ) )
+      }
+    }
+    low, high := f.min, f.max
+    switch {
+    case span == "*":
+    case strings.Contains( span, "-" ):
+      lowRaw, highRaw, _ := strings.Cut( span, "-" )
+      if low, err = f.value( lowRaw ) ; err != nil {
+        return 0, err
+      }
+      if high, err = f.value( highRaw ) ; err != nil {
+        return 0, err
+      }
+      if high < low {
+        return 0, errors.New( fmt.Sprintf( "range of %v invalid : '%v'", f.name, span ) )
+      }
+    default:
+      if low, err = f.value( span ) ; err != nil {
+        return 0, err
+      }
+      if stepped != true {
+        high = low
+      }
+    }
+    for value := low ; value <= high ; value += step {
+      bits |= 1 << uint( value )
+    }
+  }
+  return bits, nil
+}
+
+func Parse( spec string ) ( *Expression, error ) {
+  spec = strings.TrimSpace( spec )
+  if strings.HasPrefix( spec, "@" ) {
+    expanded, ok := shortcuts[strings.ToLower( spec )]
+    if ok != true {
+      return nil, errors.New( fmt.Sprintf( "shortcut unknow : '%v'", spec ) )
+    }
+    spec = expanded
+  }
+  parts := strings.Fields( spec )
+  if len( parts ) != len( fields ) {
+    return nil, errors.New( fmt.Sprintf( "%v fields expected (minute hour day month weekday) : '%v'", len( fields ), spec ) )
+  }
+  values := make( []uint64, len( fields ) )
+  for i, f := range fields {
+    bits, err := f.parse( parts[i] )
+    if err != nil {
+      return nil, err
+    }
+    values[i] = bits
+  }
+  expression := &Expression {
+    minutes: values[0],
+    hours: values[1],
+    days: values[2],
+    months: values[3],
+    // sunday is 0 or 7
+    weekdays: ( values[4] | values[4] >> 7 ) & 0x7f,
+    daysAny: strings.HasPrefix( parts[2], "*" ),
+    weekdaysAny: strings.HasPrefix( parts[4], "*" ),
+  }
+  return expression, nil
+}
+
+func has( bits uint64, value int ) bool {
+  return bits & ( 1 << uint( value ) ) != 0
+}
+
+func ( expression *Expression ) matchDay( t time.Time ) bool {
+  day, weekday := has( expression.days, t.Day() ), has( expression.weekdays, int( t.Weekday() ) )
+  switch {
+  case expression.daysAny && expression.weekdaysAny:
+    return true
+  case expression.daysAny:
+    return weekday
+  case expression.weekdaysAny:
+    return day
+  }
+  return day || weekday
+}
+
+// the first time strictly after the one given, in its location ; zero if none
+func ( expression *Expression ) Next( after time.Time ) time.Time {
+  t := after.Truncate( time.Minute ).Add( time.Minute )
+  limit := t.AddDate( searchYears, 0, 0 )
+  location := t.Location()
+  for t.Before( limit ) {
+    switch {
+    case has( expression.months, int( t.Month() ) ) != true:
+      t = time.Date( t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location )
+    case expression.matchDay( t ) != true:
+      t = time.Date( t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location )
+    case has( expression.hours, t.Hour() ) != true:
+      // the hour after (not the same hour again, at a change of offset)
+      next := time.Date( t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, location ).Add( time.Hour )
+      if next.After( t ) != true {
+        next = t.Add( time.Hour )
+      }
+      t = next
+    case has( expression.minutes, t.Minute() ) != true:
+      t = t.Truncate( time.Minute ).Add( time.Minute )
+    default:
+      return t
+    }
+  }
+  return time.Time{}
+}
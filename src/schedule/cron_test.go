@@ -0,0 +1,37 @@
+package schedule
+
+import (
+  "testing"
+  "time"
+)
+
+func TestParseErrors( t *testing.T ) {
+  for _, spec := range []string { "", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *", "@often" } {
+    if _, err := Parse( spec ) ; err == nil {
+      t.Errorf( "'%v' : error expected", spec )
+    }
+  }
+}
+
+func TestNext( t *testing.T ) {
+  paris, _ := time.LoadLocation( "Europe/Paris" )
+  from := time.Date( 2026, 3, 28, 10, 17, 30, 0, paris ) // a saturday, before the summer time
+  for spec, expected := range map[string]time.Time {
+    "*/15 * * * *": time.Date( 2026, 3, 28, 10, 30, 0, 0, paris ),
+    "0 9-17 * * mon-fri": time.Date( 2026, 3, 30, 9, 0, 0, 0, paris ),
+    "30 2 * * *": time.Date( 2026, 3, 30, 2, 30, 0, 0, paris ), // 2:30 doesn't exist the 29
+    "0 0 1 jan *": time.Date( 2027, 1, 1, 0, 0, 0, 0, paris ),
+    "0 12 13 * 5": time.Date( 2026, 4, 3, 12, 0, 0, 0, paris ), // the 13th or a friday
+    "0 0 * * 7": time.Date( 2026, 3, 29, 0, 0, 0, 0, paris ),
+    "@hourly": time.Date( 2026, 3, 28, 11, 0, 0, 0, paris ),
+    "0 0 30 2 *": {},
+  } {
+    expression, err := Parse( spec )
+    if err != nil {
+      t.Fatalf( "'%v' : %v", spec, err )
+    }
+    if next := expression.Next( from ) ; next.Equal( expected ) != true {
+      t.Errorf( "'%v' : %v instead of %v", spec, next, expected )
+    }
+  }
+}
@@ -0,0 +1,308 @@
+package schedule
+
+import (
+  "context"
+  "math/rand"
+  "net/http"
+  "sort"
+  "strconv"
+  "sync"
+  "time"
+  _ "time/tzdata"
+  // -----------
+  "jobs"
+  "logger"
+)
+
+// -----------------------------------------------
+
+// the routes' timers : a run is a job of the pool (the route's retries and
+// callback), served as an async request ; a run isn't started while the
+// previous one isn't ended
+
+const (
+  HeaderSchedule                        = "X-Faass-Schedule"
+  EnvSchedule                           = "FAASS_SCHEDULE"
+  OriginPrefix                          = "schedule:"
+
+  JitterMax                             = 3600
+  PayloadSizeMax                        = 1 << 20
+  ContentTypeDefault                    = "application/json"
+
+  RunSubmitted                          = "submitted"
+  RunSkipped                            = "skipped"
+  RunRefused                            = "refused"
+)
+
+// the timezone is a name of the IANA database (UTC by default) ; the jitter
+// (seconds) delays each run randomly
+type Definition struct {
+  Cron string `json:"cron"`
+  Timezone string `json:"timezone"`
+  Jitter int `json:"jitter"`
+  Payload string `json:"payload"`
+  ContentType string `json:"contenttype"`
+}
+
+func ( definition Definition ) Location() ( *time.Location, error ) {
+  if definition.Timezone == "" {
+    return time.UTC, nil
+  }
+  return time.LoadLocation( definition.Timezone )
+}
+
+// the problems of a definition, by field
+func ( definition Definition ) Problems() map[string]string {
+  problems := make( map[string]string )
+  if _, err := Parse( definition.Cron ) ; err != nil {
+    problems["cron"] = err.Error()
+  }
+  if _, err := definition.Location() ; err != nil {
+    problems["timezone"] = "timezone unknow : '"+definition.Timezone+"'"
+  }
+  if definition.Jitter < 0 || definition.Jitter > JitterMax {
+    problems["jitter"] = "jitter out of range (0 to "+strconv.Itoa( JitterMax )+" seconds)"
+  }
+  if len( definition.Payload ) > PayloadSizeMax {
+    problems["payload"] = "payload too large ("+strconv.Itoa( PayloadSizeMax )+" bytes at most)"
+  }
+  return problems
+}
+
+// -----------------------------------------------
+
+type Wanted struct {
+  Key string
+  Definitions []Definition
+  Policy *jobs.Policy
+}
+
+// the state of a route's definition
+type State struct {
+  Route string `json:"route"`
+  Index int `json:"index"`
+  Cron string `json:"cron"`
+  Timezone string `json:"timezone"`
+  Next *time.Time `json:"next"`
+  Last *time.Time `json:"last"`
+  LastResult string `json:"lastresult,omitempty"`
+  LastJob string `json:"lastjob,omitempty"`
+  Error string `json:"error,omitempty"`
+  Runs int `json:"runs"`
+  Skipped int `json:"skipped"`
+}
+
+type entry struct {
+  state State
+  definition Definition
+  expression *Expression
+  location *time.Location
+  policy *jobs.Policy
+  // the next time of the expression, without jitter
+  nominal time.Time
+}
+
+// the next run, the jitter added
+func ( e *entry ) plan( after time.Time ) {
+  next := e.expression.Next( after.In( e.location ) )
+  e.nominal = next
+  if next.IsZero() {
+    e.state.Next = nil
+    e.state.Error = "no next run"
+    return
+  }
+  if e.definition.Jitter > 0 {
+    next = next.Add( time.Duration( rand.Int63n( int64( e.definition.Jitter ) * int64( time.Second ) ) ) )
+  }
+  e.state.Next = &next
+}
+
+type Scheduler struct {
+  Pool *jobs.Pool
+  logger *logger.Logger
+  mutex sync.Mutex
+  wake chan struct{}
+  entries map[string][]*entry
+}
+
+func New( pool *jobs.Pool, logger *logger.Logger ) *Scheduler {
+  return &Scheduler {
+    Pool: pool,
+    logger: logger,
+    wake: make( chan struct{}, 1 ),
+    entries: make( map[string][]*entry ),
+  }
+}
+
+func ( scheduler *Scheduler ) signal() {
+  select {
+  case scheduler.wake <- struct{}{}:
+  default:
+  }
+}
+
+// the routes' definitions ; a definition unchanged keeps its state (next and
+// last runs), a route without definition is forgotten
+func ( scheduler *Scheduler ) Sync( wanted []Wanted ) {
+  scheduler.mutex.Lock()
+  defer scheduler.mutex.Unlock()
+  now := time.Now()
+  entries := make( map[string][]*entry )
+  for _, route := range wanted {
+    previous := scheduler.entries[route.Key]
+    for i, definition := range route.Definitions {
+      if i < len( previous ) && previous[i].definition == definition {
+        previous[i].policy = route.Policy.Copy()
+        entries[route.Key] = append( entries[route.Key], previous[i] )
+        continue
+      }
+      added := &entry {
+        state: State { Route: route.Key, Index: i, Cron: definition.Cron, Timezone: definition.Timezone },
+        definition: definition,
+        policy: route.Policy.Copy(),
+      }
+      expression, err := Parse( definition.Cron )
+      location, errLocation := definition.Location()
+      if err == nil {
+        err = errLocation
+      }
+      if err != nil {
+        // refused by the conf's checks, kept to be seen
+        added.state.Error = err.Error()
+      } else {
+        added.expression = expression
+        added.location = location
+        added.plan( now )
+      }
+      entries[route.Key] = append( entries[route.Key], added )
+    }
+  }
+  scheduler.entries = entries
+  scheduler.signal()
+}
+
+func ( scheduler *Scheduler ) States() []State {
+  scheduler.mutex.Lock()
+  defer scheduler.mutex.Unlock()
+  states := []State{}
+  for _, entries := range scheduler.entries {
+    for _, e := range entries {
+      states = append( states, e.state )
+    }
+  }
+  sort.Slice( states, func( i int, j int ) bool {
+    if states[i].Route != states[j].Route {
+      return states[i].Route < states[j].Route
+    }
+    return states[i].Index < states[j].Index
+  } )
+  return states
+}
+
+func ( scheduler *Scheduler ) Route( key string ) ( states []State, ok bool ) {
+  scheduler.mutex.Lock()
+  defer scheduler.mutex.Unlock()
+  entries, ok := scheduler.entries[key]
+  for _, e := range entries {
+    states = append( states, e.state )
+  }
+  return states, ok
+}
+
+// -----------------------------------------------
+
+// the runs are done when due, until the context is done
+func ( scheduler *Scheduler ) Run( ctx context.Context ) {
+  for {
+    wait := scheduler.fire( time.Now() )
+    var ready <-chan time.Time
+    var timer *time.Timer
+    if wait > 0 {
+      timer = time.NewTimer( wait )
+      ready = timer.C
+    }
+    select {
+    case <-scheduler.wake:
+    case <-ready:
+    case <-ctx.Done():
+    }
+    if timer != nil {
+      timer.Stop()
+    }
+    if ctx.Err() != nil {
+      return
+    }
+  }
+}
+
+// the entries due are run ; the wait until the next one (0 : none)
+func ( scheduler *Scheduler ) fire( now time.Time ) ( wait time.Duration ) {
+  scheduler.mutex.Lock()
+  defer scheduler.mutex.Unlock()
+  for _, entries := range scheduler.entries {
+    for _, e := range entries {
+      if e.state.Next == nil {
+        continue
+      }
+      if e.state.Next.After( now ) != true {
+        scheduler.start( e, now )
+        // from the expression's time (a jitter can pass the next one), the
+        // runs missed aren't caught up
+        if e.plan( e.nominal ) ; e.nominal.After( now ) != true {
+          e.plan( now )
+        }
+      }
+      if e.state.Next == nil {
+        continue
+      }
+      if delay := e.state.Next.Sub( now ) ; wait == 0 || delay < wait {
+        wait = delay
+      }
+    }
+  }
+  return wait
+}
+
+// to call with the mutex held
+func ( scheduler *Scheduler ) start( e *entry, now time.Time ) {
+  last := now.In( e.location )
+  e.state.Last = &last
+  e.state.Error = ""
+  if e.state.LastJob != "" {
+    if previous, ok := scheduler.Pool.Get( e.state.LastJob ) ; ok && previous.Done() != true {
+      e.state.LastResult = RunSkipped
+      e.state.Skipped++
+      scheduler.logger.Infof( "schedule '%v' of route '%v' skipped : job '%v' not ended", e.definition.Cron, e.state.Route, previous.Id )
+      return
+    }
+  }
+  job, err := scheduler.Pool.Submit( e.state.Route, e.request(), e.policy )
+  if err != nil {
+    e.state.LastResult = RunRefused
+    e.state.Error = err.Error()
+    scheduler.logger.Warningf( "schedule '%v' of route '%v' refused : %v", e.definition.Cron, e.state.Route, err )
+    return
+  }
+  e.state.LastResult = RunSubmitted
+  e.state.LastJob = job.Id
+  e.state.Runs++
+  scheduler.logger.Infof( "schedule '%v' of route '%v' run (job '%v')", e.definition.Cron, e.state.Route, job.Id )
+}
+
+func ( e *entry ) request() *jobs.Request {
+  contentType := e.definition.ContentType
+  if contentType == "" {
+    contentType = ContentTypeDefault
+  }
+  return &jobs.Request {
+    Origin: OriginPrefix+e.definition.Cron,
+    Method: http.MethodPost,
+    URL: "/lambda/"+e.state.Route,
+    Header: http.Header {
+      "Content-Type": []string{ contentType },
+      HeaderSchedule: []string{ e.definition.Cron },
+    },
+    Body: []byte( e.definition.Payload ),
+    Env: map[string]string { EnvSchedule: e.definition.Cron },
+  }
+}
@@ -0,0 +1,43 @@
+package schedule
+
+import (
+  "testing"
+  "time"
+  // -----------
+  "jobs"
+  "logger"
+)
+
+func TestScheduler( t *testing.T ) {
+  l := &logger.Logger{}
+  l.Init()
+  // without handler, the pool keeps its jobs queued : a run isn't ended
+  pool := jobs.NewPool( "", l )
+  scheduler := New( pool, l )
+  definition := Definition { Cron: "* * * * *", Payload: "{}" }
+  scheduler.Sync( []Wanted{ { Key: "a", Definitions: []Definition{ definition } } } )
+  states, _ := scheduler.Route( "a" )
+  if len( states ) != 1 || states[0].Next == nil || states[0].Last != nil {
+    t.Fatalf( "a next run expected : %+v", states )
+  }
+  due := states[0].Next.Add( time.Second )
+  scheduler.fire( due )
+  scheduler.fire( due.Add( time.Minute ) )
+  states, _ = scheduler.Route( "a" )
+  job, ok := pool.Get( states[0].LastJob )
+  if ok != true || job.Route != "a" || states[0].Runs != 1 || states[0].Skipped != 1 || states[0].LastResult != RunSkipped {
+    t.Errorf( "one run then one skipped expected : %+v", states[0] )
+  }
+  if states[0].Next.After( due.Add( time.Minute ) ) != true {
+    t.Errorf( "the next run must be planned : %+v", states[0] )
+  }
+  // unchanged, the state is kept ; without definition, forgotten
+  scheduler.Sync( []Wanted{ { Key: "a", Definitions: []Definition{ definition } } } )
+  if states, _ := scheduler.Route( "a" ) ; states[0].Runs != 1 {
+    t.Error( "the state must be kept" )
+  }
+  scheduler.Sync( nil )
+  if _, ok := scheduler.Route( "a" ) ; ok {
+    t.Error( "the route must be forgotten" )
+  }
+}
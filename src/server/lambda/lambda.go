@@ -7,6 +7,9 @@ import(
   "fmt"
   "strconv"
   "io"
+  "io/ioutil"
+  "bytes"
+  "net"
   "net/http"
   "unicode/utf8"
   "context"
@@ -18,8 +21,13 @@ import(
   "httpresponse"
   "itinerary"
   "configuration"
+  "configuration/auth"
   "logger"
   "executors/shell"
+  "events"
+  "jobs"
+  "network"
+  "pipeline"
 )
 
 // -----------------------------------------------
@@ -33,7 +41,14 @@ type HandlerLambda struct {
 
 // -----------------------------------------------
 
-func Authorization( route *itinerary.Route, request *http.Request ) bool {
+// the body is only given for a signed route, read before the conf is locked
+func Authorization( route *itinerary.Route, request *http.Request, body []byte ) bool {
+  switch route.AuthorizationType {
+  case auth.AuthTypeCertificate:
+    return auth.MatchCertificate( route.Certificates, request.TLS )
+  case auth.AuthTypeSignature:
+    return body != nil && route.Signature.Verify( request.Header, body, route.Replays, time.Now() ) == nil
+  }
   if route.Authorization == "" { 
     if request.Header.Get( "Authorization" ) != "" {
       return false 
@@ -56,11 +71,11 @@ type FunctionResponseHeaders struct {
 
 // -----------------------------------------------
 
-func ( handlerLambda *HandlerLambda ) ServeShell ( route *itinerary.Route, httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request ) {
+func ( handlerLambda *HandlerLambda ) ServeShell ( route *itinerary.Route, requestEnv map[string]string, httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request ) {
   route.Mutex.RLock()
   defer route.Mutex.RUnlock()
-  ctx, cancel := context.WithTimeout( 
-    context.Background(), 
+  ctx, cancel := jobs.Context( 
+    r.Context(), 
     time.Duration( route.Timeout ) * time.Millisecond, 
   ) 
   defer cancel()
@@ -73,6 +88,7 @@ func ( handlerLambda *HandlerLambda ) ServeShell ( route *itinerary.Route, httpR
     route.ScriptPath, 
     route.ScriptCmd, 
     route.Environment, 
+    requestEnv, 
   ) 
   if err != nil {
     handlerLambda.Logger.Warningf( "unable to get cmd for '%s' : %s", routeName, err )
@@ -104,6 +120,7 @@ func ( handlerLambda *HandlerLambda ) ServeShell ( route *itinerary.Route, httpR
       return 
     }
   }
+  jobs.SetExit( r.Context(), returnCode, "" )
   httpResponse.Code = 200
   httpResponse.Payload = map[string]interface{} { 
     "exitcode" : returnCode, 
@@ -112,11 +129,11 @@ func ( handlerLambda *HandlerLambda ) ServeShell ( route *itinerary.Route, httpR
   return 
 }
 
-func ( handlerLambda *HandlerLambda ) ServeFunction ( route *itinerary.Route, httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request ) {
+func ( handlerLambda *HandlerLambda ) ServeFunction ( key string, route *itinerary.Route, requestEnv map[string]string, httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request ) {
   route.Mutex.RLock()
   defer route.Mutex.RUnlock()
-  ctx, cancel := context.WithTimeout( 
-    context.Background(), 
+  ctx, cancel := jobs.Context( 
+    r.Context(), 
     time.Duration( route.Timeout ) * time.Millisecond, 
   ) 
   defer cancel() 
@@ -127,13 +144,34 @@ func ( handlerLambda *HandlerLambda ) ServeFunction ( route *itinerary.Route, ht
     return 
   }
   routeName := route.Name 
+  scriptPath := route.ScriptPath
+  image := route.Image
+  if route.Build != nil {
+    // the code is in the image : nothing mounted
+    scriptPath = ""
+    if image = handlerLambda.Conf.Builder.Image( key ) ; image == "" {
+      handlerLambda.Logger.Infof( "image of '%s' not built yet", routeName )
+      httpResponse.Code = 503
+      httpResponse.MessageError = "the function's image isn't built yet" 
+      return 
+    }
+  } else if route.Artifact != "" {
+    // never mounted without a check of its content
+    scriptPath, err = handlerLambda.Conf.Artifacts.Verify( route.Artifact )
+    if err != nil {
+      handlerLambda.Logger.Warningf( "unable to use artifact of '%s' : %s", routeName, err )
+      httpResponse.MessageError = "unable to run request in container (artifact invalid)" 
+      return 
+    }
+  }
   cmd, err := handlerLambda.Conf.Containers.ExecuteRequest( 
     ctx, 
     routeName, 
-    route.ScriptPath, 
+    scriptPath, 
     fileEnvPath, 
-    route.Image, 
+    image, 
     route.ScriptCmd, 
+    requestEnv, 
   ) 
   if err != nil {
     handlerLambda.Logger.Warningf( "unable to get command for '%s' : %s", routeName, err )
@@ -168,33 +206,44 @@ func ( handlerLambda *HandlerLambda ) ServeFunction ( route *itinerary.Route, ht
   if err != nil { 
     handlerLambda.Logger.Warningf( "unable to run request in container '%s' : %s", routeName, err )
     httpResponse.MessageError = "unable to run request in container (time out or failed)" 
+    if exiterr, ok := err.(*exec.ExitError); ok {
+      jobs.SetExit( r.Context(), exiterr.ExitCode(), err.Error() )
+    }
     return 
   }
+  jobs.SetExit( r.Context(), 0, "" )
   httpResponse.MessageError = "unable to run request in container (incorrect response)" 
   if len(out) < 4 {
-    handlerLambda.Logger.Warning( "incorrect size of headers'length from container '%s'", routeName )
+    handlerLambda.Logger.Warningf( "incorrect size of headers'length from container '%s'", routeName )
     return 
   }
   sizeHeaders := binary.BigEndian.Uint32( out[0:4] ) 
   if sizeHeaders < 1 {
-    handlerLambda.Logger.Warning( "headers of response null from container '%s'", routeName )
+    handlerLambda.Logger.Warningf( "headers of response null from container '%s'", routeName )
+    return 
+  }
+  if uint64( sizeHeaders ) > uint64( len( out ) - 4 ) {
+    handlerLambda.Logger.Warningf( "headers of response truncated from container '%s'", routeName )
     return 
   }
   step += 4
   var responseHeaders FunctionResponseHeaders
   err = json.Unmarshal( out[step:step+sizeHeaders], &responseHeaders )
   if err != nil {
-    handlerLambda.Logger.Warning( "incorrect headers payload of response from container '%s'", routeName )
+    handlerLambda.Logger.Warningf( "incorrect headers payload of response from container '%s'", routeName )
     return 
   }
   step += sizeHeaders 
   httpResponse.Code = responseHeaders.Code
   header := w.Header()
   contentTypeSend := false 
+  publish := ""
   for key, value := range responseHeaders.Headers {
     if strings.ToLower( key ) == "content-type" {
       header.Add( "Content-type", value )
       contentTypeSend = true 
+    } else if strings.EqualFold( key, events.HeaderPublish ) {
+      publish = value
     } else {
       header.Add( "x-faas-"+key, value ) 
     }
@@ -202,11 +251,226 @@ func ( handlerLambda *HandlerLambda ) ServeFunction ( route *itinerary.Route, ht
   if contentTypeSend == false {
     header.Add( "Content-type", "application/json" )
   } 
+  if publish != "" && responseHeaders.Code < 400 {
+    handlerLambda.publish( key, publish, header.Get( "Content-type" ), out[step+4:], w, r )
+  }
   w.Write( out[step+4:] ) 
   return 
 }
 
+// the response of a function is an event of each topic asked (a list), its
+// ids given back ; a failure is only logged : the response stays
+func ( handlerLambda *HandlerLambda ) publish ( key string, topics string, contentType string, data []byte, w http.ResponseWriter, r *http.Request ) {
+  for _, topic := range strings.Split( topics, "," ) {
+    event, _, err := handlerLambda.Conf.Events.Publish( events.Event { 
+      Topic: strings.TrimSpace( topic ), 
+      Source: key, 
+      ContentType: contentType, 
+      Data: append( []byte{}, data... ), 
+      Depth: events.Depth( r ), 
+    } ) 
+    if err != nil {
+      handlerLambda.Logger.Warningf( "event of '%s' not published on '%s' : %s", key, topic, err )
+      continue
+    }
+    w.Header().Add( events.HeaderEvent, event.Id )
+  }
+}
+
+// the request, authorized, is kept (its body read) and served later by a job ;
+// the policy (retries, callback) is the route's one of that time ; a request
+// gives its callback only if the route has one (its secret) and allows its url
+func ( handlerLambda *HandlerLambda ) ServeAsync ( key string, route *itinerary.Route, requestEnv map[string]string, httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request ) {
+  body, err := ioutil.ReadAll( http.MaxBytesReader( w, r.Body, jobs.BodySizeMax ) )
+  if err != nil {
+    handlerLambda.Logger.Info( "async request refused for :", key, "(", err, ")" )
+    httpResponse.Code = 413
+    httpResponse.MessageError = "the request's body is too large for a job" 
+    return 
+  }
+  policy := route.Jobs.Copy()
+  if callback := r.Header.Get( jobs.HeaderCallback ) ; callback != "" {
+    if policy == nil || policy.Callback == nil {
+      handlerLambda.Logger.Info( "async request refused for :", key, "(callback without secret)" )
+      httpResponse.Code = 400
+      httpResponse.MessageError = "callback not allowed for this route" 
+      return 
+    }
+    if err := policy.Callback.Permit( callback ) ; err != nil {
+      handlerLambda.Logger.Info( "async request refused for :", key, "(", err, ")" )
+      httpResponse.Code = 400
+      httpResponse.MessageError = err.Error() 
+      return 
+    }
+    policy.Callback.URL = callback
+    policy.Callback.Given = true
+  }
+  credentials := []string{}
+  if route.Signature != nil {
+    credentials = append( credentials, route.Signature.Header )
+  }
+  job, err := handlerLambda.Conf.Jobs.Submit( key, jobs.NewRequest( r, body, requestEnv, credentials... ), policy )
+  if err != nil {
+    handlerLambda.Logger.Warning( "async request refused for :", key, "(", err, ")" )
+    httpResponse.Code = 503
+    httpResponse.MessageError = "job not accepted" 
+    if err == jobs.ErrQueueFull {
+      httpResponse.MessageError = "too many jobs queued" 
+    }
+    return 
+  }
+  handlerLambda.Logger.Info( "async request accepted for :", key, "(job", job.Id, ")" )
+  w.Header().Set( "Location", jobs.Location( job.Id ) )
+  httpResponse.Code = 202
+  httpResponse.MessageError = "" 
+  httpResponse.Payload = job
+}
+
+// the handler of the jobs' pool : an attempt serves the request kept with the 
+// route of this time 
+func ( handlerLambda *HandlerLambda ) ServeJob ( ctx context.Context, key string, request *jobs.Request ) jobs.Result {
+  recorder := jobs.NewRecorder()
+  r, err := request.HTTP( ctx )
+  if err != nil {
+    handlerLambda.Logger.Warningf( "request of job for '%v' invalid : %v", key, err )
+    return jobs.Result { Code: 400 }
+  }
+  handlerLambda.serveJob( key, request.Env, true, recorder, r )
+  return recorder.Result()
+}
+
+// a request kept (a job's one, or a pipeline's step : never a pipeline)
+func ( handlerLambda *HandlerLambda ) serveJob ( key string, requestEnv map[string]string, pipelines bool, w http.ResponseWriter, r *http.Request ) {
+  // the records of the route : a copy of the handler ; the id of the first 
+  // request is kept by the job (its header), a new one else
+  r = network.WithRequestId( r )
+  requestId := network.RequestId( r.Context() )
+  scoped := *handlerLambda
+  scoped.Logger = handlerLambda.Logger.With( logger.FieldRequest, requestId ).With( logger.FieldRoute, key )
+  handlerLambda = &scoped
+  env := map[string]string {
+    network.EnvRequestId: requestId, 
+  }
+  for name, value := range requestEnv {
+    if name != network.EnvRequestId {
+      env[name] = value
+    }
+  }
+  requestEnv = env
+  httpResponse := httpresponse.Response { 
+    Code: 500, 
+    MessageError: "an unexpected error found", 
+  }
+  defer httpResponse.Respond( handlerLambda.Logger, w ) 
+  handlerLambda.ConfMutext.RLock()
+  route, err := handlerLambda.Conf.GetRoute( key )
+  if err != nil || route.TypeNum == itinerary.RouteTypeService || ( route.TypeNum == itinerary.RouteTypePipeline && pipelines != true ) {
+    handlerLambda.Logger.Info( "unknow desired url for job :", key, "(", err, ")" )
+    httpResponse.Code = 404
+    httpResponse.MessageError = "unknow desired url" 
+    handlerLambda.ConfMutext.RUnlock()
+    return
+  } 
+  route.Begin()
+  defer route.End()
+  if route.TypeNum == itinerary.RouteTypePipeline {
+    steps, timeout := route.Steps, time.Duration( route.Timeout ) * time.Millisecond
+    handlerLambda.ConfMutext.RUnlock()
+    handlerLambda.ServePipeline( key, steps, timeout, requestEnv, &httpResponse, w, r )
+    return
+  }
+  defer handlerLambda.ConfMutext.RUnlock()
+  if route.TypeNum == itinerary.RouteTypeShell {
+    handlerLambda.ServeShell( route, requestEnv, &httpResponse, w, r )
+    return
+  }
+  handlerLambda.ServeFunction( key, route, requestEnv, &httpResponse, w, r )
+}
+
+// the steps are served one by one, the conf unlocked (each one locks it, as a
+// job) : the routes are the ones of the step's time
+func ( handlerLambda *HandlerLambda ) ServePipeline ( key string, steps []pipeline.Step, timeout time.Duration, requestEnv map[string]string, httpResponse *httpresponse.Response, w http.ResponseWriter, r *http.Request ) {
+  ctx, cancel := jobs.Context( r.Context(), timeout ) 
+  defer cancel()
+  body, err := ioutil.ReadAll( http.MaxBytesReader( w, r.Body, jobs.BodySizeMax ) )
+  if err != nil {
+    handlerLambda.Logger.Info( "pipeline request refused for :", key, "(", err, ")" )
+    httpResponse.Code = 413
+    httpResponse.MessageError = "the request's body is too large for a pipeline" 
+    return 
+  }
+  // only the body's type : the output of a step ignored is the input
+  input := pipeline.Output { 
+    Code: 200, 
+    Header: http.Header { "Content-Type": r.Header.Values( "Content-Type" ) }, 
+    Body: body, 
+  }
+  output, traces, err := pipeline.Run( ctx, steps, input, handlerLambda.serveStep( key, requestEnv ) )
+  for _, trace := range traces {
+    handlerLambda.Logger.Debugf( "pipeline '%s' step %v : route '%s' (code %v, %v ms, ignored %v)", key, trace.Step, trace.Route, trace.Code, trace.Duration, trace.Ignored )
+  }
+  if err != nil {
+    handlerLambda.Logger.Warningf( "pipeline '%s' failed : %s", key, err )
+    httpResponse.Code = 502
+    httpResponse.MessageError = err.Error() 
+    if ctx.Err() != nil {
+      httpResponse.Code = 504
+    }
+    return 
+  }
+  header := w.Header()
+  for name, values := range output.Header {
+    for _, value := range values {
+      header.Add( name, value )
+    }
+  }
+  httpResponse.Code = output.Code
+  httpResponse.MessageError = ""
+  httpResponse.IOFile = ioutil.NopCloser( bytes.NewReader( output.Body ) )
+}
+
+// a step served as a job's request, its process canceled with the pipeline 
+func ( handlerLambda *HandlerLambda ) serveStep ( key string, requestEnv map[string]string ) pipeline.Runner {
+  return func( ctx context.Context, step int, route string, timeout time.Duration, input pipeline.Output ) pipeline.Output {
+    stepCtx, cancel := jobs.Within( ctx, timeout )
+    defer cancel()
+    exit := &jobs.Exit{}
+    r, err := http.NewRequestWithContext( jobs.WithExit( stepCtx, exit ), http.MethodPost, "/lambda/"+route, bytes.NewReader( input.Body ) )
+    if err != nil {
+      return pipeline.Output { Code: 400, Error: err.Error() }
+    }
+    r.Header = pipeline.Header( key, step, input )
+    if requestId := network.RequestId( ctx ) ; requestId != "" {
+      r.Header.Set( network.HeaderRequestId, requestId )
+    }
+    env := map[string]string {
+      pipeline.EnvPipeline: key, 
+      pipeline.EnvStep: strconv.Itoa( step ), 
+    }
+    for name, value := range requestEnv {
+      env[name] = value
+    }
+    recorder := jobs.NewRecorder()
+    handlerLambda.serveJob( route, env, false, recorder, r )
+    result := recorder.Result()
+    output := pipeline.Output { Code: result.Code, Header: result.Header, Body: result.Body, Exit: exit.Code }
+    switch {
+    case stepCtx.Err() == context.DeadlineExceeded:
+      output.Code = 504
+      output.Error = "timed out"
+    case len( result.Body ) > jobs.ResultSizeMax:
+      output.Code = 502
+      output.Error = "output too large"
+    }
+    return output
+  }
+}
+
 func ( handlerLambda HandlerLambda ) ServeHTTP ( w http.ResponseWriter, r *http.Request ) {
+  r = network.WithRequestId( r )
+  events.Untrust( r.Header )
+  requestId := network.RequestId( r.Context() )
+  handlerLambda.Logger = handlerLambda.Logger.With( logger.FieldRequest, requestId )
   httpResponse := httpresponse.Response { 
     Code: 500, 
     MessageError: "an unexpected error found", 
@@ -219,13 +483,42 @@ func ( handlerLambda HandlerLambda ) ServeHTTP ( w http.ResponseWriter, r *http.
     httpResponse.MessageError = "bad desired url" 
     return
   }
-  handlerLambda.Logger.Info( "known real desired url :", r.URL )
+  // the global access list is checked before, for every path 
+  handlerLambda.ConfMutext.RLock()
+  clientIP := handlerLambda.Conf.Access.ClientIP( r )
+  handlerLambda.ConfMutext.RUnlock()
+  handlerLambda.Logger.Info( "known real desired url :", r.URL, "(client", clientIP, ")" )
+  requestEnv := map[string]string {
+    network.EnvClientIp: clientIP.String(), 
+    network.EnvRequestId: requestId, 
+  }
   rNameSize := utf8.RuneCountInString( handlerLambda.GlobalRouteRegex.FindStringSubmatch( url )[1] )
   routeName := url[:rNameSize]
   rRest := url[rNameSize:]
+  handlerLambda.Logger = handlerLambda.Logger.With( logger.FieldRoute, routeName )
   if rRest == "" {
     rRest += "/"
   }
+  // le corps d'une route signée est lu entièrement avant de verrouiller la conf 
+  // (un client lent ne la bloque pas) puis rendu à la requête : la fonction 
+  // reçoit le même contenu que celui signé 
+  var signedBody []byte
+  handlerLambda.ConfMutext.RLock()
+  if route, err := handlerLambda.Conf.GetRoute( routeName ) ; err == nil && route.AuthorizationType == auth.AuthTypeSignature {
+    signedBody = []byte{}
+  }
+  handlerLambda.ConfMutext.RUnlock()
+  if signedBody != nil {
+    body, err := ioutil.ReadAll( io.LimitReader( r.Body, auth.SignatureBodyMax+1 ) )
+    if err != nil || len( body ) > auth.SignatureBodyMax {
+      handlerLambda.Logger.Info( "signed body unreadable or too large :", routeName )
+      httpResponse.Code = 413
+      httpResponse.MessageError = "signed body unreadable or too large" 
+      return
+    }
+    signedBody = body
+    r.Body = ioutil.NopCloser( bytes.NewReader( body ) )
+  }
   handlerLambda.ConfMutext.RLock()
   route, err := handlerLambda.Conf.GetRoute( routeName )
   if err != nil {
@@ -236,22 +529,51 @@ func ( handlerLambda HandlerLambda ) ServeHTTP ( w http.ResponseWriter, r *http.
     return
   } 
   handlerLambda.Logger.Info( "known desired url :", routeName )
-  if Authorization( route, r ) != true { 
+  // la route a pu changer (reload) pendant la lecture du corps : son type 
+  // d'autorisation doit être celui pour lequel le corps a été lu 
+  if ( route.AuthorizationType == auth.AuthTypeSignature ) != ( signedBody != nil ) {
+    httpResponse.Code = 503
+    httpResponse.MessageError = "the route changed during the request ; retry" 
+    handlerLambda.Logger.Info( "known desired url and authorization changed during the request :", routeName )
+    handlerLambda.ConfMutext.RUnlock()
+    return 
+  }
+  if route.Access.Permit( clientIP ) != true {
+    httpResponse.Code = 403
+    httpResponse.MessageError = "forbidden client" 
+    handlerLambda.Logger.Info( "known desired url and forbidden client :", routeName, "(client", clientIP, ")" )
+    handlerLambda.ConfMutext.RUnlock()
+    return 
+  }
+  if Authorization( route, r, signedBody ) != true { 
     httpResponse.Code = 401
     httpResponse.MessageError = "you must be authentified" 
     handlerLambda.Logger.Info( "known desired url and unauthentified request :", routeName )
     handlerLambda.ConfMutext.RUnlock()
     return 
   } 
+  // a service answers by itself (the header is given to it)
+  if route.TypeNum != itinerary.RouteTypeService && jobs.WantsAsync( r ) {
+    handlerLambda.ServeAsync( routeName, route, requestEnv, &httpResponse, w, r )
+    handlerLambda.ConfMutext.RUnlock()
+    return 
+  }
+  route.Begin()
+  defer route.End()
   switch route.TypeNum {
   case itinerary.RouteTypeFunction:
-    handlerLambda.ServeFunction( route, &httpResponse, w, r )
+    handlerLambda.ServeFunction( routeName, route, requestEnv, &httpResponse, w, r )
     handlerLambda.ConfMutext.RUnlock()
     return 
   case itinerary.RouteTypeShell:
-    handlerLambda.ServeShell( route, &httpResponse, w, r )
+    handlerLambda.ServeShell( route, requestEnv, &httpResponse, w, r )
     handlerLambda.ConfMutext.RUnlock()
     return 
+  case itinerary.RouteTypePipeline:
+    steps, timeout := route.Steps, time.Duration( route.Timeout ) * time.Millisecond
+    handlerLambda.ConfMutext.RUnlock()
+    handlerLambda.ServePipeline( routeName, steps, timeout, requestEnv, &httpResponse, w, r )
+    return 
   }
   // on doit impérativement passer en RW pour le mutex ici : 
   // - impossible de verrouiller au niveau de la route car on créé un conteneur persistant 
@@ -304,12 +626,21 @@ func ( handlerLambda HandlerLambda ) ServeHTTP ( w http.ResponseWriter, r *http.
     return
   }
   proxyReq.Header.Set( "Host", r.Host )
-  proxyReq.Header.Set( "X-Forwarded-For", r.RemoteAddr )
   for header, values := range r.Header {
     for _, value := range values {
       proxyReq.Header.Add(header, value)
     }
   }
+  remoteHost, _, err := net.SplitHostPort( r.RemoteAddr )
+  if err != nil {
+    remoteHost = r.RemoteAddr
+  }
+  if forwardedFor := strings.Join( r.Header.Values( network.HeaderForwardedFor ), ", " ) ; forwardedFor != "" {
+    proxyReq.Header.Set( network.HeaderForwardedFor, forwardedFor+", "+remoteHost )
+  } else {
+    proxyReq.Header.Set( network.HeaderForwardedFor, remoteHost )
+  }
+  proxyReq.Header.Set( network.HeaderRealIp, clientIP.String() )
   client := &http.Client{
     Timeout: time.Duration( route.Timeout ) * time.Millisecond,
   }
@@ -323,6 +654,10 @@ func ( handlerLambda HandlerLambda ) ServeHTTP ( w http.ResponseWriter, r *http.
   handlerLambda.Logger.Debug( "result of desired route :", proxyRes.StatusCode, "(cId", routeId, ")" )
   wH := w.Header()
   for header, values := range proxyRes.Header {
+    // the id of the request, whatever the service answers
+    if header == network.HeaderRequestId {
+      continue
+    }
     for _, value := range values {
       wH.Add(header, value)
     }
@@ -2,25 +2,77 @@ package server
 
 import ( 
   "net/http"
+  "crypto/tls"
+  "crypto/x509"
+  "io/ioutil"
+  "errors"
+  "fmt"
   "os"
+  "strconv"
   "sync"
   "regexp"
+  "sync/atomic"
   // -----------
   "configuration"
+  "configuration/auth"
+  "httpresponse"
   "logger"
   "server/lambda"
   ApiConfiguration "api/configuration"
   ApiFunctions "api/functions"
   ApiServices "api/services"
+  ApiKeys "api/keys"
+  ApiRoutes "api/routes"
+  ApiArtifacts "api/artifacts"
+  ApiBuilds "api/builds"
+  ApiJobs "api/jobs"
+  ApiSchedules "api/schedules"
+  ApiEvents "api/events"
+  "api"
+  "jobs"
+  "network"
 )
 
 // -----------------------------------------------
 
+func CreateTLSConfig( conf *configuration.Conf ) ( *tls.Config, error ) {
+  clientAuth, ok := auth.ClientAuthType( conf.IncomingTLSClientAuth )
+  if !ok {
+    return nil, errors.New( "tls client auth mode invalid" )
+  }
+  if auth.ClientAuthVerifies( conf.IncomingTLSClientAuth ) && conf.IncomingTLSClientCA == "" {
+    return nil, errors.New( "tls client auth mode verifying without client CA" )
+  }
+  tlsConfig := &tls.Config {
+    ClientAuth: clientAuth,
+  }
+  if conf.IncomingTLSClientCA != "" {
+    caBundle, err := ioutil.ReadFile( conf.IncomingTLSClientCA )
+    if err != nil {
+      return nil, errors.New( 
+        fmt.Sprintf( "unable to read tls client CA : %v", err ), 
+      )
+    }
+    pool := x509.NewCertPool()
+    if pool.AppendCertsFromPEM( caBundle ) != true {
+      return nil, errors.New( "no valid certificate found in tls client CA" )
+    }
+    tlsConfig.ClientCAs = pool
+  }
+  return tlsConfig, nil
+}
+
 func Run ( conf *configuration.Conf, logger *logger.Logger, httpServer *http.Server ) {
   defer logger.Warning( "Shutdown ListenAndServeTLS terminated" )
   exitWithError := false 
   if conf.IncomingTLS != "" {
-    err := httpServer.ListenAndServeTLS(
+    tlsConfig, err := CreateTLSConfig( conf )
+    if err != nil {
+      logger.Panicf( "General internal TLS server error : %v", err )
+      os.Exit( configuration.ExitUndefined )
+    }
+    httpServer.TLSConfig = tlsConfig
+    err = httpServer.ListenAndServeTLS(
       conf.IncomingTLSCrt,
       conf.IncomingTLSKey,
     ) 
@@ -40,7 +92,57 @@ func Run ( conf *configuration.Conf, logger *logger.Logger, httpServer *http.Ser
   }
 }
 
-func CreateServeMux( c *configuration.Conf, m *sync.RWMutex, l *logger.Logger, r *regexp.Regexp ) *http.ServeMux {
+// the muxer can be replaced at reload without restarting the listener 
+type Switcher struct {
+  handler atomic.Value
+}
+
+func ( switcher *Switcher ) Set( handler http.Handler ) {
+  switcher.handler.Store( &handler )
+}
+
+// every request has its id, given back whatever the response
+func ( switcher *Switcher ) ServeHTTP( w http.ResponseWriter, r *http.Request ) {
+  r = network.WithRequestId( r )
+  w.Header().Set( network.HeaderRequestId, network.RequestId( r.Context() ) )
+  handler := switcher.handler.Load().( *http.Handler )
+  ( *handler ).ServeHTTP( w, r )
+}
+
+// the global access list covers every path (lambda, API, jobs and UI) ; the 
+// routes' lists are checked after, by the lambda 
+type HandlerAccess struct {
+  Logger *logger.Logger
+  ConfMutext *sync.RWMutex
+  Conf *configuration.Conf
+  Next http.Handler
+}
+
+func ( handlerAccess HandlerAccess ) ServeHTTP( w http.ResponseWriter, r *http.Request ) {
+  handlerAccess.ConfMutext.RLock()
+  clientIP := handlerAccess.Conf.Access.ClientIP( r )
+  permit := handlerAccess.Conf.Access.Permit( clientIP )
+  handlerAccess.ConfMutext.RUnlock()
+  if permit != true {
+    l := api.Logger( handlerAccess.Logger, r )
+    l.Info( "forbidden client :", clientIP, "for url :", r.URL )
+    httpResponse := httpresponse.Response {
+      Code: http.StatusForbidden,
+      MessageError: "forbidden client",
+    }
+    httpResponse.Respond( l, w )
+    return
+  }
+  handlerAccess.Next.ServeHTTP( w, r )
+}
+
+// -----------------------------------------------
+
+func ListenKey( conf *configuration.Conf ) string {
+  return conf.IncomingAdress+":"+strconv.Itoa( conf.IncomingPort )+"|"+conf.IncomingTLS+"|"+conf.IncomingTLSClientCA+"|"+conf.IncomingTLSClientAuth
+}
+
+func CreateServeMux( c *configuration.Conf, m *sync.RWMutex, l *logger.Logger, r *regexp.Regexp ) http.Handler {
   m.RLock()
   defer m.RUnlock()
   muxer := http.NewServeMux()
@@ -49,27 +151,36 @@ func CreateServeMux( c *configuration.Conf, m *sync.RWMutex, l *logger.Logger, r
     l.Info( "UI path found :", UIPath )
     muxer.Handle( "/", http.FileServer( http.Dir( UIPath ) ) )
   }
-  muxer.Handle( 
-    "/lambda/", 
-    lambda.HandlerLambda {
-      GlobalRouteRegex: r,
+  handlerLambda := lambda.HandlerLambda {
+    GlobalRouteRegex: r,
+    Logger: l, 
+    ConfMutext: m, 
+    Conf: c, 
+  }
+  muxer.Handle( "/lambda/", handlerLambda )
+  if c.Jobs != nil {
+    c.Jobs.Handle( handlerLambda.ServeJob )
+  }
+  // the jobs are reached by their id, without API's authorization (the list 
+  // and the dead letters need it)
+  handlerJobs := ApiJobs.HandlerApi {
+    Logger: l, 
+    ConfMutext: m, 
+    Conf: c, 
+  }
+  muxer.Handle( jobs.Path, handlerJobs )
+  muxer.Handle( jobs.Path+"/", handlerJobs )
+  if api.IsActive( c ) {
+    l.Info( "Authorization secret API or API keys found ; API active" )
+    handlerConfiguration := ApiConfiguration.HandlerApi {
       Logger: l, 
       ConfMutext: m, 
       Conf: c, 
-    }, 
-  )
-  if c.AuthorizationAPI != "" {
-    l.Info( "Authorization secret API found ; API active" )
-    muxer.Handle( 
-      "/api/configuration", 
-      ApiConfiguration.HandlerApi {
-        Logger: l, 
-        ConfMutext: m, 
-        Conf: c, 
-      }, 
-    )
+    }
+    muxer.Handle( "/api/configuration", handlerConfiguration )
+    muxer.Handle( "/api/configuration/", handlerConfiguration )
     muxer.Handle( 
-      "/api/functions/", 
+      ApiFunctions.Path, 
       ApiFunctions.HandlerApi {
         Logger: l, 
         ConfMutext: m, 
@@ -77,16 +188,63 @@ func CreateServeMux( c *configuration.Conf, m *sync.RWMutex, l *logger.Logger, r
       }, 
     )
     muxer.Handle( 
-      "/api/services/", 
+      ApiServices.Path, 
       ApiServices.HandlerApi {
         Logger: l, 
         ConfMutext: m, 
         Conf: c, 
       }, 
     )
+    handlerRoutes := ApiRoutes.HandlerApi {
+      Logger: l, 
+      ConfMutext: m, 
+      Conf: c, 
+    }
+    muxer.Handle( ApiRoutes.Path, handlerRoutes )
+    muxer.Handle( ApiRoutes.Path+"/", handlerRoutes )
+    handlerArtifacts := ApiArtifacts.HandlerApi {
+      Logger: l, 
+      ConfMutext: m, 
+      Conf: c, 
+    }
+    muxer.Handle( ApiArtifacts.Path, handlerArtifacts )
+    muxer.Handle( ApiArtifacts.Path+"/", handlerArtifacts )
+    handlerBuilds := ApiBuilds.HandlerApi {
+      Logger: l, 
+      ConfMutext: m, 
+      Conf: c, 
+    }
+    muxer.Handle( ApiBuilds.Path, handlerBuilds )
+    muxer.Handle( ApiBuilds.Path+"/", handlerBuilds )
+    handlerSchedules := ApiSchedules.HandlerApi {
+      Logger: l, 
+      ConfMutext: m, 
+      Conf: c, 
+    }
+    muxer.Handle( ApiSchedules.Path, handlerSchedules )
+    muxer.Handle( ApiSchedules.Path+"/", handlerSchedules )
+    handlerEvents := ApiEvents.HandlerApi {
+      Logger: l, 
+      ConfMutext: m, 
+      Conf: c, 
+    }
+    muxer.Handle( ApiEvents.Path, handlerEvents )
+    muxer.Handle( ApiEvents.Path+"/", handlerEvents )
+    handlerKeys := ApiKeys.HandlerApi {
+      Logger: l, 
+      ConfMutext: m, 
+      Conf: c, 
+    }
+    muxer.Handle( "/api/keys", handlerKeys )
+    muxer.Handle( "/api/keys/", handlerKeys )
   } else { 
-    l.Info( "Authorization secret API not found ; API inactive" )
+    l.Info( "Authorization secret API and API keys not found ; API inactive" )
   } 
-  return muxer 
+  return HandlerAccess {
+    Logger: l, 
+    ConfMutext: m, 
+    Conf: c, 
+    Next: muxer, 
+  }
 }
 
@@ -0,0 +1,399 @@
+package triggers
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net/http"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+  // -----------
+  "jobs"
+  "logger"
+  "watcher"
+)
+
+// -----------------------------------------------
+
+// the routes' watched dirs : a file written (or moved) in the dir is a job of
+// the pool (the route's retries and callback), its metadata or its content as
+// body ; ended, the file is moved to the done or failed dir, if any
+
+const (
+  HeaderTrigger                         = "X-Faass-Trigger"
+  HeaderFile                            = "X-Faass-File"
+  EnvFile                               = "FAASS_FILE"
+  OriginPrefix                          = "file:"
+
+  TypeFs                                = "fs"
+  DebounceDefault                       = 500
+  DebounceMax                           = 60000
+  TrackInterval                         = time.Second
+
+  ContentTypeMetadata                   = "application/json"
+  ContentTypeContent                    = "application/octet-stream"
+)
+
+// the pattern is matched on the file's name (all files without) ; the debounce
+// (milliseconds) waits for the writes' end
+type Definition struct {
+  Type string `json:"type"`
+  Dir string `json:"dir"`
+  Pattern string `json:"pattern"`
+  Debounce int `json:"debounce"`
+  Content bool `json:"content"`
+  Done string `json:"done"`
+  Failed string `json:"failed"`
+}
+
+// the problems of a definition, by field
+func ( definition Definition ) Problems() map[string]string {
+  problems := make( map[string]string )
+  if definition.Type != "" && definition.Type != TypeFs {
+    problems["type"] = "type of trigger unknow : '"+definition.Type+"' ("+TypeFs+" only)"
+  }
+  if definition.Dir == "" || filepath.IsAbs( definition.Dir ) != true {
+    problems["dir"] = "dir must be an absolute path"
+  }
+  if _, err := filepath.Match( definition.Pattern, "" ) ; err != nil {
+    problems["pattern"] = "pattern invalid : '"+definition.Pattern+"'"
+  }
+  if definition.Debounce < 0 || definition.Debounce > DebounceMax {
+    problems["debounce"] = "debounce out of range (0 to "+strconv.Itoa( DebounceMax )+" milliseconds)"
+  }
+  for field, dir := range map[string]string { "done": definition.Done, "failed": definition.Failed } {
+    switch {
+    case dir == "":
+    case filepath.IsAbs( dir ) != true:
+      problems[field] = field+" must be an absolute path"
+    case filepath.Clean( dir ) == filepath.Clean( definition.Dir ):
+      problems[field] = field+" can't be the dir watched"
+    }
+  }
+  return problems
+}
+
+func ( definition Definition ) delay() time.Duration {
+  if definition.Debounce == 0 {
+    return DebounceDefault * time.Millisecond
+  }
+  return time.Duration( definition.Debounce ) * time.Millisecond
+}
+
+// the body of a job without the content
+type Metadata struct {
+  Path string `json:"path"`
+  Name string `json:"name"`
+  Size int64 `json:"size"`
+  Modified time.Time `json:"modified"`
+}
+
+// -----------------------------------------------
+
+type Wanted struct {
+  Key string
+  Definitions []Definition
+  Policy *jobs.Policy
+}
+
+type watch struct {
+  key string
+  definition Definition
+  policy *jobs.Policy
+  cancel context.CancelFunc
+  // removed by a sync (its route deleted or changed) : an event in flight
+  // isn't submitted
+  stopped bool
+}
+
+// a file submitted, until the end of its job
+type pending struct {
+  path string
+  definition Definition
+}
+
+type Manager struct {
+  Pool *jobs.Pool
+  logger *logger.Logger
+  mutex sync.Mutex
+  wake chan struct{}
+  watches map[string][]*watch
+  pending map[string]pending
+  files map[string]string
+}
+
+func New( pool *jobs.Pool, logger *logger.Logger ) *Manager {
+  return &Manager {
+    Pool: pool,
+    logger: logger,
+    wake: make( chan struct{}, 1 ),
+    watches: make( map[string][]*watch ),
+    pending: make( map[string]pending ),
+    files: make( map[string]string ),
+  }
+}
+
+func ( manager *Manager ) signal() {
+  select {
+  case manager.wake <- struct{}{}:
+  default:
+  }
+}
+
+// the routes' definitions ; a definition unchanged keeps its watch, the others
+// are stopped (started again by Run)
+func ( manager *Manager ) Sync( wanted []Wanted ) {
+  manager.mutex.Lock()
+  defer manager.mutex.Unlock()
+  watches := make( map[string][]*watch )
+  kept := make( map[*watch]bool )
+  for _, route := range wanted {
+    previous := manager.watches[route.Key]
+    for i, definition := range route.Definitions {
+      if i < len( previous ) && previous[i].definition == definition {
+        previous[i].policy = route.Policy.Copy()
+        kept[previous[i]] = true
+        watches[route.Key] = append( watches[route.Key], previous[i] )
+        continue
+      }
+      watches[route.Key] = append( watches[route.Key], &watch {
+        key: route.Key,
+        definition: definition,
+        policy: route.Policy.Copy(),
+      } )
+    }
+  }
+  for _, previous := range manager.watches {
+    for _, w := range previous {
+      if kept[w] != true {
+        w.stopped = true
+        if w.cancel != nil {
+          w.cancel()
+          manager.logger.Infof( "trigger of route '%v' on '%v' stopped", w.key, w.definition.Dir )
+        }
+      }
+    }
+  }
+  manager.watches = watches
+  manager.signal()
+}
+
+// -----------------------------------------------
+
+// the watches are started, and the jobs followed, until the context is done
+func ( manager *Manager ) Run( ctx context.Context ) {
+  var group sync.WaitGroup
+  defer group.Wait()
+  ticker := time.NewTicker( TrackInterval )
+  defer ticker.Stop()
+  for {
+    manager.start( ctx, &group )
+    manager.track()
+    select {
+    case <-manager.wake:
+    case <-ticker.C:
+    case <-ctx.Done():
+      return
+    }
+  }
+}
+
+func ( manager *Manager ) start( ctx context.Context, group *sync.WaitGroup ) {
+  manager.mutex.Lock()
+  defer manager.mutex.Unlock()
+  for _, watches := range manager.watches {
+    for _, w := range watches {
+      if w.cancel != nil {
+        continue
+      }
+      watchCtx, cancel := context.WithCancel( ctx )
+      w.cancel = cancel
+      group.Add( 1 )
+      go func( w *watch ) {
+        defer group.Done()
+        manager.watch( watchCtx, w )
+      }( w )
+    }
+  }
+}
+
+// inotify on the dir ; the files already there are submitted when the ones
+// processed are moved (done), else only the next ones
+func ( manager *Manager ) watch( ctx context.Context, w *watch ) {
+  dir := filepath.Clean( w.definition.Dir )
+  events, err := watcher.Watch( ctx, dir )
+  if err != nil {
+    manager.logger.Warningf( "trigger of route '%v' not started : %v", w.key, err )
+    return
+  }
+  manager.logger.Infof( "trigger of route '%v' watches '%v'", w.key, dir )
+  manager.adopt( w )
+  if w.definition.Done != "" {
+    if entries, err := ioutil.ReadDir( dir ) ; err == nil {
+      for _, entry := range entries {
+        if entry.IsDir() != true && watcher.Match( w.definition.Pattern, entry.Name() ) {
+          manager.submit( w, filepath.Join( dir, entry.Name() ) )
+        }
+      }
+    }
+  }
+  for event := range watcher.Debounce( ctx, events, w.definition.delay() ) {
+    if event.Removed || watcher.Match( w.definition.Pattern, event.Path ) != true {
+      continue
+    }
+    manager.submit( w, event.Path )
+  }
+}
+
+// the jobs of the dir submitted before a stop (or a reload) are followed again
+func ( manager *Manager ) adopt( w *watch ) {
+  dir := filepath.Clean( w.definition.Dir )
+  manager.mutex.Lock()
+  defer manager.mutex.Unlock()
+  for _, job := range manager.Pool.List() {
+    path := strings.TrimPrefix( job.Origin, OriginPrefix )
+    if job.Route != w.key || path == job.Origin || filepath.Dir( path ) != dir {
+      continue
+    }
+    if _, ok := manager.pending[job.Id] ; ok {
+      continue
+    }
+    if _, ok := manager.files[path] ; ok {
+      continue
+    }
+    // an ended job only for its file, not for a new one of the same name
+    if job.Done() {
+      info, err := os.Stat( path )
+      if err != nil || info.ModTime().After( job.Created ) {
+        continue
+      }
+    }
+    manager.pending[job.Id] = pending { path: path, definition: w.definition }
+    manager.files[path] = job.Id
+  }
+}
+
+func ( manager *Manager ) submit( w *watch, path string ) {
+  manager.mutex.Lock()
+  defer manager.mutex.Unlock()
+  if w.stopped {
+    return
+  }
+  if id, ok := manager.files[path] ; ok {
+    manager.logger.Infof( "trigger of route '%v' : file '%v' already submitted (job '%v')", w.key, path, id )
+    return
+  }
+  request, err := newRequest( w, path )
+  if err != nil {
+    manager.logger.Warningf( "trigger of route '%v' : file '%v' ignored : %v", w.key, path, err )
+    return
+  }
+  job, err := manager.Pool.Submit( w.key, request, w.policy )
+  if err != nil {
+    manager.logger.Warningf( "trigger of route '%v' : file '%v' refused : %v", w.key, path, err )
+    return
+  }
+  manager.pending[job.Id] = pending { path: path, definition: w.definition }
+  manager.files[path] = job.Id
+  manager.logger.Infof( "trigger of route '%v' : file '%v' submitted (job '%v')", w.key, path, job.Id )
+}
+
+func newRequest( w *watch, path string ) ( *jobs.Request, error ) {
+  info, err := os.Stat( path )
+  if err != nil {
+    return nil, err
+  }
+  if info.Mode().IsRegular() != true {
+    return nil, errors.New( "not a regular file" )
+  }
+  contentType := ContentTypeMetadata
+  var body []byte
+  if w.definition.Content {
+    if info.Size() > jobs.BodySizeMax {
+      return nil, errors.New( fmt.Sprintf( "file too large (%v bytes at most)", jobs.BodySizeMax ) )
+    }
+    contentType = ContentTypeContent
+    file, err := os.Open( path )
+    if err != nil {
+      return nil, err
+    }
+    defer file.Close()
+    if body, err = ioutil.ReadAll( io.LimitReader( file, jobs.BodySizeMax ) ) ; err != nil {
+      return nil, err
+    }
+  } else {
+    body, _ = json.Marshal( Metadata {
+      Path: path,
+      Name: info.Name(),
+      Size: info.Size(),
+      Modified: info.ModTime(),
+    } )
+  }
+  return &jobs.Request {
+    Origin: OriginPrefix+path,
+    Method: http.MethodPost,
+    URL: "/lambda/"+w.key,
+    Header: http.Header {
+      "Content-Type": []string{ contentType },
+      HeaderTrigger: []string{ TypeFs },
+      HeaderFile: []string{ path },
+    },
+    Body: body,
+    Env: map[string]string { EnvFile: path },
+  }, nil
+}
+
+// the files of the jobs ended are moved ; a job removed (before its end) lets
+// its file in place
+func ( manager *Manager ) track() {
+  manager.mutex.Lock()
+  defer manager.mutex.Unlock()
+  for id, p := range manager.pending {
+    job, ok := manager.Pool.Get( id )
+    if ok && job.Done() != true {
+      continue
+    }
+    delete( manager.pending, id )
+    delete( manager.files, p.path )
+    if ok != true {
+      continue
+    }
+    target := p.definition.Failed
+    if job.Status == jobs.StatusSucceeded {
+      target = p.definition.Done
+    }
+    if target == "" {
+      continue
+    }
+    moved, err := move( p.path, target )
+    if err != nil {
+      manager.logger.Warningf( "file '%v' of job '%v' not moved : %v", p.path, id, err )
+      continue
+    }
+    manager.logger.Infof( "file '%v' of job '%v' (%v) moved to '%v'", p.path, id, job.Status, moved )
+  }
+}
+
+// a file of the same name in the target isn't replaced : a suffix is added
+func move( path string, dir string ) ( string, error ) {
+  if err := os.MkdirAll( dir, 0755 ) ; err != nil {
+    return "", err
+  }
+  name := filepath.Base( path )
+  extension := filepath.Ext( name )
+  target := filepath.Join( dir, name )
+  for i := 1 ; ; i++ {
+    if _, err := os.Lstat( target ) ; os.IsNotExist( err ) {
+      break
+    }
+    target = filepath.Join( dir, strings.TrimSuffix( name, extension )+"."+strconv.Itoa( i )+extension )
+  }
+  return target, os.Rename( path, target )
+}
@@ -0,0 +1,116 @@
+package triggers
+
+import (
+  "context"
+  "io/ioutil"
+  "net/http"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+  // -----------
+  "jobs"
+  "logger"
+)
+
+func TestProblems( t *testing.T ) {
+  definition := Definition { Type: "s3", Dir: "in", Pattern: "[", Debounce: -1, Done: "/in", Failed: "failed" }
+  definition.Dir = "/in/"
+  problems := definition.Problems()
+  for _, field := range []string{ "type", "pattern", "debounce", "done", "failed" } {
+    if _, ok := problems[field] ; ok != true {
+      t.Errorf( "problem of '%v' expected : %v", field, problems )
+    }
+  }
+  if problems := ( Definition { Dir: "/in", Pattern: "*.csv", Done: "/in/done" } ).Problems() ; len( problems ) != 0 {
+    t.Errorf( "unexpected problems : %v", problems )
+  }
+}
+
+func TestMoved( t *testing.T ) {
+  root := t.TempDir()
+  in, done, failed := filepath.Join( root, "in" ), filepath.Join( root, "done" ), filepath.Join( root, "failed" )
+  os.Mkdir( in, 0755 )
+  // already there : submitted at the start (the dir has a done)
+  ioutil.WriteFile( filepath.Join( in, "first.txt" ), []byte( "ok" ), 0644 )
+  l := &logger.Logger{}
+  l.Init()
+  pool := jobs.NewPool( "", l )
+  pool.Configure( 2, 0, 60000 )
+  pool.Handle( func( ctx context.Context, route string, request *jobs.Request ) jobs.Result {
+    if request.Env[EnvFile] != request.Header.Get( HeaderFile ) {
+      t.Errorf( "the file expected in env : %+v", request )
+    }
+    if string( request.Body ) == "ok" {
+      return jobs.Result { Code: http.StatusOK }
+    }
+    return jobs.Result { Code: http.StatusInternalServerError }
+  } )
+  ctx, cancel := context.WithCancel( context.Background() )
+  defer cancel()
+  go pool.Run( ctx )
+  manager := New( pool, l )
+  manager.Sync( []Wanted { { Key: "a", Definitions: []Definition {
+    { Dir: in, Pattern: "*.txt", Debounce: 10, Content: true, Done: done, Failed: failed },
+  } } } )
+  go manager.Run( ctx )
+  time.Sleep( 100 * time.Millisecond )
+  ioutil.WriteFile( filepath.Join( in, "second.txt" ), []byte( "ko" ), 0644 )
+  ioutil.WriteFile( filepath.Join( in, "ignored.csv" ), []byte( "ok" ), 0644 )
+  expected := []string { filepath.Join( done, "first.txt" ), filepath.Join( failed, "second.txt" ) }
+  for i := 0 ; i < 100 ; i++ {
+    moved := 0
+    for _, path := range expected {
+      if _, err := os.Stat( path ) ; err == nil {
+        moved++
+      }
+    }
+    if moved == len( expected ) {
+      break
+    }
+    time.Sleep( 50 * time.Millisecond )
+  }
+  for _, path := range expected {
+    if _, err := os.Stat( path ) ; err != nil {
+      t.Errorf( "file '%v' expected : %v", path, err )
+    }
+  }
+  if _, err := os.Stat( filepath.Join( in, "ignored.csv" ) ) ; err != nil {
+    t.Error( "a file out of the pattern must stay" )
+  }
+  if list := pool.List() ; len( list ) != 2 || list[0].Origin != OriginPrefix+filepath.Join( in, "second.txt" ) {
+    t.Errorf( "2 jobs expected, the last for the second file : %+v", list )
+  }
+}
+
+func TestMove( t *testing.T ) {
+  root := t.TempDir()
+  for i := 0 ; i < 2 ; i++ {
+    path := filepath.Join( root, "report.csv" )
+    ioutil.WriteFile( path, []byte( "x" ), 0644 )
+    if _, err := move( path, filepath.Join( root, "done" ) ) ; err != nil {
+      t.Fatal( err )
+    }
+  }
+  if _, err := os.Stat( filepath.Join( root, "done", "report.1.csv" ) ) ; err != nil {
+    t.Errorf( "a suffix expected for the second file : %v", err )
+  }
+}
+
+func TestStopped( t *testing.T ) {
+  in := t.TempDir()
+  path := filepath.Join( in, "late.txt" )
+  ioutil.WriteFile( path, []byte( "x" ), 0644 )
+  l := &logger.Logger{}
+  l.Init()
+  pool := jobs.NewPool( "", l )
+  manager := New( pool, l )
+  manager.Sync( []Wanted { { Key: "a", Definitions: []Definition { { Dir: in } } } } )
+  w := manager.watches["a"][0]
+  // the route removed : an event still in flight is dropped
+  manager.Sync( nil )
+  manager.submit( w, path )
+  if list := pool.List() ; len( list ) != 0 {
+    t.Errorf( "no job expected for a removed route : %+v", list )
+  }
+}
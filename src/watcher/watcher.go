@@ -0,0 +1,67 @@
+package watcher
+
+import (
+  "context"
+  "path/filepath"
+  "time"
+  // -----------
+)
+
+// -----------------------------------------------
+
+type Event struct {
+  Path string
+  Removed bool
+}
+
+// -----------------------------------------------
+
+// events of a same path are merged until the path stays quiet during the delay ; 
+// only the last state (written or removed) is sent 
+func Debounce( ctx context.Context, events <-chan Event, delay time.Duration ) <-chan Event {
+  output := make( chan Event )
+  go func() {
+    defer close( output )
+    pending := map[string]Event{}
+    deadlines := map[string]time.Time{}
+    ticker := time.NewTicker( delay/4+time.Millisecond )
+    defer ticker.Stop()
+    for {
+      select {
+      case <-ctx.Done():
+        return
+      case event, ok := <-events:
+        if !ok {
+          return
+        }
+        pending[event.Path] = event
+        deadlines[event.Path] = time.Now().Add( delay )
+      case now := <-ticker.C:
+        for path, deadline := range deadlines {
+          if deadline.After( now ) {
+            continue
+          }
+          event := pending[path]
+          delete( pending, path )
+          delete( deadlines, path )
+          select {
+          case output <- event:
+          case <-ctx.Done():
+            return
+          }
+        }
+      }
+    }
+  }()
+  return output
+}
+
+// -----------------------------------------------
+
+func Match( pattern string, path string ) bool {
+  if pattern == "" {
+    return true
+  }
+  ok, err := filepath.Match( pattern, filepath.Base( path ) )
+  return err == nil && ok
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package watcher
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "os"
+  "path/filepath"
+  "syscall"
+  "unsafe"
+  // -----------
+)
+
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_DELETE | syscall.IN_CREATE
+
+// inotify on one directory (not recursive) ; the descriptor is non-blocking to 
+// be closed, and the reading stopped, with the context 
+func Watch( ctx context.Context, dir string ) ( <-chan Event, error ) {
+  fd, err := syscall.InotifyInit1( syscall.IN_NONBLOCK | syscall.IN_CLOEXEC )
+  if err != nil {
+    return nil, errors.New( fmt.Sprintf( "inotify init failed : %v", err ) )
+  }
+  if _, err := syscall.InotifyAddWatch( fd, dir, watchMask ) ; err != nil {
+    syscall.Close( fd )
+    return nil, errors.New( fmt.Sprintf( "inotify watch of '%v' failed : %v", dir, err ) )
+  }
+  file := os.NewFile( uintptr( fd ), "inotify" )
+  events := make( chan Event )
+  go func() {
+    <-ctx.Done()
+    file.Close()
+  }()
+  go func() {
+    defer close( events )
+    buffer := make( []byte, 64*( syscall.SizeofInotifyEvent+syscall.NAME_MAX+1 ) )
+    for {
+      n, err := file.Read( buffer )
+      if err != nil {
+        return
+      }
+      for offset := 0 ; offset+syscall.SizeofInotifyEvent <= n ; {
+        raw := ( *syscall.InotifyEvent )( unsafe.Pointer( &buffer[offset] ) )
+        nameBytes := buffer[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int( raw.Len )]
+        offset += syscall.SizeofInotifyEvent+int( raw.Len )
+        name := string( nameBytes )
+        for len( name ) > 0 && name[len( name )-1] == 0 {
+          name = name[:len( name )-1]
+        }
+        if name == "" || raw.Mask & syscall.IN_ISDIR != 0 {
+          continue
+        }
+        // a created file is announced when written (IN_CLOSE_WRITE)
+        if raw.Mask & syscall.IN_CREATE != 0 {
+          continue
+        }
+        event := Event {
+          Path: filepath.Join( dir, name ),
+          Removed: raw.Mask & ( syscall.IN_DELETE | syscall.IN_MOVED_FROM ) != 0,
+        }
+        select {
+        case events <- event:
+        case <-ctx.Done():
+          return
+        }
+      }
+    }
+  }()
+  return events, nil
+}
@@ -0,0 +1,75 @@
+//go:build !linux
+
+package watcher
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "os"
+  "path/filepath"
+  "time"
+  // -----------
+)
+
+const pollingDelay = time.Second
+
+func scan( dir string ) ( map[string]time.Time, error ) {
+  entries, err := os.ReadDir( dir )
+  if err != nil {
+    return nil, err
+  }
+  files := map[string]time.Time{}
+  for _, entry := range entries {
+    if entry.IsDir() {
+      continue
+    }
+    if info, err := entry.Info() ; err == nil {
+      files[filepath.Join( dir, entry.Name() )] = info.ModTime()
+    }
+  }
+  return files, nil
+}
+
+// without inotify, the directory is scanned on a regular basis 
+func Watch( ctx context.Context, dir string ) ( <-chan Event, error ) {
+  previous, err := scan( dir )
+  if err != nil {
+    return nil, errors.New( fmt.Sprintf( "watch of '%v' failed : %v", dir, err ) )
+  }
+  events := make( chan Event )
+  go func() {
+    defer close( events )
+    for {
+      select {
+      case <-ctx.Done():
+        return
+      case <-time.After( pollingDelay ):
+      }
+      current, err := scan( dir )
+      if err != nil {
+        continue
+      }
+      changes := []Event{}
+      for path, modTime := range current {
+        if old, ok := previous[path] ; !ok || old.Equal( modTime ) != true {
+          changes = append( changes, Event { Path: path } )
+        }
+      }
+      for path := range previous {
+        if _, ok := current[path] ; !ok {
+          changes = append( changes, Event { Path: path, Removed: true } )
+        }
+      }
+      previous = current
+      for _, event := range changes {
+        select {
+        case events <- event:
+        case <-ctx.Done():
+          return
+        }
+      }
+    }
+  }()
+  return events, nil
+}
@@ -0,0 +1,44 @@
+package watcher
+
+import (
+  "context"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+)
+
+func TestWatchDebounced( t *testing.T ) {
+  dir := t.TempDir()
+  ctx, cancel := context.WithCancel( context.Background() )
+  defer cancel()
+  events, err := Watch( ctx, dir )
+  if err != nil {
+    t.Fatal( err )
+  }
+  debounced := Debounce( ctx, events, 50*time.Millisecond )
+  path := filepath.Join( dir, "route.json" )
+  for i := 0 ; i < 3 ; i++ {
+    if err := ioutil.WriteFile( path, []byte( "{}" ), 0644 ) ; err != nil {
+      t.Fatal( err )
+    }
+  }
+  select {
+  case event := <-debounced:
+    if event.Path != path || event.Removed {
+      t.Errorf( "unexpected event : %+v", event )
+    }
+  case <-time.After( 5*time.Second ):
+    t.Fatal( "no event received" )
+  }
+  os.Remove( path )
+  select {
+  case event := <-debounced:
+    if event.Path != path || event.Removed != true {
+      t.Errorf( "unexpected event : %+v", event )
+    }
+  case <-time.After( 5*time.Second ):
+    t.Fatal( "no removal received" )
+  }
+}